@@ -6,7 +6,6 @@ require (
 	github.com/getkin/kin-openapi v0.2.0
 	github.com/go-openapi/swag v0.19.8
 	github.com/gofrs/uuid v3.2.0+incompatible
-	github.com/lucasjones/reggen v0.0.0-20180717132126-cdb49ff09d77
 	github.com/minimaxir/big-list-of-naughty-strings/naughtystrings v0.0.0-20200103014349-e1968d982126
 	github.com/xeipuuv/gojsonschema v1.2.0
 	golang.org/x/net v0.0.0-20200301022130-244492dfa37a // indirect
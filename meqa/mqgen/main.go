@@ -15,33 +15,44 @@ import (
 )
 
 const (
-	meqaDataDir = "meqa_data"
-	algoSimple  = "simple"
-	algoObject  = "object"
-	algoPath    = "path"
-	algoAll     = "all"
+	meqaDataDir  = "meqa_data"
+	algoSimple   = "simple"
+	algoObject   = "object"
+	algoPath     = "path"
+	algoNegative = "negative"
+	algoAll      = "all"
 )
 
-var algoList []string = []string{algoSimple, algoObject, algoPath}
+var algoList []string = []string{algoSimple, algoObject, algoPath, algoNegative}
 
 func main() {
 	mqutil.Logger = mqutil.NewStdLogger()
 
 	swaggerJSONFile := filepath.Join(meqaDataDir, "swagger.yml")
 	meqaPath := flag.String("d", meqaDataDir, "the directory where we put the generated files")
-	swaggerFile := flag.String("s", swaggerJSONFile, "the swagger.yml file location")
-	algorithm := flag.String("a", "all", "the algorithm - simple, object, path, all")
+	swaggerFile := flag.String("s", swaggerJSONFile, "the swagger.yml file location, json or yaml")
+	algorithm := flag.String("a", "all", "the algorithm - simple, object, path, negative (the tests that leave out a required body field or break one constraint of the request each), all")
 	verbose := flag.Bool("v", false, "turn on verbose mode")
 	allowedAPIsFile := flag.String("w", "", "name of the file (that lists out all fuzzable APIs) along with its relative path. Example testdata/allowedAPIs.cfg")
 	ignoredPathsFile := flag.String("i", "", "name of the file (that lists out all ignored paths in APIs) along with its relative path. Example testdata/ignorePaths.cfg")
+	methods := flag.String("methods", "", "only generate the tests with these methods, e.g. GET,POST")
+	excludeMethods := flag.String("exclude-methods", "", "don't generate the tests with these methods, e.g. DELETE")
+	tagMap := flag.String("tag-map", "", "the yaml file with the meqa tags to add to the spec's schemas, operations and parameters")
 
 	flag.Parse()
-	run(meqaPath, swaggerFile, algorithm, verbose, allowedAPIsFile, ignoredPathsFile)
+	run(meqaPath, swaggerFile, algorithm, verbose, allowedAPIsFile, ignoredPathsFile, methods, excludeMethods, tagMap)
 }
 
-func run(meqaPath *string, swaggerFile *string, algorithm *string, verbose *bool, allowedAPIsFile *string, ignoredPathsFile *string) {
+func run(meqaPath *string, swaggerFile *string, algorithm *string, verbose *bool, allowedAPIsFile *string, ignoredPathsFile *string,
+	methods *string, excludeMethods *string, tagMap *string) {
 	mqutil.Verbose = *verbose
 
+	filter, err := mqplan.NewMethodFilter(*methods, *excludeMethods)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
 	swaggerJsonPath := *swaggerFile
 	if fi, err := os.Stat(swaggerJsonPath); os.IsNotExist(err) || fi.Mode().IsDir() {
 		fmt.Printf("Can't load swagger file at the following location %s", swaggerJsonPath)
@@ -62,11 +73,22 @@ func run(meqaPath *string, swaggerFile *string, algorithm *string, verbose *bool
 	}
 
 	// loading swagger.json
-	swagger, err := mqswag.CreateSwaggerFromURL(swaggerJsonPath, *meqaPath)
+	swagger, err := mqswag.CreateSwaggerFromURL(swaggerJsonPath)
 	if err != nil {
 		mqutil.Logger.Printf("Error: %s", err.Error())
+		fmt.Println(mqutil.ErrorMessage(err))
 		os.Exit(1)
 	}
+	if len(*tagMap) > 0 {
+		mapping, err := mqswag.LoadTagMapping(*tagMap)
+		if err == nil {
+			err = swagger.ApplyTags(mapping)
+		}
+		if err != nil {
+			mqutil.Logger.Printf("Error: %s", err.Error())
+			os.Exit(1)
+		}
+	}
 	dag := mqswag.NewDAG()
 	err = swagger.AddToDAG(dag)
 	if err != nil {
@@ -91,6 +113,8 @@ func run(meqaPath *string, swaggerFile *string, algorithm *string, verbose *bool
 			testPlan, err = mqplan.GeneratePathTestPlan(swagger, dag, allowedAPIs, ignoredPaths)
 		case algoObject:
 			testPlan, err = mqplan.GenerateTestPlan(swagger, dag)
+		case algoNegative:
+			testPlan, err = mqplan.GenerateNegativeTestPlan(swagger, dag)
 		default:
 			testPlan, err = mqplan.GenerateSimpleTestPlan(swagger, dag)
 		}
@@ -98,6 +122,9 @@ func run(meqaPath *string, swaggerFile *string, algorithm *string, verbose *bool
 			mqutil.Logger.Printf("Error: %s", err.Error())
 			os.Exit(1)
 		}
+		if filtered := testPlan.FilterMethods(filter); filtered > 0 {
+			fmt.Printf("Filtered out %d %s tests by method\n", filtered, algo)
+		}
 		testPlanFile := filepath.Join(testPlanPath, algo+".yml")
 		err = testPlan.DumpToFile(testPlanFile)
 		if err != nil {
@@ -17,7 +17,10 @@ func TestMqgen(t *testing.T) {
 	verbose := false
 	allowedAPIsPath := ""
 	ignoredPathsPath := ""
-	run(&meqaPath, &swaggerPath, &algorithm, &verbose, &allowedAPIsPath, &ignoredPathsPath)
+	methods := ""
+	excludeMethods := ""
+	tagMap := ""
+	run(&meqaPath, &swaggerPath, &algorithm, &verbose, &allowedAPIsPath, &ignoredPathsPath, &methods, &excludeMethods, &tagMap)
 }
 
 func TestMain(m *testing.M) {
@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"path/filepath"
 
@@ -208,29 +210,148 @@ Do you wish to proceed? y/n: `
 	return nil
 }
 
+// runOptions holds the options of the run command, filled from its flags.
+type runOptions struct {
+	meqaPath          string
+	swaggerFile       string
+	testPlanFile      string
+	resultPath        string
+	jsonPath          string
+	junitPath         string
+	testToRun         string
+	username          string
+	password          string
+	apitoken          string
+	apiKey            string
+	oauthTokenURL     string
+	oauthClientID     string
+	oauthClientSecret string
+	oauthScopes       string
+	baseURL           string
+	host              string
+	scheme            string
+	tenant            string
+	fuzzType          string
+	batchSize         int
+	parallel          int
+	repro             bool
+	datasetPath       string
+	fixtures          string
+	loadDB            string
+	saveDB            string
+	tagMap            string
+	verbose           bool
+	logSecrets        bool
+	methods           string
+	excludeMethods    string
+	runTests          string
+	tags              string
+	excludeTags       string
+	skipTests         string
+	outDir            string
+	quiet             bool
+	client            string
+	insecure          bool
+	proxy             string
+	caFile            string
+	defaultsProb      float64
+	redirects         string
+	optionalProb      float64
+	useDefaults       bool
+	distribution      string
+	noExamples        bool
+	noValidate        bool
+	strictMatch       bool
+	strictNumbers     bool
+	seed              int64
+	shuffle           string
+	soak              mqplan.SoakBudget
+	timeout           time.Duration
+	retries           int
+	retryDelay        time.Duration
+	retryStatuses     string
+	retryPost         bool
+	validateOnly      bool
+	failFast          bool
+	abortOnError      bool
+	maxFailures       string
+}
+
 func main() {
 	genCommand := flag.NewFlagSet("generate", flag.ExitOnError)
 	genCommand.SetOutput(os.Stdout)
 	runCommand := flag.NewFlagSet("run", flag.ExitOnError)
 	runCommand.SetOutput(os.Stdout)
+	opts := &runOptions{}
 
 	genMeqaPath := genCommand.String("d", meqaDataDir, "the directory where meqa config, log and output files reside")
 	genSwaggerFile := genCommand.String("s", "", "the OpenAPI (Swagger) spec file path")
 
-	runMeqaPath := runCommand.String("d", meqaDataDir, "the directory where meqa config, log and output files reside")
-	runSwaggerFile := runCommand.String("s", "", "the meqa generated OpenAPI (Swagger) spec file path")
-	testPlanFile := runCommand.String("p", "", "the test plan file name")
-	resultPath := runCommand.String("r", "", "the test result file name (default result.yml in meqa_data dir)")
-	testToRun := runCommand.String("t", "all", "the test to run")
-	username := runCommand.String("u", "", "the username for basic HTTP authentication")
-	password := runCommand.String("w", "", "the password for basic HTTP authentication")
-	apitoken := runCommand.String("a", "", "the api token for bearer HTTP authentication")
-	baseURL := runCommand.String("h", "", "the host's base url")
-	fuzzType := runCommand.String("f", "", SupportedFuzzTypes)
-	batchSize := runCommand.Int("b", 10, "batch size")
-	repro := runCommand.Bool("re", false, "reproduce failures")
-	datasetPath := runCommand.String("l", "", "the dataset path")
-	verbose := runCommand.Bool("v", false, "turn on verbose mode")
+	runCommand.StringVar(&opts.meqaPath, "d", meqaDataDir, "the directory where meqa config, log and output files reside")
+	runCommand.StringVar(&opts.swaggerFile, "s", "", "the meqa generated OpenAPI (Swagger) spec file path, json or yaml")
+	runCommand.StringVar(&opts.testPlanFile, "p", "", "the test plan file name")
+	runCommand.StringVar(&opts.resultPath, "r", "", "the test result file name (default result.yml in meqa_data dir)")
+	runCommand.StringVar(&opts.jsonPath, "json", "", "the file to write the results of the tests to as json, with their requests and responses, result.json in the -out directory by default")
+	runCommand.StringVar(&opts.junitPath, "junit", "", "the file to write the JUnit XML report of the tests to, junit.xml in the -out directory by default")
+	runCommand.StringVar(&opts.testToRun, "t", "all", "the test to run")
+	runCommand.StringVar(&opts.username, "u", "", "the username for basic HTTP authentication")
+	runCommand.StringVar(&opts.password, "w", "", "the password for basic HTTP authentication")
+	runCommand.StringVar(&opts.apitoken, "a", "", "the api token for bearer HTTP authentication")
+	runCommand.StringVar(&opts.apiKey, "api-key", "", "the api key for the apiKey security schemes, sent in the header, query or cookie they name")
+	runCommand.StringVar(&opts.oauthTokenURL, "oauth-token-url", "", "the token url of the OAuth2 client credentials grant, the api token is got from it")
+	runCommand.StringVar(&opts.oauthClientID, "oauth-client-id", "", "the client id for the OAuth2 client credentials grant")
+	runCommand.StringVar(&opts.oauthClientSecret, "oauth-client-secret", "", "the client secret for the OAuth2 client credentials grant")
+	runCommand.StringVar(&opts.oauthScopes, "oauth-scopes", "", "the comma separated scopes to ask for in the OAuth2 client credentials grant")
+	runCommand.StringVar(&opts.baseURL, "h", "", "the host's base url, instead of the spec's server url")
+	runCommand.StringVar(&opts.host, "host", "", "the host, with its port, to send the requests to instead of the base url's, e.g. to target staging")
+	runCommand.StringVar(&opts.scheme, "scheme", "", "the scheme, http or https, to send the requests with instead of the base url's")
+	runCommand.StringVar(&opts.tenant, "tenant", "", "the tenant, used for the tenant/tenantId path params and the {tenant} placeholder in the base url")
+	runCommand.StringVar(&opts.fuzzType, "f", "", SupportedFuzzTypes)
+	runCommand.IntVar(&opts.batchSize, "b", 10, "batch size")
+	runCommand.IntVar(&opts.parallel, "parallel", 1, "how many of the suites marked parallel in their meqa_init run at the same time, see docs/format.md")
+	runCommand.BoolVar(&opts.repro, "re", false, "reproduce failures")
+	runCommand.StringVar(&opts.datasetPath, "l", "", "the dataset path")
+	runCommand.StringVar(&opts.fixtures, "fixtures", "", "the yaml file with the templates of the objects to put in the DB before running, see docs/format.md")
+	runCommand.StringVar(&opts.loadDB, "load-db", "", "the json file of the objects a run saved with -save-db, to put in the DB before running, e.g. for a cleanup plan")
+	runCommand.StringVar(&opts.saveDB, "save-db", "", "the json file to save the objects of the DB to after running, with the changes all the suites made to them")
+	runCommand.StringVar(&opts.tagMap, "tag-map", "", "the yaml file with the meqa tags to add to the spec's schemas, operations and parameters, see docs/format.md")
+	runCommand.BoolVar(&opts.verbose, "v", false, "turn on verbose mode, which also logs the whole requests and responses with the credentials hidden")
+	runCommand.BoolVar(&opts.logSecrets, "log-secrets", false, "with -v, log the credentials and the sensitive headers, such as Authorization, instead of hiding them")
+	runCommand.StringVar(&opts.methods, "methods", "", "only run the tests with these methods, e.g. GET,POST")
+	runCommand.StringVar(&opts.excludeMethods, "exclude-methods", "", "skip the tests with these methods, e.g. DELETE")
+	runCommand.StringVar(&opts.runTests, "run", "", "only run the tests whose names, or their suites' names, match one of these comma separated regular expressions, with the earlier tests they refer to")
+	runCommand.StringVar(&opts.tags, "tags", "", "only run the tests with these tags, + for all of them and , for any, e.g. smoke+fast,critical")
+	runCommand.StringVar(&opts.excludeTags, "exclude-tags", "", "skip the tests with these tags, + for all of them and , for any, e.g. slow")
+	runCommand.StringVar(&opts.skipTests, "skip", "", "skip the tests whose names, or their suites' names, match one of these comma separated regular expressions, with the tests that refer to them")
+	runCommand.StringVar(&opts.outDir, "out", "", "the directory to write all the artifacts of the run to, listed in a manifest.json")
+	runCommand.BoolVar(&opts.quiet, "q", false, "only print the output of the failed tests, with their requests and responses")
+	runCommand.StringVar(&opts.client, "c", mqplan.ClientResty, "the HTTP client - resty, http or mock (offline)")
+	runCommand.BoolVar(&opts.insecure, "insecure", false, "don't verify the server certificates, e.g. the self-signed ones of the test servers (unsafe)")
+	runCommand.StringVar(&opts.proxy, "proxy", "", "the http, https or socks5 proxy to send the requests through, e.g. socks5://localhost:1080 (default the HTTP_PROXY and HTTPS_PROXY environment variables)")
+	runCommand.StringVar(&opts.caFile, "ca-file", "", "the PEM file with the CA certificates to verify the server certificates with, besides the system's")
+	runCommand.Float64Var(&opts.defaultsProb, "defaults-prob", 0, "the probability, from 0 to 1, of using a schema default instead of generating the value, e.g. 0.8")
+	runCommand.StringVar(&opts.redirects, "redirects", mqplan.RedirectFollow, "the redirect policy: follow, none to get the 3xx responses, or max-N to follow N redirects at most")
+	runCommand.Float64Var(&opts.optionalProb, "optional-prob", 1, "the probability, from 0 to 1, of generating an optional property of an object, 0 for the minimal objects with only the required properties")
+	runCommand.BoolVar(&opts.useDefaults, "defaults", false, "use the schema defaults, including whole object and array defaults, instead of generating values")
+	runCommand.StringVar(&opts.distribution, "distribution", mqplan.DistUniform, "the distribution of the generated numbers - uniform, boundary (favors min, max and zero) or log (covers the magnitudes)")
+	runCommand.BoolVar(&opts.noExamples, "no-examples", false, "generate all the values, e.g. for fuzzing, instead of using the examples of the spec")
+	runCommand.BoolVar(&opts.noValidate, "no-validate", false, "only check the response status codes, skip validating the response bodies against the schemas")
+	runCommand.BoolVar(&opts.strictMatch, "strict-match", false, "match the objects exactly, failing the ones with fields that aren't in the schema instead of allowing a few")
+	runCommand.BoolVar(&opts.strictNumbers, "strict-numbers", false, "fail the responses with integers where the schema has floats, or floats (e.g. 3.0) where it has integers")
+	runCommand.Int64Var(&opts.seed, "seed", 0, "the seed of the random values, to repeat a run exactly (default a new seed, which is printed)")
+	runCommand.StringVar(&opts.shuffle, "shuffle", "off", "randomize the test order, keeping the dependencies - off, on or the seed to use")
+	runCommand.DurationVar(&opts.soak.Duration, "soak-duration", 0, "run the plan over and over for this long, e.g. 30m, and report the failure rates")
+	runCommand.IntVar(&opts.soak.Iterations, "soak-iterations", 0, "run the plan over and over this many times, and report the failure rates")
+	runCommand.BoolVar(&opts.soak.KeepDB, "soak-keep-db", false, "keep the objects and the test history of a soak iteration for the next, instead of starting over")
+	runCommand.DurationVar(&opts.timeout, "timeout", 0, "how long a request waits for the response, e.g. 30s, before its test fails (default no limit)")
+	runCommand.IntVar(&opts.retries, "retries", 0, "how many times a request that gets one of the retry statuses is tried again")
+	runCommand.DurationVar(&opts.retryDelay, "retry-delay", mqplan.DefaultRetryDelay, "the wait before the first retry, doubled for each later one")
+	runCommand.StringVar(&opts.retryStatuses, "retry-statuses", mqplan.DefaultRetryStatuses, "the statuses to retry, e.g. 503 or 5xx")
+	runCommand.BoolVar(&opts.retryPost, "retry-post", false, "also retry the POST and PATCH requests, which aren't idempotent")
+	runCommand.BoolVar(&opts.validateOnly, "validate-only", false, "only check the spec for problems, such as references to nothing, and exit with an error if it has any")
+	runCommand.BoolVar(&opts.failFast, "fail-fast", false, "stop the run at the first failed test, instead of running all the tests and reporting all the failures")
+	runCommand.BoolVar(&opts.abortOnError, "abort-on-error", false, "stop the run at the first internal error, such as a body that can't be encoded, while still running on after the failed tests")
+	runCommand.StringVar(&opts.maxFailures, "max-failures", "", "the failures to tolerate before exiting with an error, by category - schema, http or expect, e.g. http=3")
 
 	flag.Usage = func() {
 		fmt.Println("Usage: mqgo {generate|run} [options]")
@@ -255,8 +376,8 @@ func main() {
 		swaggerFile = genSwaggerFile
 	case "run":
 		runCommand.Parse(os.Args[2:])
-		meqaPath = runMeqaPath
-		swaggerFile = runSwaggerFile
+		meqaPath = &opts.meqaPath
+		swaggerFile = &opts.swaggerFile
 	default:
 		flag.Usage()
 		os.Exit(1)
@@ -276,14 +397,31 @@ func main() {
 		os.Exit(1)
 	}
 
+	logPath := filepath.Join(*meqaPath, "mqgo.log")
 	if os.Args[1] == "run" {
-		if len(*resultPath) == 0 {
-			rf := filepath.Join(*meqaPath, resultFile)
-			resultPath = &rf
+		if len(opts.outDir) > 0 {
+			mqplan.Current.Artifacts, err = mqutil.NewArtifactDir(opts.outDir)
+			if err != nil {
+				fmt.Printf("Can't create the output directory %s - %s\n", opts.outDir, err.Error())
+				os.Exit(1)
+			}
+			logPath = mqplan.Current.Artifacts.Path(mqutil.ArtifactLog, "")
+		}
+		if len(opts.resultPath) == 0 {
+			opts.resultPath = filepath.Join(*meqaPath, resultFile)
+			if mqplan.Current.Artifacts != nil {
+				opts.resultPath = mqplan.Current.Artifacts.Path(mqutil.ArtifactResult, "")
+			}
+		}
+		if len(opts.jsonPath) == 0 && mqplan.Current.Artifacts != nil {
+			opts.jsonPath = mqplan.Current.Artifacts.Path(mqutil.ArtifactJson, "")
+		}
+		if len(opts.junitPath) == 0 && mqplan.Current.Artifacts != nil {
+			opts.junitPath = mqplan.Current.Artifacts.Path(mqutil.ArtifactJUnit, "")
 		}
 	}
 
-	mqutil.Logger = mqutil.NewFileLogger(filepath.Join(*meqaPath, "mqgo.log"))
+	mqutil.Logger = mqutil.NewFileLogger(logPath)
 	mqutil.Logger.Println(os.Args)
 
 	if _, err := os.Stat(*swaggerFile); os.IsNotExist(err) {
@@ -291,6 +429,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	if runCommand.Parsed() && opts.validateOnly {
+		// Checking the spec doesn't need a test plan.
+		if err := validateSpec(*swaggerFile); err != nil {
+			fmt.Println(mqutil.ErrorMessage(err))
+			os.Exit(1)
+		}
+		return
+	}
+
 	if genCommand.Parsed() {
 		err = generateMeqa(*meqaPath, *swaggerFile)
 		if err != nil {
@@ -300,56 +447,143 @@ func main() {
 		return
 	}
 
-	runMeqa(meqaPath, swaggerFile, testPlanFile, resultPath, testToRun, username, password, apitoken, baseURL, datasetPath, fuzzType, batchSize, repro, verbose)
+	runMeqa(opts)
 }
 
-func runMeqa(meqaPath, swaggerFile, testPlanFile, resultPath,
-	testToRun, username, password, apitoken, baseURL, datasetPath, fuzzType *string, batchSize *int, repro, verbose *bool) {
+// validateSpec loads the spec, which checks it for problems, and prints that it's valid.
+func validateSpec(swaggerFile string) error {
+	if _, err := mqswag.CreateSwaggerFromURL(swaggerFile); err != nil {
+		mqutil.Logger.Printf("Error: %s", err.Error())
+		return err
+	}
+	fmt.Printf("The spec %s is valid\n", swaggerFile)
+	return nil
+}
+
+func runMeqa(opts *runOptions) {
 
-	mqutil.Verbose = *verbose
+	mqutil.Verbose = opts.verbose
+	mqutil.LogSecrets = opts.logSecrets
 
-	if len(*testPlanFile) == 0 {
+	if len(opts.testPlanFile) == 0 {
 		fmt.Println("You must use -p to specify a test plan file. Use -h to see more options.")
 		os.Exit(1)
 	}
 
-	if _, err := os.Stat(*testPlanFile); os.IsNotExist(err) {
-		fmt.Printf("can't load test plan file at the following location %s", *testPlanFile)
+	if _, err := os.Stat(opts.testPlanFile); os.IsNotExist(err) {
+		fmt.Printf("can't load test plan file at the following location %s", opts.testPlanFile)
 		os.Exit(1)
 	}
 
 	var fuzzMode string
-	switch strings.ToLower(*fuzzType) {
+	switch strings.ToLower(opts.fuzzType) {
 	case "none": // Accept 'none' as valid fuzzType and leave fuzzMode empty
 	case mqutil.FuzzPositive, mqutil.FuzzNegative, mqutil.FuzzDataType, mqutil.FuzzAll:
-		fuzzMode = *fuzzType
+		fuzzMode = opts.fuzzType
 	default:
-		fmt.Println("Unknown fuzzType:", *fuzzType)
+		fmt.Println("Unknown fuzzType:", opts.fuzzType)
 		fmt.Println(SupportedFuzzTypes)
 		os.Exit(1)
 	}
 
+	if opts.defaultsProb < 0 || opts.defaultsProb > 1 {
+		fmt.Printf("Invalid defaults probability %v, it must be from 0 to 1\n", opts.defaultsProb)
+		os.Exit(1)
+	}
+	if opts.optionalProb < 0 || opts.optionalProb > 1 {
+		fmt.Printf("Invalid optional probability %v, it must be from 0 to 1\n", opts.optionalProb)
+		os.Exit(1)
+	}
+	maxRedirects, err := mqplan.ParseRedirects(opts.redirects)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	thresholds, err := mqplan.ParseThresholds(opts.maxFailures)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	if opts.seed == 0 {
+		opts.seed = time.Now().UnixNano()
+	}
+	mqutil.Seed(opts.seed)
+	fmt.Printf("Generating the values with seed %d\n", opts.seed)
+	mqutil.Logger.Printf("seed: %d", opts.seed)
+
 	// load swagger.yml
-	swagger, err := mqswag.CreateSwaggerFromURL(*swaggerFile, *meqaPath)
+	swagger, err := mqswag.CreateSwaggerFromURL(opts.swaggerFile)
 	if err != nil {
 		mqutil.Logger.Printf("Error: %s", err.Error())
+		fmt.Println(mqutil.ErrorMessage(err))
+		os.Exit(1)
+	}
+	if len(opts.tagMap) > 0 {
+		mapping, err := mqswag.LoadTagMapping(opts.tagMap)
+		if err == nil {
+			err = swagger.ApplyTags(mapping)
+		}
+		if err != nil {
+			fmt.Println("Error applying the tag mapping -", err.Error())
+			os.Exit(1)
+		}
 	}
 	mqswag.ObjDB.Init(swagger)
+	mqswag.ObjDB.Options = mqswag.MatchOptions{StrictMatch: opts.strictMatch, StrictNumbers: opts.strictNumbers}
+	if len(opts.fixtures) > 0 {
+		count, err := mqswag.LoadFixtures(opts.fixtures, &mqswag.ObjDB)
+		if err != nil {
+			fmt.Println("Error loading the fixtures -", err.Error())
+			os.Exit(1)
+		}
+		mqutil.Logger.Printf("inserted %d objects from the fixtures", count)
+	}
+	if len(opts.loadDB) > 0 {
+		count, skipped, err := mqswag.ObjDB.Load(opts.loadDB)
+		if err != nil {
+			fmt.Println("Error loading the DB -", err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("Loaded %d objects from %s\n", count, opts.loadDB)
+		for _, s := range skipped {
+			fmt.Printf("Skipped %s\n", s)
+			mqutil.Logger.Printf("skipped %s", s)
+		}
+	}
 	mqplan.Current.FuzzType = fuzzMode
-	mqplan.Current.Repro = *repro
+	mqplan.Current.Repro = opts.repro
+	mqplan.Current.UseDefaults = opts.useDefaults
+	mqplan.Current.DefaultsProb = opts.defaultsProb
+	mqplan.Current.MaxRedirects = &maxRedirects
+	if opts.optionalProb < 1 {
+		mqplan.Current.OptionalProb = &opts.optionalProb
+	}
+	mqplan.Current.NoExamples = opts.noExamples
+	mqplan.Current.NoValidate = opts.noValidate
+	mqplan.Current.Quiet = opts.quiet
+	mqplan.Current.FailFast = opts.failFast
+	mqplan.Current.AbortOnError = opts.abortOnError
+	mqplan.Current.Timeout = opts.timeout
+	mqplan.Current.Retry, err = mqplan.NewRetryPolicy(opts.retries, opts.retryDelay, opts.retryStatuses, opts.retryPost)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
 	if len(fuzzMode) > 0 {
-		err := mqswag.ReadUniqueKeys(*meqaPath)
+		err := mqswag.ReadUniqueKeys(opts.meqaPath)
 		if err != nil {
 			fmt.Printf("Error reading %s - %s\n", mqswag.UniqueKeysFile, err.Error())
 			os.Exit(1)
 		}
-		err = mqplan.Current.ReadFails(*meqaPath)
+		err = mqplan.Current.ReadFails(opts.meqaPath)
 		if err != nil {
 			fmt.Printf("Error reading %s - %s\n", mqplan.MeqaFails, err.Error())
 			os.Exit(1)
 		}
-		if !*repro {
-			err := mqswag.ReadDataset(*datasetPath, *meqaPath, fuzzMode, *batchSize)
+		if !opts.repro {
+			err := mqswag.ReadDataset(opts.datasetPath, opts.meqaPath, fuzzMode, opts.batchSize)
 			if err != nil {
 				fmt.Println("Error reading datasets -", err.Error())
 				os.Exit(1)
@@ -357,63 +591,188 @@ func runMeqa(meqaPath, swaggerFile, testPlanFile, resultPath,
 		}
 	}
 
+	switch opts.distribution {
+	case mqplan.DistUniform, mqplan.DistBoundary, mqplan.DistLog:
+		mqplan.NumberDistribution = opts.distribution
+	default:
+		fmt.Printf("Unknown number distribution %s\n", opts.distribution)
+		os.Exit(1)
+	}
+
+	tlsConfig, err := mqplan.NewTLSConfig(opts.insecure, opts.caFile)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	proxyURL, err := mqplan.ParseProxy(opts.proxy)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	mqplan.Current.Client, err = mqplan.NewClient(opts.client, tlsConfig, proxyURL)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
 	// load test plan
-	mqplan.Current.Username = *username
-	mqplan.Current.Password = *password
-	mqplan.Current.ApiToken = *apitoken
-	if *baseURL == "" {
-		*baseURL = swagger.Servers[0].URL
-	}
-	mqplan.Current.BaseURL = *baseURL
-	err = mqplan.Current.InitFromFile(*testPlanFile, &mqswag.ObjDB)
+	mqplan.Current.Username = opts.username
+	mqplan.Current.Password = opts.password
+	mqplan.Current.ApiToken = opts.apitoken
+	mqplan.Current.ApiKey = opts.apiKey
+	if len(opts.oauthTokenURL) > 0 {
+		mqplan.Current.OAuth = &mqplan.OAuth{TokenURL: opts.oauthTokenURL, ClientID: opts.oauthClientID, ClientSecret: opts.oauthClientSecret}
+		for _, scope := range strings.Split(opts.oauthScopes, ",") {
+			if scope = strings.TrimSpace(scope); len(scope) > 0 {
+				mqplan.Current.OAuth.Scopes = append(mqplan.Current.OAuth.Scopes, scope)
+			}
+		}
+	}
+	var serverURL string
+	if len(swagger.Servers) > 0 {
+		serverURL = swagger.Servers[0].URL
+	}
+	mqplan.Current.BaseURL, err = mqplan.ResolveBaseURL(serverURL, opts.baseURL, opts.scheme, opts.host)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	mqplan.Current.Tenant = opts.tenant
+	err = mqplan.Current.InitFromFile(opts.testPlanFile, &mqswag.ObjDB)
 	if err != nil {
 		mqutil.Logger.Printf("Error loading test plan: %s", err.Error())
 	}
+	if opts.shuffle != "off" {
+		shuffleSeed := opts.seed
+		if opts.shuffle != "on" {
+			shuffleSeed, err = strconv.ParseInt(opts.shuffle, 10, 64)
+			if err != nil {
+				fmt.Printf("Invalid shuffle seed: %s\n", opts.shuffle)
+				os.Exit(1)
+			}
+		}
+		fmt.Printf("Shuffling the tests with seed %d\n", shuffleSeed)
+		mqutil.Logger.Printf("shuffle seed: %d", shuffleSeed)
+		mqplan.Current.Shuffle(shuffleSeed)
+	}
 
-	// for testing, set the config to skip verifying https certificates
-	resty.SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true})
-	resty.SetRedirectPolicy(resty.FlexibleRedirectPolicy(15))
+	filter, err := mqplan.NewMethodFilter(opts.methods, opts.excludeMethods)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	filtered := mqplan.Current.FilterMethods(filter)
+	if filtered > 0 {
+		fmt.Printf("Filtered out %d tests by method\n", filtered)
+	}
+	nameFilter, err := mqplan.NewNameFilter(opts.runTests, opts.skipTests)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if byName := mqplan.Current.FilterNames(nameFilter); byName > 0 {
+		fmt.Printf("Filtered out %d tests by name\n", byName)
+		filtered += byName
+	}
+	tagFilter, err := mqplan.NewTagFilter(opts.tags, opts.excludeTags)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if byTag := mqplan.Current.FilterTags(tagFilter); byTag > 0 {
+		fmt.Printf("Filtered out %d tests by tag\n", byTag)
+		filtered += byTag
+	}
 
+	if mqplan.Current.Artifacts != nil {
+		// Keep the plan as it was run, with the variables resolved and in the shuffled order.
+		if err := mqplan.Current.DumpToFile(mqplan.Current.Artifacts.Path(mqutil.ArtifactPlan, "")); err != nil {
+			mqutil.Logger.Printf("Error writing the resolved plan: %s", err.Error())
+		}
+	}
+
+	if len(opts.saveDB) > 0 {
+		mqplan.Current.SaveDB = mqswag.ObjDB.Clone()
+	}
 	mqplan.Current.ResultCounts = make(map[string]int)
-	if *testToRun == "all" {
+	mqplan.Current.ResultCounts[mqutil.Filtered] = filtered
+	if len(opts.junitPath) > 0 {
+		mqplan.Current.JUnit = mqplan.NewJUnitReport()
+	}
+	suites := []string{opts.testToRun}
+	if opts.testToRun == "all" {
+		suites = nil
 		for _, testSuite := range mqplan.Current.SuiteList {
-			mqutil.Logger.Printf("\n---\nTest suite: %s\n", testSuite.Name)
-			fmt.Printf("\n---\nTest suite: %s\n", testSuite.Name)
-			counts, err := mqplan.Current.Run(testSuite.Name, nil)
-			mqutil.Logger.Printf("err:\n%v", err)
-			for k := range counts {
-				mqplan.Current.ResultCounts[k] += counts[k]
+			if (nameFilter != nil || tagFilter != nil) && testSuite.Empty() {
+				// Don't list the suites the filter left without tests.
+				continue
 			}
+			suites = append(suites, testSuite.Name)
+		}
+	}
+	var soakReport *mqplan.SoakReport
+	if opts.soak.Duration > 0 || opts.soak.Iterations > 0 {
+		opts.soak.Seed = opts.seed
+		soakReport = mqplan.Current.Soak(suites, opts.soak)
+		for k, v := range soakReport.Counts {
+			mqplan.Current.ResultCounts[k] += v
 		}
 	} else {
-		mqutil.Logger.Printf("\n---\nTest suite: %s\n", *testToRun)
-		fmt.Printf("\n---\nTest suite: %s\n", *testToRun)
-		counts, err := mqplan.Current.Run(*testToRun, nil)
-		mqutil.Logger.Printf("err:\n%v", err)
-		for k := range counts {
-			mqplan.Current.ResultCounts[k] += counts[k]
+		for k, v := range mqplan.Current.RunSuites(suites, opts.parallel) {
+			mqplan.Current.ResultCounts[k] += v
 		}
 	}
 	mqplan.Current.LogErrors()
 	mqplan.Current.PrintSummary()
-	os.Remove(*resultPath)
-	mqplan.Current.WriteResultToFile(*resultPath)
+	if soakReport != nil {
+		soakReport.Print()
+	}
+	if len(opts.saveDB) > 0 {
+		if err := mqplan.Current.SaveDB.Save(opts.saveDB); err != nil {
+			fmt.Printf("Error saving the DB to %s - %s\n", opts.saveDB, err.Error())
+			os.Exit(1)
+		}
+	}
+	os.Remove(opts.resultPath)
+	mqplan.Current.WriteResultToFile(opts.resultPath)
+	if len(opts.jsonPath) > 0 {
+		if err := mqplan.Current.WriteJsonResult(opts.jsonPath); err != nil {
+			fmt.Printf("Error writing the json results to %s - %s\n", opts.jsonPath, err.Error())
+			os.Exit(1)
+		}
+	}
+	if mqplan.Current.JUnit != nil {
+		if err := mqplan.Current.JUnit.WriteFile(opts.junitPath); err != nil {
+			fmt.Printf("Error writing the JUnit report to %s - %s\n", opts.junitPath, err.Error())
+			os.Exit(1)
+		}
+	}
 	if len(fuzzMode) > 0 {
-		err := mqplan.Current.WriteFailures(*meqaPath)
+		err := mqplan.Current.WriteFailures(opts.meqaPath)
 		if err != nil {
 			fmt.Printf("Error writing fuzz failures to file - %s\n", err.Error())
 			os.Exit(1)
 		}
-		if !*repro {
-			err := mqswag.WriteDoneData(*meqaPath)
+		if !opts.repro {
+			err := mqswag.WriteDoneData(opts.meqaPath)
 			if err != nil {
 				fmt.Printf("Error writing to %s - %s\n", mqswag.DoneDataFile, err.Error())
 				os.Exit(1)
 			}
 		}
 	}
+	if mqplan.Current.Artifacts != nil {
+		if err := mqplan.Current.Artifacts.WriteManifest(); err != nil {
+			fmt.Printf("Error writing the manifest - %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
 	// Exit with non-zero code only for functional failures
-	if mqplan.Current.ResultCounts[mqutil.Failed] > 0 {
-		os.Exit(3)
+	if code := mqplan.Current.ExitCode(thresholds); code != 0 {
+		os.Exit(code)
+	}
+	// A run that was stopped didn't run all the tests, whatever the thresholds tolerate.
+	if mqplan.Current.Stopped() != nil {
+		os.Exit(mqplan.ExitFailed)
 	}
 }
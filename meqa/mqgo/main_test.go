@@ -1,7 +1,10 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"strings"
 	"testing"
 
 	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
@@ -33,6 +36,30 @@ func TestInterfaceEqual(t *testing.T) {
 	}
 }
 
+func TestValidateOnly(t *testing.T) {
+	if dir := os.Getenv("MQGO_TEST_MEQA_DIR"); len(dir) > 0 {
+		// Run as mqgo in the process the test started.
+		os.Args = []string{"mqgo", "run", "-d", dir, "-s", "../../testdata/petstore_meqa.yml", "-validate-only"}
+		main()
+		return
+	}
+	dir, err := ioutil.TempDir("", "mqgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Checking the spec doesn't need a test plan.
+	cmd := exec.Command(os.Args[0], "-test.run=TestValidateOnly")
+	cmd.Env = append(os.Environ(), "MQGO_TEST_MEQA_DIR="+dir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("expecting exit code 0, got %v:\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "is valid") {
+		t.Errorf("expecting the spec to be valid, got:\n%s", out)
+	}
+}
+
 func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
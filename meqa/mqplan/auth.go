@@ -0,0 +1,118 @@
+package mqplan
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	spec "github.com/getkin/kin-openapi/openapi3"
+)
+
+// The http authentication schemes of the OpenAPI security schemes.
+const (
+	AuthBasic  = "basic"
+	AuthBearer = "bearer"
+)
+
+// securityRequirements returns the security requirements of the test's operation, which override the spec's.
+// Returns nil when neither declares any.
+func (t *Test) securityRequirements() spec.SecurityRequirements {
+	if t.op != nil && t.op.Security != nil {
+		return *t.op.Security
+	}
+	return t.db.Swagger.Security
+}
+
+// canAuthenticate checks whether the suite has the credentials for the security scheme.
+func (tc *TestSuite) canAuthenticate(scheme *spec.SecurityScheme) bool {
+	if scheme == nil {
+		return false
+	}
+	if scheme.Type == "apiKey" {
+		return len(tc.ApiKey) > 0 && len(scheme.Name) > 0
+	}
+	if scheme.Type == "oauth2" || scheme.Type == "openIdConnect" {
+		// The access token is sent as a bearer token.
+		return len(tc.ApiToken) > 0
+	}
+	if scheme.Type != "http" {
+		return false
+	}
+	switch strings.ToLower(scheme.Scheme) {
+	case AuthBasic:
+		return len(tc.Username) > 0
+	case AuthBearer:
+		return len(tc.ApiToken) > 0
+	}
+	return false
+}
+
+// setApiKey puts the key where the apiKey security scheme says, in a header, the query or a cookie.
+func setApiKey(req *Request, scheme *spec.SecurityScheme, key string) {
+	switch scheme.In {
+	case "query":
+		if req.Query == nil {
+			req.Query = make(map[string]string)
+		}
+		req.Query[scheme.Name] = key
+	case "cookie":
+		req.Header.Add("Cookie", (&http.Cookie{Name: scheme.Name, Value: key}).String())
+	default:
+		req.Header.Set(scheme.Name, key)
+	}
+}
+
+// setAuth sets the credentials of the request. When the spec declares the operation's security, they are
+// the ones of the first requirement the suite has all the credentials for - http basic, bearer, oauth2 or
+// an api key - and none for an operation that doesn't need any. Otherwise the api token is used if there is one,
+// or the username and password.
+func (t *Test) setAuth(req *Request) {
+	tc := t.suite
+	requirements := t.securityRequirements()
+	schemes := t.db.Swagger.Components.SecuritySchemes
+	for _, requirement := range requirements {
+		var names []string
+		satisfied := true
+		for name := range requirement {
+			ref := schemes[name]
+			if ref == nil || !tc.canAuthenticate(ref.Value) {
+				satisfied = false
+				break
+			}
+			names = append(names, name)
+		}
+		if !satisfied {
+			continue
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			scheme := schemes[name].Value
+			if scheme.Type == "apiKey" {
+				setApiKey(req, scheme, tc.ApiKey)
+				continue
+			}
+			if scheme.Type == "oauth2" || scheme.Type == "openIdConnect" {
+				req.Token = tc.ApiToken
+				continue
+			}
+			switch strings.ToLower(scheme.Scheme) {
+			case AuthBasic:
+				req.Username = tc.Username
+				req.Password = tc.Password
+			case AuthBearer:
+				req.Token = tc.ApiToken
+			}
+		}
+		return
+	}
+	if requirements != nil && len(requirements) == 0 {
+		// The operation doesn't need any credentials.
+		return
+	}
+
+	req.Token = tc.ApiToken
+	if len(tc.ApiToken) == 0 {
+		req.Username = tc.Username
+		req.Password = tc.Password
+	}
+}
@@ -0,0 +1,164 @@
+package mqplan
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+const securedSpec = `
+openapi: 3.0.2
+info:
+  title: secured
+  version: "1.0"
+security:
+  - basicAuth: []
+paths:
+  /basic:
+    get:
+      responses:
+        '200':
+          description: ok
+  /bearer:
+    get:
+      security:
+        - bearerAuth: []
+      responses:
+        '200':
+          description: ok
+  /either:
+    get:
+      security:
+        - apiKeyAuth: []
+        - bearerAuth: []
+      responses:
+        '200':
+          description: ok
+  /query:
+    get:
+      security:
+        - apiKeyQuery: []
+      responses:
+        '200':
+          description: ok
+  /open:
+    get:
+      security: []
+      responses:
+        '200':
+          description: ok
+components:
+  securitySchemes:
+    basicAuth:
+      type: http
+      scheme: basic
+    bearerAuth:
+      type: http
+      scheme: bearer
+    apiKeyAuth:
+      type: apiKey
+      in: header
+      name: X-API-Key
+    apiKeyQuery:
+      type: apiKey
+      in: query
+      name: api_key
+`
+
+func TestSecuritySchemeAuth(t *testing.T) {
+	for _, c := range []struct {
+		path     string
+		username string
+		token    string
+	}{
+		{"/basic", "joe", ""},
+		{"/bearer", "", "token"},
+		{"/either", "", "token"},
+		{"/open", "", ""},
+	} {
+		suite := newTestSuite(t, securedSpec, "http://example.com")
+		suite.Username = "joe"
+		suite.Password = "secret"
+		suite.ApiToken = "token"
+		client := &stubClient{status: 200}
+		suite.plan.Client = client
+		if _, err := runTest(suite, &Test{Name: "get", Path: c.path, Method: "get"}); err != nil {
+			t.Fatal(err)
+		}
+		req := client.requests[0]
+		if req.Username != c.username || req.Token != c.token || (len(c.username) > 0) != (req.Password == "secret") {
+			t.Errorf("%s: unexpected credentials %q/%q and token %q", c.path, req.Username, req.Password, req.Token)
+		}
+	}
+
+	// Without the credentials a requirement asks for, what the suite has is sent.
+	suite := newTestSuite(t, securedSpec, "http://example.com")
+	suite.ApiToken = "token"
+	client := &stubClient{status: 200}
+	suite.plan.Client = client
+	if _, err := runTest(suite, &Test{Name: "get", Path: "/basic", Method: "get"}); err != nil {
+		t.Fatal(err)
+	}
+	if client.requests[0].Token != "token" {
+		t.Errorf("expecting the token to be sent, got %q", client.requests[0].Token)
+	}
+
+	// The api key goes where its scheme says, and is picked before the token when it's listed first.
+	for _, c := range []struct {
+		path   string
+		header string
+		query  string
+	}{
+		{"/either", "key", ""},
+		{"/query", "", "key"},
+		{"/bearer", "", ""},
+	} {
+		suite := newTestSuite(t, securedSpec, "http://example.com")
+		suite.ApiToken = "token"
+		suite.ApiKey = "key"
+		client := &stubClient{status: 200}
+		suite.plan.Client = client
+		if _, err := runTest(suite, &Test{Name: "get", Path: c.path, Method: "get"}); err != nil {
+			t.Fatal(err)
+		}
+		req := client.requests[0]
+		if req.Header.Get("X-API-Key") != c.header || req.Query["api_key"] != c.query {
+			t.Errorf("%s: unexpected api key header %q and query %v", c.path, req.Header.Get("X-API-Key"), req.Query)
+		}
+		if (req.Token == "token") != (c.path == "/bearer") {
+			t.Errorf("%s: unexpected token %q", c.path, req.Token)
+		}
+	}
+}
+
+func TestVerboseLogRedactsCredentials(t *testing.T) {
+	defer func() {
+		mqutil.Verbose = false
+		mqutil.LogSecrets = false
+	}()
+	for _, logSecrets := range []bool{false, true} {
+		suite := newTestSuite(t, securedSpec, "http://example.com")
+		suite.ApiToken = "token"
+		suite.ApiKey = "secretkey"
+		suite.plan.Client = &stubClient{status: 200, body: `{"ok": true}`, header: http.Header{"Set-Cookie": {"session=abc"}}}
+		var log bytes.Buffer
+		mqutil.Logger = mqutil.NewLogger(&log)
+		mqutil.Verbose = true
+		mqutil.LogSecrets = logSecrets
+		if _, err := runTest(suite, &Test{Name: "get", Path: "/query", Method: "get"}); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []string{"--> GET http://example.com/query?api_key=", "<-- 200 OK", "Set-Cookie: ", `{"ok": true}`} {
+			if !strings.Contains(log.String(), s) {
+				t.Errorf("expecting %q in the log:\n%s", s, log.String())
+			}
+		}
+		leaked := strings.Contains(log.String(), "secretkey") || strings.Contains(log.String(), "session=abc")
+		if leaked != logSecrets {
+			t.Errorf("expecting the secrets to be logged to be %v:\n%s", logSecrets, log.String())
+		}
+	}
+}
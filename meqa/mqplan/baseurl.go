@@ -0,0 +1,56 @@
+package mqplan
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// ResolveBaseURL returns the base url of the requests, so that the same spec can target different
+// environments. The base url given replaces the spec's server url, then the scheme and the host given
+// replace those of the url, keeping its path. Fails if the result isn't an absolute http or https url.
+func ResolveBaseURL(serverURL, baseURL, scheme, host string) (string, error) {
+	if len(baseURL) == 0 {
+		baseURL = serverURL
+	}
+	if len(baseURL) == 0 && len(host) == 0 {
+		return "", mqutil.NewError(mqutil.ErrInvalid, "the spec has no servers, use -h or -host to give the base url")
+	}
+	// The placeholders, e.g. {tenant}, are only filled in later. Other characters stand in for them while
+	// the url is checked.
+	var placeholders []string
+	u, err := url.Parse(pathPlaceholderRegexp.ReplaceAllStringFunc(baseURL, func(p string) string {
+		placeholders = append(placeholders, p)
+		return fmt.Sprintf("meqa-placeholder-%d", len(placeholders)-1)
+	}))
+	if err != nil {
+		return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid base url %s - %s", baseURL, err.Error()))
+	}
+	if len(scheme) > 0 {
+		u.Scheme = strings.ToLower(scheme)
+	}
+	if len(host) > 0 {
+		u.Host = host
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the base url %s must be http or https", u.String()))
+	}
+	if len(u.Hostname()) == 0 || strings.ContainsAny(u.Host, "/?#@") {
+		return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the base url %s has no valid host", u.String()))
+	}
+	if len(u.RawQuery) > 0 || len(u.Fragment) > 0 || u.User != nil {
+		return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+			"the base url %s can't have credentials, a query or a fragment", u.String()))
+	}
+	// The host given is only checked once it's part of the url, e.g. for its port.
+	if _, err := url.Parse(u.String()); err != nil {
+		return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid base url %s - %s", u.String(), err.Error()))
+	}
+	resolved := strings.TrimSuffix(u.String(), "/")
+	for i := len(placeholders) - 1; i >= 0; i-- {
+		resolved = strings.Replace(resolved, fmt.Sprintf("meqa-placeholder-%d", i), placeholders[i], -1)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,330 @@
+package mqplan
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/resty.v1"
+)
+
+const (
+	ClientResty = "resty"
+	ClientHTTP  = "http"
+	ClientMock  = "mock"
+)
+
+// Request is the REST call produced by a test, independent of the HTTP library used to send it.
+type Request struct {
+	Method  string
+	URL     string
+	Header  http.Header
+	Query   map[string]string
+	Form    map[string]string
+	Files   map[string]string // form field name to file path
+	Uploads map[string]*File  // form field name to a generated file
+	Body    interface{}
+
+	Multipart bool // Send the form as multipart/form-data even when it has no files.
+
+	// Authentication
+	Username string
+	Password string
+	Token    string
+
+	Timeout      time.Duration // How long to wait for the response, no limit when zero.
+	MaxRedirects *int          // The most redirects to follow, DefaultMaxRedirects when nil.
+}
+
+// File is a file to upload that isn't on the disk, like the generated ones.
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+func NewRequest() *Request {
+	return &Request{Header: make(http.Header)}
+}
+
+// Response holds the parts of the server's response that we verify.
+type Response struct {
+	statusCode int
+	status     string
+	header     http.Header
+	body       []byte
+}
+
+func NewResponse(statusCode int, status string, header http.Header, body []byte) *Response {
+	return &Response{statusCode, status, header, body}
+}
+
+func (r *Response) StatusCode() int {
+	if r == nil {
+		return 0
+	}
+	return r.statusCode
+}
+
+func (r *Response) Status() string {
+	if r == nil {
+		return ""
+	}
+	return r.status
+}
+
+func (r *Response) Header() http.Header {
+	if r == nil {
+		return http.Header{}
+	}
+	return r.header
+}
+
+func (r *Response) Body() []byte {
+	if r == nil {
+		return nil
+	}
+	return r.body
+}
+
+func (r *Response) String() string {
+	return strings.TrimSpace(string(r.Body()))
+}
+
+// withTimeout returns the context that cancels the request after its timeout. It also has the request's
+// redirect limit for checkRedirect.
+func (req *Request) withTimeout() (context.Context, context.CancelFunc) {
+	ctx := context.Background()
+	if req.MaxRedirects != nil {
+		ctx = context.WithValue(ctx, redirectsKey{}, *req.MaxRedirects)
+	}
+	if req.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, req.Timeout)
+}
+
+// IsTimeout checks whether the client failed because the request timed out.
+func IsTimeout(err error) bool {
+	if err == context.DeadlineExceeded {
+		return true
+	}
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
+
+// Client sends the requests the tests produce. Implementations wrap a concrete HTTP library.
+type Client interface {
+	Do(req *Request) (*Response, error)
+}
+
+// NewClient creates a client of the named type, to be shared by all the requests of a run. The client keeps
+// its connections alive, but it has no cookie jar, each suite keeps its own session cookies instead. The
+// requests go through the proxy, or the one the environment variables give when it's nil.
+func NewClient(name string, tlsConfig *tls.Config, proxy *url.URL) (Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	switch name {
+	case ClientResty, "":
+		client := resty.New()
+		client.SetRedirectPolicy(resty.RedirectPolicyFunc(checkRedirect))
+		client.SetTransport(transport)
+		client.SetCookieJar(nil)
+		return &RestyClient{Client: client}, nil
+	case ClientHTTP:
+		return &HTTPClient{Client: &http.Client{Transport: transport, CheckRedirect: checkRedirect}}, nil
+	case ClientMock:
+		return &MockClient{}, nil
+	}
+	return nil, fmt.Errorf("unknown HTTP client: %s", name)
+}
+
+// RestyClient sends requests through resty. When Client is nil the resty default client is used.
+type RestyClient struct {
+	Client *resty.Client
+}
+
+func (c *RestyClient) Do(req *Request) (*Response, error) {
+	client := c.Client
+	if client == nil {
+		client = resty.DefaultClient
+	}
+	ctx, cancel := req.withTimeout()
+	defer cancel()
+	r := client.R().SetContext(ctx)
+	if len(req.Token) > 0 {
+		r.SetAuthToken(req.Token)
+	} else if len(req.Username) > 0 {
+		r.SetBasicAuth(req.Username, req.Password)
+	}
+	if req.Multipart || len(req.Uploads) > 0 {
+		// resty only sends a multipart form when it has files on the disk, we encode the form ourselves.
+		body, contentType, err := encodeMultipart(req)
+		if err != nil {
+			return nil, err
+		}
+		r.SetBody(body).SetHeader("Content-Type", contentType)
+	} else {
+		if len(req.Files) > 0 {
+			r.SetFiles(req.Files)
+		}
+		if len(req.Form) > 0 {
+			r.SetFormData(req.Form)
+		}
+	}
+	if len(req.Query) > 0 {
+		r.SetQueryParams(req.Query)
+	}
+	if req.Body != nil {
+		r.SetBody(req.Body)
+	}
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	resp, err := r.Execute(strings.ToUpper(req.Method), req.URL)
+	if err != nil {
+		return nil, err
+	}
+	return NewResponse(resp.StatusCode(), resp.Status(), resp.Header(), resp.Body()), nil
+}
+
+// HTTPClient sends requests through net/http. When Client is nil http.DefaultClient is used.
+type HTTPClient struct {
+	Client *http.Client
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// encodeMultipart returns the request's form, files and uploads as a multipart/form-data body, and its
+// content type.
+func encodeMultipart(req *Request) (io.Reader, string, error) {
+	buf := new(bytes.Buffer)
+	w := multipart.NewWriter(buf)
+	for k, v := range req.Form {
+		w.WriteField(k, v)
+	}
+	for k, path := range req.Files {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, "", err
+		}
+		part, err := w.CreateFormFile(k, filepath.Base(path))
+		if err == nil {
+			_, err = io.Copy(part, f)
+		}
+		f.Close()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	for k, f := range req.Uploads {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(k),
+			quoteEscaper.Replace(f.Name)))
+		h.Set("Content-Type", f.ContentType)
+		part, err := w.CreatePart(h)
+		if err == nil {
+			_, err = part.Write(f.Data)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf, w.FormDataContentType(), nil
+}
+
+// encodeBody returns the request body and its content type.
+func (c *HTTPClient) encodeBody(req *Request) (io.Reader, string, error) {
+	if len(req.Files) > 0 || len(req.Uploads) > 0 || req.Multipart {
+		return encodeMultipart(req)
+	}
+	if len(req.Form) > 0 {
+		form := url.Values{}
+		for k, v := range req.Form {
+			form.Set(k, v)
+		}
+		return strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", nil
+	}
+	switch body := req.Body.(type) {
+	case nil:
+		return nil, "", nil
+	case string:
+		return strings.NewReader(body), "text/plain; charset=utf-8", nil
+	case []byte:
+		return bytes.NewReader(body), "application/octet-stream", nil
+	}
+	b, err := json.Marshal(req.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return bytes.NewReader(b), "application/json", nil
+}
+
+func (c *HTTPClient) Do(req *Request) (*Response, error) {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	body, contentType, err := c.encodeBody(req)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Query) > 0 {
+		query := u.Query()
+		for k, v := range req.Query {
+			query.Set(k, v)
+		}
+		u.RawQuery = query.Encode()
+	}
+	ctx, cancel := req.withTimeout()
+	defer cancel()
+	httpReq, err := http.NewRequest(strings.ToUpper(req.Method), u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq = httpReq.WithContext(ctx)
+	if len(contentType) > 0 {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range req.Header {
+		httpReq.Header[k] = v
+	}
+	if len(req.Token) > 0 {
+		httpReq.Header.Set("Authorization", "Bearer "+req.Token)
+	} else if len(req.Username) > 0 {
+		httpReq.SetBasicAuth(req.Username, req.Password)
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return NewResponse(resp.StatusCode, resp.Status, resp.Header, respBody), nil
+}
@@ -0,0 +1,612 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqswag"
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+const itemSpec = `
+openapi: 3.0.2
+info:
+  title: items
+  version: "1.0"
+paths:
+  /items/{id}:
+    put:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+        - name: verbose
+          in: query
+          schema:
+            type: boolean
+        - name: X-Request-Id
+          in: header
+          schema:
+            type: string
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+              properties:
+                name:
+                  type: string
+      responses:
+        '200':
+          description: updated
+`
+
+// stubClient records the requests and answers them with a canned response.
+type stubClient struct {
+	requests []*Request
+	status   int
+	body     string
+	header   http.Header
+}
+
+func (c *stubClient) Do(req *Request) (*Response, error) {
+	c.requests = append(c.requests, req)
+	header := c.header
+	if header == nil {
+		header = http.Header{}
+	}
+	return NewResponse(c.status, http.StatusText(c.status), header, []byte(c.body)), nil
+}
+
+func newItemTest() *Test {
+	test := &Test{Name: "put", Path: "/items/{id}", Method: "put"}
+	test.PathParams = map[string]interface{}{"id": 7}
+	test.QueryParams = map[string]interface{}{"verbose": true}
+	test.HeaderParams = map[string]interface{}{"X-Request-Id": "abc"}
+	test.BodyParams = map[string]interface{}{"name": "widget"}
+	return test
+}
+
+func TestStubClientRequest(t *testing.T) {
+	suite := newTestSuite(t, itemSpec, "http://example.com")
+	suite.ApiToken = "token"
+	client := &stubClient{status: 200}
+	suite.plan.Client = client
+	if _, err := runTest(suite, newItemTest()); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(client.requests))
+	}
+	req := client.requests[0]
+	if req.Method != "put" || req.URL != "http://example.com/items/7" {
+		t.Errorf("unexpected request line: %s %s", req.Method, req.URL)
+	}
+	if req.Query["verbose"] != "true" || req.Header.Get("X-Request-Id") != "abc" || req.Token != "token" {
+		t.Errorf("unexpected query/header/auth: %v %v %v", req.Query, req.Header, req.Token)
+	}
+	if body, _ := req.Body.(map[string]interface{}); body["name"] != "widget" {
+		t.Errorf("unexpected body: %v", req.Body)
+	}
+}
+
+func TestHTTPClient(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &got)
+		if r.Method != "PUT" || r.URL.Path != "/items/7" || r.URL.Query().Get("verbose") != "true" ||
+			r.Header.Get("X-Request-Id") != "abc" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	for _, name := range []string{ClientResty, ClientHTTP} {
+		got = nil
+		suite := newTestSuite(t, itemSpec, server.URL)
+		suite.ApiToken = "token"
+		suite.plan.Client, _ = NewClient(name, nil, nil)
+		if _, err := runTest(suite, newItemTest()); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if got["name"] != "widget" {
+			t.Errorf("%s: server got body %v", name, got)
+		}
+	}
+}
+
+const tenantSpec = `
+openapi: 3.0.2
+info:
+  title: tenants
+  version: "1.0"
+paths:
+  /tenants/{tenant}/users:
+    get:
+      parameters:
+        - name: tenant
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        '200':
+          description: listed
+  /orgs/{tenantId}/users/{id}:
+    delete:
+      parameters:
+        - name: tenantId
+          in: path
+          required: true
+          schema:
+            type: string
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      responses:
+        '204':
+          description: deleted
+`
+
+func TestTenantSubstitution(t *testing.T) {
+	suite := newTestSuite(t, tenantSpec, "http://{tenant}.example.com/api")
+	client := &stubClient{status: 200}
+	suite.plan.Client = client
+	suite.plan.Tenant = "acme"
+
+	if _, err := runTest(suite, &Test{Name: "list", Path: "/tenants/{tenant}/users", Method: "get"}); err != nil {
+		t.Fatal(err)
+	}
+	client.status = 204
+	test := &Test{Name: "delete", Path: "/orgs/{tenantId}/users/{id}", Method: "delete"}
+	test.PathParams = map[string]interface{}{"id": 3}
+	if _, err := runTest(suite, test); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"http://acme.example.com/api/tenants/acme/users",
+		"http://acme.example.com/api/orgs/acme/users/3",
+	}
+	for i, req := range client.requests {
+		if req.URL != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], req.URL)
+		}
+	}
+
+	// A value set in the test wins over the run's tenant.
+	test = &Test{Name: "other", Path: "/tenants/{tenant}/users", Method: "get"}
+	test.PathParams = map[string]interface{}{"tenant": "other"}
+	client.status = 200
+	if _, err := runTest(suite, test); err != nil {
+		t.Fatal(err)
+	}
+	if url := client.requests[2].URL; url != "http://acme.example.com/api/tenants/other/users" {
+		t.Errorf("unexpected url: %s", url)
+	}
+}
+
+func TestSharedClientCookies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("session"); err != nil {
+			// The first request opens the session, the later ones must carry it.
+			if r.URL.Query().Get("verbose") != "" && r.Header.Get("X-Request-Id") == "first" {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+				return
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	for _, name := range []string{ClientResty, ClientHTTP} {
+		suite := newTestSuite(t, itemSpec, server.URL)
+		client, err := NewClient(name, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		suite.plan.Client = client
+		for i, id := range []string{"first", "second", "third"} {
+			test := newItemTest()
+			test.HeaderParams["X-Request-Id"] = id
+			if _, err := runTest(suite, test); err != nil {
+				t.Errorf("%s: request %d: %v", name, i, err)
+			}
+		}
+	}
+}
+
+func TestPostJsonBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var user map[string]interface{}
+		b, _ := ioutil.ReadAll(r.Body)
+		if r.Method != "POST" || r.URL.Path != "/users" || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") ||
+			json.Unmarshal(b, &user) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		user["id"] = 1
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+	}))
+	defer server.Close()
+
+	for _, name := range []string{ClientResty, ClientHTTP} {
+		suite := newTestSuite(t, userSpec, server.URL)
+		suite.plan.Client, _ = NewClient(name, nil, nil)
+		test := &Test{Name: "post", Path: "/users", Method: "post"}
+		test.BodyParams = map[string]interface{}{"name": "alice"}
+		dup, err := runTest(suite, test)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		// The response is kept for the later tests to inspect.
+		if dup.resp == nil || dup.resp.StatusCode() != http.StatusOK || !strings.Contains(string(dup.resp.Body()), `"alice"`) {
+			t.Errorf("%s: unexpected response %v", name, dup.resp)
+		}
+	}
+}
+
+const petstoreSpec = `
+openapi: 3.0.2
+info:
+  title: petstore
+  version: "1.0"
+paths:
+  /pet:
+    put:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+      responses:
+        '200':
+          description: updated
+  /pet/{petId}:
+    patch:
+      parameters:
+        - name: petId
+          in: path
+          required: true
+          schema:
+            type: integer
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+      responses:
+        '200':
+          description: patched
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        id:
+          type: integer
+        name:
+          type: string
+        status:
+          type: string
+          enum: [available, sold]
+`
+
+func TestPutPatchBody(t *testing.T) {
+	var got []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		b, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &body); err != nil || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		got = append(got, body)
+	}))
+	defer server.Close()
+	suite := newTestSuite(t, petstoreSpec, server.URL)
+	suite.plan.Client, _ = NewClient(ClientHTTP, nil, nil)
+
+	put := &Test{Name: "put", Path: "/pet", Method: "put"}
+	put.BodyParams = map[string]interface{}{"id": 1, "name": "rex", "status": "sold"}
+	if _, err := runTest(suite, put); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0]["name"] != "rex" || got[0]["status"] != "sold" || got[0]["id"] != 1.0 {
+		t.Errorf("put body didn't round trip: %v", got)
+	}
+
+	// Without partial the other fields are generated, with it only the set fields are sent.
+	for _, partial := range []bool{false, true} {
+		got = nil
+		patch := &Test{Name: "patch", Path: "/pet/{petId}", Method: "patch", Partial: partial}
+		patch.PathParams = map[string]interface{}{"petId": 1}
+		patch.BodyParams = map[string]interface{}{"name": "max"}
+		if _, err := runTest(suite, patch); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0]["name"] != "max" || (len(got[0]) == 1) != partial {
+			t.Errorf("partial %v: unexpected patch body %v", partial, got)
+		}
+	}
+}
+
+func TestPathParamEscaping(t *testing.T) {
+	suite := newTestSuite(t, tenantSpec, "http://example.com")
+	client := &stubClient{status: 200}
+	suite.plan.Client = client
+	test := &Test{Name: "list", Path: "/tenants/{tenant}/users", Method: "get"}
+	test.PathParams = map[string]interface{}{"tenant": "acme corp/eu"}
+	if _, err := runTest(suite, test); err != nil {
+		t.Fatal(err)
+	}
+	if url := client.requests[0].URL; url != "http://example.com/tenants/acme%20corp%2Feu/users" {
+		t.Errorf("unexpected url: %s", url)
+	}
+
+	// A null value skips the parameter, which leaves the placeholder unfilled.
+	test = &Test{Name: "list", Path: "/tenants/{tenant}/users", Method: "get"}
+	test.PathParams = map[string]interface{}{"tenant": nil}
+	_, err := runTest(suite, test)
+	if err == nil || !strings.Contains(err.Error(), "{tenant}") || len(client.requests) != 1 {
+		t.Errorf("expecting an error naming {tenant} without sending the request, got %v", err)
+	}
+}
+
+const headerSpec = `
+openapi: 3.0.2
+info:
+  title: status
+  version: "1.0"
+paths:
+  /status:
+    get:
+      parameters:
+        - name: X-Request-Id
+          in: header
+          required: true
+          schema:
+            type: string
+        - name: Accept-Language
+          in: header
+          required: true
+          schema:
+            type: string
+            enum: [en, fr]
+      responses:
+        '200':
+          description: ok
+`
+
+func TestHeaderOnlyOperation(t *testing.T) {
+	var got http.Header
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		query = r.URL.RawQuery
+	}))
+	defer server.Close()
+
+	for _, name := range []string{ClientResty, ClientHTTP} {
+		suite := newTestSuite(t, headerSpec, server.URL)
+		suite.plan.Client, _ = NewClient(name, nil, nil)
+		test := &Test{Name: "status", Path: "/status", Method: "get"}
+		test.HeaderParams = map[string]interface{}{"X-Request-Id": "req-1"}
+		if _, err := runTest(suite, test); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		// The provided header is sent as is, the other one is generated.
+		if got.Get("X-Request-Id") != "req-1" || (got.Get("Accept-Language") != "en" && got.Get("Accept-Language") != "fr") {
+			t.Errorf("%s: unexpected headers %v", name, got)
+		}
+		if len(query) > 0 {
+			t.Errorf("%s: header parameters sent in the query: %s", name, query)
+		}
+	}
+}
+
+const widgetSpec = `
+openapi: 3.0.2
+info:
+  title: widgets
+  version: "1.0"
+paths:
+  /widgets:
+    post:
+      requestBody:
+        content:
+          application/vnd.api+json:
+            schema:
+              $ref: '#/components/schemas/Widget'
+      responses:
+        '201':
+          description: created
+  /gadgets:
+    post:
+      requestBody:
+        content:
+          text/csv:
+            schema:
+              type: string
+      responses:
+        '201':
+          description: created
+components:
+  schemas:
+    Widget:
+      type: object
+      required: [name, size]
+      properties:
+        name:
+          type: string
+        size:
+          type: integer
+          minimum: 1
+          maximum: 10
+`
+
+func TestRequestBodyMediaType(t *testing.T) {
+	var contentType string
+	var body map[string]interface{}
+	var raw string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		b, _ := ioutil.ReadAll(r.Body)
+		raw = string(b)
+		json.Unmarshal(b, &body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+	suite := newTestSuite(t, widgetSpec, server.URL)
+	for _, name := range []string{ClientResty, ClientHTTP} {
+		suite.plan.Client, _ = NewClient(name, nil, nil)
+		body = nil
+		if _, err := runTest(suite, &Test{Name: "create", Path: "/widgets", Method: "post"}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if contentType != "application/vnd.api+json" {
+			t.Errorf("%s: unexpected content type %s", name, contentType)
+		}
+		schema := suite.plan.swagger.FindSchemaByName("Widget")
+		if body["name"] == nil || !schema.Matches(body, mqswag.MatchOptions{}, suite.plan.swagger) {
+			t.Errorf("%s: the body doesn't match the request body schema: %v", name, body)
+		}
+	}
+
+	// A body of another media type is sent as is, and it has to be a string.
+	dup, err := runTest(suite, &Test{Name: "upload", Path: "/gadgets", Method: "post"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent, _ := dup.BodyParams.(string); contentType != "text/csv" || len(raw) == 0 || raw != sent {
+		t.Errorf("expecting the generated csv to be sent as is, got %s %q", contentType, raw)
+	}
+	upload := &Test{Name: "upload", Path: "/gadgets", Method: "post"}
+	upload.BodyParams = map[string]interface{}{"name": "widget"}
+	if _, err := runTest(suite, upload); err == nil {
+		t.Errorf("expecting an error for a csv body that isn't a string")
+	}
+}
+
+const accountSpec = `
+openapi: 3.0.2
+info:
+  title: accounts
+  version: "1.0"
+paths:
+  /accounts/{id}:
+    put:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Account'
+      responses:
+        '200':
+          description: replaced
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Account'
+components:
+  schemas:
+    Account:
+      type: object
+      properties:
+        id:
+          type: integer
+          readOnly: true
+        name:
+          type: string
+        limit:
+          type: integer
+        password:
+          type: string
+          writeOnly: true
+        tags:
+          type: array
+          items:
+            type: string
+`
+
+func TestPutEcho(t *testing.T) {
+	for _, rename := range []bool{false, true} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]interface{}
+			b, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(b, &body)
+			// The server manages the id and never returns the password.
+			body["id"] = 7
+			delete(body, "password")
+			if rename {
+				body["name"] = "renamed"
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(body)
+		}))
+		suite := newTestSuite(t, accountSpec, server.URL)
+		suite.plan.Client, _ = NewClient(ClientHTTP, nil, nil)
+		test := &Test{Name: "replace", Path: "/accounts/{id}", Method: "put", Echo: true}
+		test.PathParams = map[string]interface{}{"id": 7}
+		test.BodyParams = map[string]interface{}{"name": "joe", "limit": 10, "password": "secret", "tags": []interface{}{"a", "b"}}
+		dup, err := runTest(suite, test)
+		server.Close()
+		if rename {
+			if err == nil || dup.responseError != "response differs from the request body in: name" {
+				t.Errorf("expecting the renamed field to fail the test, got %v, %v", err, dup.responseError)
+			}
+		} else if err != nil {
+			t.Errorf("expecting the echoed writable fields to pass: %v", err)
+		}
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			// The first request hangs until the client gives up.
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}))
+	defer server.Close()
+
+	for _, name := range []string{ClientResty, ClientHTTP} {
+		calls = 0
+		suite := newTestSuite(t, securedSpec, server.URL)
+		plan := suite.plan
+		plan.Quiet = true
+		plan.Timeout = 50 * time.Millisecond
+		plan.Client, _ = NewClient(name, nil, nil)
+		if err := plan.AddFromString(soakPlan); err != nil {
+			t.Fatal(err)
+		}
+		counts, err := plan.Run("/open", nil)
+		if err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+			t.Errorf("%s: expecting the timeout to fail the test, got %v", name, err)
+		}
+		// The hung request isn't tried again, and the run goes on with the next test.
+		if calls != 2 || counts[mqutil.Failed] != 1 || counts[mqutil.Passed] != 1 {
+			t.Errorf("%s: unexpected %d calls and counts %v", name, calls, counts)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package mqplan
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// sendCookies adds the cookies that the servers set earlier in the suite, and that go to the request's
+// url, to the request. That way a login test's session carries over to the later tests of the suite.
+func (tc *TestSuite) sendCookies(req *Request) {
+	u, err := url.Parse(req.URL)
+	if tc.cookies == nil || err != nil {
+		return
+	}
+	r := &http.Request{Header: req.Header}
+	for _, c := range tc.cookies.Cookies(u) {
+		r.AddCookie(c)
+	}
+}
+
+// keepCookies keeps the cookies the response sets, for the suite's later requests.
+func (tc *TestSuite) keepCookies(req *Request, resp *Response) {
+	u, err := url.Parse(req.URL)
+	if tc.cookies == nil || err != nil || resp == nil {
+		return
+	}
+	if cookies := (&http.Response{Header: resp.Header()}).Cookies(); len(cookies) > 0 {
+		tc.cookies.SetCookies(u, cookies)
+	}
+}
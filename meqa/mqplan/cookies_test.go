@@ -0,0 +1,64 @@
+package mqplan
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const sessionSpec = `
+openapi: 3.0.2
+info:
+  title: sessions
+  version: "1.0"
+paths:
+  /login:
+    post:
+      responses:
+        '204':
+          description: logged in
+  /profile:
+    get:
+      responses:
+        '200':
+          description: the profile
+        '401':
+          description: not logged in
+`
+
+func TestSuiteCookies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+			w.WriteHeader(http.StatusNoContent)
+		case "/profile":
+			if c, err := r.Cookie("session"); err != nil || c.Value != "s1" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}
+	}))
+	defer server.Close()
+
+	for _, name := range []string{ClientResty, ClientHTTP} {
+		client, err := NewClient(name, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		suite := newTestSuite(t, sessionSpec, server.URL)
+		suite.plan.Client = client
+		if _, err := runTest(suite, &Test{Name: "login", Path: "/login", Method: "post"}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := runTest(suite, &Test{Name: "profile", Path: "/profile", Method: "get"}); err != nil {
+			t.Errorf("%s: expecting the session of the login: %v", name, err)
+		}
+
+		// The session doesn't carry over to another suite, even with the same client.
+		other := newTestSuite(t, sessionSpec, server.URL)
+		other.plan.Client = client
+		if _, err := runTest(other, &Test{Name: "profile", Path: "/profile", Method: "get"}); err == nil {
+			t.Errorf("%s: expecting another suite to have no session", name)
+		}
+	}
+}
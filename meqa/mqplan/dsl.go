@@ -6,14 +6,19 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"gopkg.in/resty.v1"
-
 	"reflect"
 
 	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
@@ -23,8 +28,6 @@ import (
 	"encoding/json"
 
 	spec "github.com/getkin/kin-openapi/openapi3"
-	uuid "github.com/gofrs/uuid"
-	"github.com/lucasjones/reggen"
 	"github.com/xeipuuv/gojsonschema"
 )
 
@@ -38,6 +41,7 @@ const (
 	StatusCodeOk              = 200       // Create success
 	StatusCodeNoResponse      = 204       // Delete success
 	StatusCodeBadRequest      = 400       // Due to incorrect body parameters
+	StatusCodeNotFound        = 404       // The object doesn't exist
 	StatusCodeTooManyRequests = 429       // API rate limiting
 )
 
@@ -108,8 +112,50 @@ type Test struct {
 	Ref        string                 `yaml:"ref,omitempty"`
 	Expect     map[string]interface{} `yaml:"expect,omitempty"`
 	Strict     bool                   `yaml:"strict,omitempty"`
+	Paginate   bool                   `yaml:"paginate,omitempty"` // Follow the pages of a list and check they add up.
+	Partial    bool                   `yaml:"partial,omitempty"`  // Patch only the body fields the test sets.
+	Echo       bool                   `yaml:"echo,omitempty"`     // The response must return the body's fields as sent.
+	Parallel   bool                   `yaml:"parallel,omitempty"` // In a suite's meqa_init, the suite can run in parallel.
 	TestParams `yaml:",inline,omitempty" json:",inline,omitempty"`
 
+	// The statuses to expect instead of 2xx, e.g. "202", "200,202", "3xx" or "200-204".
+	ExpectStatus string `yaml:"expectStatus,omitempty"`
+
+	// The relations of the response's links to get and validate, e.g. self, and the convention of the
+	// links - hal (_links) or jsonapi (links), both when not set.
+	FollowLinks []string `yaml:"followLinks,omitempty"`
+	LinkStyle   string   `yaml:"linkStyle,omitempty"`
+
+	// The redirect policy of the request, instead of the plan's: follow, none to get the 3xx response, or
+	// max-N to follow N redirects at most.
+	Redirects string `yaml:"redirects,omitempty"`
+
+	// How many times the request is tried again when it gets one of the plan's retry statuses, instead of
+	// the plan's retries. A POST or PATCH is only tried again with retryPost.
+	Retries   *int `yaml:"retries,omitempty"`
+	RetryPost bool `yaml:"retryPost,omitempty"`
+
+	// The fields to leave out of the generated body, e.g. to check the server rejects a body without one
+	// of its required fields.
+	Omit []string `yaml:"omit,omitempty"`
+
+	// The constraint of a body field or a parameter to break, e.g. name.maxLength, to check the server
+	// rejects the values the schema doesn't allow. See the Violate constants for the constraints.
+	Violate string `yaml:"violate,omitempty"`
+
+	// The queries that pick the objects the parameters are taken from, by class, e.g. to use a pet whose
+	// status is available, instead of any object of the class.
+	Select map[string]mqswag.Query `yaml:"select,omitempty"`
+
+	// The objects, by class, that the objects the test uses and creates belong to, e.g. User: {id: 5} for
+	// the orders of the user 5. The parameters are only taken from the objects associated with them, and
+	// the objects created are associated with them.
+	Associations map[string]map[string]interface{} `yaml:"associations,omitempty"`
+
+	// The tags that -tags and -exclude-tags select the test by, e.g. smoke or slow. The tags of a suite's
+	// meqa_init are the tags of all its tests.
+	Tags []string `yaml:"tags,omitempty"`
+
 	startTime time.Time
 	stopTime  time.Time
 
@@ -118,17 +164,76 @@ type Test struct {
 	comparisons map[string]([]*Comparison)
 	sampleSpace map[string][]mqutil.FuzzValue
 
-	tag   *mqswag.MeqaTag // The tag at the top level that describes the test
-	db    *mqswag.DB
-	suite *TestSuite
-	op    *spec.Operation
-	resp  *resty.Response
-	err   error
+	tag    *mqswag.MeqaTag // The tag at the top level that describes the test
+	db     *mqswag.DB
+	suite  *TestSuite
+	op     *spec.Operation
+	resp   *Response
+	err    error
+	client Client // The client shared by the run
+
+	contentType string           // The request body's content type when it's not application/json.
+	multipart   bool             // The form parameters are sent as multipart/form-data.
+	uploads     map[string]*File // The generated files of the file fields that aren't set.
+	out         *outputBuffer    // In quiet mode the output is held here until we know whether the test failed.
+	refs        map[string]bool  // The names of the tests the templates refer to, see references.
+	classSet    map[string]bool  // The classes of the objects the test works on, see classes.
+
+	failureExpected bool // The test expects a status other than 2xx, such as a negative test's 4xx.
 
 	responseError interface{}
 	schemaError   error
 }
 
+// outputBuffer holds a test's output. The fuzzed copies of a test share it and write to it in parallel.
+type outputBuffer struct {
+	buf   bytes.Buffer
+	mutex sync.Mutex
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+// output returns where the test prints its progress.
+func (t *Test) output() io.Writer {
+	if t.out != nil {
+		return t.out
+	}
+	return os.Stdout
+}
+
+func (t *Test) printf(format string, a ...interface{}) {
+	fmt.Fprintf(t.output(), format, a...)
+}
+
+func (t *Test) print(a ...interface{}) {
+	fmt.Fprint(t.output(), a...)
+}
+
+func (t *Test) println(a ...interface{}) {
+	fmt.Fprintln(t.output(), a...)
+}
+
+// stdoutMutex keeps the outputs of the tests of the parallel suites from interleaving.
+var stdoutMutex sync.Mutex
+
+// FlushOutput prints the output held in quiet mode when the test failed, or always in verbose mode. The
+// output held while the suites run in parallel is printed with print.
+func (t *Test) FlushOutput(print bool) {
+	if t.out == nil {
+		return
+	}
+	if print || mqutil.Verbose {
+		stdoutMutex.Lock()
+		os.Stdout.Write(t.out.buf.Bytes())
+		stdoutMutex.Unlock()
+	}
+	t.out = nil
+}
+
 func (t *Test) Init(suite *TestSuite) {
 	t.suite = suite
 	if suite != nil {
@@ -161,6 +266,12 @@ func (t *Test) SchemaDuplicate() *Test {
 	test.FormParams = mqutil.MapCopy(test.FormParams)
 	test.PathParams = mqutil.MapCopy(test.PathParams)
 	test.HeaderParams = mqutil.MapCopy(test.HeaderParams)
+	if test.Associations != nil {
+		test.Associations = make(map[string]map[string]interface{})
+		for class, obj := range t.Associations {
+			test.Associations[class] = mqutil.MapCopy(obj)
+		}
+	}
 	if m, ok := test.BodyParams.(map[string]interface{}); ok {
 		test.BodyParams = mqutil.MapCopy(m)
 	} else if a, ok := test.BodyParams.([]interface{}); ok {
@@ -173,6 +284,7 @@ func (t *Test) SchemaDuplicate() *Test {
 	test.comparisons = make(map[string]([]*Comparison))
 	test.sampleSpace = make(map[string][]mqutil.FuzzValue)
 	test.err = nil
+	test.uploads = nil
 	test.db = test.suite.db
 
 	return &test
@@ -297,7 +409,7 @@ func (t *Test) GetClientDB(className string, associations map[string]map[string]
 
 // Every object in the response must be in the client db
 func (t *Test) ResponseInDb(className string, associations map[string]map[string]interface{}, resultArray []interface{}) error {
-	fmt.Printf("... checking GET result against client. ")
+	t.printf("... checking GET result against client. ")
 	dbArray := t.GetClientDB(className, associations)
 	numMiss := 0
 	var missing string
@@ -330,17 +442,17 @@ func (t *Test) ResponseInDb(className string, associations map[string]map[string
 			b, _ := json.Marshal(dbArray[0])
 			found = string(b)
 		}
-		fmt.Printf("Result not found on client. Fail\n")
+		t.printf("Result not found on client. Fail\n")
 		t.responseError = fmt.Sprintf("%v remote objects missing in client\nMissing:%v\nFound %v like:%v", numMiss, missing, len(dbArray), found)
 		return mqutil.NewError(mqutil.ErrHttp, fmt.Sprintf("remote object not found in client\n"))
 	}
-	fmt.Printf("Success\n")
+	t.printf("Success\n")
 	return nil
 }
 
 // Every object in the client db must be in the response
 func (t *Test) DbInResponse(className string, associations map[string]map[string]interface{}, resultArray []interface{}) error {
-	fmt.Printf("... checking client objects against GET result. ")
+	t.printf("... checking client objects against GET result. ")
 	dbArray := t.GetClientDB(className, associations)
 	numMiss := 0
 	var missing string
@@ -366,11 +478,11 @@ func (t *Test) DbInResponse(className string, associations map[string]map[string
 		}
 	}
 	if numMiss > 0 {
-		fmt.Printf("Result not found on remote. Fail\n")
+		t.printf("Result not found on remote. Fail\n")
 		t.responseError = fmt.Sprintf("%v local objects missing from a list of %v on remote\nMissing: %s\n", numMiss, len(resultArray), missing)
 		return mqutil.NewError(mqutil.ErrHttp, fmt.Sprintf("client object not found in results returned\n"))
 	}
-	fmt.Printf("Success\n")
+	t.printf("Success\n")
 	return nil
 }
 
@@ -379,17 +491,28 @@ func (t *Test) DbInResponse(className string, associations map[string]map[string
 func (t *Test) ProcessOneComparison(className string, method string, comp *Comparison,
 	associations map[string]map[string]interface{}, collection map[string][]interface{}) error {
 
+	// The test usually works on the suite's DB, don't apply the change to it twice.
+	suiteDB := t.suite.db
+	if suiteDB == t.db {
+		suiteDB = nil
+	}
 	if method == mqswag.MethodDelete {
 		mqutil.Logger.Printf("... deleting entry from client DB. Success\n")
-		t.suite.db.Delete(className, comp.oldUsed, associations, mqutil.InterfaceEquals, 1)
+		if suiteDB != nil {
+			suiteDB.Delete(className, comp.oldUsed, associations, mqutil.InterfaceEquals, 1)
+		}
 		t.db.Delete(className, comp.oldUsed, associations, mqutil.InterfaceEquals, 1)
 	} else if method == mqswag.MethodPost && comp.new != nil {
 		mqutil.Logger.Printf("... adding entry to client DB. Success\n")
-		t.suite.db.Insert(className, comp.new, associations)
+		if suiteDB != nil {
+			suiteDB.Insert(className, comp.new, associations)
+		}
 		return t.db.Insert(className, comp.new, associations)
 	} else if (method == mqswag.MethodPatch || method == mqswag.MethodPut) && comp.new != nil {
 		mqutil.Logger.Printf("... updating entry in client DB. Success\n")
-		t.suite.db.Update(className, comp.oldUsed, associations, mqutil.InterfaceEquals, comp.new, 1, method == mqswag.MethodPatch)
+		if suiteDB != nil {
+			suiteDB.Update(className, comp.oldUsed, associations, mqutil.InterfaceEquals, comp.new, 1, method == mqswag.MethodPatch)
+		}
 		count := t.db.Update(className, comp.oldUsed, associations, mqutil.InterfaceEquals, comp.new, 1, method == mqswag.MethodPatch)
 		if count != 1 {
 			mqutil.Logger.Printf("Failed to find any entry to update")
@@ -413,17 +536,23 @@ func (t *Test) GetParam(path []string) interface{} {
 		section = t.FormParams
 	} else if path[0] == "bodyParams" {
 		section = t.BodyParams
-	} else if path[0] == "outputs" {
+	} else if path[0] == "outputs" || path[0] == "response" {
 		section = t.Expect[ExpectBody]
 	}
 
 	topSection := section
-	// First try the exact search. This only works if there is no
-	// array on the search path.
+	// First try the exact search. The entries of an array are picked by their index.
 	for _, field := range path[1:] {
 		if section == nil {
 			break
 		}
+		if array, ok := section.([]interface{}); ok {
+			section = nil
+			if i, err := strconv.Atoi(field); err == nil && i >= 0 && i < len(array) {
+				section = array[i]
+			}
+			continue
+		}
 		paramMap, ok := section.(map[string]interface{})
 		if !ok {
 			section = nil
@@ -454,9 +583,9 @@ func (t *Test) GetParam(path []string) interface{} {
 }
 
 // ProcessResult decodes the response from the server into a result array
-func (t *Test) ProcessResult(resp *resty.Response) error {
+func (t *Test) ProcessResult(resp *Response) error {
 	if t.err != nil {
-		fmt.Printf("REST call hit the following error: %s\n", t.err.Error())
+		t.printf("REST call hit the following error: %s\n", t.err.Error())
 		return t.err
 	}
 
@@ -479,16 +608,26 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 	}
 
 	respBody := resp.Body()
-	var respSchema mqswag.SchemaRef
-	if respSpec.Content != nil && respSpec.Content[mqswag.JsonResponse] != nil && respSpec.Content[mqswag.JsonResponse].Schema != nil {
-		respSchema = (mqswag.SchemaRef)(*(respSpec.Content[mqswag.JsonResponse].Schema))
+	// The response can have a different schema for each media type, pick the one the server returned.
+	contentType := resp.Header().Get("Content-Type")
+	var mediaType *spec.MediaType
+	isProblem := mqswag.IsProblemMediaType(contentType)
+	if isProblem {
+		// Problems are checked against the standard schema, only use a schema the spec declares for them.
+		mediaType = respSpec.Content[mqswag.ProblemResponse]
+	} else if respSpec.Content != nil {
+		if len(contentType) > 0 {
+			mediaType = respSpec.Content.Get(contentType)
+		}
+		if mediaType == nil {
+			mediaType = respSpec.Content[mqswag.JsonResponse]
+		}
 	}
-	var resultObj interface{}
-	if len(respBody) > 0 {
-		d := json.NewDecoder(bytes.NewReader(respBody))
-		d.UseNumber()
-		d.Decode(&resultObj)
+	var respSchema mqswag.SchemaRef
+	if mediaType != nil && mediaType.Schema != nil {
+		respSchema = (mqswag.SchemaRef)(*(mediaType.Schema))
 	}
+	resultObj := t.decodeResponse(contentType, respBody, respSchema)
 
 	// Before returning from this function, we should set the test's expect value to that
 	// of actual result. This allows us to print out a result report that is the same format
@@ -502,7 +641,7 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 	}
 
 	if mqutil.Verbose {
-		fmt.Println("Verifying REST response")
+		t.println("Verifying REST response")
 	}
 	// success based on return status
 	success := (status >= 200 && status < 300)
@@ -512,84 +651,147 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 	}
 
 	testSuccess := success
-	var expectedStatus interface{} = StatusSuccess
-	if t.Expect != nil && t.Expect[ExpectStatus] != nil {
-		expectedStatus = t.Expect[ExpectStatus]
-		if expectedStatus == "fail" {
-			testSuccess = !success
-		} else if expectedStatusNum, ok := expectedStatus.(int); ok {
-			testSuccess = (expectedStatusNum == status)
+	expectedStatus, err := t.expectedStatus()
+	if err != nil {
+		return err
+	}
+	t.failureExpected = expectsFailure(expectedStatus)
+	if expectedStatus == "fail" {
+		testSuccess = !success
+	} else if expectedStatus == StatusSuccess {
+		testSuccess = success
+	} else if expectedStatusNum, ok := expectedStatus.(int); ok {
+		testSuccess = (expectedStatusNum == status)
+	} else if list, ok := expectedStatus.(string); ok {
+		// A string can be a list of codes, classes and ranges, e.g. "200,202", "3xx" or "200-204".
+		set, err := parseStatusSet(list)
+		if err != nil {
+			return err
 		}
+		testSuccess = set.contains(status)
 	}
 
 	greenSuccess := fmt.Sprintf("%vSuccess%v", mqutil.GREEN, mqutil.END)
 	redFail := fmt.Sprintf("%vFail%v", mqutil.RED, mqutil.END)
-	yellowFail := fmt.Sprintf("%vFail%v", mqutil.YELLOW, mqutil.END)
+
+	// Deleting an object that is already gone leaves the server in the state we wanted, so it's not
+	// a failure. Drop the object from the client DB too, so that the later tests don't look for it.
+	deleting := t.Method == mqswag.MethodDelete || (t.tag != nil && t.tag.Operation == mqswag.MethodDelete)
+	if deleting && status == StatusCodeNotFound && expectedStatus == StatusSuccess {
+		t.printf("... expecting status: %v got status: %d. Object already gone. %v API=%v Method=%v\n",
+			expectedStatus, status, greenSuccess, t.Path, t.Method)
+		for className, compArray := range t.comparisons {
+			for _, c := range compArray {
+				if len(c.oldUsed) > 0 {
+					t.ProcessOneComparison(className, mqswag.MethodDelete, c, nil, nil)
+				}
+			}
+		}
+		setExpect()
+		return nil
+	}
 	if testSuccess {
-		fmt.Printf("... expecting status: %v got status: %d. %v API=%v Method=%v\n", expectedStatus, status, greenSuccess, t.Path, t.Method)
+		t.printf("... expecting status: %v got status: %d. %v API=%v Method=%v\n", expectedStatus, status, greenSuccess, t.Path, t.Method)
 		if t.Expect != nil && t.Expect[ExpectBody] != nil {
 			testSuccess = mqutil.InterfaceEquals(t.Expect[ExpectBody], resultObj)
 			if testSuccess {
-				fmt.Printf("... checking body against test's expect value. Success\n")
+				t.printf("... checking body against test's expect value. Success\n")
 			} else {
-				mqutil.InterfacePrint(map[string]interface{}{"... expecting body": t.Expect[ExpectBody]}, true)
-				fmt.Printf("... actual response body: %s\n", respBody)
-				fmt.Printf("... checking body against test's expect value. Fail\n")
+				mqutil.InterfaceFprint(t.output(), map[string]interface{}{"... expecting body": t.Expect[ExpectBody]}, true)
+				t.printf("... actual response body: %s\n", respBody)
+				t.printf("... checking body against test's expect value. Fail\n")
 				ejson, _ := json.Marshal(t.Expect[ExpectBody])
 				setExpect()
 				return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf(
 					"=== test failed, expecting body: \n%s\ngot body:\n%s\n===", string(ejson), respBody))
 			}
 		}
+		if t.Echo && t.BodyParams != nil {
+			t.printf("... checking the response echoes the request body. ")
+			var bodySchema mqswag.SchemaRef
+			if _, mediaType := t.requestMediaType(); mediaType != nil {
+				bodySchema = (mqswag.SchemaRef)(*mediaType.Schema)
+			}
+			if mismatches := bodySchema.EchoMismatches("", t.BodyParams, resultObj, t.db.Swagger); len(mismatches) > 0 {
+				t.printf("%v\n", redFail)
+				t.responseError = fmt.Sprintf("response differs from the request body in: %s", strings.Join(mismatches, ", "))
+				setExpect()
+				return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("=== test failed, response differs from the request body in: %s ===",
+					strings.Join(mismatches, ", ")))
+			}
+			t.printf("%v\n", greenSuccess)
+		}
 	} else {
 		t.responseError = resp
-		fmt.Printf("... expecting status: %v got status: %d. %v\n", expectedStatus, status, redFail)
+		t.printf("... expecting status: %v got status: %d. %v\n", expectedStatus, status, redFail)
 		setExpect()
 		return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("=== test failed, response code %d ===", status))
 	}
 
+	// With NoValidate only the status is checked, the response body isn't validated against the schemas.
+	validate := !t.suite.plan.NoValidate
+
+	// In strict mode the server must never return writeOnly fields, such as passwords.
+	if validate && t.Strict && resultObj != nil && respSchema.Value != nil {
+		t.printf("... checking response for writeOnly fields. ")
+		if leaked := respSchema.AccessViolations("", resultObj, true, t.db.Swagger); len(leaked) > 0 {
+			t.printf("%v\n", redFail)
+			t.responseError = fmt.Sprintf("writeOnly fields returned by server: %s", strings.Join(leaked, ", "))
+			setExpect()
+			return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("=== test failed, server returned writeOnly fields: %s ===",
+				strings.Join(leaked, ", ")))
+		}
+		t.printf("%v\n", greenSuccess)
+	}
+
+	// RFC 7807 problem details must have valid standard members, whether the spec declares them or not.
+	if validate && isProblem && len(respBody) > 0 {
+		t.printf("... verifying problem details against the standard schema. ")
+		if err := mqswag.ValidateProblem(resultObj, status, t.matchOptions(true), t.db.Swagger); err != nil {
+			t.printf("%v\n", redFail)
+			mqutil.Logger.Printf("server returned invalid problem details: %s", err.Error())
+			t.schemaError = err
+			t.responseError = resp
+			setExpect()
+			return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("=== test failed, status %d problem details are invalid ===\n%s",
+				status, err.Error()))
+		}
+		t.printf("%v\n", greenSuccess)
+	}
+
 	// Check if the response obj and respSchema match
 	collection := make(map[string][]interface{})
 	objMatchesSchema := false
-	if resultObj != nil && respSchema.Value != nil {
-		fmt.Printf("... verifying response against openapi schema. ")
-		err := respSchema.Parses("", resultObj, collection, true, t.db.Swagger)
+	if validate && resultObj != nil && respSchema.Value != nil {
+		t.printf("... verifying response against openapi schema. ")
+		err := respSchema.Parses("", resultObj, collection, true, t.matchOptions(true), t.db.Swagger)
 		if err != nil {
-			fmt.Printf("%v\n", yellowFail)
+			t.printf("%v\n", redFail)
 			objMatchesSchema = true
 			specBytes, _ := json.MarshalIndent(respSpec, "", "    ")
 			mqutil.Logger.Printf("server response doesn't match swagger spec: \n%s", string(specBytes))
 			t.schemaError = err
 			if mqutil.Verbose {
-				// fmt.Printf("... openapi response schema: %s\n", string(specBytes))
-				// fmt.Printf("... response body: %s\n", string(respBody))
-				fmt.Println(err.Error())
+				t.println(err.Error())
 			}
-			// schemaError is already set. No need to treat it as a hard failure
+			// A malformed response fails the test, the run goes on with the next one.
+			t.responseError = resp
 			setExpect()
-			return nil
-
-			// We ignore this if the response is success, and the spec we used is the default. This is a strong
-			// indicator that the author didn't spec out all the success cases.
-			/* Don't treat this as a hard failure for now. Too common.
-			if !(useDefaultSpec && success) {
-				setExpect()
-				return err
-			}
-			*/
+			return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("=== test failed, status %d response doesn't match the schema ===\n%s",
+				status, err.Error()))
 		} else {
-			fmt.Printf("%v API=%v Method=%v\n", greenSuccess, t.Path, t.Method)
+			t.printf("%v API=%v Method=%v\n", greenSuccess, t.Path, t.Method)
 		}
 	}
-	if resultObj != nil && len(collection) == 0 && t.tag != nil && len(t.tag.Class) > 0 {
+	if validate && resultObj != nil && len(collection) == 0 && t.tag != nil && len(t.tag.Class) > 0 {
 		// try to resolve collection from the hint on the operation's description field.
 		classSchema := t.db.GetSchema(t.tag.Class)
 		if classSchema.Value != nil {
-			if classSchema.Matches(resultObj, t.db.Swagger) {
+			if classSchema.Matches(resultObj, t.matchOptions(false), t.db.Swagger) {
 				collection[t.tag.Class] = append(collection[t.tag.Class], resultObj)
 			} else {
 				callback := func(value map[string]interface{}) error {
-					if classSchema.Matches(value, t.db.Swagger) {
+					if classSchema.Matches(value, t.matchOptions(false), t.db.Swagger) {
 						collection[t.tag.Class] = append(collection[t.tag.Class], value)
 					}
 					return nil
@@ -613,7 +815,8 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 			}
 		}
 	}
-	if expectedStatus != StatusSuccess {
+	// The client DB is only updated when the call succeeded, with a 2xx status the test expects.
+	if expectedStatus != StatusSuccess && !(testSuccess && success) {
 		setExpect()
 		return nil
 	}
@@ -633,7 +836,7 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 		var propertyCollection map[string][]interface{}
 		if objMatchesSchema {
 			propertyCollection = make(map[string][]interface{})
-			respSchema.Parses("", resultObj, propertyCollection, false, t.db.Swagger)
+			respSchema.Parses("", resultObj, propertyCollection, false, t.matchOptions(false), t.db.Swagger)
 		}
 
 		for className, compList := range t.comparisons {
@@ -661,7 +864,7 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 								setExpect()
 								b, _ := json.Marshal(comp.new)
 								c, _ := json.Marshal(classList[0].(map[string]interface{}))
-								fmt.Printf("... checking GET result against client DB. Result not found on client. Fail\n")
+								t.printf("... checking GET result against client DB. Result not found on client. Fail\n")
 								t.responseError = fmt.Sprintf("Expected:\n%v\nFound:\n%v\n", string(b), string(c))
 								if len(classList) > 1 {
 									t.responseError = t.responseError.(string) + fmt.Sprintf("... and %v other objects.\n", len(classList)-1)
@@ -686,15 +889,16 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 		}
 		// Add all fields in the response (including extra ones like metadata) to comparisons list
 		for className, resultArray := range collection {
-			objTag := mqswag.MeqaTag{className, "", "", 0}
+			objTag := mqswag.MeqaTag{Class: className}
 			for _, c := range resultArray {
 				t.AddObjectComparison(&objTag, c.(map[string]interface{}), t.db.GetSchema(className))
 			}
 		}
 	}
 
-	// Associations are only for the objects that has one for each class and has an old object.
-	associations := make(map[string]map[string]interface{})
+	// The objects the test creates are associated with the test's associations, and those it gets are
+	// compared with the objects that have them.
+	associations := mqswag.CopyWithoutClass(t.Associations, "")
 	// TODO: Understand the need of asociations & comparisons and do things the right way
 	// for className, compArray := range t.comparisons {
 	// 	if len(compArray) == 1 && compArray[0].oldUsed != nil {
@@ -747,49 +951,97 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 }
 
 // SetRequestParameters sets the parameters. Returns the new request path.
-func (t *Test) SetRequestParameters(req *resty.Request) string {
+func (t *Test) SetRequestParameters(req *Request) (string, error) {
 	files := make(map[string]string)
-	for _, p := range t.op.Parameters {
-		if p.Value.Schema.Value.Type == "file" && t.FormParams[p.Value.Name] != nil {
-			// for swagger 2 file type can only be in formData
-			if fname, ok := t.FormParams[p.Value.Name].(string); ok {
-				files[p.Value.Name] = fname
-				delete(t.FormParams, p.Value.Name)
-			}
+	for name := range t.fileFields() {
+		if fname, ok := t.FormParams[name].(string); ok {
+			files[name] = fname
+			delete(t.FormParams, name)
 		}
 	}
 	if len(files) > 0 {
-		req.SetFiles(files)
+		req.Files = files
+	}
+	req.Multipart = t.multipart
+	if len(t.uploads) > 0 {
+		req.Uploads = t.uploads
 	}
 	if len(t.FormParams) > 0 {
-		req.SetFormData(mqutil.MapInterfaceToMapString(t.FormParams))
-		mqutil.InterfacePrint(map[string]interface{}{"formParams": t.FormParams}, mqutil.Verbose)
+		req.Form = mqutil.MapInterfaceToMapString(t.FormParams)
+		mqutil.InterfaceFprint(t.output(), map[string]interface{}{"formParams": t.FormParams}, mqutil.Verbose)
 	}
 	for k, v := range files {
 		t.FormParams[k] = v
 	}
 
 	if len(t.QueryParams) > 0 {
-		req.SetQueryParams(mqutil.MapInterfaceToMapString(t.QueryParams))
-		mqutil.InterfacePrint(map[string]interface{}{"queryParams": t.QueryParams}, mqutil.Verbose)
+		req.Query = mqutil.MapInterfaceToMapString(t.styledParams(t.QueryParams, spec.ParameterInQuery))
+		mqutil.InterfaceFprint(t.output(), map[string]interface{}{"queryParams": t.QueryParams}, mqutil.Verbose)
 	}
 	if t.BodyParams != nil {
-		req.SetBody(t.BodyParams)
-		mqutil.InterfacePrint(map[string]interface{}{"bodyParams": t.BodyParams}, mqutil.Verbose)
+		req.Body = t.BodyParams
+		if _, isString := t.BodyParams.(string); !isString && mqutil.IsXmlMediaType(t.contentType) {
+			body, err := t.xmlBody()
+			if err != nil {
+				return "", err
+			}
+			req.Body = body
+		}
+		mqutil.InterfaceFprint(t.output(), map[string]interface{}{"bodyParams": t.BodyParams}, mqutil.Verbose)
+	}
+	if len(t.contentType) > 0 {
+		req.Header.Set("Content-Type", t.contentType)
+	}
+	if accept := t.acceptType(); len(accept) > 0 {
+		req.Header.Set("Accept", accept)
 	}
 	if len(t.HeaderParams) > 0 {
-		req.SetHeaders(mqutil.MapInterfaceToMapString(t.HeaderParams))
-		mqutil.InterfacePrint(map[string]interface{}{"headerParams": t.HeaderParams}, mqutil.Verbose)
+		for k, v := range mqutil.MapInterfaceToMapString(t.styledParams(t.HeaderParams, spec.ParameterInHeader)) {
+			req.Header.Set(k, v)
+		}
+		mqutil.InterfaceFprint(t.output(), map[string]interface{}{"headerParams": t.HeaderParams}, mqutil.Verbose)
 	}
-	path := t.Path
 	if len(t.PathParams) > 0 {
-		PathParamsStr := mqutil.MapInterfaceToMapString(t.PathParams)
-		for k, v := range PathParamsStr {
-			path = strings.Replace(path, "{"+k+"}", v, -1)
+		mqutil.InterfaceFprint(t.output(), map[string]interface{}{"pathParams": t.PathParams}, mqutil.Verbose)
+	}
+	return t.SubstitutePathParams()
+}
+
+// pathPlaceholderRegexp matches the {name} placeholders in a path.
+var pathPlaceholderRegexp = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// SubstitutePathParams replaces the {name} placeholders in the test's path with the escaped path parameter
+// values. It fails when a placeholder has no value.
+func (t *Test) SubstitutePathParams() (string, error) {
+	values := mqutil.MapInterfaceToMapString(t.styledParams(t.PathParams, spec.ParameterInPath))
+	path := t.Path
+	if t.op != nil {
+		for _, p := range t.op.Parameters {
+			if p.Value.In != "path" {
+				continue
+			}
+			v, ok := values[p.Value.Name]
+			if !ok {
+				return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("path parameter {%s} of %s is not set", p.Value.Name, t.Path))
+			}
+			path = strings.Replace(path, "{"+p.Value.Name+"}", url.PathEscape(v), -1)
 		}
-		mqutil.InterfacePrint(map[string]interface{}{"pathParams": t.PathParams}, mqutil.Verbose)
 	}
-	return path
+	// The test can also set the placeholders the spec doesn't declare.
+	var missing string
+	path = pathPlaceholderRegexp.ReplaceAllStringFunc(path, func(placeholder string) string {
+		if v, ok := values[placeholder[1:len(placeholder)-1]]; ok {
+			return url.PathEscape(v)
+		}
+		if len(missing) == 0 {
+			missing = placeholder
+		}
+		return placeholder
+	})
+	if len(missing) > 0 {
+		return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("path parameter %s of %s is not set", missing, t.Path))
+	}
+	return path, nil
 }
 
 func (t *Test) CopyParent(parentTest *Test) {
@@ -821,9 +1073,50 @@ func (t *Test) CopyParent(parentTest *Test) {
 	}
 }
 
+// requestMediaType picks the media type of the request body to generate: application/json if the
+// operation takes it, then the other JSON types, the XML types and */*. Returns the content type to send,
+// which is empty for application/json, and nil when the operation takes neither JSON nor XML.
+func (t *Test) requestMediaType() (string, *spec.MediaType) {
+	if t.op == nil || t.op.RequestBody == nil || t.op.RequestBody.Value == nil {
+		return "", nil
+	}
+	content := t.op.RequestBody.Value.Content
+	if m := content[mqswag.JsonResponse]; m != nil && m.Schema != nil {
+		return "", m
+	}
+	var names []string
+	for name, m := range content {
+		if m != nil && m.Schema != nil && mqswag.IsJsonMediaType(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return names[0], content[names[0]]
+	}
+	// The XML bodies are generated the same way, and written as XML when they're sent.
+	for name, m := range content {
+		if m != nil && m.Schema != nil && mqutil.IsXmlMediaType(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return names[0], content[names[0]]
+	}
+	if m := content["*/*"]; m != nil && m.Schema != nil {
+		return mqswag.JsonResponse, m
+	}
+	return "", nil
+}
+
 // Often, requests require a unique field. Here, we generate and assign a new one randomly
 func (t *Test) generateUniqueKeys(bodyMap map[string]interface{}) {
-	bodySchema := (mqswag.SchemaRef)(*t.op.RequestBody.Value.Content[mqswag.JsonResponse].Schema)
+	_, mediaType := t.requestMediaType()
+	if mediaType == nil {
+		return
+	}
+	bodySchema := (mqswag.SchemaRef)(*mediaType.Schema)
 	propSchemas := bodySchema.GetProperties(t.db.Swagger)
 	for uniqueKey := range mqswag.UniqueKeys {
 		if _, ok := propSchemas[uniqueKey]; ok {
@@ -836,7 +1129,7 @@ func (t *Test) generateUniqueKeys(bodyMap map[string]interface{}) {
 // When fuzzing, a lot of assets are created which are cleaned up by this func
 func deleteResource(t *Test) {
 	var result map[string]interface{}
-	json.Unmarshal([]byte(t.resp.String()), &result)
+	mqutil.DecodeJson(t.resp.Body(), &result)
 	if id, ok := result["id"]; ok {
 		t.Method = mqswag.MethodDelete
 		t.BodyParams = nil
@@ -900,10 +1193,10 @@ func fuzzRequest(t *Test, copyMap map[string]interface{}, fkey, fuzzType string,
 		failChan <- payload
 		b, err := json.Marshal(t.BodyParams)
 		if err != nil {
-			fmt.Println(err.Error())
+			t.println(err.Error())
 			return
 		}
-		fmt.Printf("Expecting %v; Got %v: %v\nRequest Body: %v\n", expectStatus, t.resp.StatusCode(), t.resp.String(), string(b))
+		t.printf("Expecting %v; Got %v: %v\nRequest Body: %v\n", expectStatus, t.resp.StatusCode(), t.resp.String(), string(b))
 	}
 	// If the object was created, delete it
 	if t.Method == mqswag.MethodPost && t.resp.StatusCode() == StatusCodeOk {
@@ -914,7 +1207,7 @@ func fuzzRequest(t *Test, copyMap map[string]interface{}, fkey, fuzzType string,
 // Returns a list of values to be fuzzed for each field in the request body
 func (t *Test) getSamples() (map[string][]mqutil.FuzzValue, int) {
 	samples, totalTests := make(map[string][]mqutil.FuzzValue), 1
-	if t.BodyParams != nil {
+	if _, ok := t.BodyParams.(map[string]interface{}); ok {
 		history := t.suite.plan.OldFailuresMap[t.Path][t.Method]
 		if t.suite.plan.Repro {
 			// Return values from previous failures
@@ -945,8 +1238,11 @@ func (t *Test) getSamples() (map[string][]mqutil.FuzzValue, int) {
 func fuzzTest(baseTest *Test) ([]*mqswag.Payload, error) {
 	samples, totalTests := baseTest.getSamples()
 	inParallel := baseTest.Method != mqswag.MethodPut
-	fmt.Printf("Executing tests: %v\nIn parallel: %v\n", totalTests, inParallel)
-	baseTest.suite.plan.ResultCounts[mqutil.FuzzTotal] += totalTests - 1 // Excluding baseTest
+	baseTest.printf("Executing tests: %v\nIn parallel: %v\n", totalTests, inParallel)
+	plan := baseTest.suite.plan
+	plan.mutex.Lock()
+	plan.ResultCounts[mqutil.FuzzTotal] += totalTests - 1 // Excluding baseTest
+	plan.mutex.Unlock()
 	baseCopy := baseTest.Duplicate()
 	errPositive := baseTest.Do()
 	failChan := make(chan *mqswag.Payload, totalTests)
@@ -981,125 +1277,272 @@ func fuzzTest(baseTest *Test) ([]*mqswag.Payload, error) {
 	return payloads, errPositive
 }
 
+// CheckRequestAccess verifies that the request body doesn't set any readOnly fields.
+func (t *Test) CheckRequestAccess() error {
+	if t.BodyParams == nil || t.op == nil || t.op.RequestBody == nil || t.op.RequestBody.Value == nil {
+		return nil
+	}
+	_, mediaType := t.requestMediaType()
+	if mediaType == nil {
+		return nil
+	}
+	bodySchema := (mqswag.SchemaRef)(*mediaType.Schema)
+	if violations := bodySchema.AccessViolations("", t.BodyParams, false, t.db.Swagger); len(violations) > 0 {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("request sets readOnly fields: %s", strings.Join(violations, ", ")))
+	}
+	return nil
+}
+
 func (t *Test) Do() error {
 	tc := t.suite
-	req := resty.R()
-	if len(tc.ApiToken) > 0 {
-		req.SetAuthToken(tc.ApiToken)
-	} else if len(tc.Username) > 0 {
-		req.SetBasicAuth(tc.Username, tc.Password)
+	if t.Strict {
+		if err := t.CheckRequestAccess(); err != nil {
+			t.err = err
+			return t.ProcessResult(nil)
+		}
 	}
-
-	path := tc.plan.BaseURL + t.SetRequestParameters(req)
-	var resp *resty.Response
-	var err error
-	fmt.Printf("calling API=%v Method=%v\n", t.Path, t.Method)
+	if !isKnownMethod(t.Method) {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Unknown method in test %s: %v", t.Name, t.Method))
+	}
+	req := NewRequest()
+	req.Method = t.Method
+	path, err := t.SetRequestParameters(req)
+	if err != nil {
+		t.err = err
+		return t.ProcessResult(nil)
+	}
+	t.setAuth(req)
+	req.URL = tc.plan.GetBaseURL() + path
+	req.Timeout = tc.plan.Timeout
+	if req.MaxRedirects, err = t.maxRedirects(); err != nil {
+		t.err = err
+		return t.ProcessResult(nil)
+	}
+	tc.sendCookies(req)
+
+	client := t.getClient()
+	var resp *Response
+	t.printf("calling API=%v Method=%v\n", t.Path, t.Method)
+	policy := t.retryPolicy()
+	statusRetries := 0
 	for retries := 1; retries <= MaxRetries; retries++ {
 		t.startTime = time.Now()
-		switch t.Method {
-		case mqswag.MethodGet:
-			resp, err = req.Get(path)
-		case mqswag.MethodPost:
-			resp, err = req.Post(path)
-		case mqswag.MethodPut:
-			resp, err = req.Put(path)
-		case mqswag.MethodDelete:
-			resp, err = req.Delete(path)
-		case mqswag.MethodPatch:
-			resp, err = req.Patch(path)
-		case mqswag.MethodHead:
-			resp, err = req.Head(path)
-		case mqswag.MethodOptions:
-			resp, err = req.Options(path)
-		default:
-			return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Unknown method in test %s: %v", t.Name, t.Method))
-		}
+		resp, err = client.Do(req)
 		t.stopTime = time.Now()
-		fmt.Printf("... call completed: %f seconds. Status=%v, API=%v Method=%v\n", t.stopTime.Sub(t.startTime).Seconds(), resp.StatusCode(), t.Path, t.Method)
-		if err == nil && resp.StatusCode() != StatusCodeTooManyRequests {
+		tc.keepCookies(req, resp)
+		if mqutil.Verbose {
+			t.logExchange(req, resp, err)
+		}
+		t.printf("... call completed: %f seconds. Status=%v, API=%v Method=%v\n", t.stopTime.Sub(t.startTime).Seconds(), resp.StatusCode(), t.Path, t.Method)
+		if err == nil && policy.shouldRetry(t.Method, resp.StatusCode(), statusRetries) {
+			// The status retries have their own count and backoff.
+			statusRetries++
+			retries--
+			delay := policy.delay(statusRetries)
+			t.printf("... retry %d of %d in %v\n", statusRetries, policy.Retries, delay)
+			time.Sleep(delay)
+			continue
+		}
+		if (err == nil && resp.StatusCode() != StatusCodeTooManyRequests) || IsTimeout(err) {
+			// A hung endpoint isn't tried again, the run goes on with the next test.
 			break
 		}
-		req.Header["Cookie"] = nil
+		req.Header.Del("Cookie")
 		time.Sleep(time.Millisecond * (time.Duration)(1000+rand.Intn(3000*retries)))
 	}
-	if err != nil {
+	if IsTimeout(err) {
+		t.err = mqutil.NewError(mqutil.ErrHttp, fmt.Sprintf("the request timed out after %v: %s", req.Timeout, err.Error()))
+	} else if err != nil {
 		t.err = mqutil.NewError(mqutil.ErrHttp, err.Error())
-	} else {
+	} else if !mqutil.Verbose {
 		mqutil.Logger.Print(resp.Status())
 		mqutil.Logger.Println(string(resp.Body()))
 	}
+	if t.out != nil {
+		// The quiet mode only shows the output of the failed tests, so it includes the whole exchange.
+		t.printExchange(req, resp)
+	}
 	err = t.ProcessResult(resp)
+	if err == nil && t.Paginate && t.Method == mqswag.MethodGet && t.err == nil && resp.StatusCode() < 300 {
+		if err = t.checkPages(client, req, resp); err != nil {
+			t.printf("%vFail%v\n", mqutil.RED, mqutil.END)
+			t.responseError = err.Error()
+		}
+	}
+	if err == nil && len(t.FollowLinks) > 0 && t.err == nil && resp.StatusCode() < 300 {
+		if err = t.followLinks(client, req, resp); err != nil {
+			t.printf("%vFail%v\n", mqutil.RED, mqutil.END)
+			t.responseError = err.Error()
+		}
+	}
 	return err
 }
 
-// Run runs the test. Returns the test result.
-func (t *Test) Run(tc *TestSuite) ([]*mqswag.Payload, error) {
+// printExchange prints the request and the response, without the credentials.
+func (t *Test) printExchange(req *Request, resp *Response) {
+	t.printf("... request: %s %s\n", strings.ToUpper(req.Method), req.URL)
+	for k, v := range req.Header {
+		t.printf("        %s: %s\n", k, t.redact(mqutil.RedactHeader(k, strings.Join(v, ", "))))
+	}
+	if len(req.Query) > 0 {
+		t.printf("        query: %v\n", t.redact(fmt.Sprint(req.Query)))
+	}
+	if len(req.Form) > 0 {
+		t.printf("        form: %v\n", req.Form)
+	}
+	if req.Body != nil {
+		b, _ := json.Marshal(req.Body)
+		t.printf("        body: %s\n", b)
+	}
+	t.printf("... response: status %d\n", resp.StatusCode())
+	for k, v := range resp.Header() {
+		t.printf("        %s: %s\n", k, mqutil.RedactHeader(k, strings.Join(v, ", ")))
+	}
+	if body := resp.String(); len(body) > 0 {
+		t.printf("        body: %s\n", body)
+	}
+}
+
+// getClient returns the client the test sends its requests through.
+func (t *Test) getClient() Client {
+	if t.client == nil {
+		return t.suite.plan.GetClient()
+	}
+	return t.client
+}
+
+// Run runs the test, sending the requests through the client shared by the run. Returns the test result.
+func (t *Test) Run(tc *TestSuite, client Client) ([]*mqswag.Payload, error) {
+	t.client = client
 
 	mqutil.Logger.Print("\n--- " + t.Name)
-	fmt.Printf("\nRunning test case: %s\n", t.Name)
+	t.printf("\nRunning test case: %s\n", t.Name)
 	err := t.ResolveParameters(tc)
 	if err != nil {
-		fmt.Printf("... Fail\n... %s\n", err.Error())
+		t.printf("... Fail\n... %s\n", err.Error())
 		return nil, err
 	}
 	return fuzzTest(t)
 }
 
-func StringParamsResolveWithHistory(str string, h *TestHistory) interface{} {
-	begin := strings.Index(str, "{{")
-	end := strings.Index(str, "}}")
-	if end > begin {
-		ar := strings.Split(strings.Trim(str[begin+2:end], " "), ".")
+// historyRefRegexp matches the references to the parameters and responses of the earlier tests.
+var historyRefRegexp = regexp.MustCompile(`{{([^{}]*)}}`)
+
+// StringParamsResolveWithHistory resolves the references in str, in the form of {{testName.paramSection.paramName}},
+// e.g. {{create pet.response.id}} or {{list.outputs.items.0.id}}. A string that is only a reference becomes the value
+// it refers to, otherwise the values are put into the string. Returns nil if there is no reference in str.
+func StringParamsResolveWithHistory(str string, h *TestHistory) (interface{}, error) {
+	resolve := func(ref string) (interface{}, error) {
+		ar := strings.Split(strings.Trim(ref, " "), ".")
 		if len(ar) < 3 {
 			mqutil.Logger.Printf("invalid parameter: {{%s}}, the format is {{testName.paramSection.paramName}}, e.g. {{test1.output.id}}",
-				str[begin+2:end])
-			return nil
+				ref)
+			return nil, nil
 		}
 		t := h.GetTest(ar[0])
-		if t != nil {
-			return t.GetParam(ar[1:])
+		if t == nil {
+			return nil, mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("can't resolve {{%s}}, there is no earlier test named %s", ref, ar[0]))
+		}
+		value := t.GetParam(ar[1:])
+		if value == nil {
+			return nil, mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("can't resolve {{%s}}, test %s has no %s", ref, ar[0],
+				strings.Join(ar[1:], ".")))
 		}
+		return value, nil
 	}
-	return nil
+
+	matches := historyRefRegexp.FindAllStringSubmatchIndex(str, -1)
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(str) {
+		return resolve(str[matches[0][2]:matches[0][3]])
+	}
+	var result string
+	last := 0
+	for _, m := range matches {
+		value, err := resolve(str[m[2]:m[3]])
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			continue
+		}
+		result += str[last:m[0]] + mqutil.InterfaceToJsonString(value)
+		last = m[1]
+	}
+	if last == 0 {
+		return nil, nil
+	}
+	return result + str[last:], nil
 }
 
-func MapParamsResolveWithHistory(paramMap map[string]interface{}, h *TestHistory) {
+func MapParamsResolveWithHistory(paramMap map[string]interface{}, h *TestHistory) error {
 	for k, v := range paramMap {
 		if str, ok := v.(string); ok {
-			if result := StringParamsResolveWithHistory(str, h); result != nil {
+			result, err := StringParamsResolveWithHistory(str, h)
+			if err != nil {
+				return err
+			}
+			if result != nil {
 				paramMap[k] = result
 			}
+		} else if m, ok := v.(map[string]interface{}); ok {
+			if err := MapParamsResolveWithHistory(m, h); err != nil {
+				return err
+			}
+		} else if a, ok := v.([]interface{}); ok {
+			if err := ArrayParamsResolveWithHistory(a, h); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
 }
 
-func ArrayParamsResolveWithHistory(paramArray []interface{}, h *TestHistory) {
+func ArrayParamsResolveWithHistory(paramArray []interface{}, h *TestHistory) error {
 	for i, param := range paramArray {
 		if paramMap, ok := param.(map[string]interface{}); ok {
-			MapParamsResolveWithHistory(paramMap, h)
+			if err := MapParamsResolveWithHistory(paramMap, h); err != nil {
+				return err
+			}
 		} else if str, ok := param.(string); ok {
-			if result := StringParamsResolveWithHistory(str, h); result != nil {
+			result, err := StringParamsResolveWithHistory(str, h)
+			if err != nil {
+				return err
+			}
+			if result != nil {
 				paramArray[i] = result
 			}
 		}
 	}
+	return nil
 }
 
-func (t *Test) ResolveHistoryParameters(h *TestHistory) {
-	MapParamsResolveWithHistory(t.PathParams, h)
-	MapParamsResolveWithHistory(t.FormParams, h)
-	MapParamsResolveWithHistory(t.HeaderParams, h)
-	MapParamsResolveWithHistory(t.QueryParams, h)
+// ResolveHistoryParameters resolves the references to the earlier tests in the parameters. A reference that
+// can't be resolved is an ErrNotFound error.
+func (t *Test) ResolveHistoryParameters(h *TestHistory) error {
+	for _, params := range []map[string]interface{}{t.PathParams, t.FormParams, t.HeaderParams, t.QueryParams} {
+		if err := MapParamsResolveWithHistory(params, h); err != nil {
+			return err
+		}
+	}
+	for _, obj := range t.Associations {
+		if err := MapParamsResolveWithHistory(obj, h); err != nil {
+			return err
+		}
+	}
 	if bodyMap, ok := t.BodyParams.(map[string]interface{}); ok {
-		MapParamsResolveWithHistory(bodyMap, h)
+		return MapParamsResolveWithHistory(bodyMap, h)
 	} else if bodyArray, ok := t.BodyParams.([]interface{}); ok {
-		ArrayParamsResolveWithHistory(bodyArray, h)
+		return ArrayParamsResolveWithHistory(bodyArray, h)
 	} else if bodyStr, ok := t.BodyParams.(string); ok {
-		result := StringParamsResolveWithHistory(bodyStr, h)
+		result, err := StringParamsResolveWithHistory(bodyStr, h)
+		if err != nil {
+			return err
+		}
 		if result != nil {
 			t.BodyParams = result
 		}
 	}
+	return nil
 }
 
 // ParamsAdd adds the parameters from src to dst if the param doesn't already exist on dst.
@@ -1127,14 +1570,17 @@ func ParamsAdd(dst spec.Parameters, src spec.Parameters) spec.Parameters {
 // The resolved parameters will be added to test.Parameters map.
 func (t *Test) ResolveParameters(tc *TestSuite) error {
 	pathItem := t.db.Swagger.Paths[t.Path]
-	t.op = GetOperationByMethod(pathItem, t.Method)
-	if t.op == nil {
+	op := GetOperationByMethod(pathItem, t.Method)
+	if op == nil {
 		return mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("Path %s not found in swagger file", t.Path))
 	}
-	fmt.Printf("... resolving parameters.\n")
+	t.printf("... resolving parameters.\n")
 
-	// There can be parameters at the path level. We merge these with the operation parameters.
-	t.op.Parameters = ParamsAdd(t.op.Parameters, pathItem.Parameters)
+	// There can be parameters at the path level. We merge these with the operation parameters, in a copy
+	// of the operation since the tests share it and may run in parallel.
+	merged := *op
+	merged.Parameters = ParamsAdd(append(spec.Parameters{}, op.Parameters...), pathItem.Parameters)
+	t.op = &merged
 
 	t.tag = mqswag.GetMeqaTag(t.op.Description)
 
@@ -1142,7 +1588,31 @@ func (t *Test) ResolveParameters(tc *TestSuite) error {
 	var globalParamsMap map[string]interface{}
 	var err error
 	var genParam interface{}
-	if t.op.RequestBody != nil {
+	bodyContentType, bodyMediaType := t.requestMediaType()
+	if t.op.RequestBody != nil && bodyMediaType == nil && t.op.RequestBody.Value.Content[mqswag.JsonPatch] != nil {
+
+		t.contentType = mqswag.JsonPatch
+		if t.BodyParams == nil {
+			t.BodyParams, err = t.GenerateJsonPatch()
+			if err != nil {
+				return err
+			}
+		} else {
+			t.print("provided\n")
+		}
+	} else if formType, formMediaType := t.requestFormType(); bodyMediaType == nil && formMediaType != nil {
+		if err = t.resolveFormBody(tc, formType, formMediaType); err != nil {
+			return err
+		}
+	} else if otherType, otherMediaType := t.requestOtherType(); bodyMediaType == nil && otherMediaType != nil {
+		if err = t.resolveOtherBody(otherType, otherMediaType); err != nil {
+			return err
+		}
+	} else if t.op.RequestBody != nil {
+		if bodyMediaType == nil {
+			return mqutil.NewError(mqutil.ErrInvalid, "the request body has no media type")
+		}
+		t.contentType = bodyContentType
 		var bodyMap map[string]interface{}
 		bodyIsMap := false
 		if t.BodyParams != nil {
@@ -1150,7 +1620,7 @@ func (t *Test) ResolveParameters(tc *TestSuite) error {
 		}
 		if t.BodyParams != nil && !bodyIsMap {
 			// Body is not map, we use it directly.
-			bodySchema := (mqswag.SchemaRef)(*t.op.RequestBody.Value.Content[mqswag.JsonResponse].Schema)
+			bodySchema := (mqswag.SchemaRef)(*bodyMediaType.Schema)
 			paramTag, schema := t.db.Swagger.GetSchemaRootType(bodySchema, mqswag.GetMeqaTag(bodySchema.Value.Description))
 			if schema.Value != nil && paramTag != nil {
 				objarray, _ := t.BodyParams.([]interface{})
@@ -1161,12 +1631,10 @@ func (t *Test) ResolveParameters(tc *TestSuite) error {
 					}
 				}
 			}
-			fmt.Print("provided\n")
+			t.print("provided\n")
 		} else {
-			if _, ok := t.op.RequestBody.Value.Content[mqswag.JsonResponse]; !ok {
-				return mqutil.NewError(mqutil.ErrInvalid, "Unsupported type")
-			}
-			bodyParam := &spec.Parameter{Schema: t.op.RequestBody.Value.Content[mqswag.JsonResponse].Schema}
+			bodyParam := &spec.Parameter{Schema: bodyMediaType.Schema, Example: bodyMediaType.Example,
+				Examples: bodyMediaType.Examples, ExtensionProps: bodyMediaType.ExtensionProps}
 			genParam, err = t.GenerateParameter(bodyParam, t.db)
 			if err != nil {
 				return err
@@ -1177,13 +1645,25 @@ func (t *Test) ResolveParameters(tc *TestSuite) error {
 					bodyMap = mqutil.MapAdd(bodyMap, tcBodyMap)
 				}
 				t.BodyParams = mqutil.MapReplace(genMap, bodyMap)
+				if t.Partial && t.Method == mqswag.MethodPatch {
+					// A partial update only sends the fields that are set. The generated map is also what
+					// the DB gets updated with, so the fields left out stay as they are.
+					for k := range genMap {
+						if _, ok := bodyMap[k]; !ok {
+							delete(genMap, k)
+						}
+					}
+				}
+				for _, k := range t.Omit {
+					delete(genMap, k)
+				}
 			} else {
 				t.BodyParams = genParam
 			}
 		}
 	}
 	for _, params := range t.op.Parameters {
-		fmt.Printf("        %s (in %s): ", params.Value.Name, params.Value.In)
+		t.printf("        %s (in %s): ", params.Value.Name, params.Value.In)
 		switch params.Value.In {
 		case "path":
 			if t.PathParams == nil {
@@ -1216,26 +1696,135 @@ func (t *Test) ResolveParameters(tc *TestSuite) error {
 		_, inGlobal := globalParamsMap[params.Value.Name]
 		if !inLocal && inGlobal {
 			paramsMap[params.Value.Name] = globalParamsMap[params.Value.Name]
+		} else if !inLocal && params.Value.In == "path" {
+			if tenant, ok := tc.plan.GetTenantParam(params.Value.Name); ok {
+				paramsMap[params.Value.Name] = tenant
+			}
 		}
 		if o, ok := paramsMap[params.Value.Name]; ok {
 			if o != nil {
 				t.AddBasicComparison(mqswag.GetMeqaTag(params.Value.Description), params.Value, paramsMap[params.Value.Name])
-				fmt.Print("provided\n")
+				t.print("provided\n")
 			} else {
 				delete(paramsMap, params.Value.Name)
-				fmt.Print("skipping\n")
+				t.print("skipping\n")
 			}
 			continue
 		}
+		if isFileSchema(params.Value.Schema) {
+			f := t.generateFile(params.Value.Name)
+			t.printf("%d random bytes of %s\n", len(f.Data), f.ContentType)
+			continue
+		}
 		genParam, err = t.GenerateParameter(params.Value, t.db)
 		if err != nil {
 			return err
 		}
 		paramsMap[params.Value.Name] = genParam
 	}
+	if len(t.Violate) > 0 {
+		return t.applyViolation()
+	}
 	return err
 }
 
+// patchClass returns the class of the object an operation patches.
+func (t *Test) patchClass() string {
+	if t.tag != nil && len(t.tag.Class) > 0 {
+		return t.tag.Class
+	}
+	for status, respSpec := range t.op.Responses {
+		if !strings.HasPrefix(status, "2") || respSpec.Value == nil || respSpec.Value.Content[mqswag.JsonResponse] == nil {
+			continue
+		}
+		respSchema := (mqswag.SchemaRef)(*respSpec.Value.Content[mqswag.JsonResponse].Schema)
+		tag, _ := t.db.Swagger.GetSchemaRootType(respSchema, mqswag.GetMeqaTag(respSchema.Value.Description))
+		if tag != nil && len(tag.Class) > 0 {
+			return tag.Class
+		}
+	}
+	return ""
+}
+
+// selectFunc returns the MatchFunc that picks the objects of the class for the test, MatchAlways unless
+// the test selects them.
+func (t *Test) selectFunc(class string) (mqswag.MatchFunc, error) {
+	query, ok := t.Select[class]
+	if !ok {
+		return mqswag.MatchAlways, nil
+	}
+	matches, err := query.Compile()
+	if err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the select of %s in test %s - %s", class, t.Name, err.Error()))
+	}
+	return matches, nil
+}
+
+// GenerateJsonPatch generates a JSON patch (RFC 6902) document that replaces some fields of an existing
+// object in the DB. The same patch is applied to the object and recorded as a comparison, so that the DB
+// entry is updated the way we expect the server to update it.
+func (t *Test) GenerateJsonPatch() ([]interface{}, error) {
+	class := t.patchClass()
+	if len(class) == 0 {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("can't find the object patched by %s %s", t.Method, t.Path))
+	}
+	matches, err := t.selectFunc(class)
+	if err != nil {
+		return nil, err
+	}
+	objList := t.suite.db.Find(class, nil, t.Associations, matches, -1)
+	if len(objList) == 0 {
+		objList = t.db.Find(class, nil, t.Associations, matches, -1)
+	}
+	if len(objList) == 0 {
+		return nil, mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("no %s object found to patch", class))
+	}
+	obj, _ := objList[mqutil.Rand.Intn(len(objList))].(map[string]interface{})
+	schema := t.db.GetSchema(class)
+	properties := schema.GetProperties(t.db.Swagger)
+	var keys []string
+	for k := range obj {
+		if p := properties[k]; p != nil && p.Value != nil && !p.Value.ReadOnly {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("%s object has no field to patch", class))
+	}
+	sort.Strings(keys)
+	mqutil.Rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	keys = keys[:1+mqutil.Rand.Intn(len(keys))]
+
+	var patch []interface{}
+	for _, k := range keys {
+		value, err := t.GenerateSchema(k, nil, (mqswag.SchemaRef)(*properties[k]), t.db, 0)
+		if err != nil {
+			return nil, err
+		}
+		patch = append(patch, map[string]interface{}{
+			"op":    mqutil.PatchReplace,
+			"path":  "/" + mqutil.JsonPointerEscape(k),
+			"value": value,
+		})
+	}
+	patched, err := mqutil.JsonPatchApply(obj, patch)
+	if err != nil {
+		return nil, err
+	}
+	t.comparisons[class] = append(t.comparisons[class], &Comparison{obj, mqutil.MapCopy(obj), patched, schema})
+	mqutil.InterfaceFprint(t.output(), map[string]interface{}{"jsonPatch": patch}, mqutil.Verbose)
+	return patch, nil
+}
+
+func isKnownMethod(method string) bool {
+	for _, m := range mqswag.MethodAll {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
 func GetOperationByMethod(item *spec.PathItem, method string) *spec.Operation {
 	switch method {
 	case mqswag.MethodGet:
@@ -1259,27 +1848,63 @@ func GetOperationByMethod(item *spec.PathItem, method string) *spec.Operation {
 // GenerateParameter generates paramter value based on the spec.
 func (t *Test) GenerateParameter(paramSpec *spec.Parameter, db *mqswag.DB) (interface{}, error) {
 	tag := mqswag.GetMeqaTag(paramSpec.Description)
-	if paramSpec.Schema != nil {
-		return t.GenerateSchema(paramSpec.Name, tag, (mqswag.SchemaRef)(*paramSpec.Schema), db, 3)
+	schemaRef := parameterSchema(paramSpec)
+	if schemaRef == nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("parameter %s has no schema", paramSpec.Name))
 	}
-	if len(paramSpec.Schema.Value.Enum) != 0 {
-		fmt.Print("enum\n")
-		return generateEnum(paramSpec.Schema.Value.Enum)
+	schema := (mqswag.SchemaRef)(*schemaRef)
+	if tag == nil {
+		tag = mqswag.GetMeqaTag(schema.Value.Description)
+	}
+	// A simple parameter tagged with an object's property refers to an existing object, generateByType
+	// looks it up. Everything else, the inline objects and arrays included, is generated from its schema.
+	isReference := tag != nil && len(tag.Property) > 0 && len(schema.Value.Type) > 0 &&
+		schema.Value.Type != gojsonschema.TYPE_OBJECT && schema.Value.Type != gojsonschema.TYPE_ARRAY
+	if !isReference {
+		example, ok := declaredExample(paramSpec.Example, paramSpec.Examples, paramSpec.Extensions)
+		if ok && !t.suite.plan.NoExamples {
+			value, ok := t.generateDeclared("example", example, tag, schema, db.Swagger)
+			if ok {
+				t.print("example\n")
+				return value, nil
+			}
+		}
+		return t.GenerateSchema(paramSpec.Name, tag, schema, db, 3)
 	}
-	if len(paramSpec.Schema.Value.Type) == 0 {
-		return nil, mqutil.NewError(mqutil.ErrInvalid, "Parameter doesn't have type")
+	if len(schema.Value.Enum) != 0 {
+		t.print("enum\n")
+		return generateEnum(schema.Value)
 	}
+	return t.generateByType(schema, paramSpec.Name, tag, paramSpec, true)
+}
 
-	// construct a full schema from simple ones
-	schema := (mqswag.SchemaRef)(*paramSpec.Schema)
-	if paramSpec.Schema.Value.Type == gojsonschema.TYPE_OBJECT {
-		return t.generateObject("", tag, schema, db, 3)
+// findReferenced finds an existing object of the tag's class for a value that refers to it, one of the
+// objects the test already uses if it can, otherwise one from the DB. isNew tells that the comparison
+// returned isn't one of the test's yet. Returns nil when there's no object to refer to, and an error when the
+// test's select or associations require one.
+func (t *Test) findReferenced(tag *mqswag.MeqaTag) (comp *Comparison, isNew bool, err error) {
+	matches, err := t.selectFunc(tag.Class)
+	if err != nil {
+		return nil, false, err
 	}
-	if paramSpec.Schema.Value.Type == gojsonschema.TYPE_ARRAY {
-		return t.generateArray("", tag, schema, db, 3)
+	for _, c := range t.comparisons[tag.Class] {
+		if c.old != nil && matches(nil, c.old) {
+			return c, false, nil
+		}
 	}
-
-	return t.generateByType(schema, paramSpec.Name, tag, paramSpec, true)
+	ar := t.suite.db.Find(tag.Class, nil, t.Associations, matches, 5)
+	if len(ar) == 0 {
+		ar = t.db.Find(tag.Class, nil, t.Associations, matches, 5)
+	}
+	if len(ar) == 0 {
+		if t.Select[tag.Class] != nil || len(mqswag.CopyWithoutClass(t.Associations, tag.Class)) > 0 {
+			return nil, false, mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf(
+				"no %s object matches the test's select and associations", tag.Class))
+		}
+		return nil, false, nil
+	}
+	obj := ar[mqutil.Rand.Intn(len(ar))].(map[string]interface{})
+	return &Comparison{obj, make(map[string]interface{}), nil, t.db.GetSchema(tag.Class)}, true, nil
 }
 
 // Two ways to get to generateByType
@@ -1292,37 +1917,27 @@ func (t *Test) generateByType(s mqswag.SchemaRef, prefix string, parentTag *mqsw
 	}
 	if paramSpec != nil {
 		if tag != nil && len(tag.Property) > 0 {
-			// Try to get one from the comparison objects.
-			for _, c := range t.comparisons[tag.Class] {
-				if c.old != nil {
-					c.oldUsed[tag.Property] = c.old[tag.Property]
-					if print {
-						fmt.Printf("found %s.%s\n", tag.Class, tag.Property)
-					}
-					return c.old[tag.Property], nil
-				}
-			}
-			// Get one from in-mem db and populate the comparison structure.
-			ar := t.suite.db.Find(tag.Class, nil, nil, mqswag.MatchAlways, 5)
-			if len(ar) == 0 {
-				ar = t.db.Find(tag.Class, nil, nil, mqswag.MatchAlways, 5)
+			comp, isNew, err := t.findReferenced(tag)
+			if err != nil {
+				return nil, err
 			}
-			if len(ar) > 0 {
-				obj := ar[rand.Intn(len(ar))].(map[string]interface{})
-				comp := &Comparison{obj, make(map[string]interface{}), nil, t.db.GetSchema(tag.Class)}
+			if comp != nil {
+				// The comparison records the object the parameter refers to.
 				comp.oldUsed[tag.Property] = comp.old[tag.Property]
-				t.comparisons[tag.Class] = append(t.comparisons[tag.Class], comp)
+				if isNew {
+					t.comparisons[tag.Class] = append(t.comparisons[tag.Class], comp)
+				}
 				if print {
-					fmt.Printf("found %s.%s\n", tag.Class, tag.Property)
+					t.printf("found %s.%s\n", tag.Class, tag.Property)
 				}
-				return obj[tag.Property], nil
+				return comp.old[tag.Property], nil
 			}
 		}
 	}
 
 	if len(s.Value.Type) != 0 {
 		if print {
-			fmt.Print("random\n")
+			t.print("random\n")
 		}
 		result, err := generateValue(s.Value.Type, s, prefix)
 		name := strings.ReplaceAll(prefix, "_", "")
@@ -1405,13 +2020,176 @@ func generatePattern(format string) string {
 
 // RandomTime generate a random time in the range of [t, t + r).
 func RandomTime(t time.Time, r time.Duration) time.Time {
-	return t.Add(time.Duration(float64(r) * rand.Float64()))
+	return t.Add(time.Duration(float64(r) * mqutil.Rand.Float64()))
+}
+
+// The domains of the generated emails, the shorter one is used when the longer doesn't fit in the max length.
+var emailDomains = []string{"@example.com", "@e.co"}
+
+// generateEmail generates an address like user123456@example.com. The local part is shortened to fit in
+// maxLength.
+func generateEmail(maxLength *uint64) (string, error) {
+	local := fmt.Sprintf("user%06d", mqutil.Rand.Intn(1000000))
+	if maxLength == nil {
+		return local + emailDomains[0], nil
+	}
+	for _, domain := range emailDomains {
+		if n := int(*maxLength) - len(domain); n > 0 {
+			if n < len(local) {
+				// Keep the random digits at the end.
+				local = local[len(local)-n:]
+			}
+			return local + domain, nil
+		}
+	}
+	return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("max length %d is too short for an email", *maxLength))
+}
+
+// generateHostname generates a hostname like host1234.example.com, shortened to fit in maxLength.
+func generateHostname(maxLength *uint64) (string, error) {
+	n := mqutil.Rand.Intn(10000)
+	candidates := []string{fmt.Sprintf("host%04d.example.com", n), fmt.Sprintf("host%04d", n), fmt.Sprintf("h%d", n%10)}
+	for _, host := range candidates {
+		if maxLength == nil || uint64(len(host)) <= *maxLength {
+			return host, nil
+		}
+	}
+	return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("max length %d is too short for a hostname", *maxLength))
+}
+
+// generateURI generates a url like https://example1234.com/name, with the prefix as the path. It's shortened
+// to fit in maxLength.
+func generateURI(prefix string, maxLength *uint64) (string, error) {
+	n := mqutil.Rand.Intn(10000)
+	path := url.PathEscape(strings.TrimSuffix(prefix, "_"))
+	if len(path) == 0 {
+		path = "path"
+	}
+	candidates := []string{fmt.Sprintf("https://example%04d.com/%s", n, path), fmt.Sprintf("https://example%04d.com", n),
+		fmt.Sprintf("http://e%d.co", n%10)}
+	for _, uri := range candidates {
+		if maxLength == nil || uint64(len(uri)) <= *maxLength {
+			return uri, nil
+		}
+	}
+	return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("max length %d is too short for a uri", *maxLength))
+}
+
+// generateIPv4 generates a dotted quad like 192.0.2.17. When it doesn't fit in maxLength, the octets are
+// single digits.
+func generateIPv4(maxLength *uint64) (string, error) {
+	ip := fmt.Sprintf("%d.%d.%d.%d", 1+mqutil.Rand.Intn(223), mqutil.Rand.Intn(256), mqutil.Rand.Intn(256), 1+mqutil.Rand.Intn(254))
+	if maxLength == nil || uint64(len(ip)) <= *maxLength {
+		return ip, nil
+	}
+	ip = fmt.Sprintf("%d.%d.%d.%d", 1+mqutil.Rand.Intn(9), mqutil.Rand.Intn(10), mqutil.Rand.Intn(10), 1+mqutil.Rand.Intn(9))
+	if uint64(len(ip)) <= *maxLength {
+		return ip, nil
+	}
+	return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("max length %d is too short for an ipv4 address", *maxLength))
+}
+
+// generateIPv6 generates a global unicast address, either expanded to all the eight groups or compressed,
+// with a run of zero groups as ::. The compressed form is used when the expanded one doesn't fit in
+// maxLength.
+func generateIPv6(maxLength *uint64) (string, error) {
+	groups := make([]uint16, 8)
+	groups[0] = uint16(0x2000 + mqutil.Rand.Intn(0x2000))
+	for i := 1; i < len(groups); i++ {
+		groups[i] = uint16(mqutil.Rand.Intn(0x10000))
+	}
+	if mqutil.Rand.Intn(2) == 0 {
+		start := 1 + mqutil.Rand.Intn(5)
+		for i := start; i < start+2+mqutil.Rand.Intn(2); i++ {
+			groups[i] = 0
+		}
+	}
+	ip := make(net.IP, net.IPv6len)
+	for i, g := range groups {
+		ip[2*i], ip[2*i+1] = byte(g>>8), byte(g)
+	}
+	expanded := make([]string, len(groups))
+	for i, g := range groups {
+		expanded[i] = fmt.Sprintf("%x", g)
+	}
+	candidates := []string{strings.Join(expanded, ":"), ip.String(), fmt.Sprintf("%x::%x", groups[0], groups[7])}
+	if mqutil.Rand.Intn(2) == 0 {
+		candidates[0], candidates[1] = candidates[1], candidates[0]
+	}
+	for _, c := range candidates {
+		if maxLength == nil || uint64(len(c)) <= *maxLength {
+			return c, nil
+		}
+	}
+	return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("max length %d is too short for an ipv6 address", *maxLength))
+}
+
+// generatePrefixed generates the prefix followed by random digits. The string is at least minLength runes
+// long, and is cut to maxLength when it's set.
+func generatePrefixed(prefix string, minLength uint64, maxLength *uint64) string {
+	p := []rune(prefix)
+	length := len(p) + 6
+	if int(minLength) > length {
+		length = int(minLength)
+	}
+	if maxLength != nil && int(*maxLength) < length {
+		length = int(*maxLength)
+	}
+	if len(p) > length {
+		p = p[:length]
+	}
+	for len(p) < length {
+		p = append(p, rune('0'+mqutil.Rand.Intn(10)))
+	}
+	return string(p)
 }
 
+// generateJsonPointer generates a pointer like /name/3 for the json-pointer format, and one like 1/name/3
+// for the relative-json-pointer format.
+func generateJsonPointer(format string, prefix string) string {
+	pointer := fmt.Sprintf("/%s/%d", mqswag.EscapeJsonPointerToken(prefix), mqutil.Rand.Intn(10))
+	if format == mqswag.FormatRelativeJsonPointer {
+		return fmt.Sprintf("%d%s", mqutil.Rand.Intn(3), pointer)
+	}
+	return pointer
+}
+
+// generateString generates a string for the schema's format or pattern, cut to the schema's max length.
 // TODO we need to make it context aware. Based on different contexts we should generate different
 // date ranges. Prefix is a prefix to use when generating strings. It's only used when there is
 // no specified pattern in the swagger.json
 func generateString(s mqswag.SchemaRef, prefix string) (string, error) {
+	maxLength := s.Value.MaxLength
+	if maxLength != nil && s.Value.MinLength > *maxLength {
+		return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("minLength %d is greater than maxLength %d",
+			s.Value.MinLength, *maxLength))
+	}
+	str, err := generateFormattedString(s, prefix)
+	if err != nil || maxLength == nil {
+		return str, err
+	}
+	// Count the runes the same way Validate does.
+	if r := []rune(str); uint64(len(r)) > *maxLength {
+		str = string(r[:*maxLength])
+	}
+	return str, nil
+}
+
+func generateFormattedString(s mqswag.SchemaRef, prefix string) (string, error) {
+	if len(s.Value.Pattern) == 0 {
+		switch s.Value.Format {
+		case "email":
+			return generateEmail(s.Value.MaxLength)
+		case mqswag.FormatURI, "url":
+			return generateURI(prefix, s.Value.MaxLength)
+		case mqswag.FormatHostname:
+			return generateHostname(s.Value.MaxLength)
+		case mqswag.FormatIPv4:
+			return generateIPv4(s.Value.MaxLength)
+		case mqswag.FormatIPv6:
+			return generateIPv6(s.Value.MaxLength)
+		}
+	}
 	if len(s.Value.Pattern) == 0 {
 		s.Value.Pattern = generatePattern(s.Value.Format)
 	}
@@ -1424,26 +2202,28 @@ func generateString(s mqswag.SchemaRef, prefix string) (string, error) {
 		return t.Format("2006-01-02"), nil
 	}
 	if s.Value.Format == "uuid" {
-		u, err := uuid.NewV4()
-		return u.String(), err
+		return mqutil.RandomUUID(), nil
+	}
+	if (s.Value.Format == mqswag.FormatJsonPointer || s.Value.Format == mqswag.FormatRelativeJsonPointer) &&
+		len(s.Value.Pattern) == 0 {
+		return generateJsonPointer(s.Value.Format, prefix), nil
 	}
 
-	// If no pattern is specified, we use the field name + some numbers as pattern
-	var pattern string
-	length := 0
+	// If no pattern is specified, we use the field name + some numbers, at least MinLength long.
+	var str string
 	if len(s.Value.Pattern) != 0 {
-		pattern = s.Value.Pattern
-		length = len(s.Value.Pattern) * 2
+		var err error
+		str, err = generateRegex(s.Value.Pattern, len(s.Value.Pattern)*2)
+		if err != nil {
+			return "", mqutil.NewError(mqutil.ErrInvalid, err.Error())
+		}
 	} else {
-		pattern = prefix + "\\d{6,}"
-		length = len(prefix) * 3
-	}
-	str, err := reggen.Generate(pattern, length)
-	if err != nil {
-		return "", mqutil.NewError(mqutil.ErrInvalid, err.Error())
+		str = generatePrefixed(prefix, s.Value.MinLength, s.Value.MaxLength)
 	}
 
-	if len(s.Value.Format) == 0 || s.Value.Format == "password" || s.Value.Format == "email" {
+	switch s.Value.Format {
+	case "", "password", "email", mqswag.FormatJsonPointer, mqswag.FormatRelativeJsonPointer, mqswag.FormatURI, "url",
+		mqswag.FormatHostname, mqswag.FormatIPv4, mqswag.FormatIPv6:
 		return str, nil
 	}
 	if s.Value.Format == "byte" {
@@ -1452,17 +2232,38 @@ func generateString(s mqswag.SchemaRef, prefix string) (string, error) {
 	if s.Value.Format == "binary" {
 		return hex.EncodeToString([]byte(str)), nil
 	}
-	if s.Value.Format == "uri" || s.Value.Format == "url" {
-		return "https://www.google.com/search?q=" + str, nil
-	}
 	return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Invalid format string: %s", s.Value.Format))
 }
 
 func generateBool(s mqswag.SchemaRef) (interface{}, error) {
-	return rand.Intn(2) == 0, nil
+	return mqutil.Rand.Intn(2) == 0, nil
 }
 
-func generateFloat(s mqswag.SchemaRef) (float64, error) {
+// The distributions of the generated numbers.
+const (
+	DistUniform  = "uniform"  // Evenly spread over the range.
+	DistBoundary = "boundary" // Favors the minimum, the maximum and zero.
+	DistLog      = "log"      // Evenly spread over the magnitudes.
+)
+
+// NumberDistribution is the distribution the numbers are generated with.
+var NumberDistribution = DistUniform
+
+// pickBoundary returns one of the boundary values half of the time when the boundary distribution is used.
+// Zero is one of the boundaries when it's in the range.
+func pickBoundary(realmin float64, realmax float64) (float64, bool) {
+	if NumberDistribution != DistBoundary || mqutil.Rand.Intn(2) == 0 {
+		return 0, false
+	}
+	candidates := []float64{realmin, realmax}
+	if realmin < 0 && realmax > 0 {
+		candidates = append(candidates, 0)
+	}
+	return candidates[mqutil.Rand.Intn(len(candidates))], true
+}
+
+// floatRange returns the range of the numbers the schema allows.
+func floatRange(s mqswag.SchemaRef) (float64, float64, error) {
 	var realmin float64
 	// Set the minimum, if available
 	if s.Value.Min != nil {
@@ -1489,7 +2290,7 @@ func generateFloat(s mqswag.SchemaRef) (float64, error) {
 			realmin = realmax - math.Abs(realmax)
 		} else {
 			// both are present but conflicting
-			return 0, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("specified min value %v is bigger than max %v",
+			return 0, 0, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("specified min value %v is bigger than max %v",
 				*s.Value.Min, *s.Value.Max))
 		}
 	}
@@ -1497,11 +2298,53 @@ func generateFloat(s mqswag.SchemaRef) (float64, error) {
 	if realmin == 0 && realmax == 0 {
 		realmax = 10.0
 	}
-	ret := rand.Float64()*(realmax-realmin) + realmin
+	return realmin, realmax, nil
+}
+
+// randomFloat returns a random number in [realmin, realmax) following the number distribution.
+func randomFloat(realmin float64, realmax float64) float64 {
+	if NumberDistribution == DistLog {
+		// Pick the magnitude of the offset from the minimum first, so that small and large offsets are
+		// equally likely.
+		return realmin + math.Pow(10, mqutil.Rand.Float64()*math.Log10(realmax-realmin+1)) - 1
+	}
+	return mqutil.Rand.Float64()*(realmax-realmin) + realmin
+}
+
+// roundToMultiple rounds v to the nearest multiple of multipleOf in [realmin, realmax].
+func roundToMultiple(v float64, multipleOf float64, realmin float64, realmax float64) (float64, error) {
+	if multipleOf <= 0 {
+		return 0, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("multipleOf %v is not positive", multipleOf))
+	}
+	lo := math.Ceil(realmin/multipleOf) * multipleOf
+	hi := math.Floor(realmax/multipleOf) * multipleOf
+	if lo > hi {
+		return 0, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("there is no multiple of %v between %v and %v",
+			multipleOf, realmin, realmax))
+	}
+	return math.Max(lo, math.Min(hi, math.Round(v/multipleOf)*multipleOf)), nil
+}
+
+func generateFloat(s mqswag.SchemaRef) (float64, error) {
+	realmin, realmax, err := floatRange(s)
+	if err != nil {
+		return 0, err
+	}
+	if s.Value.MultipleOf != nil {
+		ret, ok := pickBoundary(realmin, realmax)
+		if !ok {
+			ret = randomFloat(realmin, realmax)
+		}
+		return roundToMultiple(ret, *s.Value.MultipleOf, realmin, realmax)
+	}
+	if ret, ok := pickBoundary(realmin, realmax); ok {
+		return ret, nil
+	}
+	ret := randomFloat(realmin, realmax)
 	// Keep generating a new float until it cannot be casted to an integer
 	// We want to generate floats like 7.01 and not 7.00
 	for ret == float64(int(ret)) {
-		ret = rand.Float64()*(realmax-realmin) + realmin
+		ret = randomFloat(realmin, realmax)
 	}
 	return ret, nil
 }
@@ -1509,20 +2352,56 @@ func generateFloat(s mqswag.SchemaRef) (float64, error) {
 func generateInt(s mqswag.SchemaRef) (int64, error) {
 	// Give a default range if there isn't one
 	if s.Value.Max == nil && s.Value.Min == nil {
+		// On a copy, so that the range isn't added to the spec's schema and checked against the responses.
+		value := *s.Value
 		maxf := 1000000.0
-		s.Value.Max = &maxf
+		value.Max = &maxf
+		s.Value = &value
 	}
-	f, err := generateFloat(s)
+	if s.Value.MultipleOf != nil {
+		realmin, realmax, err := floatRange(s)
+		if err != nil {
+			return 0, err
+		}
+		f, err := generateFloat(s)
+		if err != nil {
+			return 0, err
+		}
+		// Round within the integer bounds, so that the rounding can't step outside of the range.
+		f, err = roundToMultiple(f, *s.Value.MultipleOf, math.Ceil(realmin), math.Floor(realmax))
+		return int64(f), err
+	}
+	if NumberDistribution == DistBoundary {
+		realmin, realmax, err := floatRange(s)
+		if err != nil {
+			return 0, err
+		}
+		if ret, ok := pickBoundary(math.Ceil(realmin), math.Floor(realmax)); ok {
+			return int64(ret), nil
+		}
+	}
+	realmin, realmax, err := floatRange(s)
 	if err != nil {
 		return 0, err
 	}
-	i := int64(f)
-	if s.Value.Min != nil && i <= int64(*s.Value.Min) {
-		i++
+	// Picked from all the integers in the range, both ends included.
+	lo, hi := math.Ceil(realmin), math.Floor(realmax)
+	if hi < lo {
+		return 0, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("there's no integer between %v and %v", realmin, realmax))
+	}
+	if hi-lo < 1<<53 {
+		return int64(lo) + mqutil.Rand.Int63n(int64(hi-lo)+1), nil
+	}
+	f, err := generateFloat(s)
+	if err != nil {
+		return 0, err
 	}
-	return i, nil
+	return int64(math.Floor(f)), nil
 }
 
+// maxUniqueKeyTries is how many times an array item is generated again when its unique key is already taken.
+const maxUniqueKeyTries = 10
+
 func (t *Test) generateArray(name string, parentTag *mqswag.MeqaTag, schema mqswag.SchemaRef, db *mqswag.DB, level int) (interface{}, error) {
 	var numItems int
 	if schema.Value.MaxItems != nil || schema.Value.MinItems > 0 {
@@ -1539,26 +2418,54 @@ func (t *Test) generateArray(name string, parentTag *mqswag.MeqaTag, schema mqsw
 			minItems = 1
 		}
 		maxDiff := maxItems - minItems
-		if maxDiff <= 0 {
-			maxDiff = 1
+		if maxDiff < 0 {
+			maxDiff = 0
 		}
-		numItems = rand.Intn(int(maxDiff)) + minItems
+		numItems = mqutil.Rand.Intn(maxDiff+1) + minItems
 	} else {
-		numItems = rand.Intn(10)
+		numItems = mqutil.Rand.Intn(10)
 	}
 	if numItems <= 0 {
 		numItems = 1
 	}
 	itemSchema := (mqswag.SchemaRef)(*schema.Value.Items)
 	tag := mqswag.GetMeqaTag(schema.Value.Description)
+	var uniqueKey string
+	if tag != nil && len(tag.UniqueKey) > 0 {
+		uniqueKey = tag.UniqueKey
+		if len(tag.Class) == 0 {
+			tag = nil
+		}
+	}
 	if tag == nil {
 		tag = parentTag
 	}
 
+	if schema.Value.UniqueItems && itemSchema.Value != nil {
+		if domain, bounded := uniqueItemDomain(itemSchema.Value); bounded {
+			if domain < int(schema.Value.MinItems) {
+				return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+					"%s: can't generate %d unique items when the items only have %d values", name, schema.Value.MinItems, domain))
+			}
+			if numItems > domain {
+				numItems = domain
+			}
+		}
+	}
+
 	var ar []interface{}
-	var hash map[interface{}]interface{}
+	var hash map[string]bool
 	if schema.Value.UniqueItems {
-		hash = make(map[interface{}]interface{})
+		hash = make(map[string]bool)
+	}
+	keys := make(map[string]bool)
+	// taken checks whether the entry is the same as, or has the same unique key as, one of the items.
+	taken := func(entry interface{}) bool {
+		if hash != nil && hash[mqutil.InterfaceToJsonString(entry)] {
+			return true
+		}
+		key, ok := mqswag.ItemKey(entry, uniqueKey)
+		return len(uniqueKey) > 0 && ok && keys[key]
 	}
 
 	generateOneEntry := func() error {
@@ -1566,15 +2473,21 @@ func (t *Test) generateArray(name string, parentTag *mqswag.MeqaTag, schema mqsw
 		if err != nil {
 			return err
 		}
-		if entry == nil {
-			return nil
+		// Try a few times to get an item that isn't taken yet.
+		for i := 0; entry != nil && taken(entry) && i < maxUniqueKeyTries; i++ {
+			if entry, err = t.GenerateSchema(name, tag, itemSchema, db, 0); err != nil {
+				return err
+			}
 		}
-		if hash != nil && hash[entry] != nil {
+		if entry == nil || taken(entry) {
 			return nil
 		}
+		if key, ok := mqswag.ItemKey(entry, uniqueKey); len(uniqueKey) > 0 && ok {
+			keys[key] = true
+		}
 		ar = append(ar, entry)
 		if hash != nil {
-			hash[entry] = 1
+			hash[mqutil.InterfaceToJsonString(entry)] = true
 		}
 		return nil
 	}
@@ -1585,15 +2498,53 @@ func (t *Test) generateArray(name string, parentTag *mqswag.MeqaTag, schema mqsw
 		return nil, err
 	}
 	level = 0 // this will supress prints
-	for i := 0; i < numItems; i++ {
+	for i := 1; i < numItems; i++ {
 		err = generateOneEntry()
 		if err != nil {
 			return nil, err
 		}
 	}
+	if schema.Value.UniqueItems && len(ar) < int(schema.Value.MinItems) {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+			"%s: only %d of the %d unique items could be generated", name, len(ar), schema.Value.MinItems))
+	}
 	return ar, nil
 }
 
+// uniqueItemDomain returns how many distinct values the item schema allows, and false when there are too
+// many to count.
+func uniqueItemDomain(s *spec.Schema) (int, bool) {
+	if len(s.Enum) > 0 {
+		return len(s.Enum), true
+	}
+	switch s.Type {
+	case gojsonschema.TYPE_BOOLEAN:
+		return 2, true
+	case gojsonschema.TYPE_INTEGER:
+		if s.Min == nil || s.Max == nil {
+			return 0, false
+		}
+		min, max := math.Ceil(*s.Min), math.Floor(*s.Max)
+		if s.ExclusiveMin && min == *s.Min {
+			min++
+		}
+		if s.ExclusiveMax && max == *s.Max {
+			max--
+		}
+		if max-min >= math.MaxInt32 {
+			return 0, false
+		}
+		if max < min {
+			return 0, true
+		}
+		return int(max-min) + 1, true
+	}
+	return 0, false
+}
+
+// nullProb is the probability of generating null for a nullable property.
+const nullProb = 0.1
+
 func (t *Test) generateObject(name string, parentTag *mqswag.MeqaTag, schema mqswag.SchemaRef, db *mqswag.DB, level int) (interface{}, error) {
 	obj := make(map[string]interface{})
 	var spaces string
@@ -1603,33 +2554,84 @@ func (t *Test) generateObject(name string, parentTag *mqswag.MeqaTag, schema mqs
 		nextLevel = level + 1
 	}
 	if level != 0 {
-		fmt.Println("")
+		t.println("")
+	}
+	tag := mqswag.GetMeqaTag(schema.Value.Description)
+	if tag == nil {
+		tag = parentTag
 	}
-	for k, v := range schema.Value.Properties {
+	_, mock := t.getClient().(*MockClient)
+	required := schema.GetRequired(db.Swagger)
+	// The properties are generated in a fixed order, so that the same seed generates the same object.
+	var keys []string
+	for k := range schema.Value.Properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := schema.Value.Properties[k]
+		if t.Strict && v.Value != nil && v.Value.ReadOnly {
+			// The server owns readOnly fields, sending them is a contract violation.
+			continue
+		}
 		if level != 0 {
-			fmt.Printf("%s%s . ", spaces, k)
+			t.printf("%s%s . ", spaces, k)
 		}
 		if t.suite.BodyParams != nil {
 			if o, ok := t.suite.BodyParams.(map[string]interface{})[k]; ok {
 				if o != nil {
 					obj[k] = o
-					fmt.Println("found")
+					t.println("found")
 				} else {
-					fmt.Println("skipping")
+					t.println("skipping")
 				}
 				continue
 			}
 		}
+		if mock && k == mqswag.IdField && tag != nil && len(tag.Class) > 0 && v.Value != nil {
+			// In mock mode ids come from the allocator shared with the mock server.
+			if id := mqswag.Ids.Next(tag.Class); v.Value.Type == gojsonschema.TYPE_STRING {
+				obj[k] = strconv.FormatInt(id, 10)
+			} else {
+				obj[k] = id
+			}
+			if level != 0 {
+				t.println("allocated")
+			}
+			continue
+		}
+		if !mqswag.IsRequired(required, k) && !t.includeOptional(k) {
+			if level != 0 {
+				t.println("optional, left out")
+			}
+			continue
+		}
+		if value, found, err := t.referencedProperty(tag, v); err != nil {
+			return nil, err
+		} else if found {
+			// The field refers to an object of another class, e.g. the petId of an order.
+			obj[k] = value
+			if level != 0 {
+				t.println("found")
+			}
+			continue
+		}
+		if ((mqswag.SchemaRef)(*v)).IsNullable(db.Swagger) && mqutil.Rand.Float64() < nullProb {
+			// The servers should take the nulls the spec allows, required fields included.
+			if level != 0 {
+				t.println("null")
+			}
+			obj[k] = nil
+			continue
+		}
 		o, err := t.GenerateSchema(k+"_", nil, (mqswag.SchemaRef)(*v), db, nextLevel)
 		if err != nil {
 			return nil, err
 		}
 		obj[k] = o
 	}
-
-	tag := mqswag.GetMeqaTag(schema.Value.Description)
-	if tag == nil {
-		tag = parentTag
+	if err := t.fitPropertyCount(obj, schema, db, nextLevel); err != nil {
+		return nil, err
 	}
 
 	if tag != nil {
@@ -1638,6 +2640,145 @@ func (t *Test) generateObject(name string, parentTag *mqswag.MeqaTag, schema mqs
 	return obj, nil
 }
 
+// includeOptional decides whether the optional property is generated, with the plan's OptionalProb. The
+// properties the test's body sets are always generated, for the test's values to replace them.
+func (t *Test) includeOptional(name string) bool {
+	if body, ok := t.BodyParams.(map[string]interface{}); ok {
+		if _, set := body[name]; set {
+			return true
+		}
+	}
+	return t.suite.plan.includeOptional()
+}
+
+// referencedProperty returns the value of an object's property that's tagged with the property of another
+// class, e.g. <meqa Pet.id>, from an existing object of that class. found is false when the property isn't
+// such a reference or there's no object to take the value from.
+func (t *Test) referencedProperty(objTag *mqswag.MeqaTag, property *spec.SchemaRef) (value interface{}, found bool, err error) {
+	if property.Value == nil || len(property.Value.Type) == 0 ||
+		property.Value.Type == gojsonschema.TYPE_OBJECT || property.Value.Type == gojsonschema.TYPE_ARRAY {
+		return nil, false, nil
+	}
+	tag := mqswag.GetMeqaTag(property.Value.Description)
+	if tag == nil || len(tag.Class) == 0 || len(tag.Property) == 0 || objTag != nil && objTag.Class == tag.Class {
+		return nil, false, nil
+	}
+	comp, _, err := t.findReferenced(tag)
+	if comp == nil || err != nil {
+		return nil, false, err
+	}
+	value, found = comp.old[tag.Property]
+	return value, found, nil
+}
+
+// fitPropertyCount makes the number of the object's fields fit the schema's minProperties and maxProperties.
+// The optional fields are dropped when there are too many, and additional fields are added when there are
+// too few.
+func (t *Test) fitPropertyCount(obj map[string]interface{}, schema mqswag.SchemaRef, db *mqswag.DB, level int) error {
+	if max := schema.Value.MaxProps; max != nil && uint64(len(obj)) > *max {
+		var optional []string
+		for k := range obj {
+			if !mqswag.IsRequired(schema.Value.Required, k) {
+				optional = append(optional, k)
+			}
+		}
+		sort.Strings(optional)
+		for uint64(len(obj)) > *max && len(optional) > 0 {
+			i := mqutil.Rand.Intn(len(optional))
+			delete(obj, optional[i])
+			optional = append(optional[:i], optional[i+1:]...)
+		}
+		if uint64(len(obj)) > *max {
+			return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+				"the object has %d required properties but maxProperties is %d", len(obj), *max))
+		}
+	}
+	if uint64(len(obj)) >= schema.Value.MinProps {
+		return nil
+	}
+	extra := schema.Value.AdditionalProperties
+	if extra == nil || extra.Value == nil {
+		if allowed := schema.Value.AdditionalPropertiesAllowed; allowed != nil && !*allowed {
+			return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+				"the object has %d properties but minProperties is %d and additionalProperties is false",
+				len(obj), schema.Value.MinProps))
+		}
+		extra = spec.NewStringSchema().NewRef()
+	}
+	for i := 1; uint64(len(obj)) < schema.Value.MinProps; i++ {
+		k := fmt.Sprintf("property%d", i)
+		if _, exist := obj[k]; exist {
+			continue
+		}
+		o, err := t.GenerateSchema(k+"_", nil, (mqswag.SchemaRef)(*extra), db, level)
+		if err != nil {
+			return err
+		}
+		obj[k] = o
+	}
+	return nil
+}
+
+// anyOfCombinable checks whether all the anyOf schemas are objects that can be merged into one object.
+// Properties shared between the schemas must have the same definition.
+func anyOfCombinable(members []*spec.SchemaRef, swagger *mqswag.Swagger) bool {
+	seen := make(map[string]*spec.Schema)
+	for _, s := range members {
+		properties := ((mqswag.SchemaRef)(*s)).GetProperties(swagger)
+		if len(properties) == 0 {
+			return false
+		}
+		for k, p := range properties {
+			if p.Value == nil {
+				return false
+			}
+			if other, ok := seen[k]; ok && other != p.Value && !reflect.DeepEqual(other, p.Value) {
+				return false
+			}
+			seen[k] = p.Value
+		}
+	}
+	return true
+}
+
+// generateAnyOf picks one of the anyOf schemas to generate. When the schemas are compatible objects we
+// sometimes merge all of them into one object instead.
+func (t *Test) generateAnyOf(name string, tag *mqswag.MeqaTag, schema mqswag.SchemaRef, db *mqswag.DB, level int) (interface{}, error) {
+	members := schema.Value.AnyOf
+	if !anyOfCombinable(members, db.Swagger) || mqutil.Rand.Intn(2) == 0 {
+		return t.GenerateSchema(name, tag, (mqswag.SchemaRef)(*members[mqutil.Rand.Intn(len(members))]), db, level)
+	}
+	combined := make(map[string]interface{})
+	for _, s := range members {
+		m, err := t.GenerateSchema(name, nil, (mqswag.SchemaRef)(*s), db, level)
+		if err != nil {
+			return nil, err
+		}
+		if o, isMap := m.(map[string]interface{}); isMap {
+			combined = mqutil.MapCombine(combined, o)
+		}
+	}
+	t.AddObjectComparison(tag, combined, schema)
+	return combined, nil
+}
+
+// generateOneOf picks one of the oneOf schemas to generate.
+func (t *Test) generateOneOf(name string, tag *mqswag.MeqaTag, schema mqswag.SchemaRef, db *mqswag.DB, level int) (interface{}, error) {
+	members := schema.Value.OneOf
+	member := members[mqutil.Rand.Intn(len(members))]
+	obj, err := t.GenerateSchema(name, tag, (mqswag.SchemaRef)(*member), db, level)
+	if err != nil {
+		return nil, err
+	}
+	// With a discriminator the object says which of the schemas it is.
+	d := schema.GetDiscriminator(db.Swagger)
+	memberName, _, _ := db.Swagger.GetReferredSchema((mqswag.SchemaRef)(*member))
+	if objMap, isMap := obj.(map[string]interface{}); isMap && d != nil && len(memberName) > 0 {
+		objMap[d.PropertyName] = mqswag.DiscriminatorValue(d, memberName)
+	}
+	return obj, nil
+}
+
 // The parentTag passed in is what the higher level thinks this schema object should be.
 func (t *Test) GenerateSchema(name string, parentTag *mqswag.MeqaTag, schema mqswag.SchemaRef, db *mqswag.DB, level int) (interface{}, error) {
 	swagger := db.Swagger
@@ -1657,30 +2798,55 @@ func (t *Test) GenerateSchema(name string, parentTag *mqswag.MeqaTag, schema mqs
 		if len(name) > 0 {
 			// This the the field of an object. Instead of generating a new object, we try to get one
 			// from the DB. If we can't find one, only then we generate a new one.
-			found := t.suite.db.Find(referenceName, nil, nil, mqswag.MatchAlways, 1)
+			matches, err := t.selectFunc(referenceName)
+			if err != nil {
+				return nil, err
+			}
+			found := t.suite.db.Find(referenceName, nil, t.Associations, matches, 1)
 			if len(found) == 0 {
-				found = t.db.Find(referenceName, nil, nil, mqswag.MatchAlways, 1)
+				found = t.db.Find(referenceName, nil, t.Associations, matches, 1)
 			}
 			if len(found) > 0 {
 				if level != 0 {
-					fmt.Printf("found %s\n", referenceName)
+					t.printf("found %s\n", referenceName)
 				}
-				return found[0], nil
+				// The body may be changed later, e.g. by a patch, so it mustn't share the DB's object.
+				return mqutil.InterfaceCopy(found[0]), nil
 			}
 		}
-		return t.GenerateSchema(name, &mqswag.MeqaTag{referenceName, "", "", 0}, referredSchema, db, level)
+		return t.GenerateSchema(name, &mqswag.MeqaTag{Class: referenceName}, referredSchema, db, level)
+	}
+
+	// A schema's default is used as is, including the defaults of whole objects and arrays, in the defaults
+	// mode or with the plan's probability of using the defaults.
+	if schema.Value.Default != nil && t.suite.plan.useDefault() {
+		if value, ok := t.generateDeclared("default", schema.Value.Default, tag, schema, swagger); ok {
+			if level != 0 {
+				t.print("default\n")
+			}
+			return value, nil
+		}
+	}
+	// The examples are realistic values the servers accept, so they're used when the spec has them.
+	if example, ok := declaredExample(schema.Value.Example, nil, schema.Value.Extensions); ok && !t.suite.plan.NoExamples {
+		if value, ok := t.generateDeclared("example", example, tag, schema, swagger); ok {
+			if level != 0 {
+				t.print("example\n")
+			}
+			return value, nil
+		}
 	}
 
 	if len(schema.Value.Enum) != 0 {
 		if level != 0 {
-			fmt.Print("enum\n")
+			t.print("enum\n")
 		}
-		return generateEnum(schema.Value.Enum)
+		return generateEnum(schema.Value)
 	}
 
 	if len(schema.Value.AllOf) > 0 {
 		combined := make(map[string]interface{})
-		discriminator := ""
+		var discriminator *spec.Discriminator
 		for _, s := range schema.Value.AllOf {
 			m, err := t.GenerateSchema(name, nil, (mqswag.SchemaRef)(*s), db, level)
 			if err != nil {
@@ -1693,24 +2859,27 @@ func (t *Test) GenerateSchema(name string, parentTag *mqswag.MeqaTag, schema mqs
 				jsonStr, _ := json.MarshalIndent(schema, "", "    ")
 				return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("can't combine AllOf schema that's not map: %s", jsonStr))
 			}
-			if s.Value.Discriminator != nil && len(s.Value.Discriminator.PropertyName) > 0 {
-				discriminator = s.Value.Discriminator.PropertyName
-			} else {
-				// This is more common, the discriminator is in a common object referred from AllOf
-				_, rs, _ := swagger.GetReferredSchema((mqswag.SchemaRef)(*s))
-				if rs.Value != nil && rs.Value.Discriminator != nil && len(rs.Value.Discriminator.PropertyName) > 0 {
-					discriminator = rs.Value.Discriminator.PropertyName
-				}
+			// The discriminator is usually in a common object referred from AllOf
+			if d := ((mqswag.SchemaRef)(*s)).GetDiscriminator(swagger); d != nil {
+				discriminator = d
 			}
 		}
-		if len(discriminator) > 0 && len(tag.Class) > 0 {
-			combined[discriminator] = tag.Class
+		if discriminator != nil && tag != nil && len(tag.Class) > 0 {
+			combined[discriminator.PropertyName] = mqswag.DiscriminatorValue(discriminator, tag.Class)
 		}
 		// Add combined to the comparison under tag.
 		t.AddObjectComparison(tag, combined, schema)
 		return combined, nil
 	}
 
+	if len(schema.Value.AnyOf) > 0 {
+		return t.generateAnyOf(name, tag, schema, db, level)
+	}
+
+	if len(schema.Value.OneOf) > 0 {
+		return t.generateOneOf(name, tag, schema, db, level)
+	}
+
 	if len(schema.Value.Type) == 0 {
 		// return nil, mqutil.NewError(mqutil.ErrInvalid, "Parameter doesn't have type")
 		return t.generateObject(name, tag, schema, db, level)
@@ -1725,6 +2894,107 @@ func (t *Test) GenerateSchema(name string, parentTag *mqswag.MeqaTag, schema mqs
 	return t.generateByType(schema, name, tag, nil, level != 0)
 }
 
-func generateEnum(e []interface{}) (interface{}, error) {
-	return e[rand.Intn(len(e))], nil
+// matchOptions returns how the test matches the objects to the schemas, as strictly as the DB says, and
+// every field when it's strict.
+func (t *Test) matchOptions(strict bool) mqswag.MatchOptions {
+	var opts mqswag.MatchOptions
+	if t.db != nil {
+		opts = t.db.Options
+	}
+	opts.Strict = strict
+	return opts
+}
+
+// generateDeclared returns a copy of a value the spec declares for the schema, its default or an example.
+// The value is only used if it's valid.
+func (t *Test) generateDeclared(what string, value interface{}, tag *mqswag.MeqaTag, schema mqswag.SchemaRef, swagger *mqswag.Swagger) (interface{}, bool) {
+	if !schema.Matches(value, t.matchOptions(false), swagger) {
+		mqutil.Logger.Printf("the %s doesn't match its schema, ignoring it: %v", what, value)
+		return nil, false
+	}
+	switch d := value.(type) {
+	case map[string]interface{}:
+		obj := mqutil.MapCopy(d)
+		if tag != nil {
+			t.AddObjectComparison(tag, obj, schema)
+		}
+		return obj, true
+	case []interface{}:
+		ar := mqutil.ArrayCopy(d)
+		if ar == nil {
+			ar = []interface{}{}
+		}
+		return ar, true
+	}
+	return value, true
+}
+
+// ExampleExtension is how the swagger 2 specs declare the examples of the parameters, e.g. x-example: rex.
+const ExampleExtension = "x-example"
+
+// declaredExample returns the example the spec declares with example, examples or x-example. Of several
+// examples the first by name is used.
+func declaredExample(example interface{}, examples map[string]*spec.ExampleRef, extensions map[string]interface{}) (interface{}, bool) {
+	if example != nil {
+		return example, true
+	}
+	var names []string
+	for name, e := range examples {
+		if e != nil && e.Value != nil && e.Value.Value != nil {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return examples[names[0]].Value.Value, true
+	}
+	raw, ok := extensions[ExampleExtension]
+	if !ok || raw == nil {
+		return nil, false
+	}
+	if data, isRaw := raw.(json.RawMessage); isRaw {
+		var value interface{}
+		if err := mqutil.DecodeJson(data, &value); err != nil || value == nil {
+			return nil, false
+		}
+		return value, true
+	}
+	return raw, true
+}
+
+// generateEnum picks one of the enum values. When the schema also has a pattern, only the values that
+// match the pattern are picked. A null in the enum is only picked when the schema is nullable.
+func generateEnum(s *spec.Schema) (interface{}, error) {
+	var re *regexp.Regexp
+	if len(s.Pattern) > 0 {
+		var err error
+		if re, err = regexp.Compile(s.Pattern); err != nil {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid pattern %s: %s", s.Pattern, err.Error()))
+		}
+	}
+	var e []interface{}
+	for _, v := range s.Enum {
+		if v == nil {
+			if s.Nullable {
+				e = append(e, nil)
+			}
+			continue
+		}
+		if re != nil && !re.MatchString(fmt.Sprint(v)) {
+			continue
+		}
+		// The spec loader turns all the numbers into float64.
+		if f, ok := v.(float64); ok && s.Type == gojsonschema.TYPE_INTEGER && f == math.Trunc(f) {
+			v = int64(f)
+		}
+		e = append(e, v)
+	}
+	if len(e) == 0 {
+		if re != nil {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("none of the enum values %v matches the pattern %s",
+				s.Enum, s.Pattern))
+		}
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("none of the enum values %v can be used", s.Enum))
+	}
+	return e[mqutil.Rand.Intn(len(e))], nil
 }
@@ -0,0 +1,2394 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqswag"
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+
+	spec "github.com/getkin/kin-openapi/openapi3"
+)
+
+const userSpec = `
+openapi: 3.0.2
+info:
+  title: users
+  version: "1.0"
+paths:
+  /users:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/User'
+      responses:
+        '200':
+          description: created
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/User'
+  /users/batch:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: array
+              items:
+                $ref: '#/components/schemas/User'
+      responses:
+        '200':
+          description: created
+components:
+  schemas:
+    User:
+      type: object
+      properties:
+        id:
+          type: integer
+          readOnly: true
+        name:
+          type: string
+        password:
+          type: string
+          writeOnly: true
+`
+
+// newTestSuite loads the spec and creates a suite that sends its requests to baseURL.
+func newTestSuite(t *testing.T, specYaml string, baseURL string) *TestSuite {
+	mqutil.Logger = mqutil.NewLogger(ioutil.Discard)
+	s, err := spec.NewSwaggerLoader().LoadSwaggerFromData([]byte(specYaml))
+	if err != nil {
+		t.Fatalf("loading spec: %v", err)
+	}
+	swagger := (*mqswag.Swagger)(s)
+	db := &mqswag.DB{}
+	db.Init(swagger)
+
+	plan := &TestPlan{}
+	plan.Init(swagger, db)
+	plan.BaseURL = baseURL
+	plan.ResultCounts = make(map[string]int)
+	suite := CreateTestSuite("suite", nil, plan)
+	suite.db = db.CloneSchema()
+	return suite
+}
+
+// runTest runs a single test in the suite the same way TestPlan.Run does.
+func runTest(suite *TestSuite, test *Test) (*Test, error) {
+	test.Init(suite)
+	dup := test.SchemaDuplicate()
+	dup.Strict = suite.Strict
+	_, err := dup.Run(suite, suite.plan.GetClient())
+	return dup, err
+}
+
+func TestStrictWriteOnlyLeak(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 1, "name": "joe", "password": "secret"}`))
+	}))
+	defer server.Close()
+
+	suite := newTestSuite(t, userSpec, server.URL)
+	dup, err := runTest(suite, &Test{Name: "lenient", Path: "/users", Method: "post"})
+	if err != nil {
+		t.Fatalf("lenient mode should ignore writeOnly fields: %v", err)
+	}
+	if _, ok := dup.BodyParams.(map[string]interface{})["id"]; !ok {
+		t.Errorf("lenient mode should still generate readOnly fields")
+	}
+
+	suite.Strict = true
+	dup, err = runTest(suite, &Test{Name: "strict", Path: "/users", Method: "post"})
+	if err == nil {
+		t.Fatalf("strict mode should fail on a leaked writeOnly field")
+	}
+	if dup.responseError != "writeOnly fields returned by server: password" {
+		t.Errorf("unexpected violation: %v", dup.responseError)
+	}
+	if _, ok := dup.BodyParams.(map[string]interface{})["id"]; ok {
+		t.Errorf("strict mode should not generate readOnly fields")
+	}
+}
+
+func TestStrictReadOnlyRequest(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	suite := newTestSuite(t, userSpec, server.URL)
+	suite.Strict = true
+	test := &Test{Name: "strict", Path: "/users/batch", Method: "post"}
+	test.BodyParams = []interface{}{map[string]interface{}{"id": 5, "name": "joe"}}
+	_, err := runTest(suite, test)
+	if err == nil || called {
+		t.Errorf("a request setting a readOnly field should fail before being sent")
+	}
+}
+
+const petSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths: {}
+components:
+  schemas:
+    Cat:
+      type: object
+      required: [meow]
+      properties:
+        meow:
+          type: string
+        lives:
+          type: integer
+          minimum: 1
+          maximum: 9
+    Dog:
+      type: object
+      required: [bark]
+      properties:
+        bark:
+          type: boolean
+    Bird:
+      type: object
+      required: [meow]
+      properties:
+        meow:
+          type: boolean
+    Combinable:
+      anyOf:
+        - $ref: '#/components/schemas/Cat'
+        - $ref: '#/components/schemas/Dog'
+    Incompatible:
+      anyOf:
+        - $ref: '#/components/schemas/Cat'
+        - $ref: '#/components/schemas/Bird'
+`
+
+// newGenerator returns a test that can be used to call the generate functions directly.
+func newGenerator(suite *TestSuite) *Test {
+	test := &Test{Name: "generate"}
+	test.Init(suite)
+	return test.SchemaDuplicate()
+}
+
+func TestGenerateAnyOf(t *testing.T) {
+	suite := newTestSuite(t, petSpec, "")
+	swagger := suite.plan.swagger
+	for _, name := range []string{"Combinable", "Incompatible"} {
+		schema := swagger.FindSchemaByName(name)
+		merged := false
+		for i := 0; i < 50; i++ {
+			obj, err := newGenerator(suite).GenerateSchema("", nil, schema, suite.db, 0)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if !schema.Matches(obj, mqswag.MatchOptions{}, swagger) {
+				t.Fatalf("%s: generated object doesn't match the schema: %v", name, obj)
+			}
+			objMap := obj.(map[string]interface{})
+			_, hasMeow := objMap["meow"]
+			_, hasBark := objMap["bark"]
+			merged = merged || (hasMeow && hasBark)
+		}
+		if name == "Combinable" && !merged {
+			t.Errorf("compatible anyOf members were never merged")
+		}
+		if name == "Incompatible" && merged {
+			t.Errorf("incompatible anyOf members were merged")
+		}
+	}
+
+	schema := swagger.FindSchemaByName("Combinable")
+	if schema.Matches(map[string]interface{}{"lives": 3}, mqswag.MatchOptions{}, swagger) {
+		t.Errorf("an object matching none of the anyOf members should fail")
+	}
+}
+
+const shapeSpec = `
+openapi: 3.0.2
+info:
+  title: shapes
+  version: "1.0"
+paths: {}
+components:
+  schemas:
+    Shape:
+      oneOf:
+        - $ref: '#/components/schemas/Circle'
+        - $ref: '#/components/schemas/Square'
+    Circle:
+      type: object
+      required: [kind, radius]
+      properties:
+        kind:
+          type: string
+          enum: [circle]
+        radius:
+          type: number
+    Square:
+      type: object
+      required: [kind, side]
+      properties:
+        kind:
+          type: string
+          enum: [square]
+        side:
+          type: number
+    Amount:
+      oneOf:
+        - type: number
+          maximum: 10
+        - type: number
+          minimum: 0
+`
+
+func TestGenerateOneOf(t *testing.T) {
+	suite := newTestSuite(t, shapeSpec, "")
+	swagger := suite.plan.swagger
+	schema := swagger.FindSchemaByName("Shape")
+	kinds := make(map[interface{}]bool)
+	for i := 0; i < 50; i++ {
+		obj, err := newGenerator(suite).GenerateSchema("", nil, schema, suite.db, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !schema.Matches(obj, mqswag.MatchOptions{}, swagger) {
+			t.Fatalf("generated object doesn't match the schema: %v", obj)
+		}
+		objMap := obj.(map[string]interface{})
+		kinds[objMap["kind"]] = true
+		if _, hasRadius := objMap["radius"]; hasRadius == (objMap["kind"] == "square") {
+			t.Errorf("the generated object mixes the shapes: %v", obj)
+		}
+	}
+	if len(kinds) != 2 {
+		t.Errorf("expecting both shapes to be generated, got %v", kinds)
+	}
+
+	for _, c := range []struct {
+		schema  string
+		object  interface{}
+		matches bool
+	}{
+		{"Shape", map[string]interface{}{"kind": "circle", "radius": 1.5}, true},
+		{"Shape", map[string]interface{}{"kind": "square", "radius": 1.5}, false},
+		{"Shape", map[string]interface{}{"kind": "triangle"}, false},
+		// 3 is in both ranges, so it matches two of the schemas instead of one.
+		{"Amount", 3, false},
+		{"Amount", -3, true},
+		{"Amount", 30, true},
+	} {
+		if swagger.FindSchemaByName(c.schema).Matches(c.object, mqswag.MatchOptions{}, swagger) != c.matches {
+			t.Errorf("%s: expecting %v to match to be %v", c.schema, c.object, c.matches)
+		}
+	}
+}
+
+const petTypeSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths: {}
+components:
+  schemas:
+    Pet:
+      type: object
+      required: [petType, name]
+      properties:
+        petType:
+          type: string
+        name:
+          type: string
+      discriminator:
+        propertyName: petType
+        mapping:
+          cat: '#/components/schemas/Cat'
+    Cat:
+      allOf:
+        - $ref: '#/components/schemas/Pet'
+        - type: object
+          required: [meow, lives]
+          properties:
+            meow:
+              type: boolean
+            lives:
+              type: integer
+            hunts:
+              type: boolean
+    Dog:
+      allOf:
+        - $ref: '#/components/schemas/Pet'
+        - type: object
+          required: [bark]
+          properties:
+            bark:
+              type: boolean
+    AnyPet:
+      oneOf:
+        - $ref: '#/components/schemas/Cat'
+        - $ref: '#/components/schemas/Dog'
+      discriminator:
+        propertyName: petType
+        mapping:
+          cat: '#/components/schemas/Cat'
+`
+
+func TestDiscriminator(t *testing.T) {
+	suite := newTestSuite(t, petTypeSpec, "")
+	swagger := suite.plan.swagger
+	anyPet := swagger.FindSchemaByName("AnyPet")
+	petTypes := make(map[interface{}]bool)
+	for i := 0; i < 50; i++ {
+		obj, err := newGenerator(suite).GenerateSchema("", nil, anyPet, suite.db, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !anyPet.Matches(obj, mqswag.MatchOptions{}, swagger) {
+			t.Fatalf("generated object doesn't match the schema: %v", obj)
+		}
+		petTypes[obj.(map[string]interface{})["petType"]] = true
+	}
+	if len(petTypes) != 2 || !petTypes["cat"] || !petTypes["Dog"] {
+		t.Errorf("expecting the discriminator to name the generated pets, got %v", petTypes)
+	}
+	cat, err := newGenerator(suite).GenerateSchema("", nil, (mqswag.SchemaRef)(*anyPet.Value.OneOf[0]), suite.db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cat.(map[string]interface{})["petType"] != "cat" {
+		t.Errorf("expecting the cat's petType to come from the mapping, got %v", cat)
+	}
+
+	felix := map[string]interface{}{"petType": "cat", "name": "felix", "meow": true, "lives": 9, "hunts": true}
+	for _, c := range []struct {
+		schema  string
+		object  interface{}
+		matches bool
+	}{
+		// The cat has more fields than a pet, but the discriminator says it's a cat.
+		{"Pet", felix, true},
+		{"AnyPet", felix, true},
+		{"Pet", map[string]interface{}{"petType": "cat", "name": "felix", "meow": "loud", "lives": 9, "hunts": true}, false},
+		{"AnyPet", map[string]interface{}{"petType": "Dog", "name": "rex", "meow": true, "lives": 9}, false},
+		{"AnyPet", map[string]interface{}{"petType": "Dog", "name": "rex", "bark": true}, true},
+	} {
+		if swagger.FindSchemaByName(c.schema).Matches(c.object, mqswag.MatchOptions{}, swagger) != c.matches {
+			t.Errorf("%s: expecting %v to match to be %v", c.schema, c.object, c.matches)
+		}
+	}
+}
+
+const propertyCountSpec = `
+openapi: 3.0.2
+info:
+  title: settings
+  version: "1.0"
+paths: {}
+components:
+  schemas:
+    Settings:
+      type: object
+      minProperties: 3
+      properties:
+        theme:
+          type: string
+      additionalProperties:
+        type: integer
+    Labels:
+      type: object
+      maxProperties: 2
+      required: [name]
+      properties:
+        name:
+          type: string
+        color:
+          type: string
+        size:
+          type: integer
+        shape:
+          type: string
+`
+
+func TestGeneratePropertyCount(t *testing.T) {
+	suite := newTestSuite(t, propertyCountSpec, "")
+	swagger := suite.plan.swagger
+	settings := swagger.FindSchemaByName("Settings")
+	labels := swagger.FindSchemaByName("Labels")
+	for i := 0; i < 20; i++ {
+		obj, err := newGenerator(suite).GenerateSchema("", nil, settings, suite.db, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := obj.(map[string]interface{}); len(m) < 3 || m["theme"] == nil || !settings.Matches(obj, mqswag.MatchOptions{}, swagger) {
+			t.Fatalf("expecting at least 3 properties that match the schema, got %v", obj)
+		}
+		obj, err = newGenerator(suite).GenerateSchema("", nil, labels, suite.db, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := obj.(map[string]interface{}); len(m) != 2 || m["name"] == nil || !labels.Matches(obj, mqswag.MatchOptions{}, swagger) {
+			t.Fatalf("expecting the name and one more property, got %v", obj)
+		}
+	}
+
+	if settings.Matches(map[string]interface{}{"theme": "dark", "volume": 3}, mqswag.MatchOptions{}, swagger) {
+		t.Errorf("an object with fewer than minProperties should not match")
+	}
+	if labels.Matches(map[string]interface{}{"name": "a", "color": "red", "size": 3}, mqswag.MatchOptions{}, swagger) {
+		t.Errorf("an object with more than maxProperties should not match")
+	}
+	labels.Value.Required = []string{"name", "color", "size"}
+	if _, err := newGenerator(suite).GenerateSchema("", nil, labels, suite.db, 0); err == nil {
+		t.Errorf("expecting an error when the required properties are more than maxProperties")
+	}
+}
+
+const patchSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths:
+  /pets/{id}:
+    patch:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      requestBody:
+        content:
+          application/json-patch+json:
+            schema:
+              type: array
+              items:
+                type: object
+      responses:
+        '200':
+          description: patched
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        id:
+          type: integer
+          readOnly: true
+        name:
+          type: string
+        tag:
+          type: string
+`
+
+func TestJsonPatchReplace(t *testing.T) {
+	suite := newTestSuite(t, patchSpec, "http://example.com")
+	client := &stubClient{status: 200}
+	suite.plan.Client = client
+	pet := map[string]interface{}{"id": 1, "name": "rex", "tag": "dog"}
+	suite.db.Insert("Pet", pet, nil)
+
+	test := &Test{Name: "patch", Path: "/pets/{id}", Method: "patch"}
+	test.PathParams = map[string]interface{}{"id": 1}
+	if _, err := runTest(suite, test); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(client.requests))
+	}
+	req := client.requests[0]
+	if req.Header.Get("Content-Type") != mqswag.JsonPatch {
+		t.Errorf("unexpected content type: %s", req.Header.Get("Content-Type"))
+	}
+	patch, ok := req.Body.([]interface{})
+	if !ok || len(patch) == 0 {
+		t.Fatalf("expected a json patch body, got %v", req.Body)
+	}
+	expected := mqutil.MapCopy(pet)
+	for _, entry := range patch {
+		op := entry.(map[string]interface{})
+		path := op["path"].(string)
+		if op["op"] != mqutil.PatchReplace || (path != "/name" && path != "/tag") {
+			t.Errorf("unexpected patch operation: %v", op)
+		}
+		expected[path[1:]] = op["value"]
+	}
+
+	stored := suite.db.Find("Pet", nil, nil, mqswag.MatchAlways, -1)
+	if len(stored) != 1 || !mqutil.InterfaceEquals(expected, stored[0]) {
+		t.Errorf("patch not applied to the DB entry: expected %v, found %v", expected, stored)
+	}
+}
+
+const mediaTypeSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths:
+  /pets/{id}:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      responses:
+        '200':
+          description: found
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+            application/xml:
+              schema:
+                $ref: '#/components/schemas/PetXml'
+components:
+  schemas:
+    Pet:
+      type: object
+      required: [id, name]
+      properties:
+        id:
+          type: integer
+        name:
+          type: string
+    PetXml:
+      type: object
+      required: [petId]
+      properties:
+        petId:
+          type: integer
+        tags:
+          type: array
+          items:
+            type: string
+`
+
+func TestResponseMediaType(t *testing.T) {
+	cases := []struct {
+		contentType string
+		body        string
+		matches     bool
+	}{
+		{"application/json", `{"id": 1, "name": "rex"}`, true},
+		{"application/xml; charset=utf-8", `<pet><petId>1</petId><tags><tag>a</tag><tag>b</tag></tags></pet>`, true},
+		{"application/xml", `<pet><petId>1</petId><tags>a</tags></pet>`, true},
+		{"application/xml", `<pet><id>1</id><name>rex</name></pet>`, false},
+		{"application/json", `{"petId": 1, "tags": ["a"]}`, false},
+	}
+	for _, c := range cases {
+		suite := newTestSuite(t, mediaTypeSpec, "http://example.com")
+		suite.plan.Client = &stubClient{status: 200, body: c.body, header: http.Header{"Content-Type": []string{c.contentType}}}
+		test := &Test{Name: "get", Path: "/pets/{id}", Method: "get"}
+		test.PathParams = map[string]interface{}{"id": 1}
+		dup, err := runTest(suite, test)
+		if (err == nil) != c.matches || (dup.schemaError == nil) != c.matches {
+			t.Errorf("%s %s: expected match to be %v, error: %v, schema error: %v", c.contentType, c.body, c.matches, err, dup.schemaError)
+		}
+	}
+}
+
+const defaultSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths:
+  /pets:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+      responses:
+        '200':
+          description: created
+  /owners:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Owner'
+      responses:
+        '200':
+          description: created
+components:
+  schemas:
+    Pet:
+      type: object
+      default:
+        name: rex
+        tags: [good, dog]
+      properties:
+        name:
+          type: string
+        tags:
+          type: array
+          items:
+            type: string
+    Owner:
+      type: object
+      required: [name]
+      default:
+        name: 5
+      properties:
+        name:
+          type: string
+`
+
+func TestSchemaLevelDefault(t *testing.T) {
+	suite := newTestSuite(t, defaultSpec, "http://example.com")
+	suite.plan.Client = &stubClient{status: 200}
+	suite.plan.UseDefaults = true
+
+	dup, err := runTest(suite, &Test{Name: "pet", Path: "/pets", Method: "post"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"name": "rex", "tags": []interface{}{"good", "dog"}}
+	if !reflect.DeepEqual(dup.BodyParams, expected) {
+		t.Errorf("expected the schema default as the body, got %v", dup.BodyParams)
+	}
+	// The body is a copy, the spec's default must stay untouched.
+	dup.BodyParams.(map[string]interface{})["name"] = "changed"
+	if suite.plan.swagger.FindSchemaByName("Pet").Value.Default.(map[string]interface{})["name"] != "rex" {
+		t.Errorf("the schema default was modified")
+	}
+
+	// A default that doesn't match the schema is ignored.
+	dup, err = runTest(suite, &Test{Name: "owner", Path: "/owners", Method: "post"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, isString := dup.BodyParams.(map[string]interface{})["name"].(string); !isString {
+		t.Errorf("an invalid default should not be used: %v", dup.BodyParams)
+	}
+}
+
+func TestDefaultsProbability(t *testing.T) {
+	suite := newTestSuite(t, defaultSpec, "")
+	schema := suite.plan.swagger.FindSchemaByName("Pet")
+	for _, prob := range []float64{0, 0.5, 1} {
+		suite.plan.DefaultsProb = prob
+		defaults := 0
+		for i := 0; i < 100; i++ {
+			obj, err := newGenerator(suite).GenerateSchema("", nil, schema, suite.db, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if obj.(map[string]interface{})["name"] == "rex" {
+				defaults++
+			}
+		}
+		// Only the probabilities between 0 and 1 are random.
+		tolerance := 0
+		if prob > 0 && prob < 1 {
+			tolerance = 25
+		}
+		if expected := int(prob * 100); defaults < expected-tolerance || defaults > expected+tolerance {
+			t.Errorf("probability %v: the default was used %d times out of 100", prob, defaults)
+		}
+	}
+}
+
+func TestOptionalProbability(t *testing.T) {
+	suite := newTestSuite(t, requiredSpec, "http://example.com")
+	schema := suite.plan.swagger.FindSchemaByName("Account")
+	for _, prob := range []float64{0, 0.5, 1} {
+		suite.plan.OptionalProb = &prob
+		optional := 0
+		for i := 0; i < 100; i++ {
+			obj, err := newGenerator(suite).GenerateSchema("", nil, schema, suite.db, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			account := obj.(map[string]interface{})
+			if account["name"] == nil || account["email"] == nil {
+				t.Fatalf("probability %v: a required field was left out of %v", prob, account)
+			}
+			if _, ok := account["age"]; ok {
+				optional++
+			}
+		}
+		tolerance := 0
+		if prob > 0 && prob < 1 {
+			tolerance = 25
+		}
+		if expected := int(prob * 100); optional < expected-tolerance || optional > expected+tolerance {
+			t.Errorf("probability %v: the optional field was generated %d times out of 100", prob, optional)
+		}
+	}
+
+	// The optional fields the test sets are still sent.
+	client := &stubClient{status: 201}
+	suite.plan.Client = client
+	test := &Test{Name: "create", Path: "/accounts", Method: "post"}
+	test.BodyParams = map[string]interface{}{"age": 30}
+	prob := 0.0
+	suite.plan.OptionalProb = &prob
+	if _, err := runTest(suite, test); err != nil {
+		t.Fatal(err)
+	}
+	if body := client.requests[0].Body.(map[string]interface{}); !mqutil.InterfaceEquals(30, body["age"]) {
+		t.Errorf("expecting the age the test sets, got %v", body)
+	}
+}
+
+const exampleSpec = `
+openapi: 3.0.2
+info:
+  title: users
+  version: "1.0"
+paths:
+  /users:
+    post:
+      parameters:
+        - name: email
+          in: query
+          schema:
+            type: string
+            format: email
+          example: alice@example.com
+        - name: X-Version
+          in: header
+          schema:
+            type: string
+          x-example: v2
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            maximum: 10
+          example: 500
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/User'
+      responses:
+        '200':
+          description: created
+components:
+  schemas:
+    User:
+      type: object
+      properties:
+        nickname:
+          type: string
+          example: ally
+        age:
+          type: integer
+`
+
+func TestUseExamples(t *testing.T) {
+	suite := newTestSuite(t, exampleSpec, "http://example.com")
+	suite.plan.Client = &stubClient{status: 200}
+	for _, noExamples := range []bool{false, true} {
+		suite.plan.NoExamples = noExamples
+		dup, err := runTest(suite, &Test{Name: "user", Path: "/users", Method: "post"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		used := dup.QueryParams["email"] == "alice@example.com" && dup.HeaderParams["X-Version"] == "v2" &&
+			dup.BodyParams.(map[string]interface{})["nickname"] == "ally"
+		if used == noExamples {
+			t.Errorf("no examples %v: unexpected params %v %v %v", noExamples, dup.QueryParams, dup.HeaderParams, dup.BodyParams)
+		}
+		// An example that doesn't match its schema is ignored.
+		if limit, ok := dup.QueryParams["limit"].(int64); !ok || limit > 10 {
+			t.Errorf("expecting a generated limit instead of the invalid example, got %v", dup.QueryParams["limit"])
+		}
+	}
+}
+
+const inlineObjectSpec = `
+openapi: 3.0.2
+info:
+  title: users
+  version: "1.0"
+paths:
+  /users:
+    post:
+      parameters:
+        - name: filter
+          in: query
+          schema:
+            type: object
+            required: [role]
+            properties:
+              role:
+                type: string
+                enum: [admin, guest]
+              active:
+                type: boolean
+        - name: range
+          in: query
+          style: deepObject
+          schema:
+            type: object
+            required: [from]
+            properties:
+              from:
+                type: integer
+        - name: X-Page
+          in: header
+          schema:
+            type: object
+            required: [size]
+            properties:
+              size:
+                type: integer
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [name, address]
+              properties:
+                name:
+                  type: string
+                address:
+                  type: object
+                  required: [city]
+                  properties:
+                    city:
+                      type: string
+                      minLength: 2
+      responses:
+        '200':
+          description: created
+`
+
+func TestInlineObjectParameters(t *testing.T) {
+	suite := newTestSuite(t, inlineObjectSpec, "http://example.com")
+	client := &stubClient{status: 200}
+	suite.plan.Client = client
+	dup, err := runTest(suite, &Test{Name: "user", Path: "/users", Method: "post"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, ok := dup.QueryParams["filter"].(map[string]interface{})
+	if !ok || (filter["role"] != "admin" && filter["role"] != "guest") {
+		t.Fatalf("expecting a filter object with a role, got %v", dup.QueryParams["filter"])
+	}
+	body, ok := dup.BodyParams.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expecting an object body, got %v", dup.BodyParams)
+	}
+	address, ok := body["address"].(map[string]interface{})
+	if city, _ := address["city"].(string); !ok || len(city) < 2 || body["name"] == nil {
+		t.Errorf("expecting the required fields in the body, got %v", body)
+	}
+
+	// The objects are serialized the way the parameters' style says.
+	req := client.requests[0]
+	if req.Query["role"] != filter["role"] || len(req.Query["filter"]) != 0 {
+		t.Errorf("expecting the filter's fields as query parameters, got %v", req.Query)
+	}
+	if len(req.Query["range[from]"]) == 0 {
+		t.Errorf("expecting the range as a deep object, got %v", req.Query)
+	}
+	if !strings.HasPrefix(req.Header.Get("X-Page"), "size,") {
+		t.Errorf("expecting the page's fields in the header, got %s", req.Header.Get("X-Page"))
+	}
+}
+
+const problemSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths:
+  /pets/{id}:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      responses:
+        '200':
+          description: found
+        '400':
+          description: bad request
+        '404':
+          description: not found
+          content:
+            application/problem+json:
+              schema:
+                type: object
+                properties:
+                  type:
+                    type: string
+                  title:
+                    type: string
+                  status:
+                    type: integer
+                  code:
+                    type: integer
+`
+
+func TestProblemResponse(t *testing.T) {
+	cases := []struct {
+		status  int
+		body    string
+		matches bool
+	}{
+		{404, `{"type": "https://example.com/not-found", "title": "Not found", "status": 404, "code": 7}`, true},
+		{404, `{"title": "Not found", "status": "404"}`, false},
+		{404, `{"title": "Not found", "status": 500}`, false},
+		{404, `{"title": "Not found", "status": 404, "code": "seven"}`, false},
+		{400, `{"title": "Bad request", "status": 400, "balance": 30, "accounts": ["a", "b"]}`, true},
+		{400, `{"title": 5}`, false},
+		{400, `["not", "an", "object"]`, false},
+	}
+	for _, c := range cases {
+		suite := newTestSuite(t, problemSpec, "http://example.com")
+		suite.plan.Client = &stubClient{status: c.status, body: c.body,
+			header: http.Header{"Content-Type": []string{"application/problem+json; charset=utf-8"}}}
+		test := &Test{Name: "get", Path: "/pets/{id}", Method: "get", Expect: map[string]interface{}{"status": "fail"}}
+		test.PathParams = map[string]interface{}{"id": 1}
+		dup, err := runTest(suite, test)
+		if (err == nil) != c.matches || (dup.schemaError == nil) != c.matches {
+			t.Errorf("%d %s: expected match to be %v, error: %v, schema error: %v", c.status, c.body, c.matches, err, dup.schemaError)
+		}
+	}
+}
+
+func TestBoundaryDistribution(t *testing.T) {
+	NumberDistribution = DistBoundary
+	defer func() { NumberDistribution = DistUniform }()
+
+	min, max := 3.0, 9.0
+	intSchema := mqswag.SchemaRef{Value: spec.NewIntegerSchema().WithMin(min).WithMax(max)}
+	floatSchema := mqswag.SchemaRef{Value: spec.NewFloat64Schema().WithMin(min).WithMax(max)}
+	const n = 1000
+	hits := make(map[string]int)
+	for i := 0; i < n; i++ {
+		iv, err := generateInt(intSchema)
+		if err != nil || iv < 3 || iv > 9 {
+			t.Fatalf("int %d out of range: %v", iv, err)
+		}
+		hits["int"+strconv.FormatInt(iv, 10)]++
+		fv, err := generateFloat(floatSchema)
+		if err != nil || fv < min || fv > max {
+			t.Fatalf("float %v out of range: %v", fv, err)
+		}
+		hits["float"+strconv.FormatFloat(fv, 'g', -1, 64)]++
+	}
+	// Each boundary should come up about a quarter of the time.
+	for _, k := range []string{"int3", "int9", "float3", "float9"} {
+		if hits[k] < n/8 {
+			t.Errorf("%s was generated %d times out of %d", k, hits[k], n)
+		}
+	}
+}
+
+const deleteSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths:
+  /pet/{petId}:
+    delete:
+      parameters:
+        - name: petId
+          in: path
+          required: true
+          description: <meqa Pet.id>
+          schema:
+            type: integer
+      responses:
+        '204':
+          description: deleted
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        id:
+          type: integer
+        name:
+          type: string
+`
+
+func TestDeleteRemovesObject(t *testing.T) {
+	for _, status := range []int{204, 404, 500} {
+		suite := newTestSuite(t, deleteSpec, "http://example.com")
+		client := &stubClient{status: status}
+		suite.plan.Client = client
+		for i := 1; i <= 2; i++ {
+			suite.db.Insert("Pet", map[string]interface{}{"id": i, "name": "pet"}, nil)
+		}
+		test := &Test{Name: "delete", Path: "/pet/{petId}", Method: "delete"}
+		test.PathParams = map[string]interface{}{"petId": 1}
+		_, err := runTest(suite, test)
+		if (err != nil) != (status == 500) {
+			t.Errorf("status %d: unexpected error %v", status, err)
+		}
+		if url := client.requests[0].URL; url != "http://example.com/pet/1" {
+			t.Errorf("status %d: unexpected url %s", status, url)
+		}
+		// A deleted or already gone object is removed from the DB, the other one stays.
+		left := suite.db.Find("Pet", nil, nil, mqswag.MatchAlways, -1)
+		if expected := map[bool]int{true: 1, false: 2}[status != 500]; len(left) != expected {
+			t.Errorf("status %d: expecting %d objects left, got %v", status, expected, left)
+		}
+	}
+}
+
+func TestSelectObject(t *testing.T) {
+	suite := newTestSuite(t, deleteSpec, "http://example.com")
+	client := &stubClient{status: 204}
+	suite.plan.Client = client
+	for i, name := range []string{"rex", "tom", "max"} {
+		suite.db.Insert("Pet", map[string]interface{}{"id": i + 1, "name": name}, nil)
+	}
+	test := &Test{Name: "delete", Path: "/pet/{petId}", Method: "delete"}
+	test.Select = map[string]mqswag.Query{"Pet": {"name": {In: []interface{}{"tom"}}}}
+	if _, err := runTest(suite, test); err != nil {
+		t.Fatal(err)
+	}
+	if url := client.requests[0].URL; url != "http://example.com/pet/2" {
+		t.Errorf("expecting the selected pet deleted, got %s", url)
+	}
+
+	test = &Test{Name: "delete", Path: "/pet/{petId}", Method: "delete"}
+	test.Select = map[string]mqswag.Query{"Pet": {"name": {Equals: "tom"}}}
+	if _, err := runTest(suite, test); err == nil || len(client.requests) != 1 {
+		t.Errorf("expecting no request without a pet to select, got %v", err)
+	}
+}
+
+const ownerSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths:
+  /pet:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+      responses:
+        '200':
+          description: created
+  /pet/{petId}:
+    patch:
+      parameters:
+        - name: petId
+          in: path
+          required: true
+          description: <meqa Pet.id>
+          schema:
+            type: integer
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+      responses:
+        '200':
+          description: patched
+    delete:
+      parameters:
+        - name: petId
+          in: path
+          required: true
+          description: <meqa Pet.id>
+          schema:
+            type: integer
+      responses:
+        '200':
+          description: deleted
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        id:
+          type: integer
+        name:
+          type: string
+        owner:
+          type: object
+          properties:
+            name:
+              type: string
+`
+
+func TestPatchDoesNotShareBody(t *testing.T) {
+	suite := newTestSuite(t, ownerSpec, "http://example.com")
+	suite.plan.Client = &stubClient{status: 200}
+	create := &Test{Name: "create", Path: "/pet", Method: "post"}
+	create.BodyParams = map[string]interface{}{"id": 1, "name": "rex", "owner": map[string]interface{}{"name": "ann"}}
+	created, err := runTest(suite, create)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := mqutil.MapCopy(created.BodyParams.(map[string]interface{}))
+
+	patch := &Test{Name: "patch", Path: "/pet/{petId}", Method: "patch", Partial: true}
+	patch.PathParams = map[string]interface{}{"petId": 1}
+	patch.BodyParams = map[string]interface{}{"name": "max", "owner": map[string]interface{}{"name": "bob"}}
+	patched, err := runTest(suite, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched.BodyParams.(map[string]interface{})["owner"].(map[string]interface{})["name"] = "eve"
+
+	// Neither the patch nor later changes to its body may leak into the body the create test sent.
+	if !reflect.DeepEqual(created.BodyParams, sent) {
+		t.Errorf("create body changed from %v to %v", sent, created.BodyParams)
+	}
+	found := suite.db.Find("Pet", nil, nil, mqswag.MatchAlways, -1)
+	if len(found) != 1 {
+		t.Fatalf("expecting one pet, got %v", found)
+	}
+	pet := found[0].(map[string]interface{})
+	if pet["name"] != "max" || pet["owner"].(map[string]interface{})["name"] != "bob" {
+		t.Errorf("the patch wasn't applied to the DB: %v", pet)
+	}
+}
+
+const userOrderSpec = `
+openapi: 3.0.2
+info:
+  title: orders
+  version: "1.0"
+paths:
+  /user/{userId}/order:
+    post:
+      parameters:
+        - name: userId
+          in: path
+          required: true
+          description: <meqa User.id>
+          schema:
+            type: integer
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Order'
+      responses:
+        '200':
+          description: created
+  /order/{orderId}:
+    get:
+      parameters:
+        - name: orderId
+          in: path
+          required: true
+          description: <meqa Order.id>
+          schema:
+            type: integer
+      responses:
+        '200':
+          description: the order
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Order'
+components:
+  schemas:
+    User:
+      type: object
+      properties:
+        id:
+          type: integer
+    Order:
+      type: object
+      properties:
+        id:
+          type: integer
+        total:
+          type: integer
+`
+
+func TestAssociatedObjects(t *testing.T) {
+	suite := newTestSuite(t, userOrderSpec, "http://example.com")
+	client := &stubClient{status: 200}
+	suite.plan.Client = client
+	for _, id := range []int{1, 2} {
+		suite.db.Insert("User", map[string]interface{}{"id": id}, nil)
+	}
+	create := &Test{Name: "create", Path: "/user/{userId}/order", Method: "post"}
+	create.PathParams = map[string]interface{}{"userId": 1}
+	create.BodyParams = map[string]interface{}{"id": 10, "total": 5}
+	create.Associations = map[string]map[string]interface{}{"User": {"id": 1}}
+	if _, err := runTest(suite, create); err != nil {
+		t.Fatal(err)
+	}
+	user1 := map[string]map[string]interface{}{"User": {"id": 1}}
+	if found := suite.db.Find("Order", nil, user1, mqswag.MatchAlways, -1); len(found) != 1 {
+		t.Fatalf("expecting the order of user 1, got %v", found)
+	}
+	suite.db.Insert("Order", map[string]interface{}{"id": 20, "total": 7}, map[string]map[string]interface{}{"User": {"id": 2}})
+
+	// The order is picked from the ones of the user.
+	for user, order := range map[int]int{1: 10, 2: 20} {
+		client.requests = nil
+		client.body = fmt.Sprintf(`{"id": %d, "total": %d}`, order, map[int]int{10: 5, 20: 7}[order])
+		get := &Test{Name: "get", Path: "/order/{orderId}", Method: "get"}
+		get.Associations = map[string]map[string]interface{}{"User": {"id": user}}
+		if _, err := runTest(suite, get); err != nil {
+			t.Fatalf("user %d: %v", user, err)
+		}
+		if url := client.requests[0].URL; url != fmt.Sprintf("http://example.com/order/%d", order) {
+			t.Errorf("user %d: expecting order %d, got %s", user, order, url)
+		}
+	}
+
+	client.requests = nil
+	get := &Test{Name: "get", Path: "/order/{orderId}", Method: "get"}
+	get.Associations = map[string]map[string]interface{}{"User": {"id": 3}}
+	if _, err := runTest(suite, get); err == nil || len(client.requests) != 0 {
+		t.Errorf("expecting no request for a user without orders, got %v", err)
+	}
+}
+
+const petOrderSpec = `
+openapi: 3.0.2
+info:
+  title: orders
+  version: "1.0"
+paths:
+  /order:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Order'
+      responses:
+        '200':
+          description: created
+  /pet/{petId}/photo:
+    get:
+      parameters:
+        - name: petId
+          in: path
+          required: true
+          schema:
+            type: integer
+            description: <meqa Pet.id>
+      responses:
+        '200':
+          description: the photo
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        id:
+          type: integer
+    Order:
+      type: object
+      properties:
+        id:
+          type: integer
+          description: <meqa Order.id>
+        petId:
+          type: integer
+          description: <meqa Pet.id>
+`
+
+func TestTaggedValuesFromDB(t *testing.T) {
+	suite := newTestSuite(t, petOrderSpec, "http://example.com")
+	client := &stubClient{status: 200}
+	suite.plan.Client = client
+
+	// Without a pet the reference is generated.
+	create, err := runTest(suite, &Test{Name: "create", Path: "/order", Method: "post"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := create.BodyParams.(map[string]interface{})["petId"]; !ok {
+		t.Errorf("expecting a generated petId, got %v", create.BodyParams)
+	}
+
+	suite.db.Insert("Pet", map[string]interface{}{"id": 7}, nil)
+	create, err = runTest(suite, &Test{Name: "create", Path: "/order", Method: "post"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order := create.BodyParams.(map[string]interface{}); !mqutil.InterfaceEquals(7, order["petId"]) {
+		t.Errorf("expecting the order of pet 7, got %v", order)
+	}
+
+	// The tag can be on the parameter's schema.
+	client.requests = nil
+	if _, err := runTest(suite, &Test{Name: "photo", Path: "/pet/{petId}/photo", Method: "get"}); err != nil {
+		t.Fatal(err)
+	}
+	if url := client.requests[0].URL; url != "http://example.com/pet/7/photo" {
+		t.Errorf("expecting the photo of pet 7, got %s", url)
+	}
+}
+
+const lifecyclePlan = `
+/pets:
+- name: create
+  path: /pet
+  method: post
+  bodyParams:
+    id: 1
+    name: rex
+- name: update
+  path: /pet/{petId}
+  method: patch
+  partial: true
+  pathParams:
+    petId: 1
+  bodyParams:
+    name: max
+- name: delete
+  path: /pet/{petId}
+  method: delete
+  pathParams:
+    petId: 1
+`
+
+func TestMutationCounts(t *testing.T) {
+	suite := newTestSuite(t, ownerSpec, "http://example.com")
+	plan := suite.plan
+	plan.Client = &stubClient{status: 200}
+	if err := plan.AddFromString(lifecyclePlan); err != nil {
+		t.Fatal(err)
+	}
+	// The counts of each suite run are added up.
+	for i := 0; i < 2; i++ {
+		if _, err := plan.Run("/pets", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	counts := plan.db.MutationCounts()
+	expected := map[string]mqswag.MutationCounts{"Pet": {Created: 2, Updated: 2, Deleted: 2}}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expecting counts %v, got %v", expected, counts)
+	}
+	output := captureStdout(plan.PrintSummary)
+	if !strings.Contains(output, "Pet: 2/2/2") {
+		t.Errorf("the summary doesn't have the counts:\n%s", output)
+	}
+}
+
+// captureStdout returns what f prints to the console.
+func captureStdout(f func()) string {
+	r, w, _ := os.Pipe()
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		done <- b
+	}()
+	f()
+	w.Close()
+	os.Stdout = stdout
+	return string(<-done)
+}
+
+const quietPlan = `
+/items:
+- name: quiet_pass
+  path: /items/{id}
+  method: put
+  pathParams:
+    id: 1
+- name: quiet_fail
+  path: /items/{id}
+  method: put
+  pathParams:
+    id: 2
+  expect:
+    status: 404
+`
+
+func TestQuietOutput(t *testing.T) {
+	suite := newTestSuite(t, itemSpec, "http://example.com")
+	plan := suite.plan
+	plan.Client = &stubClient{status: 200, body: `{"name":"widget"}`}
+	plan.Quiet = true
+	if err := plan.AddFromString(quietPlan); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	output := captureStdout(func() {
+		_, err = plan.Run("/items", nil)
+	})
+	if err == nil {
+		t.Fatal("expecting the second test to fail")
+	}
+	if strings.Contains(output, "quiet_pass") || strings.Contains(output, "/items/1") {
+		t.Errorf("the passing test's output is printed:\n%s", output)
+	}
+	for _, s := range []string{"Running test case: quiet_fail", "... request: PUT http://example.com/items/2", "... response: status 200", `body: {"name":"widget"}`} {
+		if !strings.Contains(output, s) {
+			t.Errorf("the failing test's output doesn't have %q:\n%s", s, output)
+		}
+	}
+}
+
+func TestGenerateEnumWithPattern(t *testing.T) {
+	s := spec.NewStringSchema().WithPattern("^a")
+	s.Enum = []interface{}{"apple", "banana", "avocado", "cherry"}
+	seen := make(map[interface{}]bool)
+	for i := 0; i < 100; i++ {
+		v, err := generateEnum(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[v] = true
+	}
+	if len(seen) != 2 || !seen["apple"] || !seen["avocado"] {
+		t.Errorf("expecting only the enum values matching the pattern, got %v", seen)
+	}
+
+	s.Pattern = "^z"
+	if _, err := generateEnum(s); err == nil {
+		t.Errorf("expecting an error when no enum value matches the pattern")
+	}
+}
+
+func TestGenerateNullableEnum(t *testing.T) {
+	s := spec.NewIntegerSchema()
+	s.Enum = []interface{}{1.0, 2.0, nil}
+	for _, nullable := range []bool{false, true} {
+		s.Nullable = nullable
+		seen := make(map[interface{}]bool)
+		for i := 0; i < 200; i++ {
+			v, err := generateEnum(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := v.(int64); v != nil && !ok {
+				t.Fatalf("expecting an int64 for an integer enum, got %T", v)
+			}
+			seen[v] = true
+		}
+		if len(seen) != map[bool]int{false: 2, true: 3}[nullable] || seen[nil] != nullable {
+			t.Errorf("nullable %v: unexpected values %v", nullable, seen)
+		}
+	}
+}
+
+func TestGenerateNullable(t *testing.T) {
+	suite := newTestSuite(t, userSpec, "")
+	nickname := spec.NewStringSchema()
+	nickname.Nullable = true
+	schema := mqswag.SchemaRef{Value: spec.NewObjectSchema().WithProperty("name", spec.NewStringSchema()).
+		WithProperty("nickname", nickname)}
+	nulls := 0
+	for i := 0; i < 200; i++ {
+		obj, err := newGenerator(suite).GenerateSchema("", nil, schema, suite.db, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := obj.(map[string]interface{})
+		if m["name"] == nil {
+			t.Fatalf("a field that isn't nullable was null: %v", m)
+		}
+		if v, ok := m["nickname"]; ok && v == nil {
+			nulls++
+		}
+	}
+	if nulls == 0 || nulls > 100 {
+		t.Errorf("expecting the nullable field to be null occasionally, it was null %d times of 200", nulls)
+	}
+}
+
+const listSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths:
+  /pets:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+      responses:
+        '200':
+          description: created
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+    get:
+      responses:
+        '200':
+          description: listed
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: '#/components/schemas/Pet'
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        id:
+          type: integer
+        name:
+          type: string
+`
+
+func TestCreatedObjectListed(t *testing.T) {
+	for _, forget := range []bool{false, true} {
+		var pets []interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if r.Method == "POST" {
+				var pet map[string]interface{}
+				json.NewDecoder(r.Body).Decode(&pet)
+				pet["id"] = len(pets) + 1
+				if !forget {
+					pets = append(pets, pet)
+				}
+				json.NewEncoder(w).Encode(pet)
+				return
+			}
+			json.NewEncoder(w).Encode(append([]interface{}{map[string]interface{}{"id": 100, "name": "other"}}, pets...))
+		}))
+		suite := newTestSuite(t, listSpec, server.URL)
+		suite.plan.Client, _ = NewClient(ClientHTTP, nil, nil)
+		create := &Test{Name: "create", Path: "/pets", Method: "post"}
+		create.BodyParams = map[string]interface{}{"name": "rex"}
+		if _, err := runTest(suite, create); err != nil {
+			t.Fatal(err)
+		}
+		_, err := runTest(suite, &Test{Name: "list", Path: "/pets", Method: "get"})
+		server.Close()
+		if forget && (err == nil || !strings.Contains(err.Error(), "client object not found")) {
+			t.Errorf("expecting the list to miss the created pet, got %v", err)
+		} else if !forget && err != nil {
+			t.Errorf("the created pet should be in the list: %v", err)
+		}
+	}
+}
+
+const paramsSpec = `
+openapi: 3.0.2
+info:
+  title: search
+  version: "1.0"
+paths:
+  /owners/{ownerId}/pets:
+    get:
+      parameters:
+        - name: ownerId
+          in: path
+          required: true
+          schema:
+            type: integer
+        - name: limit
+          in: query
+          schema:
+            type: integer
+        - name: sort
+          in: query
+          schema:
+            type: string
+      responses:
+        '200':
+          description: listed
+`
+
+func TestResolveAllParameters(t *testing.T) {
+	suite := newTestSuite(t, paramsSpec, "http://example.com")
+	client := &stubClient{status: 200}
+	suite.plan.Client = client
+	dup, err := runTest(suite, &Test{Name: "search", Path: "/owners/{ownerId}/pets", Method: "get"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dup.PathParams["ownerId"] == nil || dup.QueryParams["limit"] == nil || dup.QueryParams["sort"] == nil {
+		t.Errorf("expecting all three parameters, got path %v query %v", dup.PathParams, dup.QueryParams)
+	}
+	if req := client.requests[0]; len(req.Query) != 2 || strings.Contains(req.URL, "{") {
+		t.Errorf("unexpected request: %s %v", req.URL, req.Query)
+	}
+}
+
+const nestedSpec = `
+openapi: 3.0.2
+info:
+  title: owners
+  version: "1.0"
+paths: {}
+components:
+  schemas:
+    Address:
+      type: object
+      required: [street, zip]
+      properties:
+        street:
+          type: string
+        zip:
+          type: string
+          pattern: '^[0-9]{5}$'
+    Pet:
+      type: object
+      required: [kind]
+      properties:
+        kind:
+          type: string
+          enum: [cat, dog]
+        age:
+          type: integer
+          minimum: 0
+          maximum: 20
+    Owner:
+      type: object
+      required: [name, address, pets]
+      properties:
+        name:
+          type: string
+        address:
+          $ref: '#/components/schemas/Address'
+        pets:
+          type: array
+          minItems: 2
+          maxItems: 4
+          items:
+            $ref: '#/components/schemas/Pet'
+`
+
+func TestGenerateNestedSchemas(t *testing.T) {
+	suite := newTestSuite(t, nestedSpec, "")
+	swagger := suite.plan.swagger
+	schema := swagger.FindSchemaByName("Owner")
+	for i := 0; i < 20; i++ {
+		obj, err := newGenerator(suite).GenerateSchema("", nil, schema, suite.db, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := schema.Parses("", obj, make(map[string][]interface{}), true, mqswag.MatchOptions{Strict: true}, swagger); err != nil {
+			t.Fatalf("generated object doesn't match the schema: %v", err)
+		}
+		owner := obj.(map[string]interface{})
+		if address, ok := owner["address"].(map[string]interface{}); !ok || address["street"] == nil || address["zip"] == nil {
+			t.Errorf("unexpected address: %v", owner["address"])
+		}
+		pets, ok := owner["pets"].([]interface{})
+		if !ok || len(pets) < 2 || len(pets) > 4 {
+			t.Fatalf("unexpected pets: %v", owner["pets"])
+		}
+		for _, p := range pets {
+			if kind := p.(map[string]interface{})["kind"]; kind != "cat" && kind != "dog" {
+				t.Errorf("pet kind %v is not in the enum", kind)
+			}
+		}
+	}
+}
+
+func TestGenerateEmail(t *testing.T) {
+	emailRe := regexp.MustCompile(`^[a-z0-9]+@[a-z]+\.[a-z]+$`)
+	for _, max := range []uint64{0, 6, 10, 13, 20, 100} {
+		s := spec.NewStringSchema().WithFormat("email")
+		if max > 0 {
+			s = s.WithMaxLength(int64(max))
+		}
+		str, err := generateString(mqswag.SchemaRef{Value: s}, "email")
+		if err != nil {
+			t.Fatalf("max %d: %v", max, err)
+		}
+		if !emailRe.MatchString(str) || (max > 0 && uint64(len(str)) > max) {
+			t.Errorf("max %d: invalid email %s", max, str)
+		}
+	}
+	if _, err := generateString(mqswag.SchemaRef{Value: spec.NewStringSchema().WithFormat("email").WithMaxLength(5)}, ""); err == nil {
+		t.Errorf("expecting an error when the max length is too short for an email")
+	}
+}
+
+func TestGenerateURIAndHostname(t *testing.T) {
+	for _, format := range []string{mqswag.FormatURI, mqswag.FormatHostname} {
+		for _, max := range []uint64{0, 8, 12, 24, 100} {
+			s := spec.NewStringSchema().WithFormat(format)
+			if max > 0 {
+				s = s.WithMaxLength(int64(max))
+			}
+			str, err := generateString(mqswag.SchemaRef{Value: s}, "callback_")
+			if err != nil {
+				if format == mqswag.FormatURI && max == 8 {
+					continue
+				}
+				t.Fatalf("%s, max %d: %v", format, max, err)
+			}
+			if !mqswag.Validate(mqswag.SchemaRef{Value: s}, str) || (max > 0 && uint64(len(str)) > max) {
+				t.Errorf("%s, max %d: invalid %s", format, max, str)
+			}
+		}
+	}
+	uri, _ := generateString(mqswag.SchemaRef{Value: spec.NewStringSchema().WithFormat(mqswag.FormatURI)}, "callback_")
+	if u, err := url.Parse(uri); err != nil || u.Scheme != "https" || u.Path != "/callback" {
+		t.Errorf("expecting an https url with the field name as the path, got %s", uri)
+	}
+	if _, err := generateString(mqswag.SchemaRef{Value: spec.NewStringSchema().WithFormat(mqswag.FormatURI).WithMaxLength(8)}, ""); err == nil {
+		t.Errorf("expecting an error when the max length is too short for a uri")
+	}
+	for str, valid := range map[string]bool{"api.example.com": true, "-bad.com": false, "a..b": false, "under_score": false} {
+		if mqswag.ValidFormat(mqswag.FormatHostname, str) != valid {
+			t.Errorf("expecting hostname %s to be valid to be %v", str, valid)
+		}
+	}
+}
+
+func TestGenerateIP(t *testing.T) {
+	compressed := false
+	for i := 0; i < 50; i++ {
+		for _, format := range []string{mqswag.FormatIPv4, mqswag.FormatIPv6} {
+			s := mqswag.SchemaRef{Value: spec.NewStringSchema().WithFormat(format)}
+			str, err := generateString(s, "address")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ip := net.ParseIP(str)
+			if ip == nil || (ip.To4() != nil) != (format == mqswag.FormatIPv4) || !mqswag.Validate(s, str) {
+				t.Errorf("%s is not an %s address", str, format)
+			}
+			compressed = compressed || strings.Contains(str, "::")
+		}
+	}
+	if !compressed {
+		t.Errorf("expecting some of the ipv6 addresses to be compressed")
+	}
+	s := mqswag.SchemaRef{Value: spec.NewStringSchema().WithFormat(mqswag.FormatIPv6).WithMaxLength(12)}
+	if str, err := generateString(s, ""); err != nil || net.ParseIP(str) == nil || len(str) > 12 {
+		t.Errorf("expecting a compressed ipv6 address that fits in 12 characters, got %s %v", str, err)
+	}
+	if mqswag.ValidFormat(mqswag.FormatIPv4, "::1") || mqswag.ValidFormat(mqswag.FormatIPv6, "10.0.0.1") ||
+		mqswag.ValidFormat(mqswag.FormatIPv4, "256.1.1.1") {
+		t.Errorf("expecting the addresses of the other version and the invalid ones to be rejected")
+	}
+}
+
+func TestGenerateJsonPointer(t *testing.T) {
+	for _, format := range []string{mqswag.FormatJsonPointer, mqswag.FormatRelativeJsonPointer} {
+		s := mqswag.SchemaRef{Value: spec.NewStringSchema().WithFormat(format)}
+		for _, prefix := range []string{"path", "a/b~c", ""} {
+			str, err := generateString(s, prefix)
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			if !mqswag.Validate(s, str) {
+				t.Errorf("%s: %q is not valid", format, str)
+			}
+		}
+	}
+}
+
+func TestGenerateUUID(t *testing.T) {
+	uuidRe := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	s := mqswag.SchemaRef{Value: spec.NewStringSchema().WithFormat("uuid")}
+	var generated []string
+	for i := 0; i < 2; i++ {
+		mqutil.Seed(42)
+		str, err := generateString(s, "id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !uuidRe.MatchString(str) {
+			t.Errorf("%s is not a version 4 uuid", str)
+		}
+		generated = append(generated, str)
+	}
+	if generated[0] != generated[1] {
+		t.Errorf("expecting the same uuid for the same seed, got %v", generated)
+	}
+}
+
+func TestGenerateStringMinLength(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		s := mqswag.SchemaRef{Value: spec.NewStringSchema().WithMinLength(20)}
+		str, err := generateString(s, "name")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := utf8.RuneCountInString(str); n < 20 || !strings.HasPrefix(str, "name") {
+			t.Errorf("expecting the prefix and at least 20 runes, got %s (%d)", str, n)
+		}
+		if !mqswag.Validate(s, str) {
+			t.Errorf("%s doesn't validate", str)
+		}
+	}
+	// The max length cuts the string, the prefix included.
+	s := mqswag.SchemaRef{Value: spec.NewStringSchema().WithMaxLength(3)}
+	if str, _ := generateString(s, "name"); str != "nam" {
+		t.Errorf("expecting the string to be cut to 3 runes, got %s", str)
+	}
+}
+
+const tagsSpec = `
+openapi: 3.0.2
+info:
+  title: tags
+  version: "1.0"
+paths: {}
+components:
+  schemas:
+    Tagged:
+      type: object
+      properties:
+        codes:
+          type: array
+          minItems: 2
+          maxItems: 5
+          items:
+            type: string
+            minLength: 3
+            maxLength: 3
+        words:
+          type: array
+          items:
+            type: string
+            pattern: '^[a-z]{3}$'
+`
+
+func TestGenerateArrayItemConstraints(t *testing.T) {
+	suite := newTestSuite(t, tagsSpec, "")
+	schema := suite.plan.swagger.FindSchemaByName("Tagged")
+	for i := 0; i < 20; i++ {
+		obj, err := newGenerator(suite).GenerateSchema("", nil, schema, suite.db, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := obj.(map[string]interface{})
+		for _, field := range []string{"codes", "words"} {
+			items, _ := m[field].([]interface{})
+			if len(items) == 0 {
+				t.Fatalf("%s: expecting items, got %v", field, m[field])
+			}
+			for _, item := range items {
+				if str, ok := item.(string); !ok || utf8.RuneCountInString(str) != 3 {
+					t.Errorf("%s: expecting 3 rune strings, got %v", field, items)
+				}
+			}
+		}
+		if !schema.Matches(obj, mqswag.MatchOptions{}, suite.plan.swagger) {
+			t.Errorf("generated object doesn't match the schema: %v", obj)
+		}
+	}
+}
+
+func TestSeedRepeatsGeneration(t *testing.T) {
+	suite := newTestSuite(t, userSpec, "")
+	schema := suite.plan.swagger.FindSchemaByName("User")
+	words := mqswag.SchemaRef{Value: spec.NewArraySchema().WithItems(spec.NewStringSchema().WithPattern(`^[a-z]{2,5}-\d+$`))}
+	var generated []interface{}
+	for i := 0; i < 2; i++ {
+		mqutil.Seed(7)
+		obj, err := newGenerator(suite).GenerateSchema("", nil, schema, suite.db, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ar, err := newGenerator(suite).GenerateSchema("", nil, words, suite.db, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		generated = append(generated, []interface{}{obj, ar})
+	}
+	if !reflect.DeepEqual(generated[0], generated[1]) {
+		t.Errorf("expecting the same values for the same seed, got %v", generated)
+	}
+}
+
+func TestGenerateRegex(t *testing.T) {
+	for _, pattern := range []string{`^[a-z]{3}$`, `^\d{3}-\d{4}$`, `^(foo|bar)+[^a-z]?x*$`, `^[A-F0-9]{2}(:[A-F0-9]{2}){5}$`, `^.{1,8}$`} {
+		re := regexp.MustCompile(pattern)
+		for i := 0; i < 20; i++ {
+			str, err := generateRegex(pattern, len(pattern)*2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !re.MatchString(str) {
+				t.Errorf("%s doesn't match %s", str, pattern)
+			}
+		}
+	}
+	if _, err := generateRegex(`[a-`, 10); err == nil {
+		t.Errorf("expecting an error for an invalid pattern")
+	}
+}
+
+func TestGenerateUniqueItems(t *testing.T) {
+	suite := newTestSuite(t, tagsSpec, "")
+	object := spec.NewObjectSchema().WithProperty("size", spec.NewIntegerSchema().WithMin(1).WithMax(2))
+	for _, items := range []*spec.Schema{spec.NewIntegerSchema().WithMin(1).WithMax(3), object} {
+		s := spec.NewArraySchema().WithItems(items).WithUniqueItems(true).WithMinItems(2).WithMaxItems(5)
+		schema := mqswag.SchemaRef{Value: s}
+		for i := 0; i < 20; i++ {
+			obj, err := newGenerator(suite).GenerateSchema("", nil, schema, suite.db, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ar := obj.([]interface{})
+			if _, _, found := mqswag.DuplicateItems(ar); found || len(ar) < 2 {
+				t.Fatalf("expecting at least 2 unique items, got %v", ar)
+			}
+			if !schema.Matches(obj, mqswag.MatchOptions{}, suite.plan.swagger) {
+				t.Errorf("generated array doesn't match the schema: %v", obj)
+			}
+		}
+	}
+
+	s := spec.NewArraySchema().WithItems(spec.NewBoolSchema()).WithUniqueItems(true).WithMinItems(3)
+	_, err := newGenerator(suite).GenerateSchema("", nil, mqswag.SchemaRef{Value: s}, suite.db, 0)
+	if err == nil || !strings.Contains(err.Error(), "3 unique items") {
+		t.Errorf("expecting an error for 3 unique booleans, got %v", err)
+	}
+}
+
+const orderSpec = `
+openapi: 3.0.2
+info:
+  title: orders
+  version: "1.0"
+paths: {}
+components:
+  schemas:
+    Order:
+      type: object
+      required: [lines]
+      properties:
+        lines:
+          description: <meqa LineItem unique=sku>
+          type: array
+          minItems: 3
+          maxItems: 3
+          items:
+            $ref: '#/components/schemas/LineItem'
+    LineItem:
+      type: object
+      required: [sku, quantity]
+      properties:
+        sku:
+          type: string
+          enum: [A1, B2, C3, D4, E5, F6]
+        quantity:
+          type: integer
+          minimum: 1
+`
+
+func TestGenerateUniqueItemKey(t *testing.T) {
+	suite := newTestSuite(t, orderSpec, "")
+	schema := suite.plan.swagger.FindSchemaByName("Order")
+	for i := 0; i < 20; i++ {
+		obj, err := newGenerator(suite).GenerateSchema("", nil, schema, suite.db, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := obj.(map[string]interface{})["lines"].([]interface{})
+		skus := make(map[interface{}]bool)
+		for _, line := range lines {
+			skus[line.(map[string]interface{})["sku"]] = true
+		}
+		if len(lines) != 3 || len(skus) != 3 {
+			t.Errorf("expecting 3 line items with distinct skus, got %v", lines)
+		}
+		if !schema.Matches(obj, mqswag.MatchOptions{}, suite.plan.swagger) {
+			t.Errorf("generated object doesn't match the schema: %v", obj)
+		}
+	}
+}
+
+func TestNoValidate(t *testing.T) {
+	for _, noValidate := range []bool{false, true} {
+		suite := newTestSuite(t, userSpec, "http://example.com")
+		suite.plan.NoValidate = noValidate
+		suite.plan.Client = &stubClient{status: 200, body: `{"id": "abc", "name": "joe"}`}
+		dup, err := runTest(suite, &Test{Name: "create", Path: "/users", Method: "post"})
+		if (err == nil) != noValidate {
+			t.Errorf("no validate %v: unexpected result %v", noValidate, err)
+		}
+		if (dup.schemaError == nil) != noValidate {
+			t.Errorf("no validate %v: unexpected schema error %v", noValidate, dup.schemaError)
+		}
+
+		// The status is still checked.
+		suite.plan.Client = &stubClient{status: 500}
+		if _, err := runTest(suite, &Test{Name: "create", Path: "/users", Method: "post"}); err == nil {
+			t.Errorf("no validate %v: expecting a failed status to fail the test", noValidate)
+		}
+	}
+}
+
+const malformedPlan = `
+/users:
+- name: create
+  path: /users
+  method: post
+- name: batch
+  path: /users/batch
+  method: post
+`
+
+func TestMalformedResponseFailsTest(t *testing.T) {
+	suite := newTestSuite(t, userSpec, "http://example.com")
+	plan := suite.plan
+	plan.Client = &stubClient{status: 200, body: `{"id": "abc", "name": "joe"}`}
+	if err := plan.AddFromString(malformedPlan); err != nil {
+		t.Fatal(err)
+	}
+	counts, err := plan.Run("/users", nil)
+	if err == nil || err.(mqutil.Error).Type() != mqutil.ErrExpect {
+		t.Errorf("expecting the malformed response to fail the test, got %v", err)
+	}
+	// The run goes on with the next test.
+	if counts[mqutil.Failed] != 1 || counts[mqutil.SchemaMismatch] != 1 || counts[mqutil.Passed] != 1 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+}
+
+func TestGenerateStringMaxLength(t *testing.T) {
+	for _, s := range []*spec.Schema{
+		spec.NewStringSchema().WithMaxLength(8),
+		spec.NewStringSchema().WithPattern("^[a-zé]{10,20}$").WithMaxLength(8),
+		spec.NewStringSchema().WithFormat("uuid").WithMaxLength(8),
+		spec.NewStringSchema().WithMinLength(8).WithMaxLength(8),
+	} {
+		for i := 0; i < 20; i++ {
+			str, err := generateString(mqswag.SchemaRef{Value: s}, "description")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := utf8.RuneCountInString(str); n > 8 || (s.MinLength > 0 && n < 8) {
+				t.Errorf("%s has %d runes, expecting at most 8", str, n)
+			}
+		}
+	}
+
+	s := spec.NewStringSchema().WithMinLength(10).WithMaxLength(8)
+	_, err := generateString(mqswag.SchemaRef{Value: s}, "description")
+	if e, ok := err.(mqutil.Error); !ok || e.Type() != mqutil.ErrInvalid {
+		t.Errorf("expecting an invalid error for the conflicting lengths, got %v", err)
+	}
+}
+
+func TestGenerateMultipleOf(t *testing.T) {
+	for _, dist := range []string{DistUniform, DistBoundary, DistLog} {
+		NumberDistribution = dist
+		f := spec.NewFloat64Schema().WithMin(0.1).WithMax(2.9)
+		f.MultipleOf = new(float64)
+		*f.MultipleOf = 0.25
+		i := spec.NewIntegerSchema().WithMin(3).WithMax(97)
+		i.MultipleOf = new(float64)
+		*i.MultipleOf = 10
+		for n := 0; n < 100; n++ {
+			v, err := generateFloat(mqswag.SchemaRef{Value: f})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v < 0.1 || v > 2.9 || math.Mod(v, 0.25) != 0 {
+				t.Errorf("%s: %v is not a multiple of 0.25 in [0.1, 2.9]", dist, v)
+			}
+			k, err := generateInt(mqswag.SchemaRef{Value: i})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k < 3 || k > 97 || k%10 != 0 {
+				t.Errorf("%s: %v is not a multiple of 10 in [3, 97]", dist, k)
+			}
+		}
+	}
+	NumberDistribution = DistUniform
+
+	i := spec.NewIntegerSchema().WithMin(11).WithMax(19)
+	i.MultipleOf = new(float64)
+	*i.MultipleOf = 10
+	if _, err := generateInt(mqswag.SchemaRef{Value: i}); err == nil {
+		t.Errorf("expecting an error when there is no multiple in the range")
+	}
+}
+
+const captureSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths:
+  /pet:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+      responses:
+        '200':
+          description: created
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+  /pet/{petId}:
+    get:
+      parameters:
+        - name: petId
+          in: path
+          required: true
+          description: <meqa Pet.id>
+          schema:
+            type: integer
+      responses:
+        '200':
+          description: found
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+components:
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      properties:
+        id:
+          type: integer
+          readOnly: true
+        name:
+          type: string
+`
+
+const capturePlan = `
+/pets:
+- name: create
+  path: /pet
+  method: post
+- name: get
+  path: /pet/{petId}
+  method: get
+`
+
+func TestCaptureCreatedObject(t *testing.T) {
+	suite := newTestSuite(t, captureSpec, "http://example.com")
+	plan := suite.plan
+	client := &stubClient{status: 200, body: `{"id": 4242, "name": "rex"}`}
+	plan.Client = client
+	if err := plan.AddFromString(capturePlan); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plan.Run("/pets", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.requests) != 2 {
+		t.Fatalf("expecting 2 requests, got %d", len(client.requests))
+	}
+	if url := client.requests[1].URL; url != "http://example.com/pet/4242" {
+		t.Errorf("expecting the get to use the server assigned id, got %s", url)
+	}
+}
+
+const untaggedSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths:
+  /pet:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+      responses:
+        '200':
+          description: created
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+  /pet/{key}:
+    parameters:
+      - name: key
+        in: path
+        required: true
+        schema:
+          type: integer
+    get:
+      responses:
+        '200':
+          description: found
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+components:
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      properties:
+        id:
+          type: integer
+          readOnly: true
+        name:
+          type: string
+`
+
+const untaggedPlan = `
+/pets:
+- name: create
+  path: /pet
+  method: post
+- name: get
+  path: /pet/{key}
+  method: get
+`
+
+func TestTagMappingResolvesParameter(t *testing.T) {
+	for _, mapped := range []bool{false, true} {
+		suite := newTestSuite(t, untaggedSpec, "http://example.com")
+		plan := suite.plan
+		if mapped {
+			mapping := &mqswag.TagMapping{Parameters: map[string]map[string]string{"get /pet/{key}": {"key": "Pet.id"}}}
+			if err := plan.swagger.ApplyTags(mapping); err != nil {
+				t.Fatal(err)
+			}
+		}
+		client := &stubClient{status: 200, body: `{"id": 4242, "name": "rex"}`}
+		plan.Client = client
+		if err := plan.AddFromString(untaggedPlan); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := plan.Run("/pets", nil); err != nil {
+			t.Fatal(err)
+		}
+		if url := client.requests[1].URL; (url == "http://example.com/pet/4242") != mapped {
+			t.Errorf("mapped %v: unexpected url %s", mapped, url)
+		}
+	}
+}
+
+func TestLargeIntegerId(t *testing.T) {
+	// 2^53+1 is the first integer a float64 can't hold.
+	for _, c := range []struct {
+		expectId string
+		passes   bool
+	}{
+		{"9007199254740993", true},
+		{"9007199254740992", false},
+	} {
+		suite := newTestSuite(t, captureSpec, "http://example.com")
+		plan := suite.plan
+		client := &stubClient{status: 200, body: `{"id": 9007199254740993, "name": "rex"}`}
+		plan.Client = client
+		planYaml := capturePlan + "- name: get again\n  path: /pet/{petId}\n  method: get\n" +
+			"  pathParams:\n    petId: '{{create.outputs.id}}'\n  expect:\n    body:\n      id: " + c.expectId + "\n"
+		if err := plan.AddFromString(planYaml); err != nil {
+			t.Fatal(err)
+		}
+		_, err := plan.Run("/pets", nil)
+		if (err == nil) != c.passes {
+			t.Errorf("expecting the id %s to pass to be %v, got %v", c.expectId, c.passes, err)
+		}
+		if len(client.requests) != 3 {
+			t.Fatalf("expecting 3 requests, got %d", len(client.requests))
+		}
+		for _, req := range client.requests[1:] {
+			if req.URL != "http://example.com/pet/9007199254740993" {
+				t.Errorf("expecting the id to keep its precision, got %s", req.URL)
+			}
+		}
+	}
+}
+
+func TestResolveResponseReference(t *testing.T) {
+	cases := []struct {
+		key string
+		url string
+		err string
+	}{
+		{"{{create pet.response.id}}", "http://example.com/pet/4242", ""},
+		{"{{adopt pet.response.id}}", "", "there is no earlier test named adopt pet"},
+		{"{{create pet.response.owner}}", "", "test create pet has no response.owner"},
+	}
+	for _, c := range cases {
+		suite := newTestSuite(t, untaggedSpec, "http://example.com")
+		plan := suite.plan
+		client := &stubClient{status: 200, body: `{"id": 4242, "name": "rex"}`}
+		plan.Client = client
+		planYaml := "/pets:\n- name: create pet\n  path: /pet\n  method: post\n" +
+			"- name: get\n  path: /pet/{key}\n  method: get\n  pathParams:\n    key: \"" + c.key + "\"\n"
+		if err := plan.AddFromString(planYaml); err != nil {
+			t.Fatal(err)
+		}
+		_, err := plan.Run("/pets", nil)
+		if len(c.err) == 0 {
+			if err != nil || len(client.requests) != 2 || client.requests[1].URL != c.url {
+				t.Errorf("%s: expecting %s, got %v", c.key, c.url, err)
+			}
+			continue
+		}
+		if err == nil || err.(mqutil.Error).Type() != mqutil.ErrNotFound || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expecting error %q, got %v", c.key, c.err, err)
+		}
+		if len(client.requests) != 1 {
+			t.Errorf("%s: the test with the unresolved reference should not be sent", c.key)
+		}
+	}
+}
+
+func TestStringParamsResolveWithHistory(t *testing.T) {
+	h := &TestHistory{}
+	body := map[string]interface{}{"id": 5, "name": "rex", "tags": []interface{}{map[string]interface{}{"id": 7}, map[string]interface{}{"id": 8}}}
+	h.Append(&Test{Name: "create", Expect: map[string]interface{}{ExpectBody: body}})
+	for str, expected := range map[string]interface{}{
+		"{{create.response.id}}":                          5,
+		"{{ create.outputs.name }}":                       "rex",
+		"pets/{{create.response.id}}/tags":                "pets/5/tags",
+		"{{create.response.name}}-{{seq}}":                "rex-{{seq}}",
+		"{{create.response.name}}-{{create.response.id}}": "rex-5",
+		"{{create.response.tags.1.id}}":                   8,
+		"no reference":                                    nil,
+	} {
+		result, err := StringParamsResolveWithHistory(str, h)
+		if err != nil || result != expected {
+			t.Errorf("%s: expecting %v, got %v %v", str, expected, result, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package mqplan
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// redact hides the suite's credentials in a string that is printed or logged, since the api key can be in
+// a header, the query or a cookie.
+func (t *Test) redact(s string) string {
+	if mqutil.LogSecrets || t.suite == nil {
+		return s
+	}
+	for _, secret := range []string{t.suite.ApiKey, t.suite.ApiToken, t.suite.Password} {
+		if len(secret) > 0 {
+			s = strings.Replace(s, secret, mqutil.Redacted, -1)
+		}
+	}
+	return s
+}
+
+// requestHeader returns the headers of the request as the clients send them, with the credentials.
+func requestHeader(req *Request) http.Header {
+	header := http.Header{}
+	for k, v := range req.Header {
+		header[k] = v
+	}
+	if len(req.Token) > 0 {
+		header.Set("Authorization", "Bearer "+req.Token)
+	} else if len(req.Username) > 0 {
+		auth := base64.StdEncoding.EncodeToString([]byte(req.Username + ":" + req.Password))
+		header.Set("Authorization", "Basic "+auth)
+	}
+	return header
+}
+
+// writeHeader writes the headers sorted by name, with the sensitive ones hidden.
+func (t *Test) writeHeader(b *strings.Builder, header http.Header) {
+	var names []string
+	for k := range header {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		fmt.Fprintf(b, "%s: %s\n", k, t.redact(mqutil.RedactHeader(k, strings.Join(header[k], ", "))))
+	}
+}
+
+// logExchange logs the whole request and the response it got, or the error, in the verbose mode.
+func (t *Test) logExchange(req *Request, resp *Response, err error) {
+	var b strings.Builder
+	target := req.URL
+	if len(req.Query) > 0 {
+		query := url.Values{}
+		for k, v := range req.Query {
+			query.Set(k, v)
+		}
+		target += "?" + query.Encode()
+	}
+	fmt.Fprintf(&b, "--> %s %s\n", strings.ToUpper(req.Method), t.redact(target))
+	t.writeHeader(&b, requestHeader(req))
+	if len(req.Form) > 0 {
+		form := url.Values{}
+		for k, v := range req.Form {
+			form.Set(k, v)
+		}
+		fmt.Fprintf(&b, "\n%s\n", t.redact(form.Encode()))
+	}
+	for k, v := range req.Files {
+		fmt.Fprintf(&b, "file %s: %s\n", k, v)
+	}
+	if req.Body != nil {
+		body, _ := json.Marshal(req.Body)
+		fmt.Fprintf(&b, "\n%s\n", t.redact(string(body)))
+	}
+	if err != nil {
+		fmt.Fprintf(&b, "<-- error: %s\n", t.redact(err.Error()))
+	} else {
+		fmt.Fprintf(&b, "<-- %d %s\n", resp.StatusCode(), http.StatusText(resp.StatusCode()))
+		t.writeHeader(&b, resp.Header())
+		if body := resp.Body(); len(body) > 0 {
+			fmt.Fprintf(&b, "\n%s\n", t.redact(string(body)))
+		}
+	}
+	mqutil.Logger.Print(b.String())
+}
@@ -0,0 +1,311 @@
+package mqplan
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// MethodFilter selects the tests to generate and run by their HTTP method.
+type MethodFilter struct {
+	Include map[string]bool // When not empty, only these methods are allowed.
+	Exclude map[string]bool
+}
+
+// parseMethods parses a comma separated list of methods, e.g. GET,POST.
+func parseMethods(list string) (map[string]bool, error) {
+	methods := make(map[string]bool)
+	for _, m := range strings.Split(list, ",") {
+		m = strings.ToLower(strings.TrimSpace(m))
+		if len(m) == 0 {
+			continue
+		}
+		if !isKnownMethod(m) {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("unknown method: %s", m))
+		}
+		methods[m] = true
+	}
+	return methods, nil
+}
+
+// NewMethodFilter creates a filter from the comma separated lists of methods to include and exclude.
+// Returns nil when both lists are empty.
+func NewMethodFilter(include string, exclude string) (*MethodFilter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	var err error
+	filter := &MethodFilter{}
+	if filter.Include, err = parseMethods(include); err != nil {
+		return nil, err
+	}
+	if filter.Exclude, err = parseMethods(exclude); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// Allows checks whether the tests with the method pass the filter.
+func (f *MethodFilter) Allows(method string) bool {
+	method = strings.ToLower(method)
+	if len(f.Include) > 0 && !f.Include[method] {
+		return false
+	}
+	return !f.Exclude[method]
+}
+
+// FilterMethods removes the tests the filter doesn't allow from the plan, along with the tests that refer
+// to their results. The init and ref tests stay. Returns the number of tests removed.
+func (plan *TestPlan) FilterMethods(filter *MethodFilter) int {
+	if filter == nil {
+		return 0
+	}
+	removed := 0
+	for _, suite := range plan.SuiteList {
+		var kept []*Test
+		dropped := make(map[string]bool)
+		for _, t := range suite.Tests {
+			keep := (t.Name == MeqaInit || len(t.Ref) > 0 || filter.Allows(t.Method)) && !t.refersToAny(dropped)
+			if keep {
+				kept = append(kept, t)
+			} else {
+				dropped[t.Name] = true
+				removed++
+			}
+		}
+		suite.Tests = kept
+	}
+	return removed
+}
+
+// NameFilter selects the tests to run by their names, or the names of their suites, with regular expressions.
+type NameFilter struct {
+	Run  []*regexp.Regexp // When not empty, only the tests that match one of these run.
+	Skip []*regexp.Regexp
+}
+
+// parsePatterns parses a comma separated list of regular expressions.
+func parsePatterns(list string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		if len(p) == 0 {
+			continue
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid test name pattern %s: %s", p, err.Error()))
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// NewNameFilter creates a filter from the comma separated patterns of the tests to run and to skip.
+// Returns nil when both lists are empty.
+func NewNameFilter(run string, skip string) (*NameFilter, error) {
+	if len(strings.TrimSpace(run)) == 0 && len(strings.TrimSpace(skip)) == 0 {
+		return nil, nil
+	}
+	var err error
+	filter := &NameFilter{}
+	if filter.Run, err = parsePatterns(run); err != nil {
+		return nil, err
+	}
+	if filter.Skip, err = parsePatterns(skip); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+func matchesAny(patterns []*regexp.Regexp, suite string, test string) bool {
+	for _, re := range patterns {
+		if re.MatchString(test) || re.MatchString(suite) {
+			return true
+		}
+	}
+	return false
+}
+
+// Selects checks whether the test of the suite is one of the tests to run.
+func (f *NameFilter) Selects(suite string, test string) bool {
+	return len(f.Run) == 0 || matchesAny(f.Run, suite, test)
+}
+
+// Skips checks whether the test of the suite is one of the tests to skip.
+func (f *NameFilter) Skips(suite string, test string) bool {
+	return matchesAny(f.Skip, suite, test)
+}
+
+// Empty checks whether the suite has no tests left to run besides its meqa_init.
+func (tc *TestSuite) Empty() bool {
+	for _, t := range tc.Tests {
+		if t.Name != MeqaInit {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterNames removes the tests the filter doesn't select from the plan, and then the ones it skips, the
+// way filterTests does. Returns the number of tests removed.
+func (plan *TestPlan) FilterNames(filter *NameFilter) int {
+	if filter == nil {
+		return 0
+	}
+	return plan.filterTests(func(suite *TestSuite, t *Test) bool { return filter.Selects(suite.Name, t.Name) },
+		func(suite *TestSuite, t *Test) bool { return filter.Skips(suite.Name, t.Name) })
+}
+
+// filterTests removes the tests that aren't selected from the plan. The earlier tests that the selected
+// ones refer to, in any suite, are kept so that they still have their values. Then the skipped tests are
+// removed, along with the tests that refer to them. The init and ref tests stay. Returns the number of
+// tests removed.
+func (plan *TestPlan) filterTests(selects func(*TestSuite, *Test) bool, skips func(*TestSuite, *Test) bool) int {
+	type entry struct {
+		suite *TestSuite
+		test  *Test
+	}
+	var all []entry
+	positions := make(map[string][]int) // The positions of the tests by name, to find the referred ones.
+	for _, suite := range plan.SuiteList {
+		for _, t := range suite.Tests {
+			if t.Name != MeqaInit {
+				positions[t.Name] = append(positions[t.Name], len(all))
+			}
+			all = append(all, entry{suite, t})
+		}
+	}
+	keep := make(map[*Test]bool)
+	for i := len(all) - 1; i >= 0; i-- {
+		t := all[i].test
+		if t.Name == MeqaInit || len(t.Ref) > 0 || selects(all[i].suite, t) {
+			keep[t] = true
+		}
+		if !keep[t] || t.Name == MeqaInit {
+			continue
+		}
+		for name := range t.references() {
+			for _, j := range positions[name] {
+				if j < i {
+					keep[all[j].test] = true
+				}
+			}
+		}
+	}
+	dropped := make(map[string]bool)
+	for _, e := range all {
+		t := e.test
+		if !keep[t] || t.Name == MeqaInit || len(t.Ref) > 0 {
+			continue
+		}
+		if skips(e.suite, t) || t.refersToAny(dropped) {
+			keep[t] = false
+			dropped[t.Name] = true
+		}
+	}
+	removed := 0
+	for _, suite := range plan.SuiteList {
+		var kept []*Test
+		for _, t := range suite.Tests {
+			if keep[t] {
+				kept = append(kept, t)
+			} else {
+				removed++
+			}
+		}
+		suite.Tests = kept
+	}
+	return removed
+}
+
+// TagExpr is an expression of tags: the tags joined by + have to be all there, and it's enough for one of
+// the groups joined by , to be there, e.g. smoke+fast,critical.
+type TagExpr [][]string
+
+// ParseTagExpr parses a tag expression, see TagExpr.
+func ParseTagExpr(expr string) (TagExpr, error) {
+	var e TagExpr
+	for _, group := range strings.Split(expr, ",") {
+		if len(strings.TrimSpace(group)) == 0 {
+			continue
+		}
+		var tags []string
+		for _, tag := range strings.Split(group, "+") {
+			tag = strings.TrimSpace(tag)
+			if len(tag) == 0 || strings.ContainsAny(tag, " \t") {
+				return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid tag expression: %s", expr))
+			}
+			tags = append(tags, tag)
+		}
+		e = append(e, tags)
+	}
+	return e, nil
+}
+
+// Matches checks whether the tags satisfy the expression.
+func (e TagExpr) Matches(tags []string) bool {
+	has := make(map[string]bool)
+	for _, tag := range tags {
+		has[tag] = true
+	}
+	for _, group := range e {
+		all := true
+		for _, tag := range group {
+			all = all && has[tag]
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// TagFilter selects the tests to run by their tags.
+type TagFilter struct {
+	Include TagExpr // When not empty, only the tests whose tags match it run.
+	Exclude TagExpr
+}
+
+// NewTagFilter creates a filter from the tag expressions of the tests to run and to skip. Returns nil when
+// both are empty.
+func NewTagFilter(include string, exclude string) (*TagFilter, error) {
+	var err error
+	filter := &TagFilter{}
+	if filter.Include, err = ParseTagExpr(include); err != nil {
+		return nil, err
+	}
+	if filter.Exclude, err = ParseTagExpr(exclude); err != nil {
+		return nil, err
+	}
+	if len(filter.Include) == 0 && len(filter.Exclude) == 0 {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// tags returns the test's tags, with those of the suite's meqa_init.
+func (tc *TestSuite) tags(t *Test) []string {
+	tags := t.Tags
+	for _, init := range tc.Tests {
+		if init.Name == MeqaInit {
+			tags = append(append([]string{}, tags...), init.Tags...)
+		}
+	}
+	return tags
+}
+
+// FilterTags removes the tests whose tags the filter doesn't include from the plan, and then the ones it
+// excludes, the way filterTests does. Returns the number of tests removed.
+func (plan *TestPlan) FilterTags(filter *TagFilter) int {
+	if filter == nil {
+		return 0
+	}
+	return plan.filterTests(
+		func(suite *TestSuite, t *Test) bool {
+			return len(filter.Include) == 0 || filter.Include.Matches(suite.tags(t))
+		},
+		func(suite *TestSuite, t *Test) bool { return filter.Exclude.Matches(suite.tags(t)) })
+}
@@ -0,0 +1,251 @@
+package mqplan
+
+import (
+	"reflect"
+	"testing"
+)
+
+const filterSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths:
+  /pets:
+    post:
+      responses:
+        '200':
+          description: created
+    get:
+      responses:
+        '200':
+          description: listed
+  /pets/{id}:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      responses:
+        '200':
+          description: found
+    delete:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      responses:
+        '200':
+          description: deleted
+`
+
+const filterPlan = `
+/pets:
+- name: create_pet
+  path: /pets
+  method: post
+- name: list_pets
+  path: /pets
+  method: get
+- name: get_pet
+  path: /pets/{id}
+  method: get
+  pathParams:
+    id: '{{create_pet.outputs.id}}'
+- name: delete_pet
+  path: /pets/{id}
+  method: delete
+  pathParams:
+    id: 1
+- name: get_deleted
+  path: /pets/{id}
+  method: get
+  pathParams:
+    id: '{{delete_pet.pathParams.id}}'
+`
+
+func TestMethodFilter(t *testing.T) {
+	for _, c := range []struct {
+		include  string
+		exclude  string
+		filtered int
+		methods  []string
+	}{
+		{"", "", 0, []string{"post", "get", "get", "delete", "get"}},
+		{"", "DELETE", 2, []string{"post", "get", "get"}},
+		{"GET", "", 4, []string{"get"}},
+	} {
+		suite := newTestSuite(t, filterSpec, "http://example.com")
+		plan := suite.plan
+		client := &stubClient{status: 200, body: `{"id": 1}`}
+		plan.Client = client
+		if err := plan.AddFromString(filterPlan); err != nil {
+			t.Fatal(err)
+		}
+		filter, err := NewMethodFilter(c.include, c.exclude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filtered := plan.FilterMethods(filter); filtered != c.filtered {
+			t.Errorf("%q/%q: expecting %d tests filtered out, got %d", c.include, c.exclude, c.filtered, filtered)
+		}
+		plan.Run("/pets", nil)
+		var methods []string
+		for _, req := range client.requests {
+			methods = append(methods, req.Method)
+		}
+		if !reflect.DeepEqual(methods, c.methods) {
+			t.Errorf("%q/%q: expecting %v, got %v", c.include, c.exclude, c.methods, methods)
+		}
+	}
+
+	if _, err := NewMethodFilter("GET,FETCH", ""); err == nil {
+		t.Errorf("expecting an error for an unknown method")
+	}
+}
+
+func TestNameFilter(t *testing.T) {
+	for _, c := range []struct {
+		run      string
+		skip     string
+		filtered int
+		tests    []string
+	}{
+		{"", "", 0, []string{"create_pet", "list_pets", "get_pet", "delete_pet", "get_deleted"}},
+		// The tests the selected ones refer to run too.
+		{"^get_pet$", "", 3, []string{"create_pet", "get_pet"}},
+		{"list, get_deleted", "", 2, []string{"list_pets", "delete_pet", "get_deleted"}},
+		{"pets", "", 0, []string{"create_pet", "list_pets", "get_pet", "delete_pet", "get_deleted"}},
+		// The tests that refer to the skipped ones are skipped too.
+		{"", "delete", 2, []string{"create_pet", "list_pets", "get_pet"}},
+		{"get", "^get_pet$", 2, []string{"create_pet", "delete_pet", "get_deleted"}},
+	} {
+		suite := newTestSuite(t, filterSpec, "http://example.com")
+		plan := suite.plan
+		client := &stubClient{status: 200, body: `{"id": 1}`}
+		plan.Client = client
+		if err := plan.AddFromString(filterPlan); err != nil {
+			t.Fatal(err)
+		}
+		filter, err := NewNameFilter(c.run, c.skip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filtered := plan.FilterNames(filter); filtered != c.filtered {
+			t.Errorf("%q/%q: expecting %d tests filtered out, got %d", c.run, c.skip, c.filtered, filtered)
+		}
+		plan.Run("/pets", nil)
+		var tests []string
+		for _, result := range plan.resultList {
+			tests = append(tests, result.Name)
+		}
+		if !reflect.DeepEqual(tests, c.tests) {
+			t.Errorf("%q/%q: expecting %v, got %v", c.run, c.skip, c.tests, tests)
+		}
+	}
+
+	if _, err := NewNameFilter("get_(", ""); err == nil {
+		t.Errorf("expecting an error for an invalid pattern")
+	}
+	if filter, _ := NewNameFilter(" ", ""); filter != nil {
+		t.Errorf("expecting no filter without patterns, got %+v", filter)
+	}
+}
+
+const taggedPlan = `
+/pets:
+- name: meqa_init
+  tags: [pets]
+- name: create_pet
+  path: /pets
+  method: post
+  tags: [smoke]
+- name: list_pets
+  path: /pets
+  method: get
+  tags: [smoke, fast]
+- name: get_pet
+  path: /pets/{id}
+  method: get
+  tags: [fast]
+  pathParams:
+    id: '{{create_pet.outputs.id}}'
+- name: delete_pet
+  path: /pets/{id}
+  method: delete
+  tags: [slow]
+  pathParams:
+    id: 1
+`
+
+func TestTagFilter(t *testing.T) {
+	for _, c := range []struct {
+		expr    string
+		tags    []string
+		matches bool
+	}{
+		{"smoke", []string{"smoke", "fast"}, true},
+		{"smoke+fast", []string{"smoke"}, false},
+		{"smoke+fast", []string{"fast", "smoke"}, true},
+		{"slow, smoke+fast", []string{"slow"}, true},
+		{"slow,smoke+fast", []string{"fast"}, false},
+		{"smoke", nil, false},
+	} {
+		expr, err := ParseTagExpr(c.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expr.Matches(c.tags) != c.matches {
+			t.Errorf("%s: expecting the tags %v to match to be %v", c.expr, c.tags, c.matches)
+		}
+	}
+	for _, invalid := range []string{"smoke+", "+fast", "smoke test"} {
+		if _, err := ParseTagExpr(invalid); err == nil {
+			t.Errorf("%s: expecting the tag expression to be invalid", invalid)
+		}
+	}
+
+	for _, c := range []struct {
+		include  string
+		exclude  string
+		filtered int
+		tests    []string
+	}{
+		{"smoke", "", 2, []string{"create_pet", "list_pets"}},
+		// The tests the selected ones refer to run too.
+		{"fast", "", 1, []string{"create_pet", "list_pets", "get_pet"}},
+		{"smoke+fast", "", 3, []string{"list_pets"}},
+		{"", "slow", 1, []string{"create_pet", "list_pets", "get_pet"}},
+		// The tests that refer to the excluded ones are excluded too.
+		{"", "smoke+pets,slow", 4, nil},
+		{"pets", "fast", 2, []string{"create_pet", "delete_pet"}},
+	} {
+		suite := newTestSuite(t, filterSpec, "http://example.com")
+		plan := suite.plan
+		plan.Client = &stubClient{status: 200, body: `{"id": 1}`}
+		if err := plan.AddFromString(taggedPlan); err != nil {
+			t.Fatal(err)
+		}
+		filter, err := NewTagFilter(c.include, c.exclude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filtered := plan.FilterTags(filter); filtered != c.filtered {
+			t.Errorf("%q/%q: expecting %d tests filtered out, got %d", c.include, c.exclude, c.filtered, filtered)
+		}
+		if !plan.SuiteMap["/pets"].Empty() {
+			plan.Run("/pets", nil)
+		}
+		var tests []string
+		for _, result := range plan.resultList {
+			tests = append(tests, result.Name)
+		}
+		if !reflect.DeepEqual(tests, c.tests) {
+			t.Errorf("%q/%q: expecting %v, got %v", c.include, c.exclude, c.tests, tests)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package mqplan
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqswag"
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+
+	spec "github.com/getkin/kin-openapi/openapi3"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// requestFormType returns the form media type of the operation's request body, urlencoded before
+// multipart, when the body has one with a schema.
+func (t *Test) requestFormType() (string, *spec.MediaType) {
+	if t.op == nil || t.op.RequestBody == nil || t.op.RequestBody.Value == nil {
+		return "", nil
+	}
+	for _, name := range []string{mqswag.FormUrlencoded, mqswag.MultipartForm} {
+		if m := t.op.RequestBody.Value.Content[name]; m != nil && m.Schema != nil {
+			return name, m
+		}
+	}
+	return "", nil
+}
+
+// isFileSchema checks whether the schema is a file, the swagger 2 file type or a binary string.
+func isFileSchema(s *spec.SchemaRef) bool {
+	if s == nil || s.Value == nil {
+		return false
+	}
+	return s.Value.Type == "file" || (s.Value.Type == gojsonschema.TYPE_STRING && s.Value.Format == "binary")
+}
+
+// fileFields returns the names of the form parameters that are files. They are the file parameters of
+// swagger 2, and the binary properties of a multipart request body.
+func (t *Test) fileFields() map[string]bool {
+	fields := make(map[string]bool)
+	for _, p := range t.op.Parameters {
+		if p.Value != nil && isFileSchema(p.Value.Schema) {
+			fields[p.Value.Name] = true
+		}
+	}
+	if formType, mediaType := t.requestFormType(); formType == mqswag.MultipartForm {
+		for name, p := range ((mqswag.SchemaRef)(*mediaType.Schema)).GetProperties(t.db.Swagger) {
+			if isFileSchema(p) {
+				fields[name] = true
+			}
+		}
+	}
+	return fields
+}
+
+// resolveFormBody generates the fields of a form request body into the form parameters, and the ones the
+// test or its suite set replace them. The file fields that aren't set to a file path get generated files.
+func (t *Test) resolveFormBody(tc *TestSuite, formType string, mediaType *spec.MediaType) error {
+	t.multipart = formType == mqswag.MultipartForm
+	bodyParam := &spec.Parameter{Schema: mediaType.Schema, Example: mediaType.Example,
+		Examples: mediaType.Examples, ExtensionProps: mediaType.ExtensionProps}
+	genParam, err := t.GenerateParameter(bodyParam, t.db)
+	if err != nil {
+		return err
+	}
+	genMap, ok := genParam.(map[string]interface{})
+	if !ok {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the %s request body isn't an object", formType))
+	}
+	for _, k := range t.Omit {
+		delete(genMap, k)
+	}
+	set := mqutil.MapAdd(mqutil.MapCopy(t.FormParams), tc.FormParams)
+	for name := range t.fileFields() {
+		if _, generated := genMap[name]; !generated {
+			continue
+		}
+		delete(genMap, name)
+		if _, ok := set[name]; !ok {
+			f := t.generateFile(name)
+			t.printf("        %s (file): %d random bytes of %s\n", name, len(f.Data), f.ContentType)
+		}
+	}
+	mqutil.MapReplace(genMap, set)
+	t.FormParams = mqutil.MapAdd(mqutil.MapCopy(genMap), set)
+	return nil
+}
+
+// DefaultUploadType is the content type of the generated files when the spec doesn't give one.
+const DefaultUploadType = "application/octet-stream"
+
+// generateFile generates a small file of random bytes to upload for the file field. Its content type is the
+// first one the multipart body's encoding of the field lists, or else DefaultUploadType.
+func (t *Test) generateFile(name string) *File {
+	contentType := DefaultUploadType
+	if _, mediaType := t.requestFormType(); mediaType != nil && mediaType.Encoding[name] != nil {
+		for _, ct := range strings.Split(mediaType.Encoding[name].ContentType, ",") {
+			if ct = strings.TrimSpace(ct); len(ct) > 0 && !strings.Contains(ct, "*") {
+				contentType = ct
+				break
+			}
+		}
+	}
+	f := &File{Name: name, ContentType: contentType, Data: make([]byte, 16+mqutil.Rand.Intn(241))}
+	if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+		f.Name += exts[0]
+	}
+	for i := range f.Data {
+		f.Data[i] = byte(mqutil.Rand.Intn(256))
+	}
+	if t.uploads == nil {
+		t.uploads = make(map[string]*File)
+	}
+	t.uploads[name] = f
+	return f
+}
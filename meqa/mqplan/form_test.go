@@ -0,0 +1,203 @@
+package mqplan
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const formSpec = `
+openapi: 3.0.2
+info:
+  title: forms
+  version: "1.0"
+paths:
+  /login:
+    post:
+      requestBody:
+        content:
+          application/x-www-form-urlencoded:
+            schema:
+              type: object
+              required: [username, password]
+              properties:
+                username:
+                  type: string
+                password:
+                  type: string
+                  minLength: 8
+      responses:
+        '204':
+          description: logged in
+  /avatars:
+    post:
+      requestBody:
+        content:
+          multipart/form-data:
+            schema:
+              type: object
+              required: [title]
+              properties:
+                title:
+                  type: string
+                  enum: [me]
+                picture:
+                  type: string
+                  format: binary
+      responses:
+        '204':
+          description: uploaded
+`
+
+func TestFormBodies(t *testing.T) {
+	type received struct {
+		contentType string
+		form        map[string]string
+		files       map[string]string
+	}
+	var got received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = received{contentType: r.Header.Get("Content-Type"), form: map[string]string{}, files: map[string]string{}}
+		if strings.HasPrefix(got.contentType, "multipart/form-data") {
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			for k, fhs := range r.MultipartForm.File {
+				f, _ := fhs[0].Open()
+				b, _ := ioutil.ReadAll(f)
+				f.Close()
+				got.files[k] = string(b)
+			}
+		} else if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for k := range r.PostForm {
+			got.form[k] = r.PostForm.Get(k)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "meqa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	picture := filepath.Join(dir, "me.png")
+	if err := ioutil.WriteFile(picture, []byte("picture bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{ClientResty, ClientHTTP} {
+		client, err := NewClient(name, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		suite := newTestSuite(t, formSpec, server.URL)
+		suite.plan.Client = client
+
+		// The form fields are generated from the schema, the ones the test sets replace them.
+		test := &Test{Name: "login", Path: "/login", Method: "post"}
+		test.FormParams = map[string]interface{}{"username": "joe"}
+		if _, err := runTest(suite, test); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !strings.HasPrefix(got.contentType, "application/x-www-form-urlencoded") || got.form["username"] != "joe" ||
+			len(got.form["password"]) < 8 {
+			t.Errorf("%s: unexpected urlencoded request %+v", name, got)
+		}
+
+		// A multipart form is sent as multipart even without a file, and a file field set to a path is
+		// sent as that file.
+		test = &Test{Name: "no picture", Path: "/avatars", Method: "post", Omit: []string{"picture"}}
+		if _, err := runTest(suite, test); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !strings.HasPrefix(got.contentType, "multipart/form-data") || got.form["title"] != "me" || len(got.files) != 0 {
+			t.Errorf("%s: unexpected multipart request without a file %+v", name, got)
+		}
+		test = &Test{Name: "picture", Path: "/avatars", Method: "post"}
+		test.FormParams = map[string]interface{}{"picture": picture}
+		if _, err := runTest(suite, test); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.form["title"] != "me" || got.files["picture"] != "picture bytes" {
+			t.Errorf("%s: unexpected multipart request with a file %+v", name, got)
+		}
+	}
+}
+
+const uploadSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths:
+  /pet/{petId}/uploadImage:
+    post:
+      parameters:
+        - name: petId
+          in: path
+          required: true
+          schema:
+            type: integer
+      requestBody:
+        content:
+          multipart/form-data:
+            schema:
+              type: object
+              required: [file]
+              properties:
+                file:
+                  type: string
+                  format: binary
+            encoding:
+              file:
+                contentType: image/png, image/*
+      responses:
+        '200':
+          description: uploaded
+`
+
+func TestGeneratedUploads(t *testing.T) {
+	var data []byte
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, header, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		data, _ = ioutil.ReadAll(f)
+		contentType = header.Header.Get("Content-Type")
+	}))
+	defer server.Close()
+
+	for _, name := range []string{ClientResty, ClientHTTP} {
+		client, err := NewClient(name, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		suite := newTestSuite(t, uploadSpec, server.URL)
+		suite.plan.Client = client
+		data, contentType = nil, ""
+		dup, err := runTest(suite, &Test{Name: "upload", Path: "/pet/{petId}/uploadImage", Method: "post"})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		sent := dup.uploads["file"]
+		if sent == nil || len(sent.Data) == 0 || string(data) != string(sent.Data) {
+			t.Errorf("%s: expecting the server to receive the generated file %v, got %v", name, sent, data)
+		}
+		if contentType != "image/png" {
+			t.Errorf("%s: expecting the file to be an image/png, got %s", name, contentType)
+		}
+	}
+}
@@ -114,7 +114,7 @@ func GenerateTestsForObject(create *mqswag.DAGNode, obj *mqswag.DAGNode, plan *T
 	testId = 0
 	testSuite = &TestSuite{nil, fmt.Sprintf("%s -- %s -- random", createPath, objName)}
 	for i := 0; i < 2*len(obj.Children); i++ {
-		j := rand.Intn(len(obj.Children))
+		j := mqutil.Rand.Intn(len(obj.Children))
 		child := obj.Children[j]
 		if child.GetType() != mqswag.TypeOp {
 			mqutil.Logger.Printf("unexpected: (%s) has a child (%s) that's not an operation", obj.Name, child.Name)
@@ -0,0 +1,108 @@
+package mqplan
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqswag"
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+const requiredSpec = `
+openapi: 3.0.2
+info:
+  title: accounts
+  version: "1.0"
+paths:
+  /accounts:
+    post:
+      operationId: createAccount
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Account'
+      responses:
+        '201':
+          description: created
+        '400':
+          description: invalid
+    get:
+      operationId: listAccounts
+      responses:
+        '200':
+          description: ok
+components:
+  schemas:
+    Account:
+      type: object
+      required: [name, email]
+      properties:
+        name:
+          type: string
+        email:
+          type: string
+        age:
+          type: integer
+`
+
+func TestNegativeOmitTests(t *testing.T) {
+	suite := newTestSuite(t, requiredSpec, "http://example.com")
+	swagger := suite.plan.swagger
+	dag := mqswag.NewDAG()
+	if err := swagger.AddToDAG(dag); err != nil {
+		t.Fatal(err)
+	}
+	dag.Sort()
+	dag.CheckWeight()
+	plan, err := GenerateNegativeTestPlan(swagger, dag)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The negative tests of the post start with one test per required field.
+	tests := plan.SuiteMap["/accounts post -- negative"].Tests
+	if len(tests) < 2 {
+		t.Fatalf("expecting a test per required field, got %d tests", len(tests))
+	}
+	for i, field := range []string{"name", "email"} {
+		test := tests[i]
+		if test.Name != fmt.Sprintf("post_createAccount_%d%s%s", i+1, OmitSuffix, field) || len(test.Omit) != 1 ||
+			test.Omit[0] != field || test.Expect[ExpectStatus] != "4xx" {
+			t.Errorf("unexpected test %+v", test)
+		}
+
+		// The generated body has the other required field but not the omitted one.
+		client := &stubClient{status: 400}
+		suite.plan.Client = client
+		if _, err := runTest(suite, &Test{Name: test.Name, Path: test.Path, Method: test.Method, Omit: test.Omit,
+			Expect: test.Expect}); err != nil {
+			t.Errorf("%s: %v", test.Name, err)
+		}
+		body := client.requests[0].Body.(map[string]interface{})
+		other := "email"
+		if field == other {
+			other = "name"
+		}
+		if _, ok := body[field]; ok || body[other] == nil {
+			t.Errorf("%s: expecting the body without %s, got %v", test.Name, field, body)
+		}
+	}
+}
+
+func TestNegativeOmitTestsRun(t *testing.T) {
+	// Run the suite the way mqgo does, each omitted field is sent, not just the first.
+	_, counts, client := runNegativeSuite(t, requiredSpec, "/accounts post -- negative")
+	omitted := make(map[string]bool)
+	for _, req := range client.requests {
+		body := req.Body.(map[string]interface{})
+		for _, field := range []string{"name", "email"} {
+			if _, ok := body[field]; !ok {
+				omitted[field] = true
+			}
+		}
+	}
+	if !omitted["name"] || !omitted["email"] || counts[mqutil.Skipped] != 0 {
+		t.Errorf("expecting a request without each required field and none skipped, got %v and %v", omitted, counts)
+	}
+}
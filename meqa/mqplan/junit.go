@@ -0,0 +1,128 @@
+package mqplan
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// The JUnit XML report. Each test suite of the plan is a <testsuite> and each of its tests a <testcase>.
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Skipped  int               `xml:"skipped,attr"`
+	Time     string            `xml:"time,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Cases    []*junitTestCase `xml:"testcase"`
+
+	elapsed time.Duration
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"` // The failure category, schema, http or expect.
+	Text    string `xml:",chardata"`
+}
+
+// JUnitReport collects the outcomes of the tests as the plan runs them, for the CI systems that read the
+// JUnit XML reports.
+type JUnitReport struct {
+	suites []*junitTestSuite
+	mutex  sync.Mutex
+}
+
+// NewJUnitReport creates an empty report.
+func NewJUnitReport() *JUnitReport {
+	return &JUnitReport{}
+}
+
+// suite returns the report's suite of the name, adding it if it's not there yet. The caller holds the lock.
+func (r *JUnitReport) suite(name string) *junitTestSuite {
+	for _, s := range r.suites {
+		if s.Name == name {
+			return s
+		}
+	}
+	s := &junitTestSuite{Name: name}
+	r.suites = append(r.suites, s)
+	return s
+}
+
+// Add records the outcome of a test that was run in the suite, and how long it took.
+func (r *JUnitReport) Add(suiteName string, t *Test, elapsed time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	s := r.suite(suiteName)
+	c := &junitTestCase{Name: t.Name, ClassName: suiteName, Time: junitSeconds(elapsed)}
+	if t.err != nil {
+		msg := mqutil.ErrorMessage(t.err)
+		c.Failure = &junitFailure{Message: strings.SplitN(msg, "\n", 2)[0], Type: failureCategory(t), Text: msg}
+		s.Failures++
+	}
+	s.Cases = append(s.Cases, c)
+	s.Tests++
+	s.elapsed += elapsed
+}
+
+// Skip records the tests of the suite that weren't run, e.g. the ones after the POST that failed.
+func (r *JUnitReport) Skip(suiteName string, tests []*Test) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	s := r.suite(suiteName)
+	for _, t := range tests {
+		if t.Name == MeqaInit {
+			continue
+		}
+		s.Cases = append(s.Cases, &junitTestCase{Name: t.Name, ClassName: suiteName, Time: junitSeconds(0), Skipped: &struct{}{}})
+		s.Tests++
+		s.Skipped++
+	}
+}
+
+// WriteFile writes the report to the path.
+func (r *JUnitReport) WriteFile(path string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	all := &junitTestSuites{Suites: r.suites}
+	var elapsed time.Duration
+	for _, s := range r.suites {
+		s.Time = junitSeconds(s.elapsed)
+		all.Tests += s.Tests
+		all.Failures += s.Failures
+		all.Skipped += s.Skipped
+		elapsed += s.elapsed
+	}
+	all.Time = junitSeconds(elapsed)
+	data, err := xml.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
+
+// junitSeconds formats the duration the way JUnit does, in seconds.
+func junitSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
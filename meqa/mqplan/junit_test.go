@@ -0,0 +1,71 @@
+package mqplan
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const junitPlan = `
+/get:
+- name: get
+  path: /pet/{petId}
+  method: get
+  pathParams:
+    petId: 1
+`
+
+func TestJUnitReport(t *testing.T) {
+	suite := newTestSuite(t, captureSpec, "http://example.com")
+	plan := suite.plan
+	plan.JUnit = NewJUnitReport()
+	plan.Client = &stubClient{status: 500}
+	if err := plan.AddFromString(capturePlan + junitPlan); err != nil {
+		t.Fatal(err)
+	}
+	plan.Run("/pets", nil)
+	plan.Client = &stubClient{status: 200, body: `{"id": 1, "name": "rex"}`}
+	plan.Run("/get", nil)
+
+	dir, err := ioutil.TempDir("", "junit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "junit.xml")
+	if err := plan.JUnit.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report junitTestSuites
+	if err := xml.Unmarshal(data, &report); err != nil {
+		t.Fatalf("invalid report: %v\n%s", err, data)
+	}
+
+	if report.Tests != 3 || report.Failures != 1 || report.Skipped != 1 || len(report.Suites) != 2 {
+		t.Fatalf("unexpected report %s", data)
+	}
+	pets := report.Suites[0]
+	if pets.Name != "/pets" || len(pets.Cases) != 2 {
+		t.Fatalf("unexpected suite %+v", pets)
+	}
+	create := pets.Cases[0]
+	if create.Name != "create" || create.Failure == nil || create.Failure.Type != FailureExpect ||
+		strings.Contains(create.Failure.Text, "Backtrace") || len(create.Failure.Message) == 0 {
+		t.Errorf("expecting the create to fail without the back trace, got %+v", create.Failure)
+	}
+	if get := pets.Cases[1]; get.Name != "get" || get.Skipped == nil || get.Failure != nil {
+		t.Errorf("expecting the get to be skipped, got %+v", get)
+	}
+	for _, c := range report.Suites[1].Cases {
+		if c.ClassName != "/get" || c.Failure != nil || c.Skipped != nil {
+			t.Errorf("expecting %s to pass, got %+v", c.Name, c)
+		}
+	}
+}
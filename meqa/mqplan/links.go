@@ -0,0 +1,166 @@
+package mqplan
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqswag"
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+	spec "github.com/getkin/kin-openapi/openapi3"
+)
+
+// The conventions for the links in a response body.
+const (
+	LinkStyleHAL     = "hal"     // {"_links": {"self": {"href": "/pets/1"}}}, a relation can have a list of links.
+	LinkStyleJSONAPI = "jsonapi" // {"links": {"self": "/pets/1"}}, a link can also be an object with a href.
+)
+
+// responseLinks returns the hrefs of the links in the body by their relation. With no style both conventions
+// are looked at, HAL first.
+func responseLinks(body interface{}, style string) (map[string][]string, error) {
+	var fields []string
+	switch strings.ToLower(style) {
+	case "":
+		fields = []string{"_links", "links"}
+	case LinkStyleHAL:
+		fields = []string{"_links"}
+	case LinkStyleJSONAPI:
+		fields = []string{"links"}
+	default:
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("unknown link style: %s", style))
+	}
+	links := make(map[string][]string)
+	obj, _ := body.(map[string]interface{})
+	for _, f := range fields {
+		m, ok := obj[f].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for rel, link := range m {
+			if len(links[rel]) > 0 {
+				continue
+			}
+			if list, ok := link.([]interface{}); ok {
+				for _, l := range list {
+					if href := linkValue(l); len(href) > 0 {
+						links[rel] = append(links[rel], href)
+					}
+				}
+			} else if href := linkValue(link); len(href) > 0 {
+				links[rel] = []string{href}
+			}
+		}
+	}
+	return links, nil
+}
+
+// findGetOperation returns the GET operation of the swagger path the url is an instance of.
+func (t *Test) findGetOperation(linkURL string) *spec.Operation {
+	base, err := url.Parse(t.suite.plan.GetBaseURL())
+	if err != nil {
+		return nil
+	}
+	u, err := url.Parse(linkURL)
+	if err != nil || u.Host != base.Host || !strings.HasPrefix(u.Path, base.Path) {
+		return nil
+	}
+	path := "/" + strings.TrimPrefix(strings.TrimPrefix(u.Path, base.Path), "/")
+	paths := t.db.Swagger.Paths
+	if pathItem := paths[path]; pathItem != nil {
+		return pathItem.Get
+	}
+	// Sort the templates so the same one is picked when several match.
+	var templates []string
+	for template := range paths {
+		templates = append(templates, template)
+	}
+	sort.Strings(templates)
+	for _, template := range templates {
+		if matchPath(template, path) && paths[template].Get != nil {
+			return paths[template].Get
+		}
+	}
+	return nil
+}
+
+// followLinks gets the links of the test's relations from the response body, and checks that each of them
+// is a documented GET operation that succeeds and returns what its response schema declares.
+func (t *Test) followLinks(client Client, req *Request, resp *Response) error {
+	t.printf("... following the links. ")
+	var body interface{}
+	if err := mqutil.DecodeJson(resp.Body(), &body); err != nil {
+		return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("the response with the links is not json: %s", err.Error()))
+	}
+	links, err := responseLinks(body, t.LinkStyle)
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, rel := range t.FollowLinks {
+		if len(links[rel]) == 0 {
+			return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("the response has no %s link", rel))
+		}
+		for _, href := range links[rel] {
+			linkURL, err := resolveLink(req.URL, href)
+			if err != nil {
+				return err
+			}
+			op := t.findGetOperation(linkURL)
+			if op == nil {
+				return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("the %s link %s isn't a GET operation of the spec", rel, linkURL))
+			}
+			linkReq := *req
+			linkReq.Method = mqswag.MethodGet
+			linkReq.URL = linkURL
+			linkReq.Query = nil
+			linkReq.Form = nil
+			linkReq.Files = nil
+			linkReq.Body = nil
+			// An api key in the query is set again.
+			t.setAuth(&linkReq)
+			linkResp, err := client.Do(&linkReq)
+			if err != nil {
+				return mqutil.NewError(mqutil.ErrHttp, err.Error())
+			}
+			status := linkResp.StatusCode()
+			if status < 200 || status >= 300 {
+				return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("getting the %s link %s returned status %d", rel, linkURL, status))
+			}
+			if err := t.validateLinkResponse(op, linkResp); err != nil {
+				return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("the response of the %s link %s doesn't match the schema: %s",
+					rel, linkURL, err.Error()))
+			}
+			count++
+		}
+	}
+	t.printf("%d links. %vSuccess%v\n", count, mqutil.GREEN, mqutil.END)
+	return nil
+}
+
+// validateLinkResponse checks the response of a link against the schema the operation declares for its status.
+func (t *Test) validateLinkResponse(op *spec.Operation, resp *Response) error {
+	if op.Responses == nil || len(resp.Body()) == 0 {
+		return nil
+	}
+	respRef := op.Responses[fmt.Sprint(resp.StatusCode())]
+	if respRef == nil {
+		respRef = op.Responses.Default()
+	}
+	if respRef == nil || respRef.Value == nil {
+		return nil
+	}
+	mediaType := respRef.Value.Content.Get(resp.Header().Get("Content-Type"))
+	if mediaType == nil {
+		mediaType = respRef.Value.Content[mqswag.JsonResponse]
+	}
+	if mediaType == nil || mediaType.Schema == nil {
+		return nil
+	}
+	var obj interface{}
+	if err := mqutil.DecodeJson(resp.Body(), &obj); err != nil {
+		return err
+	}
+	return ((mqswag.SchemaRef)(*mediaType.Schema)).Parses("", obj, make(map[string][]interface{}), true, t.matchOptions(true), t.db.Swagger)
+}
@@ -0,0 +1,103 @@
+package mqplan
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const linkSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths:
+  /pets/{id}:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      responses:
+        '200':
+          description: found
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [id, name]
+                properties:
+                  id:
+                    type: integer
+                  name:
+                    type: string
+                  _links:
+                    type: object
+                    properties:
+                      self:
+                        $ref: '#/components/schemas/Link'
+                      item:
+                        type: array
+                        items:
+                          $ref: '#/components/schemas/Link'
+                  links:
+                    type: object
+                    properties:
+                      self:
+                        type: string
+components:
+  schemas:
+    Link:
+      type: object
+      properties:
+        href:
+          type: string
+`
+
+func TestFollowLinks(t *testing.T) {
+	for _, c := range []struct {
+		style string
+		rel   string
+		body  string
+		err   string
+	}{
+		{"", "self", `{"id": 1, "name": "rex", "_links": {"self": {"href": "/pets/2"}}}`, ""},
+		{LinkStyleHAL, "item", `{"id": 1, "name": "rex", "_links": {"item": [{"href": "/pets/2"}, {"href": "/pets/3"}]}}`, ""},
+		{LinkStyleJSONAPI, "self", `{"id": 1, "name": "rex", "links": {"self": "/pets/2"}}`, ""},
+		{LinkStyleJSONAPI, "self", `{"id": 1, "name": "rex", "_links": {"self": {"href": "/pets/2"}}}`, "the response has no self link"},
+		{"", "self", `{"id": 1, "name": "rex", "_links": {"self": {"href": "/owners/2"}}}`, "isn't a GET operation of the spec"},
+		{"", "self", `{"id": 1, "name": "rex", "_links": {"self": {"href": "/pets/9"}}}`, "returned status 404"},
+		{"", "self", `{"id": 1, "name": "rex", "_links": {"self": {"href": "/pets/4"}}}`, "doesn't match the schema"},
+	} {
+		var followed []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/pets/1":
+				w.Write([]byte(c.body))
+				return
+			case "/pets/2", "/pets/3":
+				w.Write([]byte(`{"id": 2, "name": "max"}`))
+			case "/pets/4":
+				w.Write([]byte(`{"id": "four"}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+			followed = append(followed, r.URL.Path)
+		}))
+		suite := newTestSuite(t, linkSpec, server.URL)
+		suite.plan.Client, _ = NewClient(ClientHTTP, nil, nil)
+		test := &Test{Name: "get", Path: "/pets/{id}", Method: "get", FollowLinks: []string{c.rel}, LinkStyle: c.style}
+		test.PathParams = map[string]interface{}{"id": 1}
+		dup, err := runTest(suite, test)
+		server.Close()
+		if len(c.err) == 0 && (err != nil || len(followed) == 0) {
+			t.Errorf("%s: expecting the links to be followed, got %v, followed %v", c.body, err, followed)
+		} else if len(c.err) > 0 && (err == nil || !strings.Contains(err.Error(), c.err) || dup.responseError == nil) {
+			t.Errorf("%s: expecting error %q, got %v", c.body, c.err, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package mqplan
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqswag"
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+
+	spec "github.com/getkin/kin-openapi/openapi3"
+)
+
+// chooseMediaType picks application/json, or else the first JSON media type, or else the first one.
+func chooseMediaType(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == mqswag.JsonResponse {
+			return name
+		}
+	}
+	for _, name := range names {
+		if mqswag.IsJsonMediaType(name) {
+			return name
+		}
+	}
+	return names[0]
+}
+
+// acceptType returns the media type the test asks the server to respond with, the one chooseMediaType picks
+// out of the ones the operation's 2xx responses declare, or out of the ones all its responses declare when
+// the 2xx ones declare none. It's empty when they declare none.
+func (t *Test) acceptType() string {
+	if t.op == nil {
+		return ""
+	}
+	if name := t.declaredType(true); len(name) > 0 {
+		return name
+	}
+	return t.declaredType(false)
+}
+
+// declaredType returns the media type chooseMediaType picks out of the ones the operation's responses, or
+// only its 2xx responses, declare.
+func (t *Test) declaredType(success bool) string {
+	declared := make(map[string]bool)
+	for status, resp := range t.op.Responses {
+		if resp == nil || resp.Value == nil || (success && !strings.HasPrefix(status, "2")) {
+			continue
+		}
+		for name := range resp.Value.Content {
+			if name != "*/*" && !mqswag.IsProblemMediaType(name) {
+				declared[name] = true
+			}
+		}
+	}
+	var names []string
+	for name := range declared {
+		names = append(names, name)
+	}
+	return chooseMediaType(names)
+}
+
+// requestOtherType returns the media type of the operation's request body when it has no JSON, XML, JSON
+// patch or form media type, the first one it declares.
+func (t *Test) requestOtherType() (string, *spec.MediaType) {
+	if t.op == nil || t.op.RequestBody == nil || t.op.RequestBody.Value == nil {
+		return "", nil
+	}
+	var names []string
+	for name, m := range t.op.RequestBody.Value.Content {
+		if m != nil {
+			names = append(names, name)
+		}
+	}
+	name := chooseMediaType(names)
+	if len(name) == 0 {
+		return "", nil
+	}
+	return name, t.op.RequestBody.Value.Content[name]
+}
+
+// resolveOtherBody sets the request body of a media type that is neither JSON nor XML, like text/plain. The
+// body the test sets is sent as is, otherwise it's generated from the media type's schema. Either way it
+// has to be a string, as we don't know how to encode anything else in the media type.
+func (t *Test) resolveOtherBody(contentType string, mediaType *spec.MediaType) error {
+	t.contentType = contentType
+	t.printf("        body (%s): ", contentType)
+	if t.BodyParams != nil {
+		t.print("provided\n")
+	} else {
+		if mediaType.Schema == nil {
+			return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+				"the %s request body has no schema, the test has to set bodyParams", contentType))
+		}
+		bodyParam := &spec.Parameter{Schema: mediaType.Schema, Example: mediaType.Example,
+			Examples: mediaType.Examples, ExtensionProps: mediaType.ExtensionProps}
+		body, err := t.GenerateParameter(bodyParam, t.db)
+		if err != nil {
+			return err
+		}
+		t.BodyParams = body
+	}
+	if _, ok := t.BodyParams.(string); !ok {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+			"can't send a %s request body that isn't a string: %v", contentType, t.BodyParams))
+	}
+	return nil
+}
+
+// xmlBody writes the test's body as XML, with the element names the request body's schema gives.
+func (t *Test) xmlBody() (string, error) {
+	var schema mqswag.SchemaRef
+	if _, mediaType := t.requestMediaType(); mediaType != nil && mediaType.Schema != nil {
+		schema = (mqswag.SchemaRef)(*mediaType.Schema)
+	}
+	b, err := schema.ToXml("body", t.BodyParams, t.db.Swagger)
+	if err != nil {
+		return "", err
+	}
+	return xml.Header + string(b), nil
+}
+
+// decodeResponse decodes the response body into the object the test checks and the later tests refer to.
+// An XML body is decoded as XML. A JSON body is decoded as JSON, and so is any other body when the test
+// asked for JSON, as servers often mislabel their JSON. When the test asked for something else, a body of
+// text is kept as a string and a binary one isn't kept at all.
+func (t *Test) decodeResponse(contentType string, body []byte, respSchema mqswag.SchemaRef) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+	accept := t.acceptType()
+	var obj interface{}
+	switch {
+	case mqutil.IsXmlMediaType(contentType) || (len(contentType) == 0 && mqutil.IsXmlMediaType(accept)):
+		if xmlObj, err := mqutil.XmlToObject(body); err == nil {
+			obj = respSchema.Coerce(xmlObj, t.db.Swagger)
+		}
+	case mqswag.IsJsonMediaType(contentType) || mqswag.IsProblemMediaType(contentType) ||
+		len(accept) == 0 || mqswag.IsJsonMediaType(accept):
+		mqutil.DecodeJson(body, &obj)
+	case utf8.Valid(body):
+		obj = string(body)
+	}
+	return obj
+}
@@ -0,0 +1,212 @@
+package mqplan
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+const negotiationSpec = `
+openapi: 3.0.2
+info:
+  title: reports
+  version: "1.0"
+paths:
+  /pets:
+    get:
+      responses:
+        '200':
+          description: the pets
+          content:
+            application/xml:
+              schema:
+                $ref: '#/components/schemas/Pet'
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+  /reports:
+    get:
+      responses:
+        '200':
+          description: the report
+          content:
+            text/csv:
+              schema:
+                type: string
+            text/plain:
+              schema:
+                type: string
+  /pet.xml:
+    get:
+      responses:
+        '200':
+          description: the pet
+          content:
+            application/xml:
+              schema:
+                $ref: '#/components/schemas/Pet'
+        '404':
+          description: not found
+          content:
+            application/json:
+              schema:
+                type: object
+  /logo:
+    get:
+      responses:
+        '200':
+          description: the logo
+          content:
+            image/png:
+              schema:
+                type: string
+                format: binary
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        id:
+          type: integer
+`
+
+func TestContentNegotiation(t *testing.T) {
+	cases := []struct {
+		path        string
+		contentType string
+		body        string
+		accept      string
+		expectBody  interface{}
+	}{
+		{"/pets", "application/json", `{"id": 1}`, "application/json", map[string]interface{}{"id": 1}},
+		// A report that looks like JSON stays the text it is.
+		{"/reports", "text/csv", "42", "text/csv", "42"},
+		{"/reports", "text/plain; charset=utf-8", "name,id\nrex,1\n", "text/csv", "name,id\nrex,1\n"},
+		// The media type of the errors doesn't change the one asked for.
+		{"/pet.xml", "application/xml", "<Pet><id>1</id></Pet>", "application/xml", map[string]interface{}{"id": 1}},
+		{"/logo", "image/png", "\x89PNG\r\n\x1a\n\xff\xfe", "image/png", nil},
+	}
+	for _, c := range cases {
+		suite := newTestSuite(t, negotiationSpec, "http://example.com")
+		client := &stubClient{status: 200, body: c.body, header: http.Header{"Content-Type": []string{c.contentType}}}
+		suite.plan.Client = client
+		dup, err := runTest(suite, &Test{Name: "get", Path: c.path, Method: "get"})
+		if err != nil {
+			t.Fatalf("%s: %v", c.path, err)
+		}
+		if accept := client.requests[0].Header.Get("Accept"); accept != c.accept {
+			t.Errorf("%s: expecting to accept %s, got %s", c.path, c.accept, accept)
+		}
+		if body := dup.Expect[ExpectBody]; (body == nil) != (c.expectBody == nil) ||
+			(body != nil && !mqutil.InterfaceEquals(c.expectBody, body)) {
+			t.Errorf("%s: expecting the response body %#v, got %#v", c.path, c.expectBody, body)
+		}
+	}
+
+	// The test's own Accept header wins.
+	suite := newTestSuite(t, negotiationSpec, "http://example.com")
+	client := &stubClient{status: 200, body: "<pet><id>1</id></pet>", header: http.Header{"Content-Type": []string{"application/xml"}}}
+	suite.plan.Client = client
+	test := &Test{Name: "get", Path: "/pets", Method: "get"}
+	test.HeaderParams = map[string]interface{}{"Accept": "application/xml"}
+	if _, err := runTest(suite, test); err != nil {
+		t.Fatal(err)
+	}
+	if accept := client.requests[0].Header.Get("Accept"); accept != "application/xml" {
+		t.Errorf("expecting the test's Accept header, got %s", accept)
+	}
+}
+
+const xmlBodySpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths:
+  /pets:
+    post:
+      requestBody:
+        content:
+          application/xml:
+            schema:
+              $ref: '#/components/schemas/Pet'
+      responses:
+        '201':
+          description: created
+          content:
+            application/xml:
+              schema:
+                $ref: '#/components/schemas/Pet'
+components:
+  schemas:
+    Pet:
+      type: object
+      xml:
+        name: pet
+      required: [id, name, tags]
+      properties:
+        id:
+          type: integer
+          xml:
+            attribute: true
+        name:
+          type: string
+          minLength: 1
+        tags:
+          type: array
+          xml:
+            wrapped: true
+          items:
+            type: string
+            xml:
+              name: tag
+`
+
+func TestXmlBodies(t *testing.T) {
+	type pet struct {
+		XMLName xml.Name `xml:"pet"`
+		Id      int64    `xml:"id,attr"`
+		Name    string   `xml:"name"`
+		Tags    []string `xml:"tags>tag"`
+	}
+	var received pet
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		received = pet{}
+		if err := xml.NewDecoder(r.Body).Decode(&received); err != nil || len(received.Name) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusCreated)
+		xml.NewEncoder(w).Encode(&received)
+	}))
+	defer server.Close()
+
+	for _, name := range []string{ClientResty, ClientHTTP} {
+		client, err := NewClient(name, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		suite := newTestSuite(t, xmlBodySpec, server.URL)
+		suite.plan.Client = client
+		test := &Test{Name: "create", Path: "/pets", Method: "post"}
+		test.BodyParams = map[string]interface{}{"name": "rex", "tags": []interface{}{"a", "b"}}
+		dup, err := runTest(suite, test)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if contentType != "application/xml" || received.Name != "rex" || len(received.Tags) != 2 || received.Id == 0 {
+			t.Errorf("%s: unexpected xml request %s %+v", name, contentType, received)
+		}
+		// The response is read back with the names and the types of the schema.
+		expected := map[string]interface{}{"id": received.Id, "name": "rex", "tags": []interface{}{"a", "b"}}
+		if !mqutil.InterfaceEquals(expected, dup.Expect[ExpectBody]) {
+			t.Errorf("%s: expecting the response body %v, got %v", name, expected, dup.Expect[ExpectBody])
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqswag"
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// MockClient answers requests in-process, without a server. Objects created by a POST are stored
+// under the collection path followed by their id. Missing ids are taken from the run's id allocator,
+// the same one the generator uses in mock mode.
+type MockClient struct {
+	Plan *TestPlan
+
+	objects map[string]map[string]interface{} // object path to object
+	mutex   sync.Mutex
+}
+
+// NewMockClient creates a mock server for the plan's swagger spec.
+func NewMockClient(plan *TestPlan) *MockClient {
+	return &MockClient{Plan: plan, objects: make(map[string]map[string]interface{})}
+}
+
+// matchPath checks whether the path is an instance of the swagger path template.
+func matchPath(template string, path string) bool {
+	tAr := strings.Split(strings.Trim(template, "/"), "/")
+	pAr := strings.Split(strings.Trim(path, "/"), "/")
+	if len(tAr) != len(pAr) {
+		return false
+	}
+	for i := range tAr {
+		if tAr[i] != pAr[i] && !(strings.HasPrefix(tAr[i], "{") && strings.HasSuffix(tAr[i], "}")) {
+			return false
+		}
+	}
+	return true
+}
+
+// getClass returns the class of the objects the operation on path works on.
+func (c *MockClient) getClass(method string, path string) string {
+	swagger := c.Plan.swagger
+	for template, pathItem := range swagger.Paths {
+		if !matchPath(template, path) {
+			continue
+		}
+		op := GetOperationByMethod(pathItem, method)
+		if op == nil {
+			return ""
+		}
+		if tag := mqswag.GetMeqaTag(op.Description); tag != nil && len(tag.Class) > 0 {
+			return tag.Class
+		}
+		t := &Test{op: op, db: c.Plan.db}
+		if class := t.patchClass(); len(class) > 0 {
+			return class
+		}
+		if op.RequestBody != nil && op.RequestBody.Value.Content[mqswag.JsonResponse] != nil {
+			bodySchema := (mqswag.SchemaRef)(*op.RequestBody.Value.Content[mqswag.JsonResponse].Schema)
+			if tag, _ := swagger.GetSchemaRootType(bodySchema, nil); tag != nil {
+				return tag.Class
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+func mockResponse(status int, body interface{}) (*Response, error) {
+	header := http.Header{}
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+		header.Set("Content-Type", mqswag.JsonResponse)
+	}
+	return NewResponse(status, fmt.Sprintf("%d %s", status, http.StatusText(status)), header, b), nil
+}
+
+// decodeBody round trips the request body through JSON, the way a server would receive it.
+func decodeBody(body interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]interface{}
+	if err := mqutil.DecodeJson(b, &obj); err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("mock server expects an object body: %s", string(b)))
+	}
+	return obj, nil
+}
+
+func (c *MockClient) Do(req *Request) (*Response, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	if c.Plan == nil {
+		c.Plan = &Current
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	if base, err := url.Parse(c.Plan.GetBaseURL()); err == nil {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(base.Path, "/"))
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.objects == nil {
+		c.objects = make(map[string]map[string]interface{})
+	}
+	method := strings.ToLower(req.Method)
+	switch method {
+	case mqswag.MethodPost:
+		obj, err := decodeBody(req.Body)
+		if err != nil {
+			return mockResponse(http.StatusBadRequest, nil)
+		}
+		if obj[mqswag.IdField] == nil {
+			obj[mqswag.IdField] = mqswag.Ids.Next(c.getClass(method, path))
+		}
+		c.objects[fmt.Sprintf("%s/%v", path, obj[mqswag.IdField])] = obj
+		return mockResponse(http.StatusOK, obj)
+	case mqswag.MethodPut, mqswag.MethodPatch:
+		old := c.objects[path]
+		if old == nil {
+			return mockResponse(http.StatusNotFound, nil)
+		}
+		if req.Header.Get("Content-Type") == mqswag.JsonPatch {
+			ops, _ := req.Body.([]interface{})
+			obj, err := mqutil.JsonPatchApply(old, ops)
+			if err != nil {
+				return mockResponse(http.StatusBadRequest, nil)
+			}
+			c.objects[path] = obj
+			return mockResponse(http.StatusOK, obj)
+		}
+		obj, err := decodeBody(req.Body)
+		if err != nil {
+			return mockResponse(http.StatusBadRequest, nil)
+		}
+		if method == mqswag.MethodPatch {
+			obj = mqutil.MapCombine(mqutil.MapCopy(old), obj)
+		}
+		obj[mqswag.IdField] = old[mqswag.IdField]
+		c.objects[path] = obj
+		return mockResponse(http.StatusOK, obj)
+	case mqswag.MethodDelete:
+		if c.objects[path] == nil {
+			return mockResponse(http.StatusNotFound, nil)
+		}
+		delete(c.objects, path)
+		return mockResponse(http.StatusNoContent, nil)
+	case mqswag.MethodGet:
+		if obj := c.objects[path]; obj != nil {
+			return mockResponse(http.StatusOK, obj)
+		}
+		// List the objects in the collection, in a stable order.
+		var keys []string
+		for k := range c.objects {
+			if strings.HasPrefix(k, path+"/") && !strings.Contains(k[len(path)+1:], "/") {
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) == 0 && strings.HasSuffix(c.findTemplate(path), "}") {
+			return mockResponse(http.StatusNotFound, nil)
+		}
+		sort.Strings(keys)
+		list := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			list = append(list, c.objects[k])
+		}
+		return mockResponse(http.StatusOK, list)
+	}
+	return mockResponse(http.StatusMethodNotAllowed, nil)
+}
+
+// findTemplate returns the swagger path template the path is an instance of.
+func (c *MockClient) findTemplate(path string) string {
+	for template := range c.Plan.swagger.Paths {
+		if matchPath(template, path) {
+			return template
+		}
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package mqplan
+
+import (
+	"testing"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqswag"
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+const mockSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths:
+  /pets:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+      responses:
+        '200':
+          description: created
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+  /pets/{id}:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          description: <meqa Pet.id>
+          schema:
+            type: integer
+      responses:
+        '200':
+          description: found
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        id:
+          type: integer
+          readOnly: true
+        name:
+          type: string
+`
+
+func TestMockIdAllocation(t *testing.T) {
+	suite := newTestSuite(t, mockSpec, "http://example.com/api")
+	suite.plan.Client = NewMockClient(suite.plan)
+
+	// The generator allocates the id in lenient mode, the mock server does in strict mode.
+	for _, strict := range []bool{false, true} {
+		suite.Strict = strict
+		if _, err := runTest(suite, &Test{Name: "create", Path: "/pets", Method: "post"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if last := mqswag.Ids.Last("Pet"); last != 2 {
+		t.Fatalf("expected 2 allocated Pet ids, got %d", last)
+	}
+	ids := make(map[string]bool)
+	for _, obj := range suite.db.Find("Pet", nil, nil, mqswag.MatchAlways, -1) {
+		ids[mqutil.InterfaceToJsonString(obj.(map[string]interface{})["id"])] = true
+	}
+	if !ids["1"] || !ids["2"] {
+		t.Fatalf("stored ids don't match the allocated ids: %v", ids)
+	}
+
+	suite.Strict = false
+	dup, err := runTest(suite, &Test{Name: "get", Path: "/pets/{id}", Method: "get"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := mqutil.InterfaceToJsonString(dup.PathParams["id"]); !ids[id] {
+		t.Errorf("referenced id %s was never allocated", id)
+	}
+}
+
+func TestTaggedParameterReference(t *testing.T) {
+	// Against a real server too, the tagged id refers to a pet of the DB instead of a random one.
+	suite := newTestSuite(t, mockSpec, "http://example.com/api")
+	client := &stubClient{status: 200, body: `{"id": 7, "name": "rex"}`}
+	suite.plan.Client = client
+	if err := suite.db.Insert("Pet", map[string]interface{}{"id": 7, "name": "rex"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runTest(suite, &Test{Name: "get", Path: "/pets/{id}", Method: "get"}); err != nil {
+		t.Fatal(err)
+	}
+	if url := client.requests[0].URL; url != "http://example.com/api/pets/7" {
+		t.Errorf("expecting the get to refer to the pet in the DB, got %s", url)
+	}
+}
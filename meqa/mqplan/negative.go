@@ -0,0 +1,281 @@
+package mqplan
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqswag"
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+
+	spec "github.com/getkin/kin-openapi/openapi3"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// OmitSuffix labels the negative tests that leave a required field out of the body.
+const OmitSuffix = "_omit_"
+
+// ViolateSuffix labels the negative tests that break one constraint of a body field or a parameter.
+const ViolateSuffix = "_violate_"
+
+// The constraints a negative test can break.
+const (
+	ViolateType      = "type"
+	ViolateMinLength = "minLength"
+	ViolateMaxLength = "maxLength"
+	ViolateMinimum   = "minimum"
+	ViolateMaximum   = "maximum"
+	ViolateEnum      = "enum"
+)
+
+// invalidString is the string the violations start from.
+const invalidString = "meqa-invalid"
+
+// violations lists the constraints of the schema that a value can break. The type of a string parameter
+// isn't one of them, since the parameters are sent as strings anyway.
+func violations(s *spec.Schema, isParam bool) []string {
+	var list []string
+	switch s.Type {
+	case gojsonschema.TYPE_STRING:
+		if !isParam {
+			list = append(list, ViolateType)
+		}
+		if s.MinLength > 0 {
+			list = append(list, ViolateMinLength)
+		}
+		if s.MaxLength != nil {
+			list = append(list, ViolateMaxLength)
+		}
+	case gojsonschema.TYPE_INTEGER, gojsonschema.TYPE_NUMBER:
+		list = append(list, ViolateType)
+		if s.Min != nil {
+			list = append(list, ViolateMinimum)
+		}
+		if s.Max != nil {
+			list = append(list, ViolateMaximum)
+		}
+	case gojsonschema.TYPE_BOOLEAN:
+		list = append(list, ViolateType)
+	default:
+		return nil
+	}
+	if len(s.Enum) > 0 {
+		list = append(list, ViolateEnum)
+	}
+	return list
+}
+
+// violatingValue returns a value that breaks the constraint of the schema and only that one, as much as
+// it can.
+func violatingValue(s *spec.Schema, constraint string) (interface{}, error) {
+	integer := s.Type == gojsonschema.TYPE_INTEGER
+	switch constraint {
+	case ViolateType:
+		if s.Type == gojsonschema.TYPE_STRING {
+			return 1, nil
+		}
+		return invalidString, nil
+	case ViolateMinLength:
+		if s.MinLength > 0 {
+			return strings.Repeat("a", int(s.MinLength)-1), nil
+		}
+	case ViolateMaxLength:
+		if s.MaxLength != nil {
+			return strings.Repeat("a", int(*s.MaxLength)+1), nil
+		}
+	case ViolateMinimum:
+		if s.Min != nil {
+			if s.ExclusiveMin {
+				return numberValue(*s.Min, integer), nil
+			}
+			if integer {
+				return numberValue(math.Ceil(*s.Min)-1, integer), nil
+			}
+			return *s.Min - 1, nil
+		}
+	case ViolateMaximum:
+		if s.Max != nil {
+			if s.ExclusiveMax {
+				return numberValue(*s.Max, integer), nil
+			}
+			if integer {
+				return numberValue(math.Floor(*s.Max)+1, integer), nil
+			}
+			return *s.Max + 1, nil
+		}
+	case ViolateEnum:
+		if len(s.Enum) > 0 {
+			return notInEnum(s), nil
+		}
+	}
+	return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the schema has no %s constraint to violate", constraint))
+}
+
+func numberValue(f float64, integer bool) interface{} {
+	if integer {
+		return int64(f)
+	}
+	return f
+}
+
+// notInEnum returns a value of the schema's type that isn't one of its enum values.
+func notInEnum(s *spec.Schema) interface{} {
+	if s.Type == gojsonschema.TYPE_INTEGER || s.Type == gojsonschema.TYPE_NUMBER {
+		max := 0.0
+		for _, v := range s.Enum {
+			if f, ok := v.(float64); ok && f > max {
+				max = f
+			}
+		}
+		return numberValue(math.Floor(max)+1, true)
+	}
+	value := invalidString
+	for {
+		taken := false
+		for _, v := range s.Enum {
+			if v == value {
+				taken = true
+			}
+		}
+		if !taken {
+			return value
+		}
+		value += "-"
+	}
+}
+
+// splitViolation splits the test's violate into the name of the field or parameter and the constraint.
+func splitViolation(violate string) (string, string) {
+	i := strings.LastIndex(violate, ".")
+	if i < 0 {
+		return "", violate
+	}
+	return violate[:i], violate[i+1:]
+}
+
+// applyViolation replaces the value of the body field, or else the parameter, that the test's violate
+// names with one that breaks the constraint.
+func (t *Test) applyViolation() error {
+	name, constraint := splitViolation(t.Violate)
+	if _, mediaType := t.requestMediaType(); mediaType != nil && mediaType.Schema != nil {
+		body, isMap := t.BodyParams.(map[string]interface{})
+		if p := ((mqswag.SchemaRef)(*mediaType.Schema)).GetProperties(t.db.Swagger)[name]; isMap && p != nil && p.Value != nil {
+			value, err := violatingValue(p.Value, constraint)
+			if err != nil {
+				return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("can't violate %s - %s", t.Violate, err.Error()))
+			}
+			body[name] = value
+			t.printf("        %s: violating %s\n", name, constraint)
+			return nil
+		}
+	}
+	for _, p := range t.op.Parameters {
+		if p.Value == nil || p.Value.Name != name {
+			continue
+		}
+		paramsMap := map[string]map[string]interface{}{
+			spec.ParameterInPath:   t.PathParams,
+			spec.ParameterInQuery:  t.QueryParams,
+			spec.ParameterInHeader: t.HeaderParams,
+			"formData":             t.FormParams,
+		}[p.Value.In]
+		schema := parameterSchema(p.Value)
+		if paramsMap == nil || schema == nil {
+			break
+		}
+		value, err := violatingValue(schema.Value, constraint)
+		if err != nil {
+			return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("can't violate %s - %s", t.Violate, err.Error()))
+		}
+		paramsMap[name] = value
+		t.printf("        %s (in %s): violating %s\n", name, p.Value.In, constraint)
+		return nil
+	}
+	return mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("can't violate %s - %s isn't a body field or a parameter", t.Violate, name))
+}
+
+// GenerateNegativeTestSuite generates the negative tests of the operation, each expecting the server to
+// reject the request with a 4xx. A test leaves out one of the fields the body requires, or breaks one
+// constraint of a body field or a parameter, e.g. with a string longer than its maxLength.
+func GenerateNegativeTestSuite(opNode *mqswag.DAGNode, plan *TestPlan) {
+	op, ok := opNode.Data.(*spec.Operation)
+	if !ok || op == nil {
+		return
+	}
+	var tests []*Test
+	add := func(suffix string, update func(*Test)) {
+		test := CreateTestFromOp(opNode, len(tests)+1)
+		test.Name += suffix
+		test.Expect = map[string]interface{}{ExpectStatus: "4xx"}
+		update(test)
+		tests = append(tests, test)
+	}
+	if _, mediaType := (&Test{op: op}).requestMediaType(); mediaType != nil && mediaType.Schema != nil {
+		body := (mqswag.SchemaRef)(*mediaType.Schema)
+		properties := body.GetProperties(plan.swagger)
+		for _, field := range body.GetRequired(plan.swagger) {
+			if p := properties[field]; p != nil && p.Value != nil && p.Value.ReadOnly {
+				// The server ignores the readOnly fields of the requests, leaving one out isn't an error.
+				continue
+			}
+			add(OmitSuffix+field, func(test *Test) { test.Omit = []string{field} })
+		}
+		var names []string
+		for name := range properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p := properties[name]
+			if p.Value == nil || p.Value.ReadOnly {
+				continue
+			}
+			for _, constraint := range violations(p.Value, false) {
+				violate := name + "." + constraint
+				add(ViolateSuffix+violate, func(test *Test) { test.Violate = violate })
+			}
+		}
+	}
+	for _, p := range op.Parameters {
+		if p.Value == nil {
+			continue
+		}
+		schema := parameterSchema(p.Value)
+		if schema == nil {
+			continue
+		}
+		for _, constraint := range violations(schema.Value, true) {
+			violate := p.Value.Name + "." + constraint
+			add(ViolateSuffix+violate, func(test *Test) { test.Violate = violate })
+		}
+	}
+	if len(tests) == 0 {
+		return
+	}
+	testSuite := CreateTestSuite(fmt.Sprintf("%s %s -- negative", opNode.GetName(), opNode.GetMethod()), nil, plan)
+	testSuite.Tests = tests
+	plan.Add(testSuite)
+}
+
+// GenerateNegativeTestPlan generates the negative tests that check the server rejects the requests that
+// break the schemas of the spec.
+func GenerateNegativeTestPlan(swagger *mqswag.Swagger, dag *mqswag.DAG) (*TestPlan, error) {
+	testPlan := &TestPlan{}
+	testPlan.Init(swagger, nil)
+	testPlan.comment = `
+In this test plan, each test breaks one constraint of the request, by leaving out a field the body
+requires or by sending a value the schema doesn't allow, and expects the server to reject it with a
+4xx status.
+`
+	addInitTestSuite(testPlan)
+
+	addFunc := func(previous *mqswag.DAGNode, current *mqswag.DAGNode) error {
+		if current.GetType() == mqswag.TypeOp {
+			GenerateNegativeTestSuite(current, testPlan)
+		}
+		return nil
+	}
+	dag.IterateByWeight(addFunc)
+	return testPlan, nil
+}
@@ -0,0 +1,186 @@
+package mqplan
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqswag"
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+const negativeSpec = `
+openapi: 3.0.2
+info:
+  title: accounts
+  version: "1.0"
+paths:
+  /accounts:
+    post:
+      operationId: createAccount
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Account'
+      responses:
+        '201':
+          description: created
+        '400':
+          description: invalid
+    get:
+      operationId: listAccounts
+      parameters:
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            minimum: 1
+            maximum: 100
+      responses:
+        '200':
+          description: ok
+components:
+  schemas:
+    Account:
+      type: object
+      required: [id, name]
+      properties:
+        id:
+          type: integer
+          readOnly: true
+        name:
+          type: string
+          minLength: 2
+          maxLength: 8
+        role:
+          type: string
+          enum: [admin, meqa-invalid]
+        score:
+          type: number
+          exclusiveMaximum: true
+          maximum: 10
+`
+
+func TestGenerateNegativeTestPlan(t *testing.T) {
+	suite := newTestSuite(t, negativeSpec, "http://example.com")
+	swagger := suite.plan.swagger
+	dag := mqswag.NewDAG()
+	if err := swagger.AddToDAG(dag); err != nil {
+		t.Fatal(err)
+	}
+	dag.Sort()
+	dag.CheckWeight()
+	plan, err := GenerateNegativeTestPlan(swagger, dag)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The id is required too, but there's no test that leaves it out since it's readOnly.
+	expected := map[string][]string{
+		"/accounts post -- negative": {OmitSuffix + "name", ViolateSuffix + "name.type", ViolateSuffix + "name.minLength",
+			ViolateSuffix + "name.maxLength", ViolateSuffix + "role.type", ViolateSuffix + "role.enum",
+			ViolateSuffix + "score.type", ViolateSuffix + "score.maximum"},
+		"/accounts get -- negative": {ViolateSuffix + "limit.type", ViolateSuffix + "limit.minimum",
+			ViolateSuffix + "limit.maximum"},
+	}
+	for name, suffixes := range expected {
+		tc := plan.SuiteMap[name]
+		if tc == nil || len(tc.Tests) != len(suffixes) {
+			t.Fatalf("%s: expecting the tests %v, got %v", name, suffixes, tc)
+		}
+		for i, test := range tc.Tests {
+			if !strings.HasSuffix(test.Name, suffixes[i]) || test.Expect[ExpectStatus] != "4xx" {
+				t.Errorf("%s: expecting a 4xx test ending with %s, got %+v", name, suffixes[i], test)
+			}
+		}
+	}
+
+	// Each test breaks its constraint and nothing else, and fails when the server takes the request.
+	violating := map[string]func(interface{}) bool{
+		"name.type":      func(v interface{}) bool { return reflect.DeepEqual(v, 1) },
+		"name.minLength": func(v interface{}) bool { return v == "a" },
+		"name.maxLength": func(v interface{}) bool { s, _ := v.(string); return utf8.RuneCountInString(s) == 9 },
+		"role.enum":      func(v interface{}) bool { return v == "meqa-invalid-" },
+		"score.maximum":  func(v interface{}) bool { return mqutil.InterfaceEquals(10, v) },
+		"limit.maximum":  func(v interface{}) bool { return v == "101" },
+		"limit.minimum":  func(v interface{}) bool { return v == "0" },
+	}
+	for violate, isViolating := range violating {
+		field, _ := splitViolation(violate)
+		method := "post"
+		if field == "limit" {
+			method = "get"
+		}
+		for _, status := range []int{400, 201} {
+			client := &stubClient{status: status}
+			suite.plan.Client = client
+			test := &Test{Name: "negative", Path: "/accounts", Method: method, Violate: violate,
+				Expect: map[string]interface{}{ExpectStatus: "4xx"}}
+			_, err := runTest(suite, test)
+			if (err != nil) != (status == 201) {
+				t.Errorf("%s: status %d: unexpected error %v", violate, status, err)
+			}
+			var value interface{}
+			if method == "post" {
+				value = client.requests[0].Body.(map[string]interface{})[field]
+			} else {
+				value = client.requests[0].Query[field]
+			}
+			if !isViolating(value) {
+				t.Errorf("%s: unexpected value %v", violate, value)
+			}
+		}
+	}
+
+	test := &Test{Name: "negative", Path: "/accounts", Method: "post", Violate: "name.maximum"}
+	if _, err := runTest(suite, test); err == nil {
+		t.Error("expecting an error for a constraint the field doesn't have")
+	}
+}
+
+// runNegativeSuite generates the negative plan of the spec, loads it the way mqgo run does, and runs its suite
+// with the name, with a client that rejects all the requests.
+func runNegativeSuite(t *testing.T, specYaml string, name string) (*TestSuite, map[string]int, *stubClient) {
+	suite := newTestSuite(t, specYaml, "http://example.com")
+	plan := suite.plan
+	dag := mqswag.NewDAG()
+	if err := plan.swagger.AddToDAG(dag); err != nil {
+		t.Fatal(err)
+	}
+	dag.Sort()
+	dag.CheckWeight()
+	generated, err := GenerateNegativeTestPlan(plan.swagger, dag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "negative.yml")
+	if err := generated.DumpToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := plan.InitFromFile(path, plan.db); err != nil {
+		t.Fatal(err)
+	}
+	client := &stubClient{status: 400}
+	plan.Client = client
+	tc := plan.SuiteMap[name]
+	if tc == nil {
+		t.Fatalf("no suite %s", name)
+	}
+	counts, err := plan.Run(name, nil)
+	if err != nil {
+		t.Errorf("%s: %v", name, err)
+	}
+	return tc, counts, client
+}
+
+func TestNegativeSuiteRun(t *testing.T) {
+	// A rejected POST that expects the 4xx doesn't keep the rest of the suite from being sent.
+	tc, counts, client := runNegativeSuite(t, negativeSpec, "/accounts post -- negative")
+	if len(client.requests) != len(tc.Tests) || counts[mqutil.Passed] != len(tc.Tests) || counts[mqutil.Skipped] != 0 {
+		t.Errorf("expecting all the %d tests to be sent and pass, got %d requests and %v", len(tc.Tests),
+			len(client.requests), counts)
+	}
+}
@@ -0,0 +1,79 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqswag"
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// tokenExpiryMargin is how long before it expires a token is replaced, so it doesn't expire in flight.
+const tokenExpiryMargin = 10 * time.Second
+
+// OAuth gets access tokens with the OAuth2 client credentials grant. A token is reused until it's about to
+// expire.
+type OAuth struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	token  string
+	expiry time.Time  // Zero when the token doesn't expire.
+	mutex  sync.Mutex // The parallel suites share the token.
+}
+
+// oauthToken is the token response of RFC 6749 section 5.1.
+type oauthToken struct {
+	AccessToken string      `json:"access_token"`
+	TokenType   string      `json:"token_type"`
+	ExpiresIn   json.Number `json:"expires_in"`
+}
+
+// Token returns the cached access token, or gets a new one with the client if there isn't one or it's
+// about to expire.
+func (o *OAuth) Token(client Client) (string, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if len(o.token) > 0 && (o.expiry.IsZero() || time.Now().Add(tokenExpiryMargin).Before(o.expiry)) {
+		return o.token, nil
+	}
+	req := NewRequest()
+	req.Method = mqswag.MethodPost
+	req.URL = o.TokenURL
+	req.Header.Set("Accept", "application/json")
+	req.Form = map[string]string{"grant_type": "client_credentials"}
+	if len(o.Scopes) > 0 {
+		req.Form["scope"] = strings.Join(o.Scopes, " ")
+	}
+	// The client authenticates with http basic, RFC 6749 section 2.3.1.
+	req.Username = o.ClientID
+	req.Password = o.ClientSecret
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", mqutil.NewError(mqutil.ErrHttp, fmt.Sprintf("failed to get an oauth token: %s", err.Error()))
+	}
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		return "", mqutil.NewError(mqutil.ErrHttp, fmt.Sprintf("failed to get an oauth token, status %d: %s",
+			resp.StatusCode(), string(resp.Body())))
+	}
+	var token oauthToken
+	if err := json.Unmarshal(resp.Body(), &token); err != nil || len(token.AccessToken) == 0 {
+		return "", mqutil.NewError(mqutil.ErrServerResp, fmt.Sprintf("the oauth token response has no access token: %s",
+			string(resp.Body())))
+	}
+	if len(token.TokenType) > 0 && !strings.EqualFold(token.TokenType, AuthBearer) {
+		return "", mqutil.NewError(mqutil.ErrServerResp, fmt.Sprintf("unsupported oauth token type %s", token.TokenType))
+	}
+	o.token = token.AccessToken
+	o.expiry = time.Time{}
+	if seconds, err := token.ExpiresIn.Int64(); err == nil && seconds > 0 {
+		o.expiry = time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	mqutil.Logger.Printf("got an oauth token from %s, expiring at %v", o.TokenURL, o.expiry)
+	return o.token, nil
+}
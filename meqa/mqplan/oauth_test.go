@@ -0,0 +1,99 @@
+package mqplan
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+const oauthSpec = `
+openapi: 3.0.2
+info:
+  title: oauth
+  version: "1.0"
+security:
+  - clientCredentials: [read]
+paths:
+  /items:
+    get:
+      responses:
+        '200':
+          description: ok
+components:
+  securitySchemes:
+    clientCredentials:
+      type: oauth2
+      flows:
+        clientCredentials:
+          tokenUrl: /token
+          scopes:
+            read: read the items
+`
+
+const oauthPlan = `
+/items:
+- name: first
+  path: /items
+  method: get
+- name: second
+  path: /items
+  method: get
+`
+
+func TestOAuthClientCredentials(t *testing.T) {
+	for _, c := range []struct {
+		expiresIn   int
+		tokenStatus int
+		tokens      int // The number of tokens got.
+		failed      int
+	}{
+		{3600, http.StatusOK, 1, 0},
+		{0, http.StatusOK, 1, 0},
+		// A token expiring within the margin is replaced for each test.
+		{5, http.StatusOK, 2, 0},
+		{3600, http.StatusUnauthorized, 2, 2},
+	} {
+		tokens := 0
+		var authorizations []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/token" {
+				tokens++
+				id, secret, _ := r.BasicAuth()
+				if c.tokenStatus != http.StatusOK || id != "meqa" || secret != "secret" ||
+					r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "read" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"access_token": "token%d", "token_type": "Bearer", "expires_in": %d}`, tokens, c.expiresIn)
+				return
+			}
+			authorizations = append(authorizations, r.Header.Get("Authorization"))
+		}))
+		suite := newTestSuite(t, oauthSpec, server.URL)
+		plan := suite.plan
+		plan.Client, _ = NewClient(ClientHTTP, nil, nil)
+		plan.OAuth = &OAuth{TokenURL: server.URL + "/token", ClientID: "meqa", ClientSecret: "secret", Scopes: []string{"read"}}
+		if err := plan.AddFromString(oauthPlan); err != nil {
+			t.Fatal(err)
+		}
+		counts, _ := plan.Run("/items", nil)
+		server.Close()
+		if tokens != c.tokens || counts[mqutil.Failed] != c.failed {
+			t.Errorf("expires in %d, status %d: got %d tokens and counts %v", c.expiresIn, c.tokenStatus, tokens, counts)
+		}
+		if c.failed > 0 {
+			if len(authorizations) > 0 {
+				t.Errorf("expecting no requests without a token, got %v", authorizations)
+			}
+			continue
+		}
+		last := fmt.Sprintf("Bearer token%d", c.tokens)
+		if len(authorizations) != 2 || authorizations[0] != "Bearer token1" || authorizations[1] != last {
+			t.Errorf("expires in %d: unexpected authorizations %v", c.expiresIn, authorizations)
+		}
+	}
+}
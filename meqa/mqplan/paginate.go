@@ -0,0 +1,222 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqswag"
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// MaxPages is the most pages we follow for a paginated list.
+const MaxPages = 1000
+
+var (
+	// The fields that hold the items and the total count of a page, in the order we look for them. A
+	// "count" isn't one of them, as it's often the number of items on the page.
+	pageItemsFields = []string{"items", "data", "results", "content"}
+	pageTotalFields = []string{"total", "totalCount", "total_count", "totalItems"}
+
+	linkHeaderRegexp = regexp.MustCompile(`<([^>]*)>\s*;[^,]*rel="?([a-zA-Z]+)"?`)
+)
+
+// page is one page of a paginated list response.
+type page struct {
+	url   string
+	items []interface{}
+	total *int64 // nil when the page doesn't declare a total.
+	next  string
+	prev  string
+}
+
+// linkValue returns the href of a link, which is either a string or an object with a href field.
+func linkValue(link interface{}) string {
+	switch v := link.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if href, ok := v["href"].(string); ok {
+			return href
+		}
+	}
+	return ""
+}
+
+// parsePage extracts the items, the total and the next/prev links from a list response. The links come
+// from the Link header, the top level next/prev fields or a links/_links object, the total from a total
+// field or the X-Total-Count header.
+func parsePage(pageURL string, resp *Response) (*page, error) {
+	p := &page{url: pageURL}
+	var body interface{}
+	if err := mqutil.DecodeJson(resp.Body(), &body); err != nil {
+		return nil, mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("page %s is not json: %s", pageURL, err.Error()))
+	}
+
+	links := make(map[string]string)
+	for _, m := range linkHeaderRegexp.FindAllStringSubmatch(resp.Header().Get("Link"), -1) {
+		links[m[2]] = m[1]
+	}
+	if total := resp.Header().Get("X-Total-Count"); len(total) > 0 {
+		if n, err := strconv.ParseInt(total, 10, 64); err == nil {
+			p.total = &n
+		}
+	}
+
+	switch obj := body.(type) {
+	case []interface{}:
+		p.items = obj
+	case map[string]interface{}:
+		for _, f := range pageItemsFields {
+			if items, ok := obj[f].([]interface{}); ok {
+				p.items = items
+				break
+			}
+		}
+		if p.items == nil {
+			return nil, mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("page %s has no list of items", pageURL))
+		}
+		for _, f := range pageTotalFields {
+			if n, ok := obj[f].(json.Number); ok {
+				if total, err := n.Int64(); err == nil {
+					p.total = &total
+					break
+				}
+			}
+		}
+		for _, f := range []string{"links", "_links"} {
+			if m, ok := obj[f].(map[string]interface{}); ok {
+				for rel, link := range m {
+					if _, exist := links[rel]; !exist {
+						links[rel] = linkValue(link)
+					}
+				}
+			}
+		}
+		for _, rel := range []string{"next", "prev", "previous"} {
+			if _, exist := links[rel]; !exist {
+				links[rel] = linkValue(obj[rel])
+			}
+		}
+	default:
+		return nil, mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("page %s is not a list", pageURL))
+	}
+
+	prev := links["prev"]
+	if len(prev) == 0 {
+		prev = links["previous"]
+	}
+	var err error
+	if p.next, err = resolveLink(pageURL, links["next"]); err == nil {
+		p.prev, err = resolveLink(pageURL, prev)
+	}
+	return p, err
+}
+
+// resolveLink resolves the link against the page's url, and normalizes the order of its query parameters
+// so that the links can be compared.
+func resolveLink(pageURL string, link string) (string, error) {
+	if len(link) == 0 {
+		return "", nil
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return "", mqutil.NewError(mqutil.ErrInvalid, err.Error())
+	}
+	u, err := base.Parse(link)
+	if err != nil {
+		return "", mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("page %s has an invalid link %s", pageURL, link))
+	}
+	u.RawQuery = u.Query().Encode()
+	return u.String(), nil
+}
+
+// itemKey identifies an item, by its id when it has one.
+func itemKey(item interface{}) string {
+	if m, ok := item.(map[string]interface{}); ok && m[mqswag.IdField] != nil {
+		return fmt.Sprint(m[mqswag.IdField])
+	}
+	b, _ := json.Marshal(item)
+	return string(b)
+}
+
+// checkPages follows the next links from the first page of a list and verifies that the pages are
+// consistent: the next links never loop, each page's prev link points back at the page before it, no
+// item shows up twice and the pages add up to the declared total.
+func (t *Test) checkPages(client Client, req *Request, resp *Response) error {
+	t.printf("... following the pages. ")
+	first, err := parsePage(req.URL, resp)
+	if err != nil {
+		return err
+	}
+	// The first request has its query parameters separately, add them so the prev link can be checked.
+	if len(req.Query) > 0 {
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			return mqutil.NewError(mqutil.ErrInvalid, err.Error())
+		}
+		query := u.Query()
+		for k, v := range req.Query {
+			query.Set(k, v)
+		}
+		u.RawQuery = query.Encode()
+		first.url = u.String()
+	}
+	pages := []*page{first}
+	visited := map[string]bool{first.url: true}
+	for p := first; len(p.next) > 0; {
+		if visited[p.next] {
+			return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("the next link of page %d loops back to %s", len(pages), p.next))
+		}
+		if len(pages) >= MaxPages {
+			return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("the list has more than %d pages", MaxPages))
+		}
+		visited[p.next] = true
+		nextReq := *req
+		nextReq.URL = p.next
+		nextReq.Query = nil
+		nextResp, err := client.Do(&nextReq)
+		if err != nil {
+			return mqutil.NewError(mqutil.ErrHttp, err.Error())
+		}
+		if nextResp.StatusCode() < 200 || nextResp.StatusCode() >= 300 {
+			return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("getting page %d at %s returned status %d",
+				len(pages)+1, p.next, nextResp.StatusCode()))
+		}
+		next, err := parsePage(p.next, nextResp)
+		if err != nil {
+			return err
+		}
+		if len(next.prev) > 0 && next.prev != p.url {
+			return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("the prev link of page %d is %s, expecting %s",
+				len(pages)+1, next.prev, p.url))
+		}
+		if next.total != nil && first.total != nil && *next.total != *first.total {
+			return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("page %d declares a total of %d, the first page %d",
+				len(pages)+1, *next.total, *first.total))
+		}
+		pages = append(pages, next)
+		p = next
+	}
+
+	count := 0
+	seen := make(map[string]int)
+	for i, p := range pages {
+		for _, item := range p.items {
+			key := itemKey(item)
+			if j, exist := seen[key]; exist {
+				return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("item %s shows up on both page %d and page %d", key, j+1, i+1))
+			}
+			seen[key] = i
+			count++
+		}
+	}
+	if first.total != nil && int64(count) != *first.total {
+		return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("the %d pages have %d items, the declared total is %d",
+			len(pages), count, *first.total))
+	}
+	t.printf("%d pages, %d items. %vSuccess%v\n", len(pages), count, mqutil.GREEN, mqutil.END)
+	return nil
+}
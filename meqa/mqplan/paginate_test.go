@@ -0,0 +1,99 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const pageSpec = `
+openapi: 3.0.2
+info:
+  title: pages
+  version: "1.0"
+paths:
+  /pets:
+    get:
+      parameters:
+        - name: page
+          in: query
+          schema:
+            type: integer
+      responses:
+        '200':
+          description: listed
+`
+
+// pageServer serves the items two per page, linking the pages with next/prev links and declaring the total.
+func pageServer(items int, total int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil {
+			n = 1
+		}
+		body := map[string]interface{}{"total": total}
+		var pets []interface{}
+		for i := (n-1)*2 + 1; i <= items && i <= n*2; i++ {
+			pets = append(pets, map[string]interface{}{"id": i})
+		}
+		body["items"] = pets
+		links := map[string]interface{}{}
+		if n*2 < items {
+			links["next"] = fmt.Sprintf("/pets?page=%d", n+1)
+		}
+		if n > 1 {
+			links["prev"] = map[string]interface{}{"href": fmt.Sprintf("/pets?page=%d", n-1)}
+		}
+		body["_links"] = links
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}))
+}
+
+func TestPaginationTotal(t *testing.T) {
+	for _, c := range []struct {
+		items int
+		total int
+		err   string
+	}{
+		{5, 5, ""},
+		{5, 6, "the 3 pages have 5 items, the declared total is 6"},
+	} {
+		server := pageServer(c.items, c.total)
+		suite := newTestSuite(t, pageSpec, server.URL)
+		suite.plan.Client, _ = NewClient(ClientHTTP, nil, nil)
+		test := &Test{Name: "list", Path: "/pets", Method: "get", Paginate: true}
+		test.QueryParams = map[string]interface{}{"page": 1}
+		_, err := runTest(suite, test)
+		server.Close()
+		if len(c.err) == 0 && err != nil {
+			t.Errorf("%d items: %v", c.items, err)
+		} else if len(c.err) > 0 && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%d items with total %d: expecting error %q, got %v", c.items, c.total, c.err, err)
+		}
+	}
+}
+
+func TestParsePageLinks(t *testing.T) {
+	header := http.Header{"Link": []string{`</pets?page=3&size=2>; rel="next", </pets?size=2&page=1>; rel="prev"`}}
+	p, err := parsePage("http://example.com/pets?page=2&size=2", NewResponse(200, "200 OK", header, []byte(`[{"id":3},{"id":4}]`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.next != "http://example.com/pets?page=3&size=2" || p.prev != "http://example.com/pets?page=1&size=2" || len(p.items) != 2 {
+		t.Errorf("unexpected page: %+v", p)
+	}
+
+	// The count of the items on the page isn't the total.
+	p, err = parsePage("http://example.com/pets", NewResponse(200, "200 OK", http.Header{}, []byte(`{"count":2,"items":[{"id":1},{"id":2}]}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.total != nil {
+		t.Errorf("expecting no total, got %d", *p.total)
+	}
+}
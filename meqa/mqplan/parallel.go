@@ -0,0 +1,80 @@
+package mqplan
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// independent checks whether the suite can run at the same time as the other suites. It has to be marked
+// parallel in its meqa_init, and it can't refer to other suites, which may be running already.
+func (tc *TestSuite) independent() bool {
+	if !tc.Parallel {
+		return false
+	}
+	for _, test := range tc.Tests {
+		if len(test.Ref) > 0 {
+			mqutil.Logger.Printf("suite %s refers to suite %s, it's run on its own", tc.Name, test.Ref)
+			return false
+		}
+	}
+	return true
+}
+
+// RunSuites runs the named suites and returns their result counts added up. The suites run in order,
+// except that the consecutive parallel suites run at the same time, up to workers of them at once. The
+// tests within a suite always run in order. With fewer than two workers all the suites run one by one.
+// Once the plan stops the run, the tests of the suites that are left are counted as skipped.
+func (plan *TestPlan) RunSuites(names []string, workers int) map[string]int {
+	counts := make(map[string]int)
+	var countsMutex sync.Mutex
+	runSuite := func(name string) {
+		mqutil.Logger.Printf("\n---\nTest suite: %s\n", name)
+		stdoutMutex.Lock()
+		fmt.Printf("\n---\nTest suite: %s\n", name)
+		stdoutMutex.Unlock()
+		suiteCounts, err := plan.Run(name, nil)
+		mqutil.Logger.Printf("err:\n%v", err)
+		countsMutex.Lock()
+		for k, v := range suiteCounts {
+			counts[k] += v
+		}
+		countsMutex.Unlock()
+	}
+
+	var group []string
+	runGroup := func() {
+		queue := make(chan string)
+		var wg sync.WaitGroup
+		for i := 0; i < workers && i < len(group); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for name := range queue {
+					runSuite(name)
+				}
+			}()
+		}
+		for _, name := range group {
+			plan.SuiteMap[name].buffered = true
+			queue <- name
+		}
+		close(queue)
+		wg.Wait()
+		for _, name := range group {
+			plan.SuiteMap[name].buffered = false
+		}
+		group = nil
+	}
+	for _, name := range names {
+		if tc := plan.SuiteMap[name]; workers > 1 && tc != nil && tc.independent() {
+			group = append(group, name)
+			continue
+		}
+		runGroup()
+		runSuite(name)
+	}
+	runGroup()
+	return counts
+}
@@ -0,0 +1,88 @@
+package mqplan
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// concurrencyClient counts how many requests it's sent at the same time at most.
+type concurrencyClient struct {
+	active int32
+	max    int32
+}
+
+func (c *concurrencyClient) Do(req *Request) (*Response, error) {
+	n := atomic.AddInt32(&c.active, 1)
+	defer atomic.AddInt32(&c.active, -1)
+	for m := atomic.LoadInt32(&c.max); n > m && !atomic.CompareAndSwapInt32(&c.max, m, n); m = atomic.LoadInt32(&c.max) {
+	}
+	time.Sleep(20 * time.Millisecond)
+	return NewResponse(200, "OK", http.Header{}, nil), nil
+}
+
+func TestRunSuitesInParallel(t *testing.T) {
+	var suites []string
+	for _, name := range []string{"/a", "/b", "/c"} {
+		suites = append(suites, fmt.Sprintf(`
+%s:
+- name: meqa_init
+  parallel: true
+- name: %s first
+  path: /open
+  method: get
+- name: %s second
+  path: /open
+  method: get
+`, name, name, name))
+	}
+	suites = append(suites, `
+/sequential:
+- name: only
+  path: /open
+  method: get
+`)
+	for _, c := range []struct {
+		workers    int
+		concurrent int32
+	}{
+		{1, 1},
+		{2, 2},
+		{8, 3},
+	} {
+		suite := newTestSuite(t, securedSpec, "http://example.com")
+		client := &concurrencyClient{}
+		suite.plan.Client = client
+		suite.plan.Quiet = true
+		for _, s := range suites {
+			if err := suite.plan.AddFromString(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		counts := suite.plan.RunSuites([]string{"/a", "/b", "/c", "/sequential"}, c.workers)
+		if counts[mqutil.Failed] != 0 || counts[mqutil.Passed] != 7 {
+			t.Errorf("%d workers: expecting all the tests to pass, got %v", c.workers, counts)
+		}
+		if max := atomic.LoadInt32(&client.max); max != c.concurrent {
+			t.Errorf("%d workers: expecting %d requests at the same time, got %d", c.workers, c.concurrent, max)
+		}
+		// The tests of a suite still run in order.
+		started := make(map[string]time.Time)
+		for _, test := range suite.plan.resultList {
+			started[test.Name] = test.startTime
+		}
+		for _, name := range []string{"/a", "/b", "/c"} {
+			if !started[name+" first"].Before(started[name+" second"]) {
+				t.Errorf("%d workers: the tests of %s ran out of order", c.workers, name)
+			}
+			// The sequential suite waits for the parallel ones before it.
+			if !started[name+" second"].Before(started["only"]) {
+				t.Errorf("%d workers: the sequential suite ran before %s was done", c.workers, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package mqplan
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqswag"
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+
+	spec "github.com/getkin/kin-openapi/openapi3"
+)
+
+// parameterSchema returns the schema of the parameter, or that of its json content when it's declared with
+// content instead. Returns nil when it has neither.
+func parameterSchema(p *spec.Parameter) *spec.SchemaRef {
+	if p.Schema != nil && p.Schema.Value != nil {
+		return p.Schema
+	}
+	if mediaType := p.Content.Get(mqswag.JsonResponse); mediaType != nil && mediaType.Schema != nil {
+		return mediaType.Schema
+	}
+	return nil
+}
+
+// explodes checks whether the object values of the parameter are exploded into their fields. That's the
+// default of the form style, the query parameters' default.
+func explodes(p *spec.Parameter) bool {
+	if p.Explode != nil {
+		return *p.Explode
+	}
+	return p.Style == "" && p.In == spec.ParameterInQuery || p.Style == "form"
+}
+
+// styledParams returns the parameters that are in the location with their object values serialized the
+// way the parameters' style and explode say. With the query's default style an object {"role": "admin"}
+// becomes the role=admin parameter, the other values are left as they are.
+func (t *Test) styledParams(params map[string]interface{}, in string) map[string]interface{} {
+	if t.op == nil {
+		return params
+	}
+	styled := make(map[string]interface{})
+	for k, v := range params {
+		styled[k] = v
+	}
+	for _, p := range t.op.Parameters {
+		if p.Value == nil || p.Value.In != in || p.Value.Schema == nil {
+			continue
+		}
+		obj, isMap := params[p.Value.Name].(map[string]interface{})
+		if !isMap {
+			continue
+		}
+		var keys []string
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		switch {
+		case p.Value.Style == "deepObject":
+			delete(styled, p.Value.Name)
+			for _, k := range keys {
+				styled[p.Value.Name+"["+k+"]"] = obj[k]
+			}
+		case explodes(p.Value) && in == spec.ParameterInQuery:
+			delete(styled, p.Value.Name)
+			for _, k := range keys {
+				styled[k] = obj[k]
+			}
+		default:
+			// The fields are listed as k1,v1,k2,v2, or as k1=v1,k2=v2 when they're exploded.
+			var fields []string
+			for _, k := range keys {
+				if explodes(p.Value) {
+					fields = append(fields, k+"="+mqutil.InterfaceToJsonString(obj[k]))
+				} else {
+					fields = append(fields, k, mqutil.InterfaceToJsonString(obj[k]))
+				}
+			}
+			styled[p.Value.Name] = strings.Join(fields, ",")
+		}
+	}
+	return styled
+}
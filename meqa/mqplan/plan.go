@@ -6,14 +6,16 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"gopkg.in/resty.v1"
 	"gopkg.in/yaml.v2"
 
 	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
@@ -29,11 +31,11 @@ const (
 )
 
 type TestParams struct {
-	QueryParams  map[string]interface{} `yaml:"queryParams,omitempty"`
-	FormParams   map[string]interface{} `yaml:"formParams,omitempty"`
-	PathParams   map[string]interface{} `yaml:"pathParams,omitempty"`
-	HeaderParams map[string]interface{} `yaml:"headerParams,omitempty"`
-	BodyParams   interface{}            `yaml:"bodyParams,omitempty"`
+	QueryParams  map[string]interface{} `yaml:"queryParams,omitempty" json:"queryParams,omitempty"`
+	FormParams   map[string]interface{} `yaml:"formParams,omitempty" json:"formParams,omitempty"`
+	PathParams   map[string]interface{} `yaml:"pathParams,omitempty" json:"pathParams,omitempty"`
+	HeaderParams map[string]interface{} `yaml:"headerParams,omitempty" json:"headerParams,omitempty"`
+	BodyParams   interface{}            `yaml:"bodyParams,omitempty" json:"bodyParams,omitempty"`
 }
 
 // Copy the parameters from src. If there is a conflict dst will be overwritten.
@@ -80,14 +82,18 @@ type TestSuite struct {
 	// test suite parameters
 	TestParams `yaml:",inline,omitempty" json:",inline,omitempty"`
 	Strict     bool
+	Parallel   bool // The suite doesn't depend on the others, so it can run at the same time, see RunSuites.
 
 	// Authentication
 	Username string
 	Password string
 	ApiToken string
+	ApiKey   string
 
-	plan *TestPlan
-	db   *mqswag.DB // objects generated/obtained as part of this suite
+	plan     *TestPlan
+	db       *mqswag.DB     // objects generated/obtained as part of this suite
+	cookies  http.CookieJar // The cookies the servers set during the suite, sent with its later requests.
+	buffered bool           // Hold the output of each test until it's done, while the suite runs in parallel.
 
 	comment string
 }
@@ -98,12 +104,19 @@ func CreateTestSuite(name string, tests []*Test, plan *TestPlan) *TestSuite {
 	c.Tests = tests
 	(&c.TestParams).Copy(&plan.TestParams)
 	c.Strict = plan.Strict
+	for _, t := range tests {
+		if t.Name == MeqaInit && t.Parallel {
+			c.Parallel = true
+		}
+	}
 
 	c.Username = plan.Username
 	c.Password = plan.Password
 	c.ApiToken = plan.ApiToken
+	c.ApiKey = plan.ApiKey
 
 	c.plan = plan
+	c.cookies, _ = cookiejar.New(nil)
 	return &c
 }
 
@@ -118,23 +131,111 @@ type TestPlan struct {
 	TestParams `yaml:",inline,omitempty" json:",inline,omitempty"`
 	Strict     bool
 	BaseURL    string
+	Tenant     string                 // Fills the tenant path parameters and the {tenant} placeholder in the base URL.
+	Vars       map[string]interface{} // The plan variables, referred to as ${vars.name}.
+	Client     Client                 // The HTTP client used to send requests, resty by default. Set to a MockClient to run offline.
+	Timeout    time.Duration          // How long a request waits for the response, no limit when zero.
+	Retry      *RetryPolicy           // How the requests that get a retry status are tried again, only by the tests with retries when nil.
 
 	// Authentication
 	Username string
 	Password string
 	ApiToken string
+	ApiKey   string // Sent as the operations' apiKey security schemes declare, in a header, the query or a cookie.
+	OAuth    *OAuth // Gets the api token with the OAuth2 client credentials grant when it's set.
 
 	// Run result.
+	mutex        sync.Mutex // Guards the results while the suites run in parallel.
 	resultList   []*Test
+	results      []*TestResult
 	ResultCounts map[string]int
 
 	OldFailuresMap map[string]map[string]map[string]map[mqutil.FuzzValue]bool // endpoint->method->field->(value,fuzzType)->bool
 	NewFailures    []*mqswag.Payload
 	OtherFailures  []*mqswag.Payload // Failures where fuzzType != currFuzzType
 
-	comment  string
-	FuzzType string
-	Repro    bool
+	comment     string
+	FuzzType    string
+	Repro       bool
+	UseDefaults bool // Use the schema defaults instead of generating the values.
+	Quiet       bool // Only print the output of the failed tests.
+	NoValidate  bool // Only check the response status codes, don't validate the bodies against the schemas.
+	NoExamples  bool // Generate the values even when the spec has examples of them.
+
+	// DefaultsProb is the probability of using a schema default instead of generating the value, so that
+	// the values are still generated now and then. UseDefaults always uses the defaults.
+	DefaultsProb float64
+
+	// MaxRedirects is the most redirects a request follows, DefaultMaxRedirects when nil. The tests get
+	// the 3xx response once there were as many.
+	MaxRedirects *int
+
+	// OptionalProb is the probability of generating an optional property of an object, from the minimal
+	// objects at 0 to the full ones at 1. All of them are generated when it's nil.
+	OptionalProb *float64
+
+	Artifacts *mqutil.ArtifactDir // Where the run's artifacts are written. Nil when they go to their own paths.
+	JUnit     *JUnitReport        // Collects the outcomes of the tests for the JUnit XML report when it's set.
+
+	// KeepObjects keeps the objects the suites leave in their DBs for the later suites, see Soak. Otherwise
+	// each suite starts from the plan's DB as it was.
+	KeepObjects bool
+
+	// SaveDB collects the changes the suites make to the objects of the plan's DB, e.g. to save what the run
+	// created. The suites still start from the plan's DB as it was.
+	SaveDB *mqswag.DB
+
+	// A failed test is recorded and the run goes on to the next one. FailFast stops the run at the first
+	// failed test instead, and AbortOnError at the first internal error, see Stopped. The tests that
+	// don't run then are counted as skipped.
+	FailFast     bool
+	AbortOnError bool
+	stopErr      error
+}
+
+// useDefault decides whether a schema default is used instead of generating the value.
+func (plan *TestPlan) useDefault() bool {
+	return plan.UseDefaults || (plan.DefaultsProb > 0 && mqutil.Rand.Float64() < plan.DefaultsProb)
+}
+
+// includeOptional decides whether an optional property is generated.
+func (plan *TestPlan) includeOptional() bool {
+	return plan.OptionalProb == nil || mqutil.Rand.Float64() < *plan.OptionalProb
+}
+
+// TenantParams are the names of the path parameters that take the run's tenant.
+var TenantParams = []string{"tenant", "tenantId"}
+
+// GetTenantParam returns the tenant for a path parameter that names the tenant.
+func (plan *TestPlan) GetTenantParam(name string) (string, bool) {
+	if len(plan.Tenant) == 0 {
+		return "", false
+	}
+	for _, p := range TenantParams {
+		if p == name {
+			return plan.Tenant, true
+		}
+	}
+	return "", false
+}
+
+// GetBaseURL returns the base URL with the tenant placeholders filled in.
+func (plan *TestPlan) GetBaseURL() string {
+	baseURL := plan.BaseURL
+	if len(plan.Tenant) > 0 {
+		for _, p := range TenantParams {
+			baseURL = strings.Replace(baseURL, "{"+p+"}", url.PathEscape(plan.Tenant), -1)
+		}
+	}
+	return baseURL
+}
+
+// GetClient returns the HTTP client the plan's requests are sent through.
+func (plan *TestPlan) GetClient() Client {
+	if plan.Client == nil {
+		plan.Client, _ = NewClient(ClientResty, nil, nil)
+	}
+	return plan.Client
 }
 
 // Add a new TestSuite, returns whether the Case is successfully added.
@@ -150,6 +251,25 @@ func (plan *TestPlan) Add(testSuite *TestSuite) error {
 }
 
 func (plan *TestPlan) AddFromString(data string) error {
+	// The vars section isn't a test suite, take it out first.
+	var chunk map[string]interface{}
+	if yaml.Unmarshal([]byte(data), &chunk) == nil && chunk[MeqaVars] != nil {
+		raw, err := mqutil.YamlObjToJsonObj(chunk[MeqaVars])
+		if err != nil {
+			return err
+		}
+		rawMap, ok := raw.(map[string]interface{})
+		if !ok {
+			return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the %s section must be a map", MeqaVars))
+		}
+		if err = plan.AddVars(rawMap); err != nil {
+			return err
+		}
+		delete(chunk, MeqaVars)
+		b, _ := yaml.Marshal(chunk)
+		data = string(b)
+	}
+
 	var suiteMap map[string]([]*Test)
 	err := yaml.Unmarshal([]byte(data), &suiteMap)
 	if err != nil {
@@ -177,6 +297,7 @@ func (plan *TestPlan) AddFromString(data string) error {
 			return err
 		}
 	}
+	plan.ApplyVars()
 	return nil
 }
 
@@ -392,6 +513,12 @@ func (plan *TestPlan) PrintSummary() {
 	fmt.Print(mqutil.YELLOW)
 	fmt.Printf("%v: %v\n", mqutil.Skipped, plan.ResultCounts[mqutil.Skipped])
 	fmt.Printf("%v: %v\n", mqutil.SchemaMismatch, plan.ResultCounts[mqutil.SchemaMismatch])
+	if plan.ResultCounts[mqutil.Filtered] > 0 {
+		fmt.Printf("%v: %v\n", mqutil.Filtered, plan.ResultCounts[mqutil.Filtered])
+	}
+	if err := plan.Stopped(); err != nil {
+		fmt.Printf("Stopped: %v\n", mqutil.ErrorMessage(err))
+	}
 	fmt.Print(mqutil.AQUA)
 	fmt.Printf("%v: %v\n", mqutil.Total, plan.ResultCounts[mqutil.Total])
 	fmt.Print(mqutil.RED)
@@ -399,6 +526,28 @@ func (plan *TestPlan) PrintSummary() {
 	fmt.Print(mqutil.AQUA)
 	fmt.Printf("%v: %v\n", mqutil.FuzzTotal, plan.ResultCounts[mqutil.FuzzTotal])
 	fmt.Print(mqutil.END)
+	plan.printMutationCounts()
+}
+
+// printMutationCounts prints how many objects of each class the run created, updated and deleted.
+func (plan *TestPlan) printMutationCounts() {
+	if plan.db == nil {
+		return
+	}
+	counts := plan.db.MutationCounts()
+	if len(counts) == 0 {
+		return
+	}
+	var names []string
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println("Objects (created/updated/deleted):")
+	for _, name := range names {
+		c := counts[name]
+		fmt.Printf("  %v: %d/%d/%d\n", name, c.Created, c.Updated, c.Deleted)
+	}
 }
 
 func (plan *TestPlan) Init(swagger *mqswag.Swagger, db *mqswag.DB) {
@@ -407,6 +556,9 @@ func (plan *TestPlan) Init(swagger *mqswag.Swagger, db *mqswag.DB) {
 	plan.SuiteMap = make(map[string]*TestSuite)
 	plan.SuiteList = nil
 	plan.resultList = nil
+	plan.results = nil
+	plan.stopErr = nil
+	mqswag.Ids.Reset()
 }
 
 // Run a named TestSuite in the test plan.
@@ -418,19 +570,38 @@ func (plan *TestPlan) Run(name string, parentTest *Test) (map[string]int, error)
 		mqutil.Logger.Println(str)
 		return resultCounts, errors.New(str)
 	}
-	tc.db = plan.db.CloneSchema()
+	// Each suite starts with the objects of the plan's DB, such as the fixtures.
+	tc.db = plan.db.Clone()
 	defer func() {
+		plan.db.AddMutationCounts(tc.db)
+		if plan.SaveDB != nil {
+			plan.SaveDB.MergeObjects(plan.db, tc.db)
+		}
+		if plan.KeepObjects {
+			plan.db.CopyObjects(tc.db)
+		}
 		tc.db = nil
 	}()
 	resultCounts[mqutil.Total] = len(tc.Tests)
 	resultCounts[mqutil.Failed] = 0
 	var tcErr error
 	for i, test := range tc.Tests {
+		if plan.Stopped() != nil {
+			plan.skipTests(tc, tc.Tests[i:], resultCounts)
+			break
+		}
 		if len(test.Ref) != 0 {
 			test.Strict = tc.Strict
-			resultCounts, err := plan.Run(test.Ref, test)
+			// The referred suite's failures are the suite's, but they don't keep it from going on.
+			refCounts, err := plan.Run(test.Ref, test)
+			for k, v := range refCounts {
+				resultCounts[k] += v
+			}
 			if err != nil {
-				return resultCounts, err
+				plan.stopOnFailure(test.Ref, err)
+				if tcErr == nil {
+					tcErr = err
+				}
 			}
 			continue
 		}
@@ -447,12 +618,30 @@ func (plan *TestPlan) Run(name string, parentTest *Test) (map[string]int, error)
 		if parentTest != nil {
 			dup.CopyParent(parentTest)
 		}
-		dup.ResolveHistoryParameters(&History)
+		historyErr := dup.ResolveHistoryParameters(&History)
 		History.Append(dup)
 		if parentTest != nil {
 			dup.Name = parentTest.Name // always inherit the name
 		}
-		payloads, err := dup.Run(tc) // Run the test case
+		if plan.Quiet || tc.buffered {
+			dup.out = &outputBuffer{}
+		}
+		var payloads []*mqswag.Payload
+		start := time.Now()
+		err := historyErr
+		if err == nil && plan.OAuth != nil {
+			tc.ApiToken, err = plan.OAuth.Token(plan.GetClient())
+		}
+		if err != nil {
+			// A test whose references can't be resolved, or that can't get a token, fails without being sent.
+			dup.printf("\nRunning test case: %s\n... Fail\n... %s\n", dup.Name, err.Error())
+		} else {
+			payloads, err = dup.Run(tc, plan.GetClient()) // Run the test case
+		}
+		dup.FlushOutput(err != nil || !plan.Quiet)
+		dup.err = err
+		elapsed := time.Since(start)
+		plan.mutex.Lock()
 		// Store new failures with their payloads
 		if payloads != nil && len(payloads) > 0 {
 			if plan.NewFailures == nil {
@@ -460,8 +649,12 @@ func (plan *TestPlan) Run(name string, parentTest *Test) (map[string]int, error)
 			}
 			plan.NewFailures = append(plan.NewFailures, payloads...)
 		}
-		dup.err = err
 		plan.resultList = append(plan.resultList, dup)
+		plan.results = append(plan.results, newTestResult(tc.Name, dup, elapsed))
+		if plan.JUnit != nil {
+			plan.JUnit.Add(tc.Name, dup, elapsed)
+		}
+		plan.mutex.Unlock()
 		if dup.schemaError != nil {
 			resultCounts[mqutil.SchemaMismatch]++
 		}
@@ -471,13 +664,15 @@ func (plan *TestPlan) Run(name string, parentTest *Test) (map[string]int, error)
 			if tcErr == nil {
 				tcErr = err
 			}
+			plan.stopOnFailure(dup.Name, err)
 		} else {
 			resultCounts[mqutil.Passed]++
 		}
-		// If creation (POST) of an object fails, subsequent GET, PUT, DELETE tests will fail too, so just skip them
-		if dup.Method == mqswag.MethodPost && len(dup.PathParams) == 0 && dup.resp.RawResponse.StatusCode >= 300 {
-			fmt.Printf("Skipping %v tests...\n", len(tc.Tests)-i-1)
-			resultCounts[mqutil.Skipped] += len(tc.Tests) - i - 1
+		// If creation (POST) of an object fails, subsequent GET, PUT, DELETE tests will fail too, so just skip them.
+		// A POST that expects to fail, such as a negative test, didn't fail to create anything.
+		if dup.Method == mqswag.MethodPost && len(dup.PathParams) == 0 && (dup.resp == nil || dup.resp.StatusCode() >= 300) &&
+			!dup.failureExpected {
+			plan.skipTests(tc, tc.Tests[i+1:], resultCounts)
 			break
 		}
 	}
@@ -510,9 +705,11 @@ func (h *TestHistory) Append(t *Test) {
 	h.tests = append(h.tests, t)
 }
 
-var History TestHistory
-
-func init() {
-	rand.Seed(int64(time.Now().Second()))
-	resty.SetRedirectPolicy(resty.FlexibleRedirectPolicy(15))
+// Reset forgets all the tests.
+func (h *TestHistory) Reset() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.tests = nil
 }
+
+var History TestHistory
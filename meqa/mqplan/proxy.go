@@ -0,0 +1,34 @@
+package mqplan
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// ParseProxy parses the url of the proxy the requests go through. The http, https and socks5 proxies are
+// supported, and a url without a scheme, e.g. proxy.corp:3128, is an http proxy. An empty url returns nil,
+// the clients then use the proxy the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables give.
+func ParseProxy(proxy string) (*url.URL, error) {
+	if len(proxy) == 0 {
+		return nil, nil
+	}
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid proxy %s - %s", proxy, err.Error()))
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the proxy %s must be http, https or socks5", proxy))
+	}
+	if len(u.Hostname()) == 0 {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the proxy %s has no host", proxy))
+	}
+	return u, nil
+}
@@ -0,0 +1,129 @@
+package mqplan
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// socks5Proxy is a fake SOCKS5 proxy without authentication that counts the connections it relays.
+func socks5Proxy(t *testing.T, relayed *int32) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 256)
+				// The greeting with the authentication methods, we take none.
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+					return
+				}
+				conn.Write([]byte{5, 0})
+				// The connect request, with an ipv4 address, a domain name or an ipv6 address.
+				if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+					return
+				}
+				var host string
+				switch buf[3] {
+				case 1, 4:
+					ip := make([]byte, map[byte]int{1: 4, 4: 16}[buf[3]])
+					if _, err := io.ReadFull(conn, ip); err != nil {
+						return
+					}
+					host = net.IP(ip).String()
+				case 3:
+					if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+						return
+					}
+					name := make([]byte, buf[0])
+					if _, err := io.ReadFull(conn, name); err != nil {
+						return
+					}
+					host = string(name)
+				}
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(buf[:2])))))
+				if err != nil {
+					conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer target.Close()
+				atomic.AddInt32(relayed, 1)
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				go io.Copy(target, conn)
+				io.Copy(conn, target)
+			}()
+		}
+	}()
+	return listener
+}
+
+func TestProxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("server"))
+	}))
+	defer server.Close()
+	var proxied []string
+	httpProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A proxy gets the whole url of the request.
+		proxied = append(proxied, r.URL.String())
+		w.Write([]byte("proxy"))
+	}))
+	defer httpProxy.Close()
+	var relayed int32
+	socksProxy := socks5Proxy(t, &relayed)
+	defer socksProxy.Close()
+
+	for _, name := range []string{ClientResty, ClientHTTP} {
+		proxied = nil
+		proxy, err := ParseProxy(httpProxy.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, _ := NewClient(name, nil, proxy)
+		resp, err := client.Do(&Request{Method: "GET", URL: server.URL + "/pets", Header: http.Header{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(resp.Body()) != "proxy" || len(proxied) != 1 || proxied[0] != server.URL+"/pets" {
+			t.Errorf("%s: expecting the request to go through the http proxy, got %s %v", name, resp.Body(), proxied)
+		}
+
+		atomic.StoreInt32(&relayed, 0)
+		proxy, err = ParseProxy("socks5://" + socksProxy.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, _ = NewClient(name, nil, proxy)
+		resp, err = client.Do(&Request{Method: "GET", URL: server.URL, Header: http.Header{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(resp.Body()) != "server" || atomic.LoadInt32(&relayed) != 1 {
+			t.Errorf("%s: expecting the request to be relayed by the socks5 proxy, got %s after %d connections", name, resp.Body(), relayed)
+		}
+	}
+
+	for _, proxy := range []string{"ftp://proxy.corp:21", "http://", "http://proxy corp"} {
+		if _, err := ParseProxy(proxy); err == nil {
+			t.Errorf("%s: expecting an error", proxy)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package mqplan
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// The redirect policies, besides max-N that follows N redirects at most.
+const (
+	RedirectFollow = "follow"
+	RedirectNone   = "none"
+)
+
+// DefaultMaxRedirects is how many redirects the follow policy follows.
+const DefaultMaxRedirects = 15
+
+// ParseRedirects parses a redirect policy, follow, none or max-N, into the most redirects to follow.
+func ParseRedirects(policy string) (int, error) {
+	switch p := strings.ToLower(strings.TrimSpace(policy)); {
+	case p == RedirectFollow || p == "":
+		return DefaultMaxRedirects, nil
+	case p == RedirectNone:
+		return 0, nil
+	case strings.HasPrefix(p, "max-"):
+		if n, err := strconv.Atoi(p[len("max-"):]); err == nil && n >= 0 {
+			return n, nil
+		}
+	}
+	return 0, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid redirect policy %s, it must be follow, none or max-N", policy))
+}
+
+// maxRedirects returns the most redirects to follow for the test, the test's own policy or else the plan's.
+func (t *Test) maxRedirects() (*int, error) {
+	if len(t.Redirects) == 0 {
+		return t.suite.plan.MaxRedirects, nil
+	}
+	n, err := ParseRedirects(t.Redirects)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+type redirectsKey struct{}
+
+// checkRedirect is the redirect policy of the clients. It stops following the redirects once there were as
+// many as the request allows, and the client then returns the last 3xx response as is.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	max := DefaultMaxRedirects
+	if n, ok := req.Context().Value(redirectsKey{}).(int); ok {
+		max = n
+	}
+	if len(via) > max {
+		return http.ErrUseLastResponse
+	}
+	return nil
+}
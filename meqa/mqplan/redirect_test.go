@@ -0,0 +1,93 @@
+package mqplan
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const redirectSpec = `
+openapi: 3.0.2
+info:
+  title: redirects
+  version: "1.0"
+paths:
+  /a:
+    get:
+      responses:
+        '200':
+          description: ok
+        '302':
+          description: moved
+`
+
+func TestParseRedirects(t *testing.T) {
+	cases := map[string]int{"": DefaultMaxRedirects, "follow": DefaultMaxRedirects, "none": 0, "max-2": 2, "MAX-0": 0}
+	for policy, expected := range cases {
+		if n, err := ParseRedirects(policy); err != nil || n != expected {
+			t.Errorf("%s: expecting %d, got %d %v", policy, expected, n, err)
+		}
+	}
+	for _, policy := range []string{"always", "max-", "max--1", "max-x"} {
+		if _, err := ParseRedirects(policy); err == nil {
+			t.Errorf("%s: expecting an invalid policy", policy)
+		}
+	}
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	// /a redirects to /b, which redirects to /c.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/c", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	none, two := 0, 2
+	cases := []struct {
+		planMax   *int
+		redirects string
+		status    int
+	}{
+		{nil, "", 200},
+		{&none, "", 302},
+		{&none, "follow", 200},
+		{nil, "none", 302},
+		{nil, "max-1", 302},
+		{&two, "", 200},
+	}
+	for _, name := range []string{ClientResty, ClientHTTP} {
+		client, err := NewClient(name, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range cases {
+			suite := newTestSuite(t, redirectSpec, server.URL)
+			suite.plan.Client = client
+			suite.plan.MaxRedirects = c.planMax
+			test := &Test{Name: "get", Path: "/a", Method: "get", Redirects: c.redirects}
+			dup, err := runTest(suite, test)
+			if status := dup.resp.StatusCode(); status != c.status {
+				t.Errorf("%s %+v: expecting status %d, got %d", name, c, c.status, status)
+			}
+			// The 3xx fails the test unless it's expected.
+			if (err != nil) != (c.status != 200) {
+				t.Errorf("%s %+v: unexpected error %v", name, c, err)
+			}
+		}
+	}
+
+	suite := newTestSuite(t, redirectSpec, server.URL)
+	suite.plan.Client, _ = NewClient(ClientHTTP, nil, nil)
+	if _, err := runTest(suite, &Test{Name: "get", Path: "/a", Method: "get", Redirects: "none", ExpectStatus: "302"}); err != nil {
+		t.Errorf("expecting the redirect to pass with expectStatus: %v", err)
+	}
+	suite.plan.Client = &stubClient{status: 200}
+	if _, err := runTest(suite, &Test{Name: "get", Path: "/a", Method: "get", Redirects: "sometimes"}); err == nil {
+		t.Error("expecting an invalid redirect policy to fail the test")
+	}
+}
@@ -0,0 +1,99 @@
+package mqplan
+
+import (
+	"regexp/syntax"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// printableChars are what the negated character classes and the dots pick from.
+const printableChars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~ "
+
+// generateRegex generates a string that matches the pattern. The stars, pluses and open ended repeats
+// repeat at most limit times. The random choices come from mqutil.Rand, so that the strings are the same
+// for the same seed.
+func generateRegex(pattern string, limit int) (string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	writeRegex(&b, re.Simplify(), limit)
+	return b.String(), nil
+}
+
+func writeRegex(b *strings.Builder, re *syntax.Regexp, limit int) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			b.WriteRune(r)
+		}
+	case syntax.OpCharClass:
+		b.WriteRune(pickRune(re.Rune))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteByte(printableChars[mqutil.Rand.Intn(len(printableChars))])
+	case syntax.OpCapture:
+		writeRegex(b, re.Sub[0], limit)
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		min, max := re.Min, re.Max
+		switch re.Op {
+		case syntax.OpStar:
+			min, max = 0, -1
+		case syntax.OpPlus:
+			min, max = 1, -1
+		case syntax.OpQuest:
+			min, max = 0, 1
+		}
+		if max < 0 || max > min+limit {
+			max = min + limit
+		}
+		for count := min + mqutil.Rand.Intn(max-min+1); count > 0; count-- {
+			for _, sub := range re.Sub {
+				writeRegex(b, sub, limit)
+			}
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			writeRegex(b, sub, limit)
+		}
+	case syntax.OpAlternate:
+		writeRegex(b, re.Sub[mqutil.Rand.Intn(len(re.Sub))], limit)
+	}
+	// The anchors, the word boundaries and the empty matches don't add anything.
+}
+
+// pickRune picks one of the runes in the ranges of the character class. A class that reaches the end of
+// unicode, which is what a negated class usually does, is limited to the printable ascii characters.
+func pickRune(ranges []rune) rune {
+	if len(ranges) == 0 {
+		return ' '
+	}
+	if ranges[len(ranges)-1] == '\U0010FFFF' {
+		var candidates []rune
+		for _, c := range printableChars {
+			for i := 0; i < len(ranges); i += 2 {
+				if c >= ranges[i] && c <= ranges[i+1] {
+					candidates = append(candidates, c)
+					break
+				}
+			}
+		}
+		if len(candidates) > 0 {
+			return candidates[mqutil.Rand.Intn(len(candidates))]
+		}
+	}
+	total := 0
+	for i := 0; i < len(ranges); i += 2 {
+		total += int(ranges[i+1]-ranges[i]) + 1
+	}
+	n := mqutil.Rand.Intn(total)
+	for i := 0; i < len(ranges); i += 2 {
+		size := int(ranges[i+1]-ranges[i]) + 1
+		if n < size {
+			return ranges[i] + rune(n)
+		}
+		n -= size
+	}
+	return ranges[0]
+}
@@ -0,0 +1,78 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// TestResult is the outcome of a test the plan ran, for the programs that post-process the results.
+type TestResult struct {
+	Suite    string        `json:"suite"`
+	Name     string        `json:"name"`
+	Method   string        `json:"method"`
+	Path     string        `json:"path"`
+	Params   TestParams    `json:"params"` // The parameters as they were sent.
+	Status   int           `json:"status,omitempty"`
+	Response interface{}   `json:"response,omitempty"` // The json response body, or the body as a string when it's not json.
+	Passed   bool          `json:"passed"`
+	Error    string        `json:"error,omitempty"`
+	Category string        `json:"category,omitempty"` // The category of the failure, schema, http or expect.
+	Elapsed  time.Duration `json:"elapsed"`            // In nanoseconds.
+}
+
+// PlanResult is the outcome of the whole run.
+type PlanResult struct {
+	Passed  bool           `json:"passed"`
+	Counts  map[string]int `json:"counts"`
+	Elapsed time.Duration  `json:"elapsed"` // In nanoseconds, the sum of the tests'.
+	Tests   []*TestResult  `json:"tests"`
+}
+
+// newTestResult creates the result of the test that was run in the suite.
+func newTestResult(suiteName string, t *Test, elapsed time.Duration) *TestResult {
+	r := &TestResult{Suite: suiteName, Name: t.Name, Method: t.Method, Path: t.Path, Params: t.TestParams,
+		Passed: t.err == nil, Elapsed: elapsed}
+	if t.resp != nil {
+		r.Status = t.resp.StatusCode()
+		if body := t.resp.Body(); len(body) > 0 {
+			if err := mqutil.DecodeJson(body, &r.Response); err != nil {
+				r.Response = string(body)
+			}
+		}
+	}
+	if t.err != nil {
+		r.Error = mqutil.ErrorMessage(t.err)
+		r.Category = failureCategory(t)
+	}
+	return r
+}
+
+// Results returns the results of the tests that were run, in the order they were run.
+func (plan *TestPlan) Results() []*TestResult {
+	return plan.results
+}
+
+// Outcome returns the outcome of the run, with the results of all the tests.
+func (plan *TestPlan) Outcome() *PlanResult {
+	outcome := &PlanResult{Passed: true, Counts: plan.ResultCounts, Tests: plan.results}
+	if outcome.Tests == nil {
+		outcome.Tests = []*TestResult{}
+	}
+	for _, r := range plan.results {
+		outcome.Passed = outcome.Passed && r.Passed
+		outcome.Elapsed += r.Elapsed
+	}
+	return outcome
+}
+
+// WriteJsonResult writes the outcome of the run to the path as json.
+func (plan *TestPlan) WriteJsonResult(path string) error {
+	data, err := json.MarshalIndent(plan.Outcome(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,45 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+func TestResults(t *testing.T) {
+	suite := newTestSuite(t, captureSpec, "http://example.com")
+	plan := suite.plan
+	plan.Client = &stubClient{status: 200, body: `{"id": 4242, "name": "rex"}`}
+	if err := plan.AddFromString(capturePlan + junitPlan); err != nil {
+		t.Fatal(err)
+	}
+	plan.ResultCounts, _ = plan.Run("/pets", nil)
+	plan.Client = &stubClient{status: 404}
+	plan.Run("/get", nil)
+
+	results := plan.Results()
+	if len(results) != 3 {
+		t.Fatalf("expecting a result per test, got %d", len(results))
+	}
+	create, get, missing := results[0], results[1], results[2]
+	if create.Suite != "/pets" || create.Name != "create" || create.Method != "post" || create.Path != "/pet" ||
+		create.Status != 200 || !create.Passed || create.Params.BodyParams == nil {
+		t.Errorf("unexpected create result %+v", create)
+	}
+	if get.Params.PathParams["petId"] == nil || get.Response.(map[string]interface{})["id"] != json.Number("4242") {
+		t.Errorf("expecting the get's path param and response, got %+v", get)
+	}
+	if missing.Suite != "/get" || missing.Passed || missing.Status != 404 || missing.Category != FailureExpect ||
+		len(missing.Error) == 0 {
+		t.Errorf("unexpected failed result %+v", missing)
+	}
+
+	outcome := plan.Outcome()
+	if outcome.Passed || len(outcome.Tests) != 3 || outcome.Counts[mqutil.Passed] != 2 {
+		t.Errorf("unexpected outcome %+v", outcome)
+	}
+	if _, err := json.Marshal(outcome); err != nil {
+		t.Errorf("the outcome can't be marshaled: %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package mqplan
+
+import (
+	"strings"
+	"time"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqswag"
+)
+
+// DefaultRetryStatuses are the statuses that are retried by default, the gateway errors of a flaky endpoint.
+const DefaultRetryStatuses = "502,503,504"
+
+// DefaultRetryDelay is the wait before the first retry by default.
+const DefaultRetryDelay = time.Second
+
+// maxRetryShift caps the doubling of the retry delay.
+const maxRetryShift = 10
+
+// RetryPolicy is how a request that gets one of the retry statuses is tried again. The delay before each
+// retry doubles, starting from BaseDelay. The non-idempotent requests, POST and PATCH, are only tried again
+// when RetryPost is set.
+type RetryPolicy struct {
+	Retries   int
+	BaseDelay time.Duration
+	RetryPost bool
+
+	statuses statusSet
+}
+
+// NewRetryPolicy creates the policy that retries the statuses, a comma separated list of status codes, NXX
+// classes and lo-hi ranges.
+func NewRetryPolicy(retries int, baseDelay time.Duration, statuses string, retryPost bool) (*RetryPolicy, error) {
+	set, err := parseStatusSet(statuses)
+	if err != nil {
+		return nil, err
+	}
+	return &RetryPolicy{Retries: retries, BaseDelay: baseDelay, RetryPost: retryPost, statuses: set}, nil
+}
+
+// retryPolicy returns the policy of the test, the plan's with the test's retries when it sets them.
+func (t *Test) retryPolicy() RetryPolicy {
+	policy := RetryPolicy{BaseDelay: DefaultRetryDelay}
+	policy.statuses, _ = parseStatusSet(DefaultRetryStatuses)
+	if t.suite != nil && t.suite.plan != nil && t.suite.plan.Retry != nil {
+		policy = *t.suite.plan.Retry
+	}
+	if t.Retries != nil {
+		policy.Retries = *t.Retries
+	}
+	policy.RetryPost = policy.RetryPost || t.RetryPost
+	return policy
+}
+
+// shouldRetry checks whether a request that got the status is tried again, after it was retried the number
+// of times already.
+func (p RetryPolicy) shouldRetry(method string, status int, retried int) bool {
+	if retried >= p.Retries || !p.statuses.contains(status) {
+		return false
+	}
+	method = strings.ToLower(method)
+	return p.RetryPost || (method != mqswag.MethodPost && method != mqswag.MethodPatch)
+}
+
+// delay returns the wait before the retry, counting from 1.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	shift := retry - 1
+	if shift > maxRetryShift {
+		shift = maxRetryShift
+	}
+	return p.BaseDelay << uint(shift)
+}
@@ -0,0 +1,77 @@
+package mqplan
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const retrySpec = `
+openapi: 3.0.2
+info:
+  title: jobs
+  version: "1.0"
+paths:
+  /jobs:
+    get:
+      responses:
+        '200':
+          description: ok
+    post:
+      responses:
+        '200':
+          description: ok
+`
+
+func TestRetryPolicy(t *testing.T) {
+	two := 2
+	zero := 0
+	for _, c := range []struct {
+		method    string
+		retries   int
+		testRetry *int
+		retryPost bool
+		calls     int
+		passes    bool
+	}{
+		{"get", 2, nil, false, 3, true},
+		{"get", 1, nil, false, 2, false},
+		{"get", 2, &zero, false, 1, false},
+		{"get", 0, &two, false, 3, true},
+		// A POST isn't tried again unless the test allows it.
+		{"post", 2, nil, false, 1, false},
+		{"post", 2, nil, true, 3, true},
+	} {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		suite := newTestSuite(t, retrySpec, server.URL)
+		suite.plan.Client, _ = NewClient(ClientHTTP, nil, nil)
+		var err error
+		suite.plan.Retry, err = NewRetryPolicy(c.retries, time.Millisecond, "502-504", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = runTest(suite, &Test{Name: "jobs", Path: "/jobs", Method: c.method, Retries: c.testRetry, RetryPost: c.retryPost})
+		server.Close()
+		if calls != c.calls || (err == nil) != c.passes {
+			t.Errorf("%+v: got %d calls and %v", c, calls, err)
+		}
+	}
+
+	policy, err := NewRetryPolicy(3, time.Second, "5xx", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.delay(1) != time.Second || policy.delay(3) != 4*time.Second {
+		t.Errorf("expecting the delay to double, got %v and %v", policy.delay(1), policy.delay(3))
+	}
+	if _, err := NewRetryPolicy(3, time.Second, "5xx,abc", false); err == nil {
+		t.Errorf("expecting an error for the invalid status")
+	}
+}
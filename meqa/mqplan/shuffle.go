@@ -0,0 +1,222 @@
+package mqplan
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqswag"
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+
+	spec "github.com/getkin/kin-openapi/openapi3"
+)
+
+// isReadOnlyMethod checks whether the method leaves the server state alone.
+func isReadOnlyMethod(method string) bool {
+	return method == mqswag.MethodGet || method == mqswag.MethodHead || method == mqswag.MethodOptions
+}
+
+// basePath returns the path up to the first path parameter, e.g. /pets for /pets/{id}/photos.
+func basePath(path string) string {
+	if idx := strings.Index(path, "{"); idx >= 0 {
+		path = path[:idx]
+	}
+	return strings.TrimSuffix(path, "/")
+}
+
+// templateRegexp matches the start of a {{name.section.param}} template, up to its end.
+var templateRegexp = regexp.MustCompile(`\{\{\s*([^}]*)`)
+
+// references returns the names of the tests the test's parameters use with {{name.section.param}}
+// templates. They're found once, as the filters and the shuffle look them up for many pairs of tests.
+func (t *Test) references() map[string]bool {
+	if t.refs != nil {
+		return t.refs
+	}
+	t.refs = make(map[string]bool)
+	params, err := yaml.Marshal(&t.TestParams)
+	if err != nil {
+		mqutil.Logger.Printf("can't find the templates of test %s: %s", t.Name, err.Error())
+		return t.refs
+	}
+	for _, m := range templateRegexp.FindAllSubmatch(params, -1) {
+		// A name can have dots too, so any part before a dot may be the name.
+		for i, c := range m[1] {
+			if c == '.' {
+				t.refs[string(m[1][:i])] = true
+			}
+		}
+	}
+	return t.refs
+}
+
+// refersTo checks whether the test's parameters use a {{name.section.param}} template on the named test.
+func (t *Test) refersTo(name string) bool {
+	return t.references()[name]
+}
+
+// refersToAny checks whether the test's parameters use a template on any of the named tests.
+func (t *Test) refersToAny(names map[string]bool) bool {
+	for name := range t.references() {
+		if names[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// classes returns the classes of the objects the test's operation works on, the ones the spec's DAG
+// orders the operations by: the classes the meqa tags of the operation and its parameters name, and the
+// ones its request body refers to, with the classes their fields are tagged with, e.g. the Owner of a
+// Pet's "<meqa Owner.id>". They're found once, like the references.
+func (t *Test) classes(swagger *mqswag.Swagger) map[string]bool {
+	if t.classSet != nil {
+		return t.classSet
+	}
+	t.classSet = make(map[string]bool)
+	if swagger == nil || swagger.Paths[t.Path] == nil {
+		return t.classSet
+	}
+	pathItem := swagger.Paths[t.Path]
+	op := GetOperationByMethod(pathItem, t.Method)
+	if op == nil {
+		return t.classSet
+	}
+	collected := make(map[string]interface{})
+	dep := &mqswag.Dependencies{Produces: collected, Consumes: collected}
+	if tag := mqswag.GetMeqaTag(op.Description); tag != nil && len(tag.Class) > 0 {
+		collected[tag.Class] = 1
+	}
+	err := mqswag.CollectParamDependencies(append(append(spec.Parameters{}, op.Parameters...), pathItem.Parameters...),
+		swagger, nil, dep)
+	if _, mediaType := (&Test{op: op}).requestMediaType(); err == nil && mediaType != nil && mediaType.Schema != nil {
+		dep.Default = collected
+		err = mqswag.CollectSchemaDependencies((mqswag.SchemaRef)(*mediaType.Schema), swagger, nil, dep)
+	}
+	var names []string
+	for name := range collected {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if schema := swagger.FindSchemaByName(name); err == nil && schema.Value != nil {
+			dep.Default = collected
+			err = mqswag.CollectSchemaDependencies(schema, swagger, nil, dep)
+		}
+	}
+	if err != nil {
+		mqutil.Logger.Printf("can't find the classes of test %s: %s", t.Name, err.Error())
+	}
+	for name := range collected {
+		t.classSet[name] = true
+	}
+	return t.classSet
+}
+
+// sharesClass checks whether the tests work on objects of the same class.
+func (t *Test) sharesClass(other *Test, swagger *mqswag.Swagger) bool {
+	otherClasses := other.classes(swagger)
+	for name := range t.classes(swagger) {
+		if otherClasses[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// mustFollow checks whether the test, which comes after the previous test in the plan, has to keep
+// running after it. Besides the declared template references, tests on the same resource, or on objects
+// of the same class such as a pet and the owner it needs, must stay in order unless they both just read
+// them. The init and ref tests keep their place.
+func (t *Test) mustFollow(previous *Test, swagger *mqswag.Swagger) bool {
+	if t.Name == MeqaInit || previous.Name == MeqaInit || len(t.Ref) > 0 || len(previous.Ref) > 0 {
+		return true
+	}
+	if t.refersTo(previous.Name) {
+		return true
+	}
+	if isReadOnlyMethod(t.Method) && isReadOnlyMethod(previous.Method) {
+		return false
+	}
+	return basePath(t.Path) == basePath(previous.Path) || t.sharesClass(previous, swagger)
+}
+
+// mustFollow checks whether the suite, which comes after the previous suite in the plan, has to keep
+// running after it.
+func (tc *TestSuite) mustFollow(previous *TestSuite, swagger *mqswag.Swagger) bool {
+	for _, t := range tc.Tests {
+		if t.Ref == previous.Name {
+			return true
+		}
+		for _, p := range previous.Tests {
+			// The init tests only affect their own suite.
+			if t.Name != MeqaInit && p.Name != MeqaInit && t.mustFollow(p, swagger) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// shuffleOrder returns a random order of n items where every item still comes after the earlier items
+// it must follow.
+func shuffleOrder(n int, mustFollow func(later int, earlier int) bool, r *rand.Rand) []int {
+	deps := make([][]int, n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < i; j++ {
+			if mustFollow(i, j) {
+				deps[i] = append(deps[i], j)
+			}
+		}
+	}
+	done := make([]bool, n)
+	order := make([]int, 0, n)
+	for len(order) < n {
+		var ready []int
+		for i := 0; i < n; i++ {
+			if done[i] {
+				continue
+			}
+			isReady := true
+			for _, j := range deps[i] {
+				if !done[j] {
+					isReady = false
+					break
+				}
+			}
+			if isReady {
+				ready = append(ready, i)
+			}
+		}
+		next := ready[r.Intn(len(ready))]
+		done[next] = true
+		order = append(order, next)
+	}
+	return order
+}
+
+// Shuffle randomizes the order of the suites and of the tests within each suite, keeping the orderings
+// the tests depend on. The same seed always gives the same order.
+func (plan *TestPlan) Shuffle(seed int64) {
+	r := rand.New(rand.NewSource(seed))
+	suites := plan.SuiteList
+	order := shuffleOrder(len(suites), func(later int, earlier int) bool {
+		return suites[later].mustFollow(suites[earlier], plan.swagger)
+	}, r)
+	plan.SuiteList = make([]*TestSuite, 0, len(suites))
+	for _, i := range order {
+		plan.SuiteList = append(plan.SuiteList, suites[i])
+	}
+
+	for _, suite := range plan.SuiteList {
+		tests := suite.Tests
+		order := shuffleOrder(len(tests), func(later int, earlier int) bool {
+			return tests[later].mustFollow(tests[earlier], plan.swagger)
+		}, r)
+		suite.Tests = make([]*Test, 0, len(tests))
+		for _, i := range order {
+			suite.Tests = append(suite.Tests, tests[i])
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package mqplan
+
+import (
+	"strings"
+	"testing"
+)
+
+const shufflePlan = `
+/pets:
+- name: meqa_init
+  pathParams:
+    owner: joe
+- name: create_pet
+  path: /pets
+  method: post
+- name: list_pets
+  path: /pets
+  method: get
+- name: get_pet
+  path: /pets/{id}
+  method: get
+  pathParams:
+    id: '{{create_pet.outputs.id}}'
+- name: delete_pet
+  path: /pets/{id}
+  method: delete
+---
+/reads:
+- name: get_store
+  path: /store
+  method: get
+- name: get_users
+  path: /users
+  method: get
+- name: get_orders
+  path: /orders
+  method: get
+- name: get_user_pet
+  path: /users/pet
+  method: get
+  queryParams:
+    id: '{{ create_pet.outputs.id }}'
+`
+
+func TestShuffleKeepsDependencies(t *testing.T) {
+	orders := make(map[string]bool)
+	for seed := int64(0); seed < 50; seed++ {
+		suite := newTestSuite(t, userSpec, "")
+		plan := suite.plan
+		for _, chunk := range strings.Split(shufflePlan, "---") {
+			if err := plan.AddFromString(chunk); err != nil {
+				t.Fatal(err)
+			}
+		}
+		plan.Shuffle(seed)
+
+		position := make(map[string]int)
+		var names []string
+		for _, s := range plan.SuiteList {
+			for _, test := range s.Tests {
+				position[test.Name] = len(names)
+				names = append(names, test.Name)
+			}
+		}
+		orders[strings.Join(names, ",")] = true
+
+		before := [][2]string{
+			{"meqa_init", "create_pet"},
+			{"create_pet", "list_pets"},
+			{"create_pet", "get_pet"},
+			{"list_pets", "delete_pet"},
+			{"get_pet", "delete_pet"},
+			{"create_pet", "get_user_pet"},
+		}
+		for _, b := range before {
+			if position[b[0]] > position[b[1]] {
+				t.Errorf("seed %d: %s ran after %s: %v", seed, b[0], b[1], names)
+			}
+		}
+	}
+	if len(orders) < 2 {
+		t.Errorf("the independent tests were never shuffled")
+	}
+}
+
+const ownersSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths:
+  /owners:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Owner'
+      responses:
+        '200':
+          description: created
+  /pets:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+      responses:
+        '200':
+          description: created
+  /store:
+    get:
+      responses:
+        '200':
+          description: the store
+components:
+  schemas:
+    Owner:
+      type: object
+      properties:
+        id:
+          type: integer
+    Pet:
+      type: object
+      properties:
+        id:
+          type: integer
+        ownerId:
+          type: integer
+          description: <meqa Owner.id>
+`
+
+const ownersPlan = `
+/owners:
+- name: create_owner
+  path: /owners
+  method: post
+---
+/store:
+- name: get_store
+  path: /store
+  method: get
+---
+/pets:
+- name: create_first_owner
+  path: /owners
+  method: post
+- name: get_pets_store
+  path: /store
+  method: get
+- name: create_pet
+  path: /pets
+  method: post
+`
+
+func TestShuffleKeepsClassDependencies(t *testing.T) {
+	orders := make(map[string]bool)
+	for seed := int64(0); seed < 100; seed++ {
+		suite := newTestSuite(t, ownersSpec, "")
+		plan := suite.plan
+		for _, chunk := range strings.Split(ownersPlan, "---") {
+			if err := plan.AddFromString(chunk); err != nil {
+				t.Fatal(err)
+			}
+		}
+		plan.Shuffle(seed)
+
+		position := make(map[string]int)
+		var names []string
+		for _, s := range plan.SuiteList {
+			for _, test := range s.Tests {
+				position[test.Name] = len(names)
+				names = append(names, test.Name)
+			}
+		}
+		orders[strings.Join(names, ",")] = true
+
+		// The pet needs an owner, in its own suite and in the other one, though the paths differ.
+		if position["create_owner"] > position["create_pet"] || position["create_first_owner"] > position["create_pet"] {
+			t.Errorf("seed %d: an owner was created after the pet: %v", seed, names)
+		}
+	}
+	if len(orders) < 2 {
+		t.Errorf("the independent tests were never shuffled")
+	}
+}
+
+func TestReferences(t *testing.T) {
+	test := &Test{Name: "get"}
+	test.PathParams = map[string]interface{}{"id": "{{create pet.outputs.id}}"}
+	test.QueryParams = map[string]interface{}{"q": "pets/{{ v1.list.outputs.0.name }}/tags"}
+	for name, expected := range map[string]bool{"create pet": true, "v1": true, "v1.list": true, "create": false, "list": false} {
+		if test.refersTo(name) != expected {
+			t.Errorf("expecting the reference to %s to be %v", name, expected)
+		}
+	}
+	if !test.refersToAny(map[string]bool{"other": true, "v1.list": true}) || test.refersToAny(map[string]bool{"other": true}) {
+		t.Errorf("unexpected references %v", test.references())
+	}
+}
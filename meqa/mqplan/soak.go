@@ -0,0 +1,95 @@
+package mqplan
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// SoakBudget is how long a soak runs the plan for. The soak stops when either the duration or the
+// iterations run out, the ones that are zero don't limit it.
+type SoakBudget struct {
+	Duration   time.Duration
+	Iterations int
+	Seed       int64 // Iteration i generates its values with Seed + i.
+	KeepDB     bool  // Keep the objects and the test history of an iteration for the next, instead of starting over.
+}
+
+// SoakReport aggregates the results of the soak's iterations.
+type SoakReport struct {
+	Iterations       int
+	FailedIterations int
+	Counts           map[string]int // The result counts of all the iterations.
+	Elapsed          time.Duration
+
+	FirstFailure     int   // The first iteration that had a failure, 0 when there were none.
+	FirstFailureSeed int64 // The seed of the first failed iteration, to reproduce it.
+}
+
+// Soak runs the suites over and over until the budget runs out, or the plan stops the run. Each iteration
+// runs all of the suites, and starts from the plan's DB and an empty test history unless the budget keeps them.
+func (plan *TestPlan) Soak(suites []string, budget SoakBudget) *SoakReport {
+	report := &SoakReport{Counts: make(map[string]int)}
+	if budget.Duration <= 0 && budget.Iterations <= 0 {
+		mqutil.Logger.Println("the soak has no budget, running the plan once")
+		budget.Iterations = 1
+	}
+	initial := plan.db.Clone()
+	keep := plan.KeepObjects
+	plan.KeepObjects = keep || budget.KeepDB
+	defer func() { plan.KeepObjects = keep }()
+	start := time.Now()
+	for i := 1; budget.Iterations <= 0 || i <= budget.Iterations; i++ {
+		if budget.Duration > 0 && time.Since(start) >= budget.Duration || plan.Stopped() != nil {
+			break
+		}
+		if !budget.KeepDB {
+			plan.db.CopyObjects(initial)
+			History.Reset()
+		}
+		seed := budget.Seed + int64(i)
+		mqutil.Seed(seed)
+		fmt.Printf("\n===\nSoak iteration %d, seed %d\n", i, seed)
+		mqutil.Logger.Printf("soak iteration %d, seed %d", i, seed)
+		failed := 0
+		for _, name := range suites {
+			fmt.Printf("\n---\nTest suite: %s\n", name)
+			counts, err := plan.Run(name, nil)
+			if err != nil {
+				mqutil.Logger.Printf("err:\n%v", err)
+			}
+			for k, v := range counts {
+				report.Counts[k] += v
+			}
+			failed += counts[mqutil.Failed]
+		}
+		report.Iterations = i
+		if failed > 0 {
+			report.FailedIterations++
+			if report.FirstFailure == 0 {
+				report.FirstFailure = i
+				report.FirstFailureSeed = seed
+			}
+		}
+	}
+	report.Elapsed = time.Since(start)
+	return report
+}
+
+// Print prints the failure rates of the soak.
+func (report *SoakReport) Print() {
+	rate := func(n int, total int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(n) * 100 / float64(total)
+	}
+	fmt.Printf("Soak: %d iterations in %v\n", report.Iterations, report.Elapsed.Round(time.Millisecond))
+	fmt.Printf("Failed iterations: %d (%.1f%%)\n", report.FailedIterations, rate(report.FailedIterations, report.Iterations))
+	fmt.Printf("Failed tests: %d of %d (%.1f%%)\n", report.Counts[mqutil.Failed], report.Counts[mqutil.Total],
+		rate(report.Counts[mqutil.Failed], report.Counts[mqutil.Total]))
+	if report.FirstFailure > 0 {
+		fmt.Printf("First failure in iteration %d, seed %d\n", report.FirstFailure, report.FirstFailureSeed)
+	}
+}
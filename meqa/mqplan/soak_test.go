@@ -0,0 +1,60 @@
+package mqplan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+const soakPlan = `
+/open:
+- name: first
+  path: /open
+  method: get
+- name: second
+  path: /open
+  method: get
+`
+
+func TestSoak(t *testing.T) {
+	for _, c := range []struct {
+		budget     SoakBudget
+		status     int
+		iterations int // The expected iterations, 0 for any number.
+	}{
+		{SoakBudget{Iterations: 3, Seed: 100}, 200, 3},
+		{SoakBudget{Iterations: 2, Seed: 100}, 500, 2},
+		{SoakBudget{Iterations: 2, Seed: 100, KeepDB: true}, 200, 2},
+		{SoakBudget{Duration: 20 * time.Millisecond}, 200, 0},
+		{SoakBudget{}, 200, 1},
+	} {
+		suite := newTestSuite(t, securedSpec, "http://example.com")
+		plan := suite.plan
+		plan.Quiet = true
+		plan.Client = &stubClient{status: c.status}
+		if err := plan.AddFromString(soakPlan); err != nil {
+			t.Fatal(err)
+		}
+		History.Append(&Test{Name: "earlier"})
+		report := plan.Soak([]string{"/open"}, c.budget)
+
+		if report.Iterations == 0 || (c.iterations > 0 && report.Iterations != c.iterations) {
+			t.Errorf("%+v: expecting %d iterations, got %d", c.budget, c.iterations, report.Iterations)
+		}
+		if report.Counts[mqutil.Total] != 2*report.Iterations {
+			t.Errorf("%+v: expecting the counts of all the iterations, got %v", c.budget, report.Counts)
+		}
+		if c.status != 200 {
+			if report.FailedIterations != report.Iterations || report.FirstFailure != 1 || report.FirstFailureSeed != 101 {
+				t.Errorf("unexpected failures %+v", report)
+			}
+		} else if report.FailedIterations != 0 || report.FirstFailure != 0 {
+			t.Errorf("%+v: unexpected failures %+v", c.budget, report)
+		}
+		// Each iteration starts with an empty history unless the budget keeps it.
+		if kept := History.GetTest("earlier") != nil; kept != c.budget.KeepDB {
+			t.Errorf("%+v: expecting the history to be kept to be %v", c.budget, c.budget.KeepDB)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// ExpectStatusExtension is the operation extension that overrides the statuses the operation's tests expect
+// to get, e.g. x-meqa-expect-status: 202.
+const ExpectStatusExtension = "x-meqa-expect-status"
+
+// statusRange is an inclusive range of status codes.
+type statusRange struct {
+	lo int
+	hi int
+}
+
+// statusSet is a list of status codes and ranges, such as "200,202", "2xx" or "200-204".
+type statusSet []statusRange
+
+// parseStatusSet parses a comma separated list of status codes, NXX classes and lo-hi ranges.
+func parseStatusSet(list string) (statusSet, error) {
+	invalid := func(s string) error {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid expected status %q in %q", s, list))
+	}
+	var set statusSet
+	for _, s := range strings.Split(list, ",") {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if len(s) == 0 {
+			continue
+		}
+		var r statusRange
+		var err error
+		if len(s) == 3 && strings.HasSuffix(s, "xx") {
+			if r.lo, err = strconv.Atoi(s[:1]); err != nil {
+				return nil, invalid(s)
+			}
+			r.lo *= 100
+			r.hi = r.lo + 99
+		} else if i := strings.IndexByte(s, '-'); i > 0 {
+			r.lo, err = strconv.Atoi(strings.TrimSpace(s[:i]))
+			if err == nil {
+				r.hi, err = strconv.Atoi(strings.TrimSpace(s[i+1:]))
+			}
+			if err != nil || r.lo > r.hi {
+				return nil, invalid(s)
+			}
+		} else {
+			if r.lo, err = strconv.Atoi(s); err != nil {
+				return nil, invalid(s)
+			}
+			r.hi = r.lo
+		}
+		if r.lo < 100 || r.hi > 599 {
+			return nil, invalid(s)
+		}
+		set = append(set, r)
+	}
+	if len(set) == 0 {
+		return nil, invalid(list)
+	}
+	return set, nil
+}
+
+func (set statusSet) contains(status int) bool {
+	for _, r := range set {
+		if status >= r.lo && status <= r.hi {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedStatus returns the status the test expects to get: its expect status, or else its expectStatus, or
+// else the operation's x-meqa-expect-status, or else success, the default 2xx.
+func (t *Test) expectedStatus() (interface{}, error) {
+	if t.Expect != nil && t.Expect[ExpectStatus] != nil {
+		return t.Expect[ExpectStatus], nil
+	}
+	if len(t.ExpectStatus) > 0 {
+		return t.ExpectStatus, nil
+	}
+	opStatus, err := t.operationExpectStatus()
+	if err != nil || len(opStatus) == 0 {
+		return StatusSuccess, err
+	}
+	return opStatus, nil
+}
+
+// expectsFailure tells whether an expected status, as expectedStatus returns it, is a status other than 2xx,
+// such as the 4xx of a negative test.
+func expectsFailure(expected interface{}) bool {
+	switch status := expected.(type) {
+	case int:
+		return status < 200 || status >= 300
+	case string:
+		if status == "fail" {
+			return true
+		}
+		set, err := parseStatusSet(status)
+		if err != nil {
+			return false
+		}
+		for _, r := range set {
+			if r.lo < 300 && r.hi >= 200 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// operationExpectStatus returns the statuses the operation's x-meqa-expect-status declares, as a list for
+// parseStatusSet. Returns "" when it's not set.
+func (t *Test) operationExpectStatus() (string, error) {
+	if t.op == nil || t.op.Extensions[ExpectStatusExtension] == nil {
+		return "", nil
+	}
+	raw, ok := t.op.Extensions[ExpectStatusExtension].(json.RawMessage)
+	if !ok {
+		return fmt.Sprint(t.op.Extensions[ExpectStatusExtension]), nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid %s: %s", ExpectStatusExtension, string(raw)))
+	}
+	// The extension can be a code, a string or a list of them.
+	if list, ok := value.([]interface{}); ok {
+		var codes []string
+		for _, v := range list {
+			codes = append(codes, fmt.Sprint(v))
+		}
+		return strings.Join(codes, ","), nil
+	}
+	return fmt.Sprint(value), nil
+}
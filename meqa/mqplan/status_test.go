@@ -0,0 +1,112 @@
+package mqplan
+
+import "testing"
+
+const acceptedSpec = `
+openapi: 3.0.2
+info:
+  title: jobs
+  version: "1.0"
+paths:
+  /jobs:
+    post:
+      x-meqa-expect-status: 202
+      responses:
+        '202':
+          description: accepted
+  /tasks:
+    post:
+      responses:
+        '201':
+          description: created
+`
+
+func TestExpectStatusOverride(t *testing.T) {
+	for status, pass := range map[int]bool{202: true, 200: false} {
+		suite := newTestSuite(t, acceptedSpec, "http://example.com")
+		suite.plan.Client = &stubClient{status: status}
+		if _, err := runTest(suite, &Test{Name: "start", Path: "/jobs", Method: "post"}); (err == nil) != pass {
+			t.Errorf("status %d: expecting pass to be %v, got %v", status, pass, err)
+		}
+	}
+
+	// The test's expect status takes precedence over the operation's.
+	for status, pass := range map[int]bool{200: true, 204: true, 202: false, 302: true, 404: false} {
+		suite := newTestSuite(t, acceptedSpec, "http://example.com")
+		suite.plan.Client = &stubClient{status: status}
+		test := &Test{Name: "start", Path: "/jobs", Method: "post"}
+		test.Expect = map[string]interface{}{ExpectStatus: "200, 203-204, 3xx"}
+		if _, err := runTest(suite, test); (err == nil) != pass {
+			t.Errorf("status %d: expecting pass to be %v, got %v", status, pass, err)
+		}
+	}
+
+	// So does the test's expectStatus, and the expect status wins over it.
+	for status, pass := range map[int]bool{200: true, 204: true, 202: false, 302: true, 404: false} {
+		suite := newTestSuite(t, acceptedSpec, "http://example.com")
+		suite.plan.Client = &stubClient{status: status}
+		test := &Test{Name: "start", Path: "/jobs", Method: "post", ExpectStatus: "200, 203-204, 3xx"}
+		if _, err := runTest(suite, test); (err == nil) != pass {
+			t.Errorf("status %d: expecting pass to be %v, got %v", status, pass, err)
+		}
+		test = &Test{Name: "start", Path: "/jobs", Method: "post", ExpectStatus: "202"}
+		test.Expect = map[string]interface{}{ExpectStatus: "200, 203-204, 3xx"}
+		if _, err := runTest(suite, test); (err == nil) != pass {
+			t.Errorf("status %d: expecting the expect status to win, got %v", status, err)
+		}
+	}
+
+	// So does success, the default 2xx.
+	suite := newTestSuite(t, acceptedSpec, "http://example.com")
+	suite.plan.Client = &stubClient{status: 200}
+	test := &Test{Name: "start", Path: "/jobs", Method: "post"}
+	test.Expect = map[string]interface{}{ExpectStatus: StatusSuccess}
+	if _, err := runTest(suite, test); err != nil {
+		t.Errorf("expecting success to pass on 200: %v", err)
+	}
+}
+
+func TestExpectStatusInPlan(t *testing.T) {
+	cases := []struct {
+		expect string
+		status int
+		pass   bool
+	}{
+		{"", 201, true},
+		{"", 404, false},
+		{"", 500, false},
+		{"expect:\n    status: 201", 201, true},
+		{"expect:\n    status: 201", 200, false},
+		{"expect:\n    status: '4xx'", 404, true},
+		{"expect:\n    status: '4xx'", 201, false},
+		{"expect:\n    status: fail", 404, true},
+	}
+	for _, c := range cases {
+		suite := newTestSuite(t, acceptedSpec, "http://example.com")
+		plan := suite.plan
+		plan.Client = &stubClient{status: c.status}
+		if err := plan.AddFromString("/tasks:\n- name: create\n  path: /tasks\n  method: post\n  " + c.expect + "\n"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := plan.Run("/tasks", nil); (err == nil) != c.pass {
+			t.Errorf("%q, status %d: expecting pass to be %v, got %v", c.expect, c.status, c.pass, err)
+		}
+	}
+}
+
+func TestParseStatusSet(t *testing.T) {
+	for _, list := range []string{"", "abc", "2x", "204-200", "700", "0xx"} {
+		if _, err := parseStatusSet(list); err == nil {
+			t.Errorf("%q: expecting an error", list)
+		}
+	}
+	set, err := parseStatusSet("201,4XX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for status, in := range map[int]bool{201: true, 200: false, 400: true, 499: true, 500: false} {
+		if set.contains(status) != in {
+			t.Errorf("%d: expecting contains to be %v", status, in)
+		}
+	}
+}
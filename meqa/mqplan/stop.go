@@ -0,0 +1,45 @@
+package mqplan
+
+import (
+	"fmt"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// isInternalError checks whether the test failed because of meqa or the plan, e.g. a body it can't
+// encode, rather than because of the server's response.
+func isInternalError(err error) bool {
+	e, ok := err.(mqutil.Error)
+	return !ok || e.Type() == mqutil.ErrInvalid || e.Type() == mqutil.ErrInternal
+}
+
+// stopOnFailure stops the run after the test's failure when the plan says so: after any failure with
+// FailFast, after an internal error with AbortOnError. Otherwise the run goes on to the next test.
+func (plan *TestPlan) stopOnFailure(name string, err error) {
+	if !plan.FailFast && !(plan.AbortOnError && isInternalError(err)) {
+		return
+	}
+	plan.mutex.Lock()
+	defer plan.mutex.Unlock()
+	if plan.stopErr == nil {
+		plan.stopErr = mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("the run was stopped after %s failed: %s",
+			name, mqutil.ErrorMessage(err)))
+		fmt.Printf("Stopping the run after %s failed\n", name)
+	}
+}
+
+// Stopped returns the reason the run was stopped before all the tests ran, nil when it wasn't.
+func (plan *TestPlan) Stopped() error {
+	plan.mutex.Lock()
+	defer plan.mutex.Unlock()
+	return plan.stopErr
+}
+
+// skipTests counts the tests that won't run as skipped.
+func (plan *TestPlan) skipTests(tc *TestSuite, tests []*Test, resultCounts map[string]int) {
+	fmt.Printf("Skipping %v tests...\n", len(tests))
+	resultCounts[mqutil.Skipped] += len(tests)
+	if plan.JUnit != nil {
+		plan.JUnit.Skip(tc.Name, tests)
+	}
+}
@@ -0,0 +1,70 @@
+package mqplan
+
+import (
+	"testing"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+var stopPlan = []string{`
+/a:
+- name: a pass
+  path: /open
+  method: get
+- name: a fail
+  path: /open
+  method: get
+  expect:
+    status: 404
+- name: a after
+  path: /open
+  method: get
+`, `
+/b:
+- name: b ref
+  ref: /a
+  expect:
+    status: 404
+- name: b broken
+  path: /open
+  method: get
+  expect:
+    status: nonsense
+- name: b after
+  path: /open
+  method: get
+`}
+
+func TestStopRun(t *testing.T) {
+	for _, c := range []struct {
+		failFast, abortOnError  bool
+		passed, failed, skipped int
+		stopped                 bool
+	}{
+		// The failures, those of the referred suite included, don't keep the others from running.
+		{false, false, 3, 5, 0, false},
+		{true, false, 1, 1, 4, true},
+		// Only the plan's own error stops the run, not the unexpected status.
+		{false, true, 2, 5, 1, true},
+	} {
+		suite := newTestSuite(t, securedSpec, "http://example.com")
+		plan := suite.plan
+		plan.Quiet = true
+		plan.Client = &stubClient{status: 200}
+		plan.FailFast = c.failFast
+		plan.AbortOnError = c.abortOnError
+		for _, s := range stopPlan {
+			if err := plan.AddFromString(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		counts := plan.RunSuites([]string{"/a", "/b"}, 1)
+		if counts[mqutil.Passed] != c.passed || counts[mqutil.Failed] != c.failed || counts[mqutil.Skipped] != c.skipped {
+			t.Errorf("fail fast %v, abort on error %v: expecting %d passed, %d failed and %d skipped, got %v",
+				c.failFast, c.abortOnError, c.passed, c.failed, c.skipped, counts)
+		}
+		if stopped := plan.Stopped() != nil; stopped != c.stopped {
+			t.Errorf("fail fast %v, abort on error %v: expecting the run to be stopped to be %v", c.failFast, c.abortOnError, c.stopped)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package mqplan
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// The categories of the failed tests for the exit thresholds. Each failed test is in one of them.
+const (
+	FailureSchema = "schema" // The response doesn't match the schema.
+	FailureHttp   = "http"   // The request didn't get a response, e.g. the connection failed.
+	FailureExpect = "expect" // Any other failure, such as an unexpected status.
+)
+
+// FailureCategories lists the categories of the failed tests.
+var FailureCategories = []string{FailureSchema, FailureHttp, FailureExpect}
+
+// ExitFailed is the exit code of a run whose failures exceed the thresholds.
+const ExitFailed = 3
+
+// ParseThresholds parses the number of failures each category tolerates, e.g. "http=3,expect=1". The
+// categories that aren't listed tolerate none.
+func ParseThresholds(list string) (map[string]int, error) {
+	thresholds := make(map[string]int)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		category := strings.ToLower(strings.TrimSpace(kv[0]))
+		known := false
+		for _, c := range FailureCategories {
+			known = known || c == category
+		}
+		if !known {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("unknown failure category %q, expecting one of %s",
+				kv[0], strings.Join(FailureCategories, ", ")))
+		}
+		var n int
+		var err error
+		if len(kv) == 2 {
+			n, err = strconv.Atoi(strings.TrimSpace(kv[1]))
+		}
+		if len(kv) != 2 || err != nil || n < 0 {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid failure threshold %q, expecting category=count", entry))
+		}
+		thresholds[category] = n
+	}
+	return thresholds, nil
+}
+
+// failureCategory returns the category of a failed test.
+func failureCategory(t *Test) string {
+	if t.schemaError != nil {
+		return FailureSchema
+	}
+	if e, ok := t.err.(mqutil.Error); ok && e.Type() == mqutil.ErrHttp {
+		return FailureHttp
+	}
+	return FailureExpect
+}
+
+// FailureCounts counts the failed tests of the run by their category.
+func (plan *TestPlan) FailureCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, t := range plan.resultList {
+		if t.err != nil {
+			counts[failureCategory(t)]++
+		}
+	}
+	return counts
+}
+
+// ExitCode returns ExitFailed if the failures of any category exceed its threshold, 0 otherwise. The
+// categories over their thresholds are printed.
+func (plan *TestPlan) ExitCode(thresholds map[string]int) int {
+	counts := plan.FailureCounts()
+	var over []string
+	for category, count := range counts {
+		if count > thresholds[category] {
+			over = append(over, fmt.Sprintf("%s: %d failures, %d allowed", category, count, thresholds[category]))
+		}
+	}
+	if len(over) == 0 {
+		return 0
+	}
+	sort.Strings(over)
+	fmt.Printf("Failures over the thresholds:\n  %s\n", strings.Join(over, "\n  "))
+	return ExitFailed
+}
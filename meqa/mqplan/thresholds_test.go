@@ -0,0 +1,41 @@
+package mqplan
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+func TestExitCodeThresholds(t *testing.T) {
+	httpFailure := &Test{err: mqutil.NewError(mqutil.ErrHttp, "connection refused")}
+	schemaFailure := &Test{err: mqutil.NewError(mqutil.ErrExpect, "response doesn't match"), schemaError: errors.New("mismatch")}
+	statusFailure := &Test{err: mqutil.NewError(mqutil.ErrExpect, "response code 500")}
+	passed := &Test{}
+
+	thresholds, err := ParseThresholds("http=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		results []*Test
+		code    int
+	}{
+		{[]*Test{passed, httpFailure, httpFailure}, 0},
+		{[]*Test{passed, httpFailure, httpFailure, httpFailure}, ExitFailed},
+		{[]*Test{passed, httpFailure, schemaFailure}, ExitFailed},
+		{[]*Test{passed, statusFailure}, ExitFailed},
+		{[]*Test{passed}, 0},
+	} {
+		plan := &TestPlan{resultList: c.results}
+		if code := plan.ExitCode(thresholds); code != c.code {
+			t.Errorf("%v: expecting exit code %d, got %d", plan.FailureCounts(), c.code, code)
+		}
+	}
+
+	for _, list := range []string{"infra=1", "http", "http=-1", "http=many"} {
+		if _, err := ParseThresholds(list); err == nil {
+			t.Errorf("%q: expecting an error", list)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package mqplan
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// NewTLSConfig returns the TLS config of the clients. The server certificates are verified against the
+// system's CAs and the ones in caFile, a PEM bundle, e.g. for the internal servers with self-signed
+// certificates. With insecure they aren't verified at all.
+func NewTLSConfig(insecure bool, caFile string) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	if insecure {
+		mqutil.Logger.Print("warning: the server certificates aren't verified, the connections can be intercepted")
+	}
+	if len(caFile) > 0 {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("can't read the CA file %s - %s", caFile, err.Error()))
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the CA file %s has no PEM certificates", caFile))
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
@@ -0,0 +1,65 @@
+package mqplan
+
+import (
+	"bytes"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+func TestTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var log bytes.Buffer
+	mqutil.Logger = mqutil.NewLogger(&log)
+
+	for _, c := range []struct {
+		insecure bool
+		caFile   string
+		ok       bool
+	}{
+		{false, "", false},
+		{false, caFile, true},
+		{true, "", true},
+	} {
+		config, err := NewTLSConfig(c.insecure, c.caFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{ClientResty, ClientHTTP} {
+			client, err := NewClient(name, config, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = client.Do(&Request{Method: "GET", URL: server.URL, Header: http.Header{}})
+			if (err == nil) != c.ok {
+				t.Errorf("%s, insecure %v, CA file %q: expecting success to be %v, got %v", name, c.insecure, c.caFile, c.ok, err)
+			}
+		}
+		if warned := strings.Contains(log.String(), "warning"); warned != c.insecure {
+			t.Errorf("insecure %v: unexpected log %q", c.insecure, log.String())
+		}
+		log.Reset()
+	}
+
+	if _, err := NewTLSConfig(false, filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Errorf("expecting an error for a missing CA file")
+	}
+	if err := ioutil.WriteFile(caFile, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTLSConfig(false, caFile); err == nil {
+		t.Errorf("expecting an error for a CA file without certificates")
+	}
+}
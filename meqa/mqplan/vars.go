@@ -0,0 +1,176 @@
+package mqplan
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// MeqaVars is the top level section of the test plan that defines the plan variables, e.g.
+//
+//	vars:
+//	  prefix: run-${random(a, b, c)}
+//	  name: ${vars.prefix}-pet
+//	  expires: ${now()+24h}
+//
+// The variables are referred to as ${vars.name} in the test parameters.
+const MeqaVars = "vars"
+
+var exprRegexp = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// varsResolver evaluates the raw variable definitions, resolving references between them.
+type varsResolver struct {
+	raw      map[string]interface{}
+	resolved map[string]interface{}
+	visiting map[string]bool
+}
+
+func (r *varsResolver) resolve(name string) (interface{}, error) {
+	if v, ok := r.resolved[name]; ok {
+		return v, nil
+	}
+	raw, ok := r.raw[name]
+	if !ok {
+		return nil, mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("variable not defined: %s", name))
+	}
+	if r.visiting[name] {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("variable refers to itself: %s", name))
+	}
+	r.visiting[name] = true
+	defer delete(r.visiting, name)
+
+	str, ok := raw.(string)
+	if !ok {
+		r.resolved[name] = raw
+		return raw, nil
+	}
+	// A value that is a single expression keeps the expression's type.
+	if m := exprRegexp.FindStringSubmatch(str); m != nil && m[0] == str {
+		v, err := r.eval(m[1])
+		if err != nil {
+			return nil, err
+		}
+		r.resolved[name] = v
+		return v, nil
+	}
+	var err error
+	result := exprRegexp.ReplaceAllStringFunc(str, func(expr string) string {
+		v, e := r.eval(expr[2 : len(expr)-1])
+		if e != nil {
+			err = e
+			return expr
+		}
+		return fmt.Sprint(v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.resolved[name] = result
+	return result, nil
+}
+
+// eval evaluates one expression: vars.name, now() with an optional +/- duration, or random(a, b, ...).
+func (r *varsResolver) eval(expr string) (interface{}, error) {
+	expr = strings.TrimSpace(expr)
+	switch {
+	case strings.HasPrefix(expr, MeqaVars+"."):
+		return r.resolve(expr[len(MeqaVars)+1:])
+	case strings.HasPrefix(expr, "now()"):
+		t := time.Now()
+		if offset := strings.Replace(expr[len("now()"):], " ", "", -1); len(offset) > 0 {
+			d, err := time.ParseDuration(strings.TrimPrefix(offset, "+"))
+			if err != nil {
+				return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid duration in %s: %s", expr, err.Error()))
+			}
+			t = t.Add(d)
+		}
+		return t.Format(time.RFC3339), nil
+	case strings.HasPrefix(expr, "random(") && strings.HasSuffix(expr, ")"):
+		choices := strings.Split(expr[len("random("):len(expr)-1], ",")
+		return strings.TrimSpace(choices[mqutil.Rand.Intn(len(choices))]), nil
+	}
+	return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("unknown expression: ${%s}", expr))
+}
+
+// AddVars evaluates the variable definitions and adds them to the plan.
+func (plan *TestPlan) AddVars(raw map[string]interface{}) error {
+	if plan.Vars == nil {
+		plan.Vars = make(map[string]interface{})
+	}
+	r := &varsResolver{raw: raw, resolved: make(map[string]interface{}), visiting: make(map[string]bool)}
+	// Earlier definitions can be referred to.
+	for k, v := range plan.Vars {
+		if _, ok := raw[k]; !ok {
+			r.resolved[k] = v
+		}
+	}
+	for name := range raw {
+		v, err := r.resolve(name)
+		if err != nil {
+			return err
+		}
+		plan.Vars[name] = v
+	}
+	return nil
+}
+
+// substituteVars replaces the ${vars.name} references in the value. A string that is just one reference
+// is replaced by the variable's value, keeping its type.
+func substituteVars(value interface{}, vars map[string]interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		lookup := func(expr string) (interface{}, bool) {
+			name := strings.TrimSpace(expr)
+			if !strings.HasPrefix(name, MeqaVars+".") {
+				return nil, false
+			}
+			result, ok := vars[name[len(MeqaVars)+1:]]
+			return result, ok
+		}
+		if m := exprRegexp.FindStringSubmatch(v); m != nil && m[0] == v {
+			if result, ok := lookup(m[1]); ok {
+				return result
+			}
+			return v
+		}
+		return exprRegexp.ReplaceAllStringFunc(v, func(expr string) string {
+			if result, ok := lookup(expr[2 : len(expr)-1]); ok {
+				return fmt.Sprint(result)
+			}
+			return expr
+		})
+	case map[string]interface{}:
+		for k, entry := range v {
+			v[k] = substituteVars(entry, vars)
+		}
+	case []interface{}:
+		for i, entry := range v {
+			v[i] = substituteVars(entry, vars)
+		}
+	}
+	return value
+}
+
+func (params *TestParams) substituteVars(vars map[string]interface{}) {
+	for _, m := range []map[string]interface{}{params.QueryParams, params.FormParams, params.PathParams, params.HeaderParams} {
+		substituteVars(m, vars)
+	}
+	params.BodyParams = substituteVars(params.BodyParams, vars)
+}
+
+// ApplyVars replaces the variable references in the parameters of the plan, its suites and tests.
+func (plan *TestPlan) ApplyVars() {
+	if len(plan.Vars) == 0 {
+		return
+	}
+	(&plan.TestParams).substituteVars(plan.Vars)
+	for _, suite := range plan.SuiteList {
+		(&suite.TestParams).substituteVars(plan.Vars)
+		for _, t := range suite.Tests {
+			(&t.TestParams).substituteVars(plan.Vars)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+const varsPlan = `
+vars:
+  suffix: ${random(a, b, c)}
+  prefix: run-${vars.suffix}
+  expires: ${now()+24h}
+  count: 3
+---
+create:
+- name: create
+  path: /users
+  method: post
+  bodyParams:
+    name: ${vars.prefix}-joe
+    count: ${vars.count}
+---
+update:
+- name: update
+  path: /users
+  method: post
+  bodyParams:
+    name: ${vars.prefix}-joe
+    expires: ${vars.expires}
+`
+
+func TestPlanVars(t *testing.T) {
+	suite := newTestSuite(t, userSpec, "")
+	plan := suite.plan
+	for _, chunk := range strings.Split(varsPlan, "---") {
+		if err := plan.AddFromString(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	create := plan.SuiteMap["create"].Tests[0].BodyParams.(map[string]interface{})
+	update := plan.SuiteMap["update"].Tests[0].BodyParams.(map[string]interface{})
+	if create["name"] != update["name"] {
+		t.Errorf("the same var resolved to different values: %v, %v", create["name"], update["name"])
+	}
+	if name := create["name"].(string); name != "run-"+plan.Vars["suffix"].(string)+"-joe" {
+		t.Errorf("unexpected name: %s", name)
+	}
+	if create["count"] != json.Number("3") {
+		t.Errorf("a var referenced alone should keep its type: %#v", create["count"])
+	}
+	expires, err := time.Parse(time.RFC3339, update["expires"].(string))
+	if err != nil || expires.Before(time.Now().Add(23*time.Hour)) {
+		t.Errorf("unexpected expiry: %v %v", update["expires"], err)
+	}
+
+	if err := plan.AddFromString("vars:\n  a: ${vars.b}\n  b: ${vars.a}\n"); err == nil {
+		t.Errorf("circular vars should fail")
+	}
+}
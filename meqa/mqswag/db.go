@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"unicode/utf8"
@@ -49,10 +52,48 @@ func (schema SchemaRef) GetProperties(swagger *Swagger) map[string]*spec.SchemaR
 	return nil
 }
 
+// GetRequired returns the names of the first level properties the schema requires, including the ones its
+// allOf schemas require.
+func (schema SchemaRef) GetRequired(swagger *Swagger) []string {
+	_, referredSchema, err := swagger.GetReferredSchema(schema)
+	if err != nil {
+		return nil
+	}
+	if referredSchema.Value != nil {
+		return referredSchema.GetRequired(swagger)
+	}
+	required := append([]string{}, schema.Value.Required...)
+	for _, s := range schema.Value.AllOf {
+		for _, name := range ((SchemaRef)(*s)).GetRequired(swagger) {
+			if !IsRequired(required, name) {
+				required = append(required, name)
+			}
+		}
+	}
+	return required
+}
+
+// MatchOptions say how strictly Parses and Matches match an object to a schema. The zero value is the
+// most lenient.
+type MatchOptions struct {
+	// Strict makes every field of an object conform to its property schema, otherwise a malformed optional
+	// field only counts as a mismatched field. Null is then only accepted where the schema allows it.
+	Strict bool
+
+	// StrictMatch matches the objects exactly. Every field of an object must be declared in the schema, or
+	// allowed by its additionalProperties, and must match its schema. Otherwise a quarter of the fields can
+	// be unaccounted for, since the schemas are frequently incomplete.
+	StrictMatch bool
+
+	// StrictNumbers tells integers and floats apart by how the numbers are written, e.g. 3.0 is not accepted
+	// as an integer and 3 is not accepted as a number.
+	StrictNumbers bool
+}
+
 // Prases the object against this schema. If the obj and schema doesn't match
 // return an error. Otherwise parse all the objects identified by the schema
-// into the map indexed by the object class name.
-func (schema SchemaRef) Parses(name string, object interface{}, collection map[string][]interface{}, followRef bool, swagger *Swagger) error {
+// into the map indexed by the object class name, as strictly as the options say.
+func (schema SchemaRef) Parses(name string, object interface{}, collection map[string][]interface{}, followRef bool, opts MatchOptions, swagger *Swagger) error {
 	raiseError := func(msg string) error {
 		schemaBytes, _ := json.MarshalIndent(schema.Value, "", "    ")
 		objectBytes, _ := json.MarshalIndent(object, "", "    ")
@@ -61,6 +102,10 @@ func (schema SchemaRef) Parses(name string, object interface{}, collection map[s
 			msg, string(schemaBytes), string(objectBytes)))
 	}
 	if object == nil {
+		// The lenient matching accepts null for anything, the strict one only where the schema allows it.
+		if opts.Strict && !schema.IsNullable(swagger) {
+			return raiseError("object is null but the schema isn't nullable")
+		}
 		return nil
 	}
 	refName, referredSchema, err := swagger.GetReferredSchema(schema)
@@ -71,7 +116,12 @@ func (schema SchemaRef) Parses(name string, object interface{}, collection map[s
 		if !followRef {
 			return nil
 		}
-		return referredSchema.Parses(refName, object, collection, followRef, swagger)
+		return referredSchema.Parses(refName, object, collection, followRef, opts, swagger)
+	}
+
+	// A polymorphic object is matched against the subtype its discriminator property names.
+	if subName, sub, ok := schema.discriminatedSchema(object, swagger); ok {
+		return sub.Parses(subName, object, collection, followRef, opts, swagger)
 	}
 
 	if len(schema.Value.AllOf) > 0 {
@@ -95,17 +145,13 @@ func (schema SchemaRef) Parses(name string, object interface{}, collection map[s
 				}
 			}
 			// The name doesn't get passed down. The name is handled at the current level.
-			err = ((SchemaRef)(*s)).Parses("", m, collection, followRef, swagger)
+			err = ((SchemaRef)(*s)).Parses("", m, collection, followRef, opts, swagger)
 			if err != nil {
 				return err
 			}
 		}
-		if count*4 < len(objMap)*3 {
-			// This is a bit fuzzy. Sometimes it's ok for the object to have a few more fields than
-			// the schema. On the other hand, the schema frequently doesn't have the "required" field.
-			// So we allow a bit margin here but the object's fields can't have too many fields that
-			// aren't in the schema.
-			return raiseError("too many mismatched fields")
+		if msg := fieldMismatch(count, len(objMap), opts); len(msg) > 0 {
+			return raiseError(msg)
 		}
 
 		// AllOf is satisfied. We can add the whole object to our collection
@@ -115,6 +161,83 @@ func (schema SchemaRef) Parses(name string, object interface{}, collection map[s
 		return nil
 	}
 
+	if len(schema.Value.AnyOf) > 0 {
+		// AnyOf is satisfied if the object matches at least one of the schemas. An object can also
+		// combine the properties of several schemas, so each schema only checks the fields it knows.
+		matched := false
+		accounted := make(map[string]bool) // the object's properties that are accounted for.
+		objMap, objIsMap := object.(map[string]interface{})
+		for _, s := range schema.Value.AnyOf {
+			var candidate interface{} = object
+			if objIsMap {
+				p := ((SchemaRef)(*s)).GetProperties(swagger)
+				m := make(map[string]interface{})
+				for k := range p {
+					if v, ok := objMap[k]; ok {
+						m[k] = v
+					}
+				}
+				if len(m) == 0 && len(objMap) > 0 {
+					continue
+				}
+				candidate = m
+			}
+			memberCollection := make(map[string][]interface{})
+			if ((SchemaRef)(*s)).Parses("", candidate, memberCollection, followRef, opts, swagger) != nil {
+				continue
+			}
+			matched = true
+			for k, v := range memberCollection {
+				collection[k] = append(collection[k], v...)
+			}
+			if m, ok := candidate.(map[string]interface{}); ok && objIsMap {
+				for k := range m {
+					accounted[k] = true
+				}
+			}
+		}
+		if !matched {
+			return raiseError("object doesn't match any of the anyOf schemas")
+		}
+		if msg := fieldMismatch(len(accounted), len(objMap), opts); objIsMap && len(msg) > 0 {
+			return raiseError(msg)
+		}
+		if len(name) > 0 {
+			collection[name] = append(collection[name], object)
+		}
+		return nil
+	}
+
+	if len(schema.Value.OneOf) > 0 {
+		// OneOf is satisfied if the object matches exactly one of the schemas. The members are always
+		// followed, otherwise any member that's a reference would match.
+		matches := 0
+		var matchedCollection map[string][]interface{}
+		for _, s := range schema.Value.OneOf {
+			memberCollection := make(map[string][]interface{})
+			if ((SchemaRef)(*s)).Parses("", object, memberCollection, true, opts, swagger) != nil {
+				continue
+			}
+			matches++
+			matchedCollection = memberCollection
+		}
+		if matches == 0 {
+			return raiseError("object doesn't match any of the oneOf schemas")
+		}
+		if matches > 1 {
+			return raiseError(fmt.Sprintf("object matches %d of the oneOf schemas instead of one", matches))
+		}
+		if followRef {
+			for k, v := range matchedCollection {
+				collection[k] = append(collection[k], v...)
+			}
+		}
+		if len(name) > 0 {
+			collection[name] = append(collection[name], object)
+		}
+		return nil
+	}
+
 	isProperty := true
 	k := reflect.TypeOf(object).Kind()
 	if k == reflect.Bool {
@@ -133,17 +256,29 @@ func (schema SchemaRef) Parses(name string, object interface{}, collection map[s
 		if !strings.Contains(schema.Value.Type, gojsonschema.TYPE_INTEGER) && !strings.Contains(schema.Value.Type, gojsonschema.TYPE_NUMBER) {
 			return raiseError("schema is not a floating point number")
 		}
+		if f, _ := NumberValue(object); opts.StrictNumbers && schema.Value.Type == gojsonschema.TYPE_INTEGER && f != math.Trunc(f) {
+			return raiseError("schema is an integer but the value has a fraction")
+		}
 		if !Validate(schema, object) {
 			return raiseError("float validation failed")
 		}
 	} else if k == reflect.String {
-		bothAreNumbers := reflect.TypeOf(object).String() == "json.Number" && (strings.Contains(schema.Value.Type, gojsonschema.TYPE_INTEGER) || strings.Contains(schema.Value.Type, gojsonschema.TYPE_NUMBER))
-		if strings.Contains(schema.Value.Type, gojsonschema.TYPE_STRING) {
+		if _, isNumber := object.(json.Number); isNumber {
+			if !strings.Contains(schema.Value.Type, gojsonschema.TYPE_INTEGER) && !strings.Contains(schema.Value.Type, gojsonschema.TYPE_NUMBER) {
+				return raiseError("schema is not a number")
+			}
+			if msg := strictNumberMismatch(schema.Value.Type, object.(json.Number), opts); len(msg) > 0 {
+				return raiseError(msg)
+			}
+			if !Validate(schema, object) {
+				return raiseError("number validation failed")
+			}
+		} else if strings.Contains(schema.Value.Type, gojsonschema.TYPE_STRING) {
 			if !Validate(schema, object) {
 				return raiseError("string validation failed")
 			}
-		} else if !bothAreNumbers {
-			return raiseError("schema is not a number")
+		} else {
+			return raiseError("schema is not a string")
 		}
 	} else if k == reflect.Map {
 		isProperty = false
@@ -152,24 +287,61 @@ func (schema SchemaRef) Parses(name string, object interface{}, collection map[s
 			return raiseError("schema is not an object")
 		}
 		for _, requiredName := range schema.Value.Required {
-			if _, exist := objMap[requiredName]; !exist {
+			v, exist := objMap[requiredName]
+			if !exist {
 				return raiseError(fmt.Sprintf("required field not present: %s", requiredName))
 			}
+			// A null doesn't satisfy a required field unless the field is nullable. Otherwise a required
+			// nested object could be left out, since nothing would be parsed below it.
+			if v == nil && !schema.propertyNullable(requiredName, swagger) {
+				return raiseError(fmt.Sprintf("required field is null: %s", requiredName))
+			}
+		}
+		if n := uint64(len(objMap)); n < schema.Value.MinProps {
+			return raiseError(fmt.Sprintf("object has %d properties, fewer than minProperties %d", n, schema.Value.MinProps))
+		}
+		if max := schema.Value.MaxProps; max != nil && uint64(len(objMap)) > *max {
+			return raiseError(fmt.Sprintf("object has %d properties, more than maxProperties %d", len(objMap), *max))
 		}
 		// Check all the properties of the object and make sure that they can be found on the schema.
 		count := 0
 		for propertyName, objProperty := range objMap {
 			propertySchema, exist := schema.Value.Properties[propertyName]
-			if exist {
+			if !exist {
+				// The fields that aren't declared can still be allowed by additionalProperties.
+				propertySchema = schema.Value.AdditionalProperties
+				if propertySchema == nil || propertySchema.Value == nil {
+					if allowed := schema.Value.AdditionalPropertiesAllowed; allowed != nil && *allowed {
+						count++
+					}
+					continue
+				}
+				if len(propertySchema.Ref) == 0 && propertySchema.Value.IsEmpty() {
+					// An empty schema accepts anything.
+					count++
+					continue
+				}
+			}
+			if opts.Strict || IsRequired(schema.Value.Required, propertyName) {
 				count++
-				err = ((SchemaRef)(*propertySchema)).Parses("", objProperty, collection, followRef, swagger)
+				err = ((SchemaRef)(*propertySchema)).Parses("", objProperty, collection, followRef, opts, swagger)
 				if err != nil {
 					return err
 				}
+				continue
+			}
+			// The objects of a malformed optional field aren't collected.
+			propertyCollection := make(map[string][]interface{})
+			if ((SchemaRef)(*propertySchema)).Parses("", objProperty, propertyCollection, followRef, opts, swagger) != nil {
+				continue
+			}
+			count++
+			for k, v := range propertyCollection {
+				collection[k] = append(collection[k], v...)
 			}
 		}
-		if count*4 < len(objMap)*3 {
-			return raiseError("too many mis-matched fields")
+		if msg := fieldMismatch(count, len(objMap), opts); len(msg) > 0 {
+			return raiseError(msg)
 		}
 
 		// all the properties are OK.
@@ -188,11 +360,21 @@ func (schema SchemaRef) Parses(name string, object interface{}, collection map[s
 		}
 		ar := object.([]interface{})
 		for _, item := range ar {
-			err = itemsSchema.Parses("", item, collection, followRef, swagger)
+			err = itemsSchema.Parses("", item, collection, followRef, opts, swagger)
 			if err != nil {
 				return err
 			}
 		}
+		if schema.Value.UniqueItems {
+			if i, j, found := DuplicateItems(ar); found {
+				return raiseError(fmt.Sprintf("items %d and %d are the same but the items must be unique", i, j))
+			}
+		}
+		if tag := GetMeqaTag(schema.Value.Description); tag != nil && len(tag.UniqueKey) > 0 {
+			if dup, found := DuplicateItemKey(ar, tag.UniqueKey); found {
+				return raiseError(fmt.Sprintf("more than one item has %s %s", tag.UniqueKey, dup))
+			}
+		}
 	} else {
 		return raiseError(fmt.Sprintf("unknown type: %v", k))
 	}
@@ -206,14 +388,280 @@ func (schema SchemaRef) Parses(name string, object interface{}, collection map[s
 	return nil
 }
 
+// IsRequired checks whether the field is one of the required ones.
+func IsRequired(required []string, field string) bool {
+	for _, r := range required {
+		if r == field {
+			return true
+		}
+	}
+	return false
+}
+
+// ItemKey returns the value of the key property of an array item as a string, so that the values can be
+// compared whatever their type. Returns false if the item doesn't have the key.
+func ItemKey(item interface{}, key string) (string, bool) {
+	m, ok := item.(map[string]interface{})
+	if !ok || m[key] == nil {
+		return "", false
+	}
+	return mqutil.InterfaceToJsonString(m[key]), true
+}
+
+// DuplicateItemKey returns the first value of the key property that more than one of the items have.
+func DuplicateItemKey(items []interface{}, key string) (string, bool) {
+	seen := make(map[string]bool)
+	for _, item := range items {
+		if k, ok := ItemKey(item, key); ok {
+			if seen[k] {
+				return k, true
+			}
+			seen[k] = true
+		}
+	}
+	return "", false
+}
+
+// DuplicateItems returns the indexes of the first two items that are equal.
+func DuplicateItems(items []interface{}) (int, int, bool) {
+	for j := range items {
+		for i := 0; i < j; i++ {
+			if mqutil.JsonEquals(items[i], items[j]) {
+				return i, j, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// propertyNullable checks whether the named property of the object schema accepts null.
+func (schema SchemaRef) propertyNullable(name string, swagger *Swagger) bool {
+	propertySchema, exist := schema.Value.Properties[name]
+	if !exist || propertySchema == nil {
+		return true
+	}
+	return ((SchemaRef)(*propertySchema)).IsNullable(swagger)
+}
+
+// NullableExtension is how swagger 2 specs, which don't have nullable, mark the schemas that accept null.
+const NullableExtension = "x-nullable"
+
+// IsNullable checks whether the schema accepts null. That's the case when it's nullable or has x-nullable,
+// or when one of its anyOf or oneOf schemas is nullable.
+func (schema SchemaRef) IsNullable(swagger *Swagger) bool {
+	_, referredSchema, err := swagger.GetReferredSchema(schema)
+	if err == nil && referredSchema.Value != nil {
+		return referredSchema.IsNullable(swagger)
+	}
+	if schema.Value == nil || schema.Value.Nullable {
+		return true
+	}
+	if raw, ok := schema.Value.Extensions[NullableExtension].(json.RawMessage); ok {
+		var nullable bool
+		if json.Unmarshal(raw, &nullable) == nil && nullable {
+			return true
+		}
+	}
+	for _, s := range append(append([]*spec.SchemaRef{}, schema.Value.AnyOf...), schema.Value.OneOf...) {
+		if ((SchemaRef)(*s)).IsNullable(swagger) {
+			return true
+		}
+	}
+	return false
+}
+
+// Coerce converts an object decoded from an untyped format such as XML to the types the schema
+// describes. Strings become numbers or booleans, single elements become arrays, and the elements that the
+// xml objects name get the names of their properties back.
+func (schema SchemaRef) Coerce(object interface{}, swagger *Swagger) interface{} {
+	if object == nil || schema.Value == nil {
+		return object
+	}
+	_, referredSchema, err := swagger.GetReferredSchema(schema)
+	if err != nil {
+		return object
+	}
+	if referredSchema.Value != nil {
+		return referredSchema.Coerce(object, swagger)
+	}
+
+	if strings.Contains(schema.Value.Type, gojsonschema.TYPE_ARRAY) && schema.Value.Items != nil {
+		if m, ok := object.(map[string]interface{}); ok && len(m) == 1 {
+			// A wrapped array, e.g. <tags><tag>a</tag><tag>b</tag></tags>
+			for _, v := range m {
+				object = v
+			}
+		}
+		ar, ok := object.([]interface{})
+		if !ok {
+			ar = []interface{}{object}
+		}
+		itemsSchema := (SchemaRef)(*schema.Value.Items)
+		for i := range ar {
+			ar[i] = itemsSchema.Coerce(ar[i], swagger)
+		}
+		return ar
+	}
+	switch o := object.(type) {
+	case map[string]interface{}:
+		properties := schema.GetProperties(swagger)
+		for k, p := range properties {
+			// The element that holds the property can have another name, see XmlElementName.
+			name := XmlElementName(k, (SchemaRef)(*p))
+			if v, ok := o[name]; ok && name != k {
+				if _, taken := o[k]; !taken {
+					o[k] = v
+					delete(o, name)
+				}
+			}
+		}
+		for k, v := range o {
+			if p := properties[k]; p != nil {
+				o[k] = ((SchemaRef)(*p)).Coerce(v, swagger)
+			}
+		}
+	case string:
+		if strings.Contains(schema.Value.Type, gojsonschema.TYPE_INTEGER) || strings.Contains(schema.Value.Type, gojsonschema.TYPE_NUMBER) {
+			if _, err := json.Number(o).Float64(); err == nil {
+				return json.Number(o)
+			}
+		} else if strings.Contains(schema.Value.Type, gojsonschema.TYPE_BOOLEAN) {
+			if b, err := strconv.ParseBool(o); err == nil {
+				return b
+			}
+		}
+	}
+	return object
+}
+
 // Matches checks if the Schema matches the input interface. In proper swagger.json
 // Enums should have types as well. So we don't check for untyped enums.
-// TODO check format, handle AllOf, AnyOf, OneOf
-func (schema SchemaRef) Matches(object interface{}, swagger *Swagger) bool {
-	err := schema.Parses("", object, make(map[string][]interface{}), true, swagger)
+func (schema SchemaRef) Matches(object interface{}, opts MatchOptions, swagger *Swagger) bool {
+	err := schema.Parses("", object, make(map[string][]interface{}), true, opts, swagger)
 	return err == nil
 }
 
+// AccessViolations walks the object together with the schema and returns the paths of the fields
+// that shouldn't be there. For a response these are the writeOnly fields (e.g. a leaked password),
+// for a request these are the readOnly fields.
+func (schema SchemaRef) AccessViolations(path string, object interface{}, isResponse bool, swagger *Swagger) []string {
+	if object == nil || schema.Value == nil {
+		return nil
+	}
+	_, referredSchema, err := swagger.GetReferredSchema(schema)
+	if err != nil {
+		return nil
+	}
+	if referredSchema.Value != nil {
+		return referredSchema.AccessViolations(path, object, isResponse, swagger)
+	}
+	if len(path) > 0 && ((isResponse && schema.Value.WriteOnly) || (!isResponse && schema.Value.ReadOnly)) {
+		return []string{path}
+	}
+
+	var violations []string
+	for _, s := range schema.Value.AllOf {
+		violations = append(violations, ((SchemaRef)(*s)).AccessViolations(path, object, isResponse, swagger)...)
+	}
+	if objMap, ok := object.(map[string]interface{}); ok {
+		var keys []string
+		for k := range objMap {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			propertySchema, exist := schema.Value.Properties[k]
+			if !exist {
+				continue
+			}
+			propertyPath := k
+			if len(path) > 0 {
+				propertyPath = path + "." + k
+			}
+			violations = append(violations, ((SchemaRef)(*propertySchema)).AccessViolations(propertyPath, objMap[k], isResponse, swagger)...)
+		}
+	} else if ar, ok := object.([]interface{}); ok && schema.Value.Items != nil {
+		for i, item := range ar {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			violations = append(violations, ((SchemaRef)(*schema.Value.Items)).AccessViolations(itemPath, item, isResponse, swagger)...)
+		}
+	}
+	return violations
+}
+
+// EchoMismatches compares the object a request sent with the one the server returned, and returns the paths
+// of the fields that differ. The readOnly and writeOnly fields are managed by the server or never returned,
+// so they are skipped, as are the fields the server added.
+func (schema SchemaRef) EchoMismatches(path string, sent interface{}, got interface{}, swagger *Swagger) []string {
+	if schema.Value != nil {
+		_, referredSchema, err := swagger.GetReferredSchema(schema)
+		if err == nil && referredSchema.Value != nil {
+			return referredSchema.EchoMismatches(path, sent, got, swagger)
+		}
+		if len(path) > 0 && (schema.Value.ReadOnly || schema.Value.WriteOnly) {
+			return nil
+		}
+	}
+	mismatch := []string{path}
+	if len(path) == 0 {
+		mismatch = []string{"."}
+	}
+
+	switch s := sent.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return mismatch
+		}
+		var properties map[string]*spec.SchemaRef
+		if schema.Value != nil {
+			properties = schema.GetProperties(swagger)
+		}
+		var keys []string
+		for k := range s {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var mismatches []string
+		for _, k := range keys {
+			var propertySchema SchemaRef
+			if properties[k] != nil {
+				propertySchema = (SchemaRef)(*properties[k])
+			}
+			propertyPath := k
+			if len(path) > 0 {
+				propertyPath = path + "." + k
+			}
+			mismatches = append(mismatches, propertySchema.EchoMismatches(propertyPath, s[k], g[k], swagger)...)
+		}
+		return mismatches
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(s) {
+			return mismatch
+		}
+		var itemSchema SchemaRef
+		if schema.Value != nil && schema.Value.Items != nil {
+			itemSchema = (SchemaRef)(*schema.Value.Items)
+		}
+		var mismatches []string
+		for i := range s {
+			mismatches = append(mismatches, itemSchema.EchoMismatches(fmt.Sprintf("%s[%d]", path, i), s[i], g[i], swagger)...)
+		}
+		return mismatches
+	}
+	if _, ok := mqutil.NumberRat(sent); ok {
+		if cmp, ok := mqutil.NumberCompare(sent, got); ok && cmp == 0 {
+			return nil
+		}
+		return mismatch
+	}
+	if reflect.DeepEqual(sent, got) || mqutil.TimeCompare(sent, got) {
+		return nil
+	}
+	return mismatch
+}
+
 func (schema SchemaRef) Contains(name string, swagger *Swagger) bool {
 	iterFunc := func(swagger *Swagger, schemaName string, schema SchemaRef, context interface{}) error {
 		// The only way we have to abort is through an error.
@@ -290,25 +738,115 @@ func (schema SchemaRef) Iterate(iterFunc SchemaIterator, context interface{}, sw
 	return nil
 }
 
+// fieldMismatch returns why an object doesn't match when only some of its fields are accounted for by the
+// schema, or "" when it does.
+func fieldMismatch(accounted int, total int, opts MatchOptions) string {
+	if opts.StrictMatch {
+		if accounted < total {
+			return fmt.Sprintf("%d of the %d fields aren't in the schema or don't match it", total-accounted, total)
+		}
+		return ""
+	}
+	// This is a bit fuzzy. Sometimes it's ok for the object to have a few more fields than the schema. On
+	// the other hand, the schema frequently doesn't have the "required" field. So we allow a bit margin
+	// here but the object's fields can't have too many fields that aren't in the schema.
+	if accounted*4 < total*3 {
+		return "too many mismatched fields"
+	}
+	return ""
+}
+
+// strictNumberMismatch returns why the number doesn't fit the schema type in the strict numbers mode, or ""
+// when it does.
+func strictNumberMismatch(schemaType string, n json.Number, opts MatchOptions) string {
+	if !opts.StrictNumbers {
+		return ""
+	}
+	isInt := !strings.ContainsAny(n.String(), ".eE")
+	if schemaType == gojsonschema.TYPE_INTEGER && !isInt {
+		return fmt.Sprintf("schema is an integer but the value %s is not", n)
+	}
+	if schemaType == gojsonschema.TYPE_NUMBER && isInt {
+		return fmt.Sprintf("schema is a floating point number but the value %s is an integer", n)
+	}
+	return ""
+}
+
+// NumberValue converts any of the numeric types we get from unmarshaling or generation to a float64.
+func NumberValue(c interface{}) (float64, bool) {
+	if n, ok := c.(json.Number); ok {
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	v := reflect.ValueOf(c)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
 func Validate(s SchemaRef, c interface{}) bool {
 	if s.Value.Type == gojsonschema.TYPE_STRING {
-		length := uint64(utf8.RuneCountInString(c.(string)))
+		str, ok := c.(string)
+		if !ok {
+			return false
+		}
+		length := uint64(utf8.RuneCountInString(str))
 		if s.Value.MinLength > length || (s.Value.MaxLength != nil && length > *s.Value.MaxLength) {
 			return false
 		}
+		if !ValidFormat(s.Value.Format, str) {
+			return false
+		}
 	} else if s.Value.Type == gojsonschema.TYPE_NUMBER || s.Value.Type == gojsonschema.TYPE_INTEGER {
-		if (s.Value.Min != nil && *s.Value.Min > c.(float64)) || (s.Value.Max != nil && c.(float64) > *s.Value.Max) {
+		// Compared exactly, so that the large integers decoded as json.Number aren't rounded to the bounds.
+		if _, ok := mqutil.NumberRat(c); !ok {
 			return false
 		}
+		if s.Value.Min != nil {
+			if cmp, _ := mqutil.NumberCompare(c, *s.Value.Min); cmp < 0 {
+				return false
+			}
+		}
+		if s.Value.Max != nil {
+			if cmp, _ := mqutil.NumberCompare(c, *s.Value.Max); cmp > 0 {
+				return false
+			}
+		}
 	}
 	if len(s.Value.Pattern) > 0 {
 		if ok, _ := regexp.MatchString(s.Value.Pattern, fmt.Sprint(c)); !ok {
 			return false
 		}
 	}
+	// The value must satisfy both the enum and the pattern when there are both.
+	if len(s.Value.Enum) > 0 {
+		return enumContains(s.Value.Enum, c)
+	}
 	return true
 }
 
+// enumContains checks whether the value is one of the enum values. Numbers are compared by value, since
+// they can be decoded as different types.
+func enumContains(enum []interface{}, c interface{}) bool {
+	_, isNumber := mqutil.NumberRat(c)
+	for _, v := range enum {
+		if isNumber {
+			if cmp, ok := mqutil.NumberCompare(c, v); ok && cmp == 0 {
+				return true
+			}
+		} else if reflect.DeepEqual(v, c) {
+			return true
+		}
+	}
+	return false
+}
+
 type DBEntry struct {
 	Data         map[string]interface{}            // The object itself.
 	Associations map[string]map[string]interface{} // The objects associated with this object. Class to object map.
@@ -323,20 +861,110 @@ func (entry *DBEntry) Matches(criteria interface{}, associations map[string]map[
 	return matches(criteria, entry.Data)
 }
 
+// MutationCounts is how many objects of a class were created, updated and deleted.
+type MutationCounts struct {
+	Created int `yaml:"created"`
+	Updated int `yaml:"updated"`
+	Deleted int `yaml:"deleted"`
+}
+
+// Add adds the other counts to these.
+func (c *MutationCounts) Add(other MutationCounts) {
+	c.Created += other.Created
+	c.Updated += other.Updated
+	c.Deleted += other.Deleted
+}
+
 // SchemaDB is our in-memory DB. It is organized around Schemas. Each schema maintains a list of objects that matches
-// the schema. We don't build indexes and do linear search. This keeps the searching flexible for now.
+// the schema. The lookups by the schema's identifying key go through an index, the others search the list.
 type SchemaDB struct {
 	Name      string
 	Schema    SchemaRef
 	NoHistory bool
-	Objects   []*DBEntry
+	Objects   []*DBEntry     // Changed through the methods, or the index has to be reset with ResetIndex.
+	Counts    MutationCounts // The changes made to the objects, even when NoHistory is set.
+
+	key   string                // The property that identifies the objects, empty when there's none.
+	index map[string][]*DBEntry // The objects by their key, nil until a lookup by the key builds it.
+}
+
+// NewSchemaDB creates the DB of the schema's objects.
+func NewSchemaDB(name string, schema SchemaRef, noHistory bool) *SchemaDB {
+	return &SchemaDB{Name: name, Schema: schema, NoHistory: noHistory, key: identifyingKey(schema)}
+}
+
+// identifyingKey returns the property that identifies the schema's objects. That's the unique=<property> of
+// the schema's meqa tag, or the id property.
+func identifyingKey(schema SchemaRef) string {
+	if schema.Value == nil {
+		return ""
+	}
+	if tag := GetMeqaTag(schema.Value.Description); tag != nil && len(tag.UniqueKey) > 0 {
+		return tag.UniqueKey
+	}
+	if _, ok := schema.Value.Properties[IdField]; ok {
+		return IdField
+	}
+	return ""
+}
+
+// indexKey returns the value as a key of the index. The numbers are keyed by their exact value, since they
+// can be decoded as different types. Returns false for the values that aren't indexed.
+func indexKey(v interface{}) (string, bool) {
+	if r, ok := mqutil.NumberRat(v); ok {
+		return "n" + r.RatString(), true
+	}
+	if s, ok := v.(string); ok {
+		return "s" + s, true
+	}
+	return "", false
+}
+
+// ResetIndex drops the index, to be built again on the next lookup by the key.
+func (db *SchemaDB) ResetIndex() {
+	db.index = nil
+}
+
+func (db *SchemaDB) indexEntry(entry *DBEntry) {
+	if k, ok := indexKey(entry.Data[db.key]); ok {
+		db.index[k] = append(db.index[k], entry)
+	}
+}
+
+// candidates returns the entries that can match the criteria. When the criteria are compared with
+// mqutil.InterfaceEquals and have the key, only the entries with the same key can match, and they're
+// looked up in the index. Otherwise all the entries are candidates.
+func (db *SchemaDB) candidates(criteria interface{}, matches MatchFunc) []*DBEntry {
+	if len(db.key) == 0 || reflect.ValueOf(matches).Pointer() != reflect.ValueOf(mqutil.InterfaceEquals).Pointer() {
+		return db.Objects
+	}
+	criteriaMap, ok := criteria.(map[string]interface{})
+	if !ok {
+		return db.Objects
+	}
+	k, ok := indexKey(criteriaMap[db.key])
+	if !ok {
+		return db.Objects
+	}
+	if db.index == nil {
+		db.index = make(map[string][]*DBEntry)
+		for _, entry := range db.Objects {
+			db.indexEntry(entry)
+		}
+	}
+	return db.index[k]
 }
 
 // Insert inserts an object into the schema's object list.
 func (db *SchemaDB) Insert(obj interface{}, associations map[string]map[string]interface{}) error {
+	db.Counts.Created++
 	if !db.NoHistory {
-		dbentry := &DBEntry{obj.(map[string]interface{}), associations}
+		// Store a copy, so later updates to the entry don't change the caller's object, and vice versa.
+		dbentry := &DBEntry{mqutil.MapCopy(obj.(map[string]interface{})), associations}
 		db.Objects = append(db.Objects, dbentry)
+		if db.index != nil {
+			db.indexEntry(dbentry)
+		}
 	}
 	return nil
 }
@@ -350,13 +978,13 @@ func MatchAlways(criteria interface{}, existing interface{}) bool {
 
 // Clone this one but not the objects.
 func (db *SchemaDB) CloneSchema() *SchemaDB {
-	return &SchemaDB{db.Name, db.Schema, db.NoHistory, nil}
+	return &SchemaDB{Name: db.Name, Schema: db.Schema, NoHistory: db.NoHistory, key: db.key}
 }
 
 // Find finds the specified number of objects that match the input criteria.
 func (db *SchemaDB) Find(criteria interface{}, associations map[string]map[string]interface{}, matches MatchFunc, desiredCount int) []interface{} {
 	var result []interface{}
-	for _, entry := range db.Objects {
+	for _, entry := range db.candidates(criteria, matches) {
 		if entry.Matches(criteria, associations, matches) {
 			result = append(result, entry.Data)
 			if desiredCount >= 0 && len(result) >= desiredCount {
@@ -381,6 +1009,10 @@ func (db *SchemaDB) Delete(criteria interface{}, associations map[string]map[str
 		}
 	}
 	db.Objects = db.Objects[count:]
+	db.Counts.Deleted += count
+	if count > 0 {
+		db.ResetIndex()
+	}
 	return count
 }
 
@@ -389,12 +1021,17 @@ func (db *SchemaDB) Update(criteria interface{}, associations map[string]map[str
 	matches MatchFunc, newObj map[string]interface{}, desiredCount int, patch bool) int {
 
 	count := 0
-	for _, entry := range db.Objects {
+	rekeyed := false
+	for _, entry := range db.candidates(criteria, matches) {
 		if entry.Matches(criteria, associations, matches) {
+			oldKey, _ := indexKey(entry.Data[db.key])
 			if patch {
 				mqutil.MapCombine(entry.Data, newObj)
 			} else {
-				entry.Data = newObj
+				entry.Data = mqutil.MapCopy(newObj)
+			}
+			if newKey, _ := indexKey(entry.Data[db.key]); newKey != oldKey {
+				rekeyed = true
 			}
 			count++
 			if desiredCount >= 0 && count >= desiredCount {
@@ -402,13 +1039,18 @@ func (db *SchemaDB) Update(criteria interface{}, associations map[string]map[str
 			}
 		}
 	}
+	db.Counts.Updated += count
+	if rekeyed {
+		db.ResetIndex()
+	}
 	return count
 }
 
 type DB struct {
 	schemas map[string](*SchemaDB)
 	Swagger *Swagger
-	mutex   sync.Mutex // We don't expect much contention, as such mutex will be fast
+	Options MatchOptions // How strictly the objects are matched to the schemas.
+	mutex   sync.Mutex   // We don't expect much contention, as such mutex will be fast
 }
 
 // TODO it seems that if an object is not being used as a parameter to any operation, we don't
@@ -424,17 +1066,118 @@ func (db *DB) Init(s *Swagger) {
 		}
 		// Note that schema variable is reused in the loop
 		schemaCopy := (SchemaRef)(*schema)
-		db.schemas[schemaName] = &SchemaDB{schemaName, schemaCopy, false, nil}
+		db.schemas[schemaName] = NewSchemaDB(schemaName, schemaCopy, false)
 	}
 }
 
 // Clone the db but not the objects
 func (db *DB) CloneSchema() *DB {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	schemas := make(map[string]*SchemaDB)
+	for k, v := range db.schemas {
+		schemas[k] = v.CloneSchema()
+	}
+	return &DB{schemas: schemas, Swagger: db.Swagger, Options: db.Options}
+}
+
+// Clone the db with copies of the objects, but not the mutation counts.
+func (db *DB) Clone() *DB {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
 	schemas := make(map[string]*SchemaDB)
 	for k, v := range db.schemas {
 		schemas[k] = v.CloneSchema()
+		for _, entry := range v.Objects {
+			schemas[k].Objects = append(schemas[k].Objects, &DBEntry{mqutil.MapCopy(entry.Data), entry.Associations})
+		}
+	}
+	return &DB{schemas: schemas, Swagger: db.Swagger, Options: db.Options}
+}
+
+// CopyObjects replaces the objects of the db's schemas with copies of the other db's, keeping the mutation
+// counts.
+func (db *DB) CopyObjects(other *DB) {
+	clone := other.Clone()
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	for k, v := range db.schemas {
+		if c := clone.schemas[k]; c != nil {
+			v.Objects = c.Objects
+			v.ResetIndex()
+		}
+	}
+}
+
+// MergeObjects makes the changes to the db's objects that another db made to the objects it started with,
+// those of base: the objects it doesn't have anymore are removed, and the ones base didn't have are added.
+// An updated object is both. The objects are told apart by their data.
+func (db *DB) MergeObjects(base *DB, other *DB) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	base.mutex.Lock()
+	defer base.mutex.Unlock()
+	other.mutex.Lock()
+	defer other.mutex.Unlock()
+	key := func(entry *DBEntry) string {
+		return mqutil.InterfaceToJsonString(entry.Data)
+	}
+	for name, schemaDB := range db.schemas {
+		removed := make(map[string]int)
+		if b := base.schemas[name]; b != nil {
+			for _, entry := range b.Objects {
+				removed[key(entry)]++
+			}
+		}
+		var added []*DBEntry
+		if o := other.schemas[name]; o != nil {
+			for _, entry := range o.Objects {
+				if k := key(entry); removed[k] > 0 {
+					removed[k]--
+				} else {
+					added = append(added, entry)
+				}
+			}
+		}
+		var objects []*DBEntry
+		for _, entry := range schemaDB.Objects {
+			if k := key(entry); removed[k] > 0 {
+				removed[k]--
+				continue
+			}
+			objects = append(objects, entry)
+		}
+		for _, entry := range added {
+			objects = append(objects, &DBEntry{mqutil.MapCopy(entry.Data), entry.Associations})
+		}
+		schemaDB.Objects = objects
+		schemaDB.ResetIndex()
+	}
+}
+
+// MutationCounts returns the mutation counts of the classes that had any objects changed.
+func (db *DB) MutationCounts() map[string]MutationCounts {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	counts := make(map[string]MutationCounts)
+	for name, schemaDB := range db.schemas {
+		if schemaDB.Counts != (MutationCounts{}) {
+			counts[name] = schemaDB.Counts
+		}
+	}
+	return counts
+}
+
+// AddMutationCounts adds the mutation counts of a clone of this db to the counts of this one.
+func (db *DB) AddMutationCounts(clone *DB) {
+	counts := clone.MutationCounts()
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	for name, c := range counts {
+		if db.schemas[name] != nil {
+			db.schemas[name].Counts.Add(c)
+		}
 	}
-	return &DB{schemas, db.Swagger, sync.Mutex{}}
 }
 
 func (db *DB) GetSchema(name string) SchemaRef {
@@ -506,7 +1249,7 @@ func (db *DB) Update(name string, criteria interface{}, associations map[string]
 func (db *DB) FindMatchingSchema(obj interface{}) (string, SchemaRef) {
 	for name, schemaDB := range db.schemas {
 		schema := schemaDB.Schema
-		if schema.Matches(obj, db.Swagger) {
+		if schema.Matches(obj, db.Options, db.Swagger) {
 			mqutil.Logger.Printf("found matching schema: %s", name)
 			return name, (SchemaRef)(schema)
 		}
@@ -516,3 +1259,41 @@ func (db *DB) FindMatchingSchema(obj interface{}) (string, SchemaRef) {
 
 // DB holds schema name to Schema mapping.
 var ObjDB DB
+
+// IdField is the property that holds an object's id.
+const IdField = "id"
+
+// IdAllocator hands out monotonically increasing ids per class. The generator and the mock server
+// share the same allocator so that ids are unique and predictable across a run.
+type IdAllocator struct {
+	next  map[string]int64
+	mutex sync.Mutex
+}
+
+// Next allocates a new id for the class. Ids start from 1.
+func (a *IdAllocator) Next(class string) int64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.next == nil {
+		a.next = make(map[string]int64)
+	}
+	a.next[class]++
+	return a.next[class]
+}
+
+// Last returns the last id allocated for the class, 0 if none has been allocated.
+func (a *IdAllocator) Last(class string) int64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.next[class]
+}
+
+// Reset forgets all the allocated ids.
+func (a *IdAllocator) Reset() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.next = nil
+}
+
+// The id allocator shared by the run.
+var Ids IdAllocator
@@ -0,0 +1,490 @@
+package mqswag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+
+	spec "github.com/getkin/kin-openapi/openapi3"
+)
+
+const orderSpec = `
+openapi: 3.0.2
+info:
+  title: orders
+  version: "1.0"
+paths: {}
+components:
+  schemas:
+    Address:
+      type: object
+      required: [street]
+      properties:
+        street:
+          type: string
+    Order:
+      type: object
+      required: [id, shipping]
+      properties:
+        id:
+          type: integer
+        shipping:
+          $ref: '#/components/schemas/Address'
+        billing:
+          $ref: '#/components/schemas/Address'
+    Wrapper:
+      type: object
+      required: [order]
+      properties:
+        order:
+          $ref: '#/components/schemas/Order'
+`
+
+func TestParsesRequiredNestedObject(t *testing.T) {
+	s, err := spec.NewSwaggerLoader().LoadSwaggerFromData([]byte(orderSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	swagger := (*Swagger)(s)
+	wrapper := swagger.FindSchemaByName("Wrapper")
+
+	cases := []struct {
+		order   interface{}
+		matches bool
+	}{
+		{map[string]interface{}{"id": 1, "shipping": map[string]interface{}{"street": "main"}}, true},
+		{map[string]interface{}{"id": 1, "shipping": map[string]interface{}{"street": "main"}, "billing": nil}, true},
+		{map[string]interface{}{"id": 1}, false},
+		{map[string]interface{}{"id": 1, "shipping": nil}, false},
+		{map[string]interface{}{"id": 1, "shipping": map[string]interface{}{}}, false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		obj := map[string]interface{}{"order": c.order}
+		if wrapper.Matches(obj, MatchOptions{}, swagger) != c.matches {
+			t.Errorf("%v: expected match to be %v", obj, c.matches)
+		}
+	}
+}
+
+func TestValidateEnumAndPattern(t *testing.T) {
+	s := spec.NewStringSchema().WithPattern("^a")
+	s.Enum = []interface{}{"apple", "avocado", "banana"}
+	schema := SchemaRef{Value: s}
+	for value, valid := range map[string]bool{"apple": true, "avocado": true, "banana": false, "apricot": false} {
+		if Validate(schema, value) != valid {
+			t.Errorf("%s: expecting valid to be %v", value, valid)
+		}
+	}
+
+	n := spec.NewIntegerSchema()
+	n.Enum = []interface{}{1.0, 2.0}
+	if !Validate(SchemaRef{Value: n}, 2) || Validate(SchemaRef{Value: n}, 3) {
+		t.Errorf("numbers should be compared by value")
+	}
+}
+
+func TestValidateJsonPointer(t *testing.T) {
+	for _, c := range []struct {
+		format string
+		value  string
+		valid  bool
+	}{
+		{FormatJsonPointer, "", true},
+		{FormatJsonPointer, "/foo/0/bar", true},
+		{FormatJsonPointer, "/a~1b/m~0n", true},
+		{FormatJsonPointer, "foo/0", false},
+		{FormatJsonPointer, "/a~2b", false},
+		{FormatRelativeJsonPointer, "0", true},
+		{FormatRelativeJsonPointer, "1/foo/0", true},
+		{FormatRelativeJsonPointer, "2#", true},
+		{FormatRelativeJsonPointer, "/foo", false},
+		{FormatRelativeJsonPointer, "01/foo", false},
+		{FormatRelativeJsonPointer, "1#/foo", false},
+	} {
+		schema := SchemaRef{Value: spec.NewStringSchema().WithFormat(c.format)}
+		if Validate(schema, c.value) != c.valid {
+			t.Errorf("%s %q: expecting valid to be %v", c.format, c.value, c.valid)
+		}
+	}
+}
+
+func TestParsesStrictNumbers(t *testing.T) {
+	s, err := spec.NewSwaggerLoader().LoadSwaggerFromData([]byte(orderSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	swagger := (*Swagger)(s)
+	order := swagger.FindSchemaByName("Order")
+
+	for _, id := range []string{"3", "3.0", "3.5"} {
+		var obj interface{}
+		d := json.NewDecoder(strings.NewReader(`{"id": ` + id + `, "shipping": {"street": "main"}}`))
+		d.UseNumber()
+		if err := d.Decode(&obj); err != nil {
+			t.Fatal(err)
+		}
+		for _, strict := range []bool{false, true} {
+			opts := MatchOptions{Strict: true, StrictNumbers: strict}
+			err := order.Parses("", obj, make(map[string][]interface{}), true, opts, swagger)
+			if (err == nil) != (!strict || id == "3") {
+				t.Errorf("id %s, strict %v: unexpected result %v", id, strict, err)
+			}
+		}
+	}
+
+	strictNumbers := MatchOptions{Strict: true, StrictNumbers: true}
+	number := SchemaRef{Value: spec.NewFloat64Schema()}
+	if number.Parses("", json.Number("2"), make(map[string][]interface{}), true, strictNumbers, swagger) == nil {
+		t.Errorf("an integer should not parse as a floating point number in strict mode")
+	}
+	if err := number.Parses("", json.Number("2.5"), make(map[string][]interface{}), true, strictNumbers, swagger); err != nil {
+		t.Errorf("a floating point number should parse: %v", err)
+	}
+}
+
+func TestParsesUniqueItemKey(t *testing.T) {
+	s := spec.NewArraySchema()
+	s.Description = "<meqa LineItem unique=sku>"
+	s.Items = spec.NewObjectSchema().WithProperty("sku", spec.NewStringSchema()).NewRef()
+	lines := SchemaRef{Value: s}
+	swagger := &Swagger{}
+
+	line := func(sku interface{}) interface{} { return map[string]interface{}{"sku": sku} }
+	if !lines.Matches([]interface{}{line("a"), line("b"), line(nil), line(nil)}, MatchOptions{}, swagger) {
+		t.Errorf("items with distinct keys should match")
+	}
+	if lines.Matches([]interface{}{line("a"), line("b"), line("a")}, MatchOptions{}, swagger) {
+		t.Errorf("items with the same key should not match")
+	}
+
+	tag := GetMeqaTag(s.Description)
+	if tag == nil || tag.Class != "LineItem" || tag.UniqueKey != "sku" {
+		t.Errorf("unexpected tag %v", tag)
+	}
+}
+
+func TestParsesMalformedOptionalField(t *testing.T) {
+	s := spec.NewObjectSchema().
+		WithProperty("id", spec.NewIntegerSchema()).
+		WithProperty("name", spec.NewStringSchema()).
+		WithProperty("email", spec.NewStringSchema()).
+		WithProperty("age", spec.NewIntegerSchema()).
+		WithProperty("nickname", spec.NewStringSchema())
+	s.Required = []string{"id", "name"}
+	user := SchemaRef{Value: s}
+	swagger := &Swagger{}
+	obj := map[string]interface{}{"id": 1, "name": "joe", "email": "joe@example.com", "age": 30, "nickname": 5}
+
+	if err := user.Parses("", obj, make(map[string][]interface{}), true, MatchOptions{Strict: true}, swagger); err == nil {
+		t.Errorf("a malformed optional field should fail the strict mode")
+	}
+	if err := user.Parses("", obj, make(map[string][]interface{}), true, MatchOptions{}, swagger); err != nil {
+		t.Errorf("a malformed optional field should only count as a mismatch in the lenient mode: %v", err)
+	}
+	obj["name"] = 5
+	if user.Matches(obj, MatchOptions{}, swagger) {
+		t.Errorf("a malformed required field should fail the lenient mode")
+	}
+}
+
+func TestParsesAdditionalProperties(t *testing.T) {
+	swagger := &Swagger{}
+	labels := map[string]interface{}{"env": "prod", "team": "core", "tier": "web"}
+
+	free := SchemaRef{Value: spec.NewObjectSchema().WithAnyAdditionalProperties()}
+	if !free.Matches(labels, MatchOptions{}, swagger) {
+		t.Errorf("additionalProperties: true should accept any fields")
+	}
+	closed := SchemaRef{Value: spec.NewObjectSchema().WithProperty("id", spec.NewIntegerSchema())}
+	if closed.Matches(labels, MatchOptions{}, swagger) {
+		t.Errorf("the undeclared fields should count as mismatches without additionalProperties")
+	}
+
+	stringMap := SchemaRef{Value: spec.NewObjectSchema().WithAdditionalProperties(spec.NewStringSchema())}
+	if !stringMap.Matches(labels, MatchOptions{}, swagger) {
+		t.Errorf("the fields should match the additionalProperties schema")
+	}
+	labels["replicas"] = 3
+	if err := stringMap.Parses("", labels, make(map[string][]interface{}), true, MatchOptions{Strict: true}, swagger); err == nil {
+		t.Errorf("a field that doesn't match the additionalProperties schema should fail the strict mode")
+	}
+	labels["port"] = 80
+	if stringMap.Matches(labels, MatchOptions{}, swagger) {
+		t.Errorf("too many fields that don't match the additionalProperties schema should not match")
+	}
+}
+
+func TestParsesUniqueItems(t *testing.T) {
+	s := spec.NewArraySchema().WithItems(spec.NewObjectSchema().WithProperty("n", spec.NewIntegerSchema()))
+	s.UniqueItems = true
+	ar := SchemaRef{Value: s}
+	swagger := &Swagger{}
+
+	item := func(n interface{}) interface{} { return map[string]interface{}{"n": n} }
+	if !ar.Matches([]interface{}{item(1), item(2), item(json.Number("3"))}, MatchOptions{}, swagger) {
+		t.Errorf("distinct items should match")
+	}
+	if ar.Matches([]interface{}{item(1), item(2), item(json.Number("1.0"))}, MatchOptions{}, swagger) {
+		t.Errorf("equal items should not match")
+	}
+	s.UniqueItems = false
+	if !ar.Matches([]interface{}{item(1), item(1)}, MatchOptions{}, swagger) {
+		t.Errorf("equal items should match without uniqueItems")
+	}
+}
+
+func TestParsesStrictMatch(t *testing.T) {
+	s, err := spec.NewSwaggerLoader().LoadSwaggerFromData([]byte(orderSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	swagger := (*Swagger)(s)
+	order := swagger.FindSchemaByName("Order")
+
+	shipping := map[string]interface{}{"street": "main"}
+	cases := []struct {
+		obj    map[string]interface{}
+		fuzzy  bool
+		strict bool
+	}{
+		{map[string]interface{}{"id": 1, "shipping": shipping}, true, true},
+		// One field of four that isn't in the schema is tolerated, but not in the strict mode.
+		{map[string]interface{}{"id": 1, "shipping": shipping, "billing": shipping, "note": "x"}, true, false},
+		{map[string]interface{}{"id": 1}, false, false},
+	}
+	for _, c := range cases {
+		for _, strict := range []bool{false, true} {
+			want := c.fuzzy
+			if strict {
+				want = c.strict
+			}
+			if order.Matches(c.obj, MatchOptions{StrictMatch: strict}, swagger) != want {
+				t.Errorf("%v, strict %v: expected match to be %v", c.obj, strict, want)
+			}
+		}
+	}
+
+	open := SchemaRef{Value: spec.NewObjectSchema().WithProperty("id", spec.NewIntegerSchema()).WithAnyAdditionalProperties()}
+	if !open.Matches(map[string]interface{}{"id": 1, "note": "x"}, MatchOptions{StrictMatch: true}, swagger) {
+		t.Errorf("additionalProperties should allow the undeclared fields in the strict mode")
+	}
+}
+
+func TestParsesNullable(t *testing.T) {
+	nickname := spec.NewStringSchema()
+	legacy := spec.NewStringSchema()
+	legacy.Extensions = map[string]interface{}{NullableExtension: json.RawMessage("true")}
+	user := SchemaRef{Value: spec.NewObjectSchema().WithProperty("name", spec.NewStringSchema()).
+		WithProperty("nickname", nickname).WithProperty("legacy", legacy)}
+	swagger := &Swagger{}
+	parses := func(obj map[string]interface{}) bool {
+		return user.Parses("", obj, make(map[string][]interface{}), true, MatchOptions{Strict: true}, swagger) == nil
+	}
+
+	if parses(map[string]interface{}{"name": "joe", "nickname": nil}) {
+		t.Errorf("a null field that isn't nullable should fail the strict check")
+	}
+	nickname.Nullable = true
+	if !parses(map[string]interface{}{"name": "joe", "nickname": nil, "legacy": nil}) {
+		t.Errorf("the nullable and x-nullable fields should accept null")
+	}
+	if !user.Matches(map[string]interface{}{"name": nil}, MatchOptions{}, swagger) {
+		t.Errorf("the lenient matching should accept null")
+	}
+}
+
+func newIndexedSchemaDB(description string) *SchemaDB {
+	s := spec.NewObjectSchema().WithProperty("id", spec.NewIntegerSchema()).WithProperty("code", spec.NewStringSchema())
+	s.Description = description
+	return NewSchemaDB("Item", SchemaRef{Value: s}, false)
+}
+
+// linearEquals compares like mqutil.InterfaceEquals, but isn't it, so the lookups with it don't use the index.
+func linearEquals(criteria interface{}, existing interface{}) bool {
+	return mqutil.InterfaceEquals(criteria, existing)
+}
+
+func TestSchemaDBIndex(t *testing.T) {
+	db := newIndexedSchemaDB("")
+	for i := 0; i < 10; i++ {
+		db.Insert(map[string]interface{}{"id": i % 5, "code": fmt.Sprintf("c%d", i)}, nil)
+	}
+	find := func(criteria map[string]interface{}) []interface{} {
+		found := db.Find(criteria, nil, mqutil.InterfaceEquals, -1)
+		if linear := db.Find(criteria, nil, linearEquals, -1); !reflect.DeepEqual(found, linear) {
+			t.Errorf("%v: the index found %v instead of %v", criteria, found, linear)
+		}
+		return found
+	}
+	// The numbers are looked up by value, whatever their type.
+	if found := find(map[string]interface{}{"id": json.Number("3")}); len(found) != 2 || db.index == nil {
+		t.Errorf("expecting the two objects with id 3 through the index, got %v", found)
+	}
+	find(map[string]interface{}{"id": 3.0, "code": "c8"})
+	find(map[string]interface{}{"code": "c8"})
+
+	// The index follows the changes.
+	db.Insert(map[string]interface{}{"id": 3, "code": "new"}, nil)
+	db.Update(map[string]interface{}{"code": "c3"}, nil, mqutil.InterfaceEquals, map[string]interface{}{"id": 7, "code": "c3"}, 1, false)
+	db.Update(map[string]interface{}{"id": 1}, nil, mqutil.InterfaceEquals, map[string]interface{}{"code": "patched"}, -1, true)
+	if found := find(map[string]interface{}{"id": 3}); len(found) != 2 {
+		t.Errorf("expecting the updated object out of the index, got %v", found)
+	}
+	find(map[string]interface{}{"id": 7})
+	find(map[string]interface{}{"code": "patched"})
+	db.Delete(map[string]interface{}{"id": 3}, nil, mqutil.InterfaceEquals, -1)
+	if found := find(map[string]interface{}{"id": 3}); len(found) != 0 {
+		t.Errorf("expecting the deleted objects out of the index, got %v", found)
+	}
+
+	if key := newIndexedSchemaDB("<meqa Item unique=code>").key; key != "code" {
+		t.Errorf("expecting the tag's unique key to identify the objects, got %q", key)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	s, err := spec.NewSwaggerLoader().LoadSwaggerFromData([]byte(orderSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	swagger := (*Swagger)(s)
+	saved := &DB{}
+	saved.Init(swagger)
+	order := map[string]interface{}{"id": json.Number("9007199254740993"), "shipping": map[string]interface{}{"street": "main"}}
+	associations := map[string]map[string]interface{}{"Address": {"street": "main"}}
+	if err := saved.Insert("Order", order, associations); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "db.json")
+	if err := saved.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := &DB{}
+	loaded.Init(swagger)
+	count, skipped, err := loaded.Load(path)
+	if err != nil || count != 1 || len(skipped) != 0 {
+		t.Fatalf("expecting the order loaded, got %d %v %v", count, skipped, err)
+	}
+	found := loaded.Find("Order", map[string]interface{}{"id": 9007199254740993}, associations, mqutil.InterfaceEquals, -1)
+	if len(found) != 1 || !reflect.DeepEqual(found[0], order) {
+		t.Errorf("expecting the saved order with its associations, got %v", found)
+	}
+
+	// The objects that the spec doesn't describe anymore are skipped.
+	changed := `{"Order": [{"data": {"id": 1}}, {"data": {"id": 2, "shipping": {"street": "side"}}}], "Customer": [{"data": {"id": 1}}]}`
+	if err := ioutil.WriteFile(path, []byte(changed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	count, skipped, err = loaded.Load(path)
+	if err != nil || count != 1 || len(skipped) != 2 {
+		t.Errorf("expecting one order loaded and two skipped, got %d %v %v", count, skipped, err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := loaded.Load(path); err == nil {
+		t.Error("expecting an invalid DB file to fail")
+	}
+}
+
+func TestMergeObjects(t *testing.T) {
+	s, err := spec.NewSwaggerLoader().LoadSwaggerFromData([]byte(orderSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := func(id int, street string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "shipping": map[string]interface{}{"street": street}}
+	}
+	base := &DB{}
+	base.Init((*Swagger)(s))
+	base.Insert("Order", order(1, "main"), nil)
+	base.Insert("Order", order(2, "main"), nil)
+	saved := base.Clone()
+
+	// Each clone starts from the base, one deletes an order and creates another, the other updates one.
+	first := base.Clone()
+	first.Delete("Order", map[string]interface{}{"id": 1}, nil, mqutil.InterfaceEquals, -1)
+	first.Insert("Order", order(3, "main"), nil)
+	second := base.Clone()
+	second.Update("Order", map[string]interface{}{"id": 2}, nil, mqutil.InterfaceEquals, order(2, "side"), -1, false)
+	saved.MergeObjects(base, first)
+	saved.MergeObjects(base, second)
+
+	found := saved.Find("Order", map[string]interface{}{}, nil, mqutil.InterfaceEquals, -1)
+	expected := []interface{}{order(2, "side"), order(3, "main")}
+	if len(found) != len(expected) {
+		t.Fatalf("expecting the orders %v, got %v", expected, found)
+	}
+	for _, e := range expected {
+		if len(saved.Find("Order", e, nil, mqutil.InterfaceEquals, -1)) != 1 {
+			t.Errorf("expecting the order %v, got %v", e, found)
+		}
+	}
+	if len(base.Find("Order", map[string]interface{}{}, nil, mqutil.InterfaceEquals, -1)) != 2 {
+		t.Errorf("expecting the base to be left alone")
+	}
+}
+
+func TestCloneSchemaConcurrently(t *testing.T) {
+	s, err := spec.NewSwaggerLoader().LoadSwaggerFromData([]byte(orderSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &DB{}
+	db.Init((*Swagger)(s))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				db.Insert("Address", map[string]interface{}{"street": fmt.Sprintf("street-%d-%d", i, j)}, nil)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				clone := db.CloneSchema()
+				if err := clone.Insert("Address", map[string]interface{}{"street": "cloned"}, nil); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if found := db.Find("Address", nil, nil, mqutil.InterfaceEquals, -1); len(found) != 400 {
+		t.Errorf("expecting the 400 inserted objects, got %d", len(found))
+	}
+}
+
+func BenchmarkSchemaDBFind(b *testing.B) {
+	db := newIndexedSchemaDB("")
+	for i := 0; i < 10000; i++ {
+		db.Insert(map[string]interface{}{"id": i, "code": fmt.Sprintf("c%d", i)}, nil)
+	}
+	for _, c := range []struct {
+		name    string
+		matches MatchFunc
+	}{
+		{"indexed", mqutil.InterfaceEquals},
+		{"linear", linearEquals},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if len(db.Find(map[string]interface{}{"id": i % 10000}, nil, c.matches, 1)) != 1 {
+					b.Fatal("the object isn't found")
+				}
+			}
+		})
+	}
+}
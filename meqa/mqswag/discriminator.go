@@ -0,0 +1,87 @@
+package mqswag
+
+import (
+	"strings"
+
+	spec "github.com/getkin/kin-openapi/openapi3"
+)
+
+// schemaRefPrefix is how a reference to a schema in the components starts.
+const schemaRefPrefix = "#/components/schemas/"
+
+// GetDiscriminator returns the schema's discriminator, following the $refs, and nil if it doesn't have one.
+func (schema SchemaRef) GetDiscriminator(swagger *Swagger) *spec.Discriminator {
+	_, referredSchema, err := swagger.GetReferredSchema(schema)
+	if err != nil {
+		return nil
+	}
+	if referredSchema.Value != nil {
+		return referredSchema.GetDiscriminator(swagger)
+	}
+	if schema.Value == nil || schema.Value.Discriminator == nil || len(schema.Value.Discriminator.PropertyName) == 0 {
+		return nil
+	}
+	return schema.Value.Discriminator
+}
+
+// DiscriminatorValue returns the value of the discriminator property for the schema with the name. That's
+// the key of the discriminator's mapping that points to the schema, or the name itself.
+func DiscriminatorValue(d *spec.Discriminator, name string) string {
+	for value, ref := range d.Mapping {
+		if ref == schemaRefPrefix+EscapeJsonPointerToken(name) || ref == name {
+			return value
+		}
+	}
+	return name
+}
+
+// DiscriminatedSchema returns the name of the schema the discriminator property's value selects, and the
+// schema. The value is looked up in the discriminator's mapping first, and otherwise taken as the schema's
+// name. An empty SchemaRef is returned if there's no such schema.
+func (swagger *Swagger) DiscriminatedSchema(d *spec.Discriminator, value string) (string, SchemaRef) {
+	name := value
+	if ref, ok := d.Mapping[value]; ok {
+		name = ref
+		if strings.HasPrefix(ref, schemaRefPrefix) {
+			name = strings.Replace(strings.Replace(ref[len(schemaRefPrefix):], "~1", "/", -1), "~0", "~", -1)
+		}
+	}
+	return name, swagger.FindSchemaByName(name)
+}
+
+// discriminatedSchema returns the subtype the object's discriminator property selects, when the object
+// should be matched against the subtype instead of the schema. For a oneOf or anyOf that's always the
+// case. A base type is only dispatched to the subtype when the object has fields the base type doesn't
+// have, since the subtype usually includes the base type through allOf.
+func (schema SchemaRef) discriminatedSchema(object interface{}, swagger *Swagger) (string, SchemaRef, bool) {
+	d := schema.Value.Discriminator
+	if d == nil || len(d.PropertyName) == 0 {
+		return "", SchemaRef{}, false
+	}
+	objMap, ok := object.(map[string]interface{})
+	if !ok {
+		return "", SchemaRef{}, false
+	}
+	value, ok := objMap[d.PropertyName].(string)
+	if !ok {
+		return "", SchemaRef{}, false
+	}
+	name, sub := swagger.DiscriminatedSchema(d, value)
+	if sub.Value == nil || sub.Value == schema.Value {
+		return "", SchemaRef{}, false
+	}
+	if len(schema.Value.OneOf) == 0 && len(schema.Value.AnyOf) == 0 {
+		properties := schema.GetProperties(swagger)
+		extra := false
+		for k := range objMap {
+			if _, ok := properties[k]; !ok {
+				extra = true
+				break
+			}
+		}
+		if !extra {
+			return "", SchemaRef{}, false
+		}
+	}
+	return name, sub, true
+}
@@ -0,0 +1,101 @@
+package mqswag
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+	"gopkg.in/yaml.v2"
+)
+
+// Fixture is a template for the objects of a class that are put into the DB before the tests run. The
+// placeholders in the template's strings are expanded for each object: {{seq}} is the object's sequence
+// number in its class starting from 1, {{uuid}} a random uuid and {{now}} the current time. A string that
+// is only {{seq}} becomes a number.
+type Fixture struct {
+	Class  string      `yaml:"class"`
+	Count  int         `yaml:"count,omitempty"` // How many objects to create, 1 if not set.
+	Object interface{} `yaml:"object"`
+}
+
+var placeholderRegexp = regexp.MustCompile(`{{\s*(seq|uuid|now)\s*}}`)
+
+// ExpandPlaceholders returns a copy of the template with the placeholders expanded.
+func ExpandPlaceholders(template interface{}, seq int) interface{} {
+	switch v := template.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for k, e := range v {
+			m[k] = ExpandPlaceholders(e, seq)
+		}
+		return m
+	case []interface{}:
+		var a []interface{}
+		for _, e := range v {
+			a = append(a, ExpandPlaceholders(e, seq))
+		}
+		return a
+	case string:
+		if m := placeholderRegexp.FindStringSubmatch(v); m != nil && m[0] == v && m[1] == "seq" {
+			return seq
+		}
+		return placeholderRegexp.ReplaceAllStringFunc(v, func(p string) string {
+			switch placeholderRegexp.FindStringSubmatch(p)[1] {
+			case "seq":
+				return strconv.Itoa(seq)
+			case "uuid":
+				return mqutil.RandomUUID()
+			default:
+				return time.Now().UTC().Format(time.RFC3339)
+			}
+		})
+	}
+	return template
+}
+
+// InsertFixtures inserts the objects of the fixtures into the DB. The sequence numbers continue across the
+// fixtures of the same class. Returns the number of objects inserted.
+func InsertFixtures(fixtures []Fixture, db *DB) (int, error) {
+	seqs := make(map[string]int)
+	inserted := 0
+	for _, f := range fixtures {
+		if db.GetSchema(f.Class).Value == nil {
+			return inserted, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("fixture for unknown class: %s", f.Class))
+		}
+		template, err := mqutil.YamlObjToJsonObj(f.Object)
+		if err != nil {
+			return inserted, err
+		}
+		if _, ok := template.(map[string]interface{}); !ok {
+			return inserted, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("fixture for %s is not an object", f.Class))
+		}
+		count := f.Count
+		if count <= 0 {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			seqs[f.Class]++
+			if err := db.Insert(f.Class, ExpandPlaceholders(template, seqs[f.Class]), nil); err != nil {
+				return inserted, err
+			}
+			inserted++
+		}
+	}
+	return inserted, nil
+}
+
+// LoadFixtures reads the fixtures from the yaml file and inserts their objects into the DB.
+func LoadFixtures(path string, db *DB) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, mqutil.NewError(mqutil.ErrInvalid, err.Error())
+	}
+	var fixtures []Fixture
+	if err := yaml.Unmarshal(data, &fixtures); err != nil {
+		return 0, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid fixtures file %s: %s", path, err.Error()))
+	}
+	return InsertFixtures(fixtures, db)
+}
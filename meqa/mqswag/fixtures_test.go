@@ -0,0 +1,61 @@
+package mqswag
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	spec "github.com/getkin/kin-openapi/openapi3"
+	"gopkg.in/yaml.v2"
+)
+
+const petFixtures = `
+- class: Pet
+  count: 5
+  object:
+    id: "{{seq}}"
+    name: pet-{{seq}}
+    tag: "{{ uuid }}"
+    created: "{{now}}"
+`
+
+func TestInsertFixtures(t *testing.T) {
+	s := &spec.Swagger{}
+	s.Components.Schemas = map[string]*spec.SchemaRef{
+		"Pet": {Value: spec.NewObjectSchema()},
+	}
+	db := &DB{}
+	db.Init((*Swagger)(s))
+
+	var fixtures []Fixture
+	if err := yaml.Unmarshal([]byte(petFixtures), &fixtures); err != nil {
+		t.Fatal(err)
+	}
+	count, err := InsertFixtures(fixtures, db)
+	if err != nil || count != 5 {
+		t.Fatalf("expecting 5 objects, got %d, %v", count, err)
+	}
+	pets := db.Find("Pet", nil, nil, MatchAlways, -1)
+	ids := make(map[int]bool)
+	tags := make(map[string]bool)
+	for _, p := range pets {
+		pet := p.(map[string]interface{})
+		id, ok := pet["id"].(int)
+		if !ok || pet["name"] != "pet-"+strconv.Itoa(id) {
+			t.Errorf("the sequence isn't expanded: %v", pet)
+		}
+		ids[id] = true
+		tags[pet["tag"].(string)] = true
+		if _, err := time.Parse(time.RFC3339, pet["created"].(string)); err != nil {
+			t.Errorf("now isn't expanded: %v", pet)
+		}
+	}
+	if len(ids) != 5 || !ids[1] || !ids[5] || len(tags) != 5 {
+		t.Errorf("expecting 5 distinct objects numbered from 1, got %v", pets)
+	}
+
+	fixtures[0].Class = "Owner"
+	if _, err := InsertFixtures(fixtures, db); err == nil {
+		t.Errorf("expecting an error for an unknown class")
+	}
+}
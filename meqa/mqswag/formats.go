@@ -0,0 +1,71 @@
+package mqswag
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// The string formats that are checked besides the length, pattern and enum of the schema.
+const (
+	FormatJsonPointer         = "json-pointer"
+	FormatRelativeJsonPointer = "relative-json-pointer"
+	FormatURI                 = "uri"
+	FormatHostname            = "hostname"
+	FormatIPv4                = "ipv4"
+	FormatIPv6                = "ipv6"
+)
+
+// RFC 6901: a pointer is a list of /-prefixed tokens, in which ~ is only used in the escapes ~0 and ~1.
+var jsonPointerRegexp = regexp.MustCompile(`^(/([^/~]|~[01])*)*$`)
+
+// A relative pointer is the number of levels to go up, followed by a pointer or by # for the key or index.
+var relativeJsonPointerRegexp = regexp.MustCompile(`^(0|[1-9][0-9]*)(#|(/([^/~]|~[01])*)*)$`)
+
+// RFC 1123: dot separated labels of letters, digits and hyphens, which don't start or end with a hyphen.
+var hostnameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// validHostname checks whether the string is a hostname, which is at most 253 characters long.
+func validHostname(str string) bool {
+	return len(str) <= 253 && hostnameRegexp.MatchString(str)
+}
+
+// validURI checks whether the string is an absolute uri, one with a scheme.
+func validURI(str string) bool {
+	u, err := url.Parse(str)
+	return err == nil && u.IsAbs()
+}
+
+// validIPv4 checks whether the string is an ipv4 address in the dotted quad form.
+func validIPv4(str string) bool {
+	return !strings.Contains(str, ":") && net.ParseIP(str) != nil
+}
+
+// validIPv6 checks whether the string is an ipv6 address.
+func validIPv6(str string) bool {
+	return strings.Contains(str, ":") && net.ParseIP(str) != nil
+}
+
+// formatCheckers checks the strings of the formats. The formats that aren't listed aren't checked.
+var formatCheckers = map[string]func(string) bool{
+	FormatJsonPointer:         jsonPointerRegexp.MatchString,
+	FormatRelativeJsonPointer: relativeJsonPointerRegexp.MatchString,
+	FormatURI:                 validURI,
+	FormatHostname:            validHostname,
+	FormatIPv4:                validIPv4,
+	FormatIPv6:                validIPv6,
+}
+
+// ValidFormat checks whether the string is of the format.
+func ValidFormat(format string, str string) bool {
+	if check := formatCheckers[format]; check != nil {
+		return check(str)
+	}
+	return true
+}
+
+// EscapeJsonPointerToken escapes the ~ and / of a pointer token as ~0 and ~1.
+func EscapeJsonPointerToken(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
@@ -2,9 +2,10 @@
 package mqswag
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -39,8 +40,25 @@ const (
 
 const (
 	JsonResponse = "application/json"
+	JsonPatch    = "application/json-patch+json"
+
+	FormUrlencoded = "application/x-www-form-urlencoded"
+	MultipartForm  = "multipart/form-data"
 )
 
+// IsJsonMediaType checks whether the media type is JSON, such as application/json or application/vnd.api+json.
+// The JSON patch and problem types are left out, as their bodies have their own meaning.
+func IsJsonMediaType(mediaType string) bool {
+	if i := strings.IndexByte(mediaType, ';'); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == JsonPatch || mediaType == ProblemResponse {
+		return false
+	}
+	return mediaType == JsonResponse || strings.HasSuffix(mediaType, "+json")
+}
+
 var MethodAll []string = []string{MethodGet, MethodPut, MethodPost, MethodDelete, MethodHead, MethodPatch, MethodOptions}
 
 const (
@@ -59,6 +77,7 @@ type MeqaTag struct {
 	Property  string
 	Operation string
 	Flags     int64
+	UniqueKey string // The property that must be different on each item of an array, from unique=<property>.
 }
 
 type DatasetType struct {
@@ -100,11 +119,12 @@ func (t *MeqaTag) ToString() string {
 
 // GetMeqaTag extracts the <meqa > tags.
 // Example. for  <meqa Pet.Name.update>, return Pet, Name, update
+// An array's tag can name the property of its items that must be unique, e.g. <meqa LineItem unique=sku>.
 func GetMeqaTag(desc string) *MeqaTag {
 	if len(desc) == 0 {
 		return nil
 	}
-	re := regexp.MustCompile("<meqa *[/-~\\-]+\\.?[/-~\\-]*\\.?[a-zA-Z]* *[a-zA-Z,]* *>")
+	re := regexp.MustCompile("<meqa *[/-~\\-]+\\.?[/-~\\-]*\\.?[a-zA-Z]* *[a-zA-Z0-9_,=]* *>")
 	ar := re.FindAllString(desc, -1)
 
 	// TODO it's possible that we have multiple choices because the server can't be
@@ -122,10 +142,12 @@ func GetMeqaTag(desc string) *MeqaTag {
 	meqa = strings.Trim(meqa[:right], " ")
 	tags := strings.Split(meqa, " ")
 	var flags int64
-	var objtags string
+	var objtags, uniqueKey string
 	for _, t := range tags {
 		if len(t) > 0 {
-			if t == "success" {
+			if strings.HasPrefix(t, "unique=") {
+				uniqueKey = t[len("unique="):]
+			} else if t == "success" {
 				flags |= FlagSuccess
 			} else if t == "fail" {
 				flags |= FlagFail
@@ -140,11 +162,11 @@ func GetMeqaTag(desc string) *MeqaTag {
 	contents := strings.Split(objtags, ".")
 	switch len(contents) {
 	case 1:
-		return &MeqaTag{contents[0], "", "", flags}
+		return &MeqaTag{contents[0], "", "", flags, uniqueKey}
 	case 2:
-		return &MeqaTag{contents[0], contents[1], "", flags}
+		return &MeqaTag{contents[0], contents[1], "", flags, uniqueKey}
 	case 3:
-		return &MeqaTag{contents[0], contents[1], contents[2], flags}
+		return &MeqaTag{contents[0], contents[1], contents[2], flags, uniqueKey}
 	default:
 		mqutil.Logger.Printf("invalid meqa tag in description: %s", desc)
 		return nil
@@ -268,51 +290,48 @@ func WriteDoneData(meqaPath string) error {
 }
 
 // Init from a file
-func CreateSwaggerFromURL(path string, meqaPath string) (*Swagger, error) {
-	tmpPath := filepath.Join(meqaPath, ".meqatmp")
-	os.Remove(tmpPath)
-	tmpFile, err := os.Create(tmpPath)
+// IsJson checks whether the document is json rather than yaml, by its first character.
+func IsJson(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
+
+// CreateSwaggerFromURL loads the spec in the file or at the http(s) url, json or yaml whatever its extension
+// is. The references to the other files and urls are resolved, so that the spec is one document.
+func CreateSwaggerFromURL(path string) (*Swagger, error) {
+	location := path
+	if !isRemote(path) {
+		if abs, err := filepath.Abs(path); err == nil {
+			location = abs
+		}
+	}
+	data, err := readSpec(location)
 	if err != nil {
-		mqutil.Logger.Printf("can't access tmp file %s", tmpPath)
+		mqutil.Logger.Printf("can't read file %s", path)
 		return nil, err
 	}
-	defer os.Remove(tmpPath)
-
-	// If input is yaml, transform to json
-	var swaggerJsonPath string
-	ar := strings.Split(path, ".")
-	if ar[len(ar)-1] == "json" {
-		swaggerJsonPath = path
-	} else {
-		yamlBytes, err := ioutil.ReadFile(path)
-		if err != nil {
-			mqutil.Logger.Printf("can't read file %s", path)
-			return nil, err
-		}
-		jsonBytes, err := mqutil.YamlToJson(yamlBytes)
-		if err != nil {
-			mqutil.Logger.Printf("invalid yaml in file %s %v", path, err)
-			return nil, err
-		}
-		_, err = tmpFile.Write(jsonBytes)
-		if err != nil {
-			mqutil.Logger.Printf("can't access tmp file %s", tmpPath)
-			return nil, err
-		}
-		swaggerJsonPath = tmpPath
+	doc, err := decodeSpec(data)
+	if err != nil {
+		mqutil.Logger.Printf("invalid yaml in file %s %v", path, err)
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("%s is neither json nor valid yaml: %s", path, err.Error()))
+	}
+	if err := FlattenExternalRefs(doc, location); err != nil {
+		return nil, err
+	}
+	if problems := ValidateSpec(doc); len(problems) > 0 {
+		return nil, SpecError(path, problems)
+	}
+	jsonBytes, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
 	}
 
-	// specDoc, err := loads.Spec(swaggerJsonPath)
-	spec, err := spec.NewSwaggerLoader().LoadSwaggerFromFile(swaggerJsonPath)
+	spec, err := spec.NewSwaggerLoader().LoadSwaggerFromData(jsonBytes)
 	if err != nil {
 		mqutil.Logger.Printf("Can't open the following file: %s", path)
 		mqutil.Logger.Println(err.Error())
-		return nil, err
+		return nil, SpecError(path, []string{err.Error()})
 	}
-
-	// log.Println("Would be serving:", specDoc.Spec().Info.Title)
-
-	// return (*Swagger)(specDoc.Spec()), nil
 	return (*Swagger)(spec), nil
 }
 
@@ -369,7 +388,7 @@ func (swagger *Swagger) GetSchemaRootType(schema SchemaRef, parentTag *MeqaTag)
 	}
 	if referredSchema.Value != nil {
 		if tag == nil {
-			tag = &MeqaTag{referenceName, "", "", 0}
+			tag = &MeqaTag{referenceName, "", "", 0, ""}
 		}
 		return swagger.GetSchemaRootType(referredSchema, tag)
 	}
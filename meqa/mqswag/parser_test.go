@@ -0,0 +1,82 @@
+package mqswag
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+const storeSpec = `
+openapi: 3.0.2
+info:
+  title: store
+  version: "1.0"
+paths:
+  /orders/{id}:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      responses:
+        '200':
+          description: found
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Order'
+components:
+  schemas:
+    Order:
+      type: object
+      properties:
+        id:
+          type: integer
+`
+
+func TestCreateSwaggerJsonOrYaml(t *testing.T) {
+	mqutil.Logger = mqutil.NewLogger(ioutil.Discard)
+	dir, err := ioutil.TempDir("", "spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	jsonSpec, err := mqutil.YamlToJson([]byte(storeSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The format is told by the content, so a spec loads whatever its extension is.
+	files := map[string][]byte{"openapi.yaml": []byte(storeSpec), "swagger.json": jsonSpec, "spec": jsonSpec, "spec.txt": []byte(storeSpec)}
+	var paths []byte
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		swagger, err := CreateSwaggerFromURL(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(swagger.Paths) == 0 {
+			t.Fatalf("%s: no paths loaded", name)
+		}
+		p, _ := json.Marshal(swagger.Paths)
+		if paths != nil && !reflect.DeepEqual(p, paths) {
+			t.Errorf("%s: the paths differ from the other formats':\n%s\n%s", name, p, paths)
+		}
+		paths = p
+	}
+
+	bad := filepath.Join(dir, "bad.yaml")
+	ioutil.WriteFile(bad, []byte("paths: [unclosed"), 0644)
+	if _, err := CreateSwaggerFromURL(bad); err == nil {
+		t.Errorf("expecting an error for the invalid spec")
+	}
+}
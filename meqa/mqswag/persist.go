@@ -0,0 +1,79 @@
+package mqswag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// savedEntry is how an object of the DB is saved.
+type savedEntry struct {
+	Data         map[string]interface{}            `json:"data"`
+	Associations map[string]map[string]interface{} `json:"associations,omitempty"`
+}
+
+// Save writes the objects of the DB, with their associations, to the json file at the path, so that a
+// later run can load them, e.g. to clean up what this run created.
+func (db *DB) Save(path string) error {
+	db.mutex.Lock()
+	saved := make(map[string][]savedEntry)
+	for name, schemaDB := range db.schemas {
+		for _, entry := range schemaDB.Objects {
+			saved[name] = append(saved[name], savedEntry{entry.Data, entry.Associations})
+		}
+	}
+	b, err := json.MarshalIndent(saved, "", "  ")
+	db.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// Load adds the objects saved in the json file at the path to the DB. The spec may have changed since they
+// were saved, so the objects of the classes the spec doesn't have anymore, and the objects that don't match
+// their schema, are skipped. Returns the number of objects loaded and the reasons the others were skipped.
+func (db *DB) Load(path string) (int, []string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	var saved map[string][]savedEntry
+	if err := mqutil.DecodeJson(b, &saved); err != nil {
+		return 0, nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the DB file %s is invalid - %s", path, err.Error()))
+	}
+	var names []string
+	for name := range saved {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	loaded := 0
+	var skipped []string
+	for _, name := range names {
+		schemaDB := db.schemas[name]
+		if schemaDB == nil {
+			skipped = append(skipped, fmt.Sprintf("%d objects of %s, which isn't in the spec", len(saved[name]), name))
+			continue
+		}
+		mismatched := 0
+		for _, entry := range saved[name] {
+			if entry.Data == nil || !schemaDB.Schema.Matches(entry.Data, db.Options, db.Swagger) {
+				mismatched++
+				continue
+			}
+			schemaDB.Objects = append(schemaDB.Objects, &DBEntry{entry.Data, entry.Associations})
+			loaded++
+		}
+		schemaDB.ResetIndex()
+		if mismatched > 0 {
+			skipped = append(skipped, fmt.Sprintf("%d objects of %s, which don't match its schema", mismatched, name))
+		}
+	}
+	return loaded, skipped, nil
+}
@@ -0,0 +1,59 @@
+package mqswag
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+
+	spec "github.com/getkin/kin-openapi/openapi3"
+)
+
+// This file implements the validation of RFC 7807 problem details responses.
+
+const ProblemResponse = "application/problem+json"
+
+// ProblemSchema is the schema of the standard problem details members. Problems can have any number
+// of extension members besides these.
+var ProblemSchema = SchemaRef{Value: spec.NewObjectSchema().
+	WithProperty("type", spec.NewStringSchema().WithFormat("uri-reference")).
+	WithProperty("title", spec.NewStringSchema()).
+	WithProperty("status", spec.NewIntegerSchema().WithMin(100).WithMax(599)).
+	WithProperty("detail", spec.NewStringSchema()).
+	WithProperty("instance", spec.NewStringSchema().WithFormat("uri-reference")).
+	WithAnyAdditionalProperties()}
+
+// IsProblemMediaType checks whether the media type is the problem details JSON type.
+func IsProblemMediaType(mediaType string) bool {
+	if i := strings.IndexByte(mediaType, ';'); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(mediaType)) == ProblemResponse
+}
+
+// ValidateProblem checks the standard members of a problem details object, strictly and otherwise as the
+// options say. The status member, if present, must be the status code of the response.
+func ValidateProblem(object interface{}, status int, opts MatchOptions, swagger *Swagger) error {
+	objMap, ok := object.(map[string]interface{})
+	if !ok {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("problem details is not an object: %v", object))
+	}
+	standard := make(map[string]interface{})
+	for k := range ProblemSchema.Value.Properties {
+		if v, exist := objMap[k]; exist {
+			standard[k] = v
+		}
+	}
+	if len(standard) > 0 {
+		opts.Strict = true
+		if err := ProblemSchema.Parses("", standard, make(map[string][]interface{}), true, opts, swagger); err != nil {
+			return err
+		}
+	}
+	if v, exist := objMap["status"]; exist {
+		if n, _ := NumberValue(v); int(n) != status {
+			return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("problem details status %v doesn't match the response status %d", v, status))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package mqswag
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// Condition is what a field of the objects has to satisfy. All the operators that are set have to hold,
+// e.g. {gt: 0, lt: 10} picks the values between 0 and 10.
+type Condition struct {
+	Equals interface{}   `yaml:"equals,omitempty" json:"equals,omitempty"`
+	In     []interface{} `yaml:"in,omitempty" json:"in,omitempty"`
+	Gt     interface{}   `yaml:"gt,omitempty" json:"gt,omitempty"`
+	Lt     interface{}   `yaml:"lt,omitempty" json:"lt,omitempty"`
+}
+
+// Query selects the objects by the conditions on their fields, keyed by the field names. The fields of the
+// nested objects are named with dots, e.g. category.name. An empty query selects all the objects.
+//
+//	status: {equals: available}
+//	tag: {in: [dog, cat]}
+//	age: {gt: 2}
+type Query map[string]*Condition
+
+// Compile checks the query and turns it into a MatchFunc for DB.Find and the like. The func ignores the
+// criteria it's given and only looks at the objects.
+func (q Query) Compile() (MatchFunc, error) {
+	type compiled struct {
+		path []string
+		cond Condition
+	}
+	var fields []string
+	for field := range q {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	var conditions []compiled
+	for _, field := range fields {
+		cond := q[field]
+		if cond == nil || cond.Equals == nil && cond.In == nil && cond.Gt == nil && cond.Lt == nil {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the query of %s has no condition", field))
+		}
+		for _, bound := range []interface{}{cond.Gt, cond.Lt} {
+			if _, ok := mqutil.NumberRat(bound); bound != nil && !ok {
+				return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the query of %s compares with %v, which isn't a number", field, bound))
+			}
+		}
+		// The values from the yaml plans have the yaml types, the objects the json ones.
+		c := *cond
+		var err error
+		if c.Equals, err = mqutil.YamlObjToJsonObj(c.Equals); err != nil {
+			return nil, err
+		}
+		for i := range c.In {
+			if c.In[i], err = mqutil.YamlObjToJsonObj(c.In[i]); err != nil {
+				return nil, err
+			}
+		}
+		conditions = append(conditions, compiled{strings.Split(field, "."), c})
+	}
+	return func(criteria interface{}, existing interface{}) bool {
+		for _, c := range conditions {
+			value, found := fieldValue(existing, c.path)
+			if !found || !c.cond.holds(value) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// holds checks whether the value satisfies the condition.
+func (c *Condition) holds(value interface{}) bool {
+	if c.Equals != nil && !mqutil.InterfaceEquals(c.Equals, value) {
+		return false
+	}
+	if c.In != nil {
+		in := false
+		for _, v := range c.In {
+			if mqutil.InterfaceEquals(v, value) {
+				in = true
+				break
+			}
+		}
+		if !in {
+			return false
+		}
+	}
+	if cmp, ok := mqutil.NumberCompare(value, c.Gt); c.Gt != nil && (!ok || cmp <= 0) {
+		return false
+	}
+	if cmp, ok := mqutil.NumberCompare(value, c.Lt); c.Lt != nil && (!ok || cmp >= 0) {
+		return false
+	}
+	return true
+}
+
+// fieldValue returns the value of the field at the path in the object.
+func fieldValue(obj interface{}, path []string) (interface{}, bool) {
+	for _, name := range path {
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if obj, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return obj, true
+}
@@ -0,0 +1,79 @@
+package mqswag
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+const petQueries = `
+available:
+  status: {equals: available}
+pets:
+  tag: {in: [dog, cat]}
+adults:
+  age: {gt: 2, lt: 10}
+named:
+  category.name: {equals: home}
+big:
+  id: {gt: 9007199254740992}
+`
+
+func TestQuery(t *testing.T) {
+	var queries map[string]Query
+	if err := yaml.Unmarshal([]byte(petQueries), &queries); err != nil {
+		t.Fatal(err)
+	}
+	pets := []map[string]interface{}{
+		{"id": json.Number("9007199254740993"), "status": "available", "tag": "dog", "age": 3,
+			"category": map[string]interface{}{"name": "home"}},
+		{"id": 2, "status": "sold", "tag": "cat", "age": 10.0},
+		{"id": 3, "status": "available", "tag": "fish", "age": json.Number("2.5")},
+		{"id": 4, "tag": "dog", "age": "old", "category": "home"},
+	}
+	expected := map[string][]int{
+		"available": {0, 2},
+		"pets":      {0, 1, 3},
+		"adults":    {0, 2},
+		"named":     {0},
+		"big":       {0},
+	}
+	for name, indexes := range expected {
+		matches, err := queries[name].Compile()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var found []int
+		for i, pet := range pets {
+			if matches(nil, pet) {
+				found = append(found, i)
+			}
+		}
+		if len(found) != len(indexes) {
+			t.Errorf("%s: expecting the pets %v, got %v", name, indexes, found)
+			continue
+		}
+		for i := range found {
+			if found[i] != indexes[i] {
+				t.Errorf("%s: expecting the pets %v, got %v", name, indexes, found)
+				break
+			}
+		}
+	}
+
+	db := NewSchemaDB("Pet", SchemaRef{}, false)
+	for _, pet := range pets {
+		db.Insert(pet, nil)
+	}
+	matches, _ := queries["available"].Compile()
+	if found := db.Find(nil, nil, matches, -1); len(found) != 2 {
+		t.Errorf("expecting the 2 available pets from the DB, got %v", found)
+	}
+
+	for _, invalid := range []Query{{"status": nil}, {"status": {}}, {"age": {Gt: "two"}}} {
+		if _, err := invalid.Compile(); err == nil {
+			t.Errorf("%v: expecting the query to be invalid", invalid)
+		}
+	}
+}
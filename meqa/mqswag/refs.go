@@ -0,0 +1,252 @@
+package mqswag
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// MaxRefDepth limits how many files deep the external references can go, to stop the ones that never end.
+const MaxRefDepth = 32
+
+// refFetchTimeout is how long fetching a spec or a referred document over http can take.
+const refFetchTimeout = 30 * time.Second
+
+// isRemote checks whether the location is an http(s) url rather than a file path.
+func isRemote(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// readSpec reads the document at the location, a file path or an http(s) url.
+func readSpec(location string) ([]byte, error) {
+	if !isRemote(location) {
+		return ioutil.ReadFile(location)
+	}
+	client := http.Client{Timeout: refFetchTimeout}
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("getting %s failed with status %d", location, resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// decodeSpec decodes the json or yaml document, keeping the numbers as json.Number.
+func decodeSpec(data []byte) (interface{}, error) {
+	if !IsJson(data) {
+		var err error
+		if data, err = mqutil.YamlToJson(data); err != nil {
+			return nil, err
+		}
+	}
+	var doc interface{}
+	if err := mqutil.DecodeJson(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// resolveLocation returns the location a reference points to, relative to the document it's in.
+func resolveLocation(base string, ref string) (string, error) {
+	if isRemote(ref) {
+		return ref, nil
+	}
+	if isRemote(base) {
+		b, err := url.Parse(base)
+		if err != nil {
+			return "", err
+		}
+		r, err := url.Parse(ref)
+		if err != nil {
+			return "", err
+		}
+		return b.ResolveReference(r).String(), nil
+	}
+	if filepath.IsAbs(ref) {
+		return ref, nil
+	}
+	return filepath.Join(filepath.Dir(base), filepath.FromSlash(ref)), nil
+}
+
+var componentRefRegex = regexp.MustCompile(`^/components/([^/]+)/`)
+
+// refSection returns the section of the components a referred value goes in, by the pointer to it. The
+// values at the other pointers are taken as schemas.
+func refSection(pointer string) string {
+	if m := componentRefRegex.FindStringSubmatch(pointer); m != nil {
+		return m[1]
+	}
+	for _, section := range []string{"parameters", "responses"} {
+		if strings.HasPrefix(pointer, "/"+section+"/") {
+			return section
+		}
+	}
+	return "schemas"
+}
+
+// refFlattener copies the values the external references point to into the components of the spec, and
+// points the references to the copies.
+type refFlattener struct {
+	root       string
+	docs       map[string]interface{} // The documents loaded, by location.
+	refs       map[string]string      // The local references of the external values, by location#pointer.
+	components map[string]interface{}
+}
+
+// FlattenExternalRefs resolves the references to the other files and urls in the spec at the location, so
+// that the spec is one document. A reference such as "./definitions/pet.yaml#/Pet" becomes
+// "#/components/schemas/Pet", with the value it points to added to the components.
+func FlattenExternalRefs(doc interface{}, location string) error {
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the spec at %s is not an object", location))
+	}
+	components, ok := root["components"].(map[string]interface{})
+	if !ok {
+		components = make(map[string]interface{})
+	}
+	f := &refFlattener{
+		root:       location,
+		docs:       map[string]interface{}{location: doc},
+		refs:       make(map[string]string),
+		components: components,
+	}
+	if err := f.flatten(doc, location, 0); err != nil {
+		return err
+	}
+	if len(components) > 0 {
+		root["components"] = components
+	}
+	return nil
+}
+
+func (f *refFlattener) flatten(node interface{}, base string, depth int) error {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, v := range n {
+			if err := f.flatten(v, base, depth); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if ref, ok := n["$ref"].(string); ok {
+			local, err := f.resolve(ref, base, depth)
+			if err != nil {
+				return err
+			}
+			n["$ref"] = local
+			return nil
+		}
+		for _, v := range n {
+			if err := f.flatten(v, base, depth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve returns the local reference for the reference in the document at base.
+func (f *refFlattener) resolve(ref string, base string, depth int) (string, error) {
+	parts := strings.SplitN(ref, "#", 2)
+	pointer := ""
+	if len(parts) == 2 {
+		pointer = parts[1]
+	}
+	location := base
+	if len(parts[0]) > 0 {
+		var err error
+		if location, err = resolveLocation(base, parts[0]); err != nil {
+			return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid reference %s: %s", ref, err.Error()))
+		}
+	}
+	if location == f.root {
+		return "#" + pointer, nil
+	}
+	key := location + "#" + pointer
+	if local, ok := f.refs[key]; ok {
+		return local, nil
+	}
+	if depth >= MaxRefDepth {
+		return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the reference %s is more than %d files deep", ref, MaxRefDepth))
+	}
+
+	doc, ok := f.docs[location]
+	if !ok {
+		data, err := readSpec(location)
+		if err != nil {
+			return "", mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("can't read %s referred to by %s: %s", location, ref, err.Error()))
+		}
+		if doc, err = decodeSpec(data); err != nil {
+			return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("%s referred to by %s is neither json nor valid yaml: %s",
+				location, ref, err.Error()))
+		}
+		f.docs[location] = doc
+	}
+	value, name, err := jsonPointerValue(doc, pointer)
+	if err != nil {
+		return "", mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("can't resolve %s: %s", ref, err.Error()))
+	}
+	if len(name) == 0 {
+		name = strings.TrimSuffix(filepath.Base(location), filepath.Ext(location))
+	}
+
+	section := refSection(pointer)
+	values, ok := f.components[section].(map[string]interface{})
+	if !ok {
+		values = make(map[string]interface{})
+		f.components[section] = values
+	}
+	unique := name
+	for i := 2; values[unique] != nil; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	values[unique] = value
+	local := "#/components/" + section + "/" + EscapeJsonPointerToken(unique)
+	// Registered before going in, so that the references back to it end.
+	f.refs[key] = local
+	return local, f.flatten(value, location, depth+1)
+}
+
+// jsonPointerValue returns the value the pointer points to in the document, and the last token of the
+// pointer, which names it.
+func jsonPointerValue(doc interface{}, pointer string) (interface{}, string, error) {
+	if len(pointer) == 0 {
+		return doc, "", nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, "", fmt.Errorf("invalid json pointer %s", pointer)
+	}
+	value := doc
+	var token string
+	for _, t := range strings.Split(pointer[1:], "/") {
+		token = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if value, ok = v[token]; !ok {
+				return nil, "", fmt.Errorf("%s not found", pointer)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, "", fmt.Errorf("%s not found", pointer)
+			}
+			value = v[i]
+		default:
+			return nil, "", fmt.Errorf("%s not found", pointer)
+		}
+	}
+	return value, token, nil
+}
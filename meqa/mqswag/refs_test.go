@@ -0,0 +1,139 @@
+package mqswag
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+const splitSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths:
+  /pets:
+    get:
+      parameters:
+        - $ref: 'parameters.yaml#/parameters/limit'
+      responses:
+        '200':
+          description: ok
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: './definitions/pet.yaml#/Pet'
+components:
+  schemas:
+    Error:
+      type: object
+      properties:
+        message:
+          type: string
+`
+
+const petDefinitions = `
+Pet:
+  type: object
+  properties:
+    name:
+      type: string
+    owner:
+      $ref: '#/Owner'
+    tag:
+      $ref: '../tag.json'
+    error:
+      $ref: '../openapi.yaml#/components/schemas/Error'
+Owner:
+  type: object
+  properties:
+    pets:
+      type: array
+      items:
+        $ref: '#/Pet'
+    address:
+      $ref: '{{server}}/address.yaml#/Address'
+`
+
+const limitParameters = `
+parameters:
+  limit:
+    name: limit
+    in: query
+    schema:
+      type: integer
+`
+
+func TestFlattenExternalRefs(t *testing.T) {
+	mqutil.Logger = mqutil.NewLogger(ioutil.Discard)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/address.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("Address:\n  type: object\n  properties:\n    street:\n      type: string\n"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "refs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"openapi.yaml":           splitSpec,
+		"parameters.yaml":        limitParameters,
+		"definitions/pet.yaml":   strings.Replace(petDefinitions, "{{server}}", server.URL, 1),
+		"tag.json":               `{"type": "object", "properties": {"label": {"type": "string"}}}`,
+		"definitions/extra.yaml": "Unused:\n  type: string\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	swagger, err := CreateSwaggerFromURL(filepath.Join(dir, "openapi.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pet := swagger.FindSchemaByName("Pet")
+	if pet.Value == nil {
+		t.Fatalf("the referred schema isn't in the components: %v", swagger.Components.Schemas)
+	}
+	props := pet.Value.Properties
+	if props["owner"].Ref != "#/components/schemas/Owner" || props["tag"].Ref != "#/components/schemas/tag" ||
+		props["error"].Ref != "#/components/schemas/Error" {
+		t.Errorf("unexpected references %s, %s and %s", props["owner"].Ref, props["tag"].Ref, props["error"].Ref)
+	}
+	owner := swagger.FindSchemaByName("Owner")
+	// The cycle back to Pet refers to the same schema.
+	if items := owner.Value.Properties["pets"].Value.Items; items.Ref != "#/components/schemas/Pet" || items.Value != pet.Value {
+		t.Errorf("unexpected items %v", items.Ref)
+	}
+	if address := owner.Value.Properties["address"]; address.Value == nil || address.Value.Properties["street"] == nil {
+		t.Errorf("the remote reference isn't resolved")
+	}
+	if swagger.Components.Parameters["limit"] == nil || swagger.Components.Schemas["Unused"] != nil {
+		t.Errorf("expecting only the referred values in the components")
+	}
+	op := swagger.Paths["/pets"].Get
+	if op.Parameters[0].Value == nil || op.Parameters[0].Value.Name != "limit" {
+		t.Errorf("the parameter reference isn't resolved")
+	}
+
+	os.Remove(filepath.Join(dir, "tag.json"))
+	if _, err := CreateSwaggerFromURL(filepath.Join(dir, "openapi.yaml")); err == nil || !strings.Contains(err.Error(), "tag.json") {
+		t.Errorf("expecting an error about the missing file, got %v", err)
+	}
+}
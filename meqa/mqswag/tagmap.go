@@ -0,0 +1,146 @@
+package mqswag
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+	spec "github.com/getkin/kin-openapi/openapi3"
+	"gopkg.in/yaml.v2"
+)
+
+// TagMapping holds meqa tags that are kept outside of the spec. The tags are written like in the descriptions,
+// with or without the <meqa > around them, e.g. "Pet.id" or "<meqa Pet.id>".
+//
+//	schemas:
+//	  Pet: Pet
+//	  Order.petId: Pet.id
+//	operations:
+//	  post /pet: Pet..post
+//	parameters:
+//	  get /pet/{petId}:
+//	    petId: Pet.id
+type TagMapping struct {
+	Schemas    map[string]string            `yaml:"schemas"`    // schema or schema.property -> tag
+	Operations map[string]string            `yaml:"operations"` // "method path" -> tag
+	Parameters map[string]map[string]string `yaml:"parameters"` // "method path" -> parameter name -> tag
+}
+
+// LoadTagMapping reads the tag mapping from the yaml file.
+func LoadTagMapping(path string) (*TagMapping, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, err.Error())
+	}
+	mapping := &TagMapping{}
+	if err := yaml.UnmarshalStrict(data, mapping); err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid tag mapping file %s: %s", path, err.Error()))
+	}
+	return mapping, nil
+}
+
+// tagDescription puts the tag in front of the description, so it's the one GetMeqaTag finds.
+func tagDescription(tag string, desc string) string {
+	tag = strings.TrimSpace(tag)
+	if !strings.HasPrefix(tag, "<meqa") {
+		tag = "<meqa " + tag + ">"
+	}
+	if len(desc) == 0 {
+		return tag
+	}
+	return tag + " " + desc
+}
+
+// sortedKeys returns the keys of the map in order, so that the errors are the same from run to run.
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// findOperation finds the operation from a "method path" key.
+func (swagger *Swagger) findOperation(key string) (*spec.PathItem, *spec.Operation, error) {
+	fields := strings.Fields(key)
+	if len(fields) == 2 {
+		if pathItem := swagger.Paths[fields[1]]; pathItem != nil {
+			if op := pathItem.GetOperation(strings.ToUpper(fields[0])); op != nil {
+				return pathItem, op, nil
+			}
+		}
+	}
+	return nil, nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("tag mapping for unknown operation: %s", key))
+}
+
+// ApplyTags merges the tags of the mapping into the descriptions of the spec, where the rest of meqa looks
+// for them. A tag from the mapping takes precedence over the one already in a description.
+func (swagger *Swagger) ApplyTags(mapping *TagMapping) error {
+	for _, key := range sortedKeys(mapping.Schemas) {
+		names := strings.SplitN(key, ".", 2)
+		schema := swagger.Components.Schemas[names[0]]
+		if schema == nil || schema.Value == nil {
+			return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("tag mapping for unknown schema: %s", key))
+		}
+		if len(names) == 1 {
+			schema.Value.Description = tagDescription(mapping.Schemas[key], schema.Value.Description)
+			continue
+		}
+		property := schema.Value.Properties[names[1]]
+		if property == nil || property.Value == nil {
+			return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("tag mapping for unknown property: %s", key))
+		}
+		// A property that refers to another schema shares its value, so the tag goes on a copy.
+		value := *property.Value
+		value.Description = tagDescription(mapping.Schemas[key], value.Description)
+		schema.Value.Properties[names[1]] = &spec.SchemaRef{Ref: property.Ref, Value: &value}
+	}
+
+	for _, key := range sortedKeys(mapping.Operations) {
+		_, op, err := swagger.findOperation(key)
+		if err != nil {
+			return err
+		}
+		op.Description = tagDescription(mapping.Operations[key], op.Description)
+	}
+
+	var opKeys []string
+	for k := range mapping.Parameters {
+		opKeys = append(opKeys, k)
+	}
+	sort.Strings(opKeys)
+	for _, key := range opKeys {
+		pathItem, op, err := swagger.findOperation(key)
+		if err != nil {
+			return err
+		}
+		for _, name := range sortedKeys(mapping.Parameters[key]) {
+			// A parameter can be shared through a reference or by all the operations of the path, so the tag goes
+			// on a copy in the operation's own parameters, which override the path's.
+			var param *spec.ParameterRef
+			for i, p := range op.Parameters {
+				if p.Value != nil && p.Value.Name == name {
+					value := *p.Value
+					param = &spec.ParameterRef{Ref: p.Ref, Value: &value}
+					op.Parameters[i] = param
+					break
+				}
+			}
+			for _, p := range pathItem.Parameters {
+				if param == nil && p.Value != nil && p.Value.Name == name {
+					value := *p.Value
+					param = &spec.ParameterRef{Ref: p.Ref, Value: &value}
+					op.Parameters = append(op.Parameters, param)
+				}
+			}
+			if param == nil {
+				return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("tag mapping for unknown parameter %s of %s", name, key))
+			}
+			param.Value.Description = tagDescription(mapping.Parameters[key][name], param.Value.Description)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package mqswag
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	spec "github.com/getkin/kin-openapi/openapi3"
+)
+
+const orderTagMapping = `
+schemas:
+  Order: Order
+  Order.billing: <meqa Address weak>
+operations:
+  post /orders: Order..post
+parameters:
+  get /orders/{id}:
+    id: Order.id
+`
+
+func TestApplyTags(t *testing.T) {
+	s, err := spec.NewSwaggerLoader().LoadSwaggerFromData([]byte(orderSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	swagger := (*Swagger)(s)
+	op := spec.NewOperation()
+	op.Description = "creates an order"
+	get := spec.NewOperation()
+	get.AddParameter(spec.NewPathParameter("id").WithSchema(spec.NewIntegerSchema()))
+	swagger.Paths = spec.Paths{"/orders": {Post: op}, "/orders/{id}": {Get: get}}
+
+	dir, err := ioutil.TempDir("", "tagmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tags.yml")
+	if err := ioutil.WriteFile(path, []byte(orderTagMapping), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mapping, err := LoadTagMapping(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := swagger.ApplyTags(mapping); err != nil {
+		t.Fatal(err)
+	}
+
+	order := swagger.FindSchemaByName("Order")
+	if tag := GetMeqaTag(order.Value.Description); tag == nil || tag.Class != "Order" {
+		t.Errorf("unexpected schema tag %v", tag)
+	}
+	billing := order.Value.Properties["billing"]
+	if tag := GetMeqaTag(billing.Value.Description); tag == nil || tag.Class != "Address" || tag.Flags != FlagWeak {
+		t.Errorf("unexpected property tag %v", tag)
+	}
+	// The tag of a property that refers to a schema doesn't change the schema it refers to.
+	if billing.Ref == "" || len(swagger.FindSchemaByName("Address").Value.Description) > 0 {
+		t.Errorf("the referred schema is changed")
+	}
+	if op.Description != "<meqa Order..post> creates an order" {
+		t.Errorf("unexpected operation description %q", op.Description)
+	}
+	if tag := GetMeqaTag(get.Parameters[0].Value.Description); tag == nil || tag.Class != "Order" || tag.Property != "id" {
+		t.Errorf("unexpected parameter tag %v", tag)
+	}
+
+	for _, m := range []*TagMapping{
+		{Schemas: map[string]string{"Invoice": "Invoice"}},
+		{Schemas: map[string]string{"Order.total": "Order.total"}},
+		{Operations: map[string]string{"delete /orders": "Order"}},
+		{Parameters: map[string]map[string]string{"get /orders/{id}": {"orderId": "Order.id"}}},
+	} {
+		if swagger.ApplyTags(m) == nil {
+			t.Errorf("%v: expecting an error", m)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package mqswag
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+// operationMethods are the keys of a path item that are operations.
+var operationMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// ValidateSpec checks the structure of the spec document, before it's loaded, for the problems that stop
+// meqa from using it: the references that point to nothing, the operations without responses and the
+// operationIds used more than once. It returns all the problems found, sorted.
+func ValidateSpec(doc interface{}) []string {
+	var problems []string
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		return []string{"the spec is not an object"}
+	}
+	danglingRefs(root, root, "", &problems)
+
+	paths, _ := root["paths"].(map[string]interface{})
+	operationIds := make(map[string][]string)
+	for path, item := range paths {
+		pathItem, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, method := range operationMethods {
+			op, ok := pathItem[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name := method + " " + path
+			if responses, _ := op["responses"].(map[string]interface{}); len(responses) == 0 {
+				problems = append(problems, fmt.Sprintf("%s has no responses", name))
+			}
+			if id, _ := op["operationId"].(string); len(id) > 0 {
+				operationIds[id] = append(operationIds[id], name)
+			}
+		}
+	}
+	for id, ops := range operationIds {
+		if len(ops) > 1 {
+			sort.Strings(ops)
+			problems = append(problems, fmt.Sprintf("operationId %s is used by %s", id, strings.Join(ops, ", ")))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// danglingRefs adds the references under the node that point to nothing in the document to the problems.
+func danglingRefs(doc interface{}, node interface{}, pointer string, problems *[]string) {
+	switch n := node.(type) {
+	case []interface{}:
+		for i, v := range n {
+			danglingRefs(doc, v, fmt.Sprintf("%s/%d", pointer, i), problems)
+		}
+	case map[string]interface{}:
+		if ref, ok := n["$ref"].(string); ok {
+			if !strings.HasPrefix(ref, "#") {
+				*problems = append(*problems, fmt.Sprintf("the reference %s at %s is not in the spec", ref, pointer))
+			} else if _, _, err := jsonPointerValue(doc, ref[1:]); err != nil {
+				*problems = append(*problems, fmt.Sprintf("the reference %s at %s points to nothing", ref, pointer))
+			}
+			return
+		}
+		for k, v := range n {
+			danglingRefs(doc, v, pointer+"/"+EscapeJsonPointerToken(k), problems)
+		}
+	}
+}
+
+// SpecError is the error with all the problems of the spec at the path.
+func SpecError(path string, problems []string) error {
+	return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the spec %s has %d problems:\n  %s", path, len(problems),
+		strings.Join(problems, "\n  ")))
+}
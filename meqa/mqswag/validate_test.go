@@ -0,0 +1,80 @@
+package mqswag
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+)
+
+const brokenSpec = `
+openapi: 3.0.2
+info:
+  title: broken
+  version: "1.0"
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      responses:
+        '200':
+          description: ok
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pets'
+    post:
+      operationId: listPets
+  /pets/{id}:
+    get:
+      operationId: getPet
+      responses:
+        '200':
+          description: ok
+components:
+  schemas:
+    Pet:
+      type: object
+`
+
+func TestValidateSpec(t *testing.T) {
+	mqutil.Logger = mqutil.NewLogger(ioutil.Discard)
+	doc, err := decodeSpec([]byte(brokenSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := ValidateSpec(doc)
+	expected := []string{
+		"operationId listPets is used by get /pets, post /pets",
+		"post /pets has no responses",
+		"the reference #/components/schemas/Pets at /paths/~1pets/get/responses/200/content/application~1json/schema points to nothing",
+	}
+	if strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected problems:\n%s", strings.Join(problems, "\n"))
+	}
+
+	// Loading the spec reports all the problems at once.
+	dir, err := ioutil.TempDir("", "validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "broken.yaml")
+	if err := ioutil.WriteFile(path, []byte(brokenSpec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = CreateSwaggerFromURL(path)
+	if err == nil || !strings.Contains(mqutil.ErrorMessage(err), "has 3 problems:\n  "+strings.Join(expected, "\n  ")) {
+		t.Errorf("expecting the problems in the error, got %v", err)
+	}
+
+	if doc, err = decodeSpec([]byte(storeSpec)); err != nil {
+		t.Fatal(err)
+	}
+	if problems := ValidateSpec(doc); len(problems) > 0 {
+		t.Errorf("expecting no problems, got %v", problems)
+	}
+}
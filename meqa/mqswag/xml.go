@@ -0,0 +1,201 @@
+package mqswag
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+
+	spec "github.com/getkin/kin-openapi/openapi3"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// XmlInfo is the xml object of a schema, that says how its values are written in XML.
+type XmlInfo struct {
+	Name      string
+	Namespace string
+	Prefix    string
+	Attribute bool
+	Wrapped   bool
+}
+
+// GetXmlInfo returns the schema's xml object, or the zero XmlInfo when it doesn't have one.
+func (schema SchemaRef) GetXmlInfo() XmlInfo {
+	var info XmlInfo
+	if schema.Value == nil {
+		return info
+	}
+	m, ok := schema.Value.XML.(map[string]interface{})
+	if !ok {
+		return info
+	}
+	info.Name, _ = m["name"].(string)
+	info.Namespace, _ = m["namespace"].(string)
+	info.Prefix, _ = m["prefix"].(string)
+	info.Attribute, _ = m["attribute"].(bool)
+	info.Wrapped, _ = m["wrapped"].(bool)
+	return info
+}
+
+func isArraySchema(schema SchemaRef) bool {
+	return schema.Value != nil && strings.Contains(schema.Value.Type, gojsonschema.TYPE_ARRAY) && schema.Value.Items != nil
+}
+
+// XmlElementName returns the name of the element, or the attribute, that holds the property in XML. It's
+// the name the xml object gives, the wrapper's for a wrapped array and the items' for one that isn't, or
+// else the property's own name.
+func XmlElementName(property string, schema SchemaRef) string {
+	if isArraySchema(schema) && !schema.GetXmlInfo().Wrapped {
+		if name := ((SchemaRef)(*schema.Value.Items)).GetXmlInfo().Name; len(name) > 0 {
+			return name
+		}
+		return property
+	}
+	if name := schema.GetXmlInfo().Name; len(name) > 0 {
+		return name
+	}
+	return property
+}
+
+// XmlRootName returns the name of the root element of a body of the schema. It's the name the xml object
+// gives, or the name of the schema the body refers to, or else the name passed in.
+func (schema SchemaRef) XmlRootName(name string, swagger *Swagger) string {
+	if xmlName := schema.GetXmlInfo().Name; len(xmlName) > 0 {
+		return xmlName
+	}
+	if refName, referred, err := swagger.GetReferredSchema(schema); err == nil && referred.Value != nil {
+		if xmlName := referred.GetXmlInfo().Name; len(xmlName) > 0 {
+			return xmlName
+		}
+		return refName
+	}
+	return name
+}
+
+// ToXml writes the object as an XML document with the root element named by XmlRootName. The properties'
+// elements and attributes are named by their xml objects the way XmlElementName does it.
+func (schema SchemaRef) ToXml(name string, object interface{}, swagger *Swagger) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	e := xml.NewEncoder(buf)
+	if err := schema.encodeXml(e, schema.xmlStartElement(schema.XmlRootName(name, swagger)), object, swagger); err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("can't write the %s body as xml: %s", name, err.Error()))
+	}
+	if err := e.Flush(); err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
+func (schema SchemaRef) xmlStartElement(name string) xml.StartElement {
+	info := schema.GetXmlInfo()
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if len(info.Prefix) > 0 {
+		start.Name.Local = info.Prefix + ":" + name
+	}
+	if len(info.Namespace) > 0 {
+		attrName := "xmlns"
+		if len(info.Prefix) > 0 {
+			attrName += ":" + info.Prefix
+		}
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: attrName}, Value: info.Namespace})
+	}
+	return start
+}
+
+// encodeXml writes the value as the element start, with its children for an object.
+func (schema SchemaRef) encodeXml(e *xml.Encoder, start xml.StartElement, value interface{}, swagger *Swagger) error {
+	object, isObject := value.(map[string]interface{})
+	if !isObject {
+		if array, isArray := value.([]interface{}); isArray && isArraySchema(schema) {
+			// A body that is an array has an element for each item in the root element.
+			items := (SchemaRef)(*schema.Value.Items)
+			if err := e.EncodeToken(start); err != nil {
+				return err
+			}
+			itemName := XmlElementName(start.Name.Local, items)
+			for _, item := range array {
+				if err := items.encodeXml(e, items.xmlStartElement(itemName), item, swagger); err != nil {
+					return err
+				}
+			}
+			return e.EncodeToken(start.End())
+		}
+		return e.EncodeElement(xmlText(value), start)
+	}
+
+	var properties map[string]*spec.SchemaRef
+	if schema.Value != nil {
+		properties = schema.GetProperties(swagger)
+	}
+	var names []string
+	for k, v := range object {
+		if v != nil {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	// The attributes go in the start element, the other properties are the children.
+	var children []string
+	for _, k := range names {
+		p := properties[k]
+		if p != nil && ((SchemaRef)(*p)).GetXmlInfo().Attribute {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: XmlElementName(k, (SchemaRef)(*p))},
+				Value: xmlText(object[k])})
+		} else {
+			children = append(children, k)
+		}
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, k := range children {
+		var p SchemaRef
+		if properties[k] != nil {
+			p = (SchemaRef)(*properties[k])
+		}
+		if err := p.encodeXmlProperty(e, k, object[k], swagger); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// encodeXmlProperty writes the property of an object, an array as its items' elements, in a wrapper
+// element when the xml object says so.
+func (schema SchemaRef) encodeXmlProperty(e *xml.Encoder, property string, value interface{}, swagger *Swagger) error {
+	array, isArray := value.([]interface{})
+	if !isArray || !isArraySchema(schema) {
+		return schema.encodeXml(e, schema.xmlStartElement(XmlElementName(property, schema)), value, swagger)
+	}
+	items := (SchemaRef)(*schema.Value.Items)
+	itemName := XmlElementName(property, items)
+	if !schema.GetXmlInfo().Wrapped {
+		for _, item := range array {
+			if err := items.encodeXml(e, items.xmlStartElement(itemName), item, swagger); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	wrapper := schema.xmlStartElement(XmlElementName(property, schema))
+	if err := e.EncodeToken(wrapper); err != nil {
+		return err
+	}
+	for _, item := range array {
+		if err := items.encodeXml(e, items.xmlStartElement(itemName), item, swagger); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(wrapper.End())
+}
+
+// xmlText returns the text of a simple value, and the JSON of anything else.
+func xmlText(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return mqutil.InterfaceToJsonString(value)
+}
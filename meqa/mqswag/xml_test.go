@@ -0,0 +1,108 @@
+package mqswag
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/AdityaVallabh/swagger_meqa/meqa/mqutil"
+
+	spec "github.com/getkin/kin-openapi/openapi3"
+)
+
+const xmlSpec = `
+openapi: 3.0.2
+info:
+  title: pets
+  version: "1.0"
+paths: {}
+components:
+  schemas:
+    Category:
+      type: object
+      xml:
+        name: category
+      properties:
+        name:
+          type: string
+    Pet:
+      type: object
+      properties:
+        id:
+          type: integer
+          xml:
+            attribute: true
+        name:
+          type: string
+          xml:
+            name: petName
+        category:
+          $ref: '#/components/schemas/Category'
+        photoUrls:
+          type: array
+          xml:
+            name: photos
+            wrapped: true
+          items:
+            type: string
+            xml:
+              name: photoUrl
+        tags:
+          type: array
+          items:
+            type: string
+            xml:
+              name: tag
+        sold:
+          type: boolean
+`
+
+func TestXml(t *testing.T) {
+	s, err := spec.NewSwaggerLoader().LoadSwaggerFromData([]byte(xmlSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	swagger := (*Swagger)(s)
+	pet := SchemaRef{Ref: "#/components/schemas/Pet", Value: swagger.FindSchemaByName("Pet").Value}
+	object := map[string]interface{}{
+		"id":        7,
+		"name":      "rex & co",
+		"category":  map[string]interface{}{"name": "dogs"},
+		"photoUrls": []interface{}{"a.png", "b.png"},
+		"tags":      []interface{}{"good"},
+		"sold":      false,
+	}
+	b, err := pet.ToXml("body", object, swagger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<Pet id="7"><category><name>dogs</name></category><petName>rex &amp; co</petName>` +
+		`<photos><photoUrl>a.png</photoUrl><photoUrl>b.png</photoUrl></photos><sold>false</sold><tag>good</tag></Pet>`
+	if string(b) != expected {
+		t.Errorf("expecting the xml\n%s\ngot\n%s", expected, b)
+	}
+
+	// Reading it back gives the object, with the property names and types of the schema.
+	decoded, err := mqutil.XmlToObject(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coerced := pet.Coerce(decoded, swagger)
+	if !pet.Matches(coerced, MatchOptions{}, swagger) {
+		t.Errorf("expecting the decoded pet to match the schema: %v", coerced)
+	}
+	jsonObject, _ := json.Marshal(object)
+	var expectedObject interface{}
+	mqutil.DecodeJson(jsonObject, &expectedObject)
+	if !mqutil.InterfaceEquals(expectedObject, coerced) {
+		t.Errorf("expecting the decoded pet %v, got %v", expectedObject, coerced)
+	}
+
+	if name := (SchemaRef{}).XmlRootName("body", swagger); name != "body" {
+		t.Errorf("expecting an inline schema's root to be named body, got %s", name)
+	}
+	category := SchemaRef{Ref: "#/components/schemas/Category", Value: swagger.FindSchemaByName("Category").Value}
+	if b, _ := category.ToXml("body", map[string]interface{}{"name": "cats"}, swagger); !strings.HasPrefix(string(b), "<category>") {
+		t.Errorf("expecting the root to be named by the xml object, got %s", b)
+	}
+}
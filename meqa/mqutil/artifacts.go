@@ -0,0 +1,94 @@
+package mqutil
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ManifestFile lists the artifacts in the output directory.
+const ManifestFile = "manifest.json"
+
+// The kinds of artifacts a run produces, and their file names in the output directory.
+const (
+	ArtifactLog    = "log"
+	ArtifactResult = "result"
+	ArtifactPlan   = "plan"
+	ArtifactJUnit  = "junit"
+	ArtifactJson   = "json"
+)
+
+var artifactNames = map[string]string{
+	ArtifactLog:    "mqgo.log",
+	ArtifactResult: "result.yml",
+	ArtifactPlan:   "plan.yml",
+	ArtifactJUnit:  "junit.xml",
+	ArtifactJson:   "result.json",
+}
+
+// Artifact is a file a run produced.
+type Artifact struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"` // The file name relative to the output directory.
+	Size int64  `json:"size"`
+}
+
+// Manifest is the index of the output directory.
+type Manifest struct {
+	Created   string     `json:"created"`
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// ArtifactDir collects all the files a run produces under one directory, so they can be archived together.
+type ArtifactDir struct {
+	Dir string
+
+	kinds map[string]string // file name to kind
+	mutex sync.Mutex
+}
+
+// NewArtifactDir creates the output directory if it doesn't exist yet.
+func NewArtifactDir(dir string) (*ArtifactDir, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, NewError(ErrInvalid, err.Error())
+	}
+	return &ArtifactDir{Dir: dir, kinds: make(map[string]string)}, nil
+}
+
+// Path returns the path to write the artifact of the kind to, and records it for the manifest. The
+// known kinds have fixed names, the others are named after the kind plus the extension.
+func (d *ArtifactDir) Path(kind string, ext string) string {
+	name, ok := artifactNames[kind]
+	if !ok {
+		name = kind + ext
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.kinds[name] = kind
+	return filepath.Join(d.Dir, name)
+}
+
+// WriteManifest writes the manifest listing the artifacts that were produced. The ones that were
+// never written are left out.
+func (d *ArtifactDir) WriteManifest() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	manifest := Manifest{Created: time.Now().Format(time.RFC3339), Artifacts: []Artifact{}}
+	for name, kind := range d.kinds {
+		fi, err := os.Stat(filepath.Join(d.Dir, name))
+		if err != nil {
+			continue
+		}
+		manifest.Artifacts = append(manifest.Artifacts, Artifact{kind, name, fi.Size()})
+	}
+	sort.Slice(manifest.Artifacts, func(i, j int) bool { return manifest.Artifacts[i].Name < manifest.Artifacts[j].Name })
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(d.Dir, ManifestFile), data, 0644)
+}
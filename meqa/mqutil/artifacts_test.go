@@ -0,0 +1,54 @@
+package mqutil
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestArtifactManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meqa-out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	artifacts, err := NewArtifactDir(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{
+		artifacts.Path(ArtifactResult, ""),
+		artifacts.Path(ArtifactLog, ""),
+		artifacts.Path("junit", ".xml"),
+	} {
+		if err := ioutil.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An artifact that never gets written isn't listed.
+	artifacts.Path(ArtifactPlan, "")
+	if err := artifacts.WriteManifest(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "out", ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	expected := []Artifact{
+		{"junit", "junit.xml", 4},
+		{ArtifactLog, "mqgo.log", 4},
+		{ArtifactResult, "result.yml", 4},
+	}
+	if !reflect.DeepEqual(manifest.Artifacts, expected) {
+		t.Errorf("expecting %v, got %v", expected, manifest.Artifacts)
+	}
+}
@@ -25,6 +25,7 @@ type Error interface {
 type TypedError struct {
 	errType int
 	errMsg  string
+	msg     string // The message without the back trace.
 }
 
 func (e *TypedError) Error() string {
@@ -37,7 +38,15 @@ func (e *TypedError) Type() int {
 
 func NewError(errType int, str string) error {
 	buf := string(debug.Stack())
-	err := TypedError{errType, ""}
+	err := TypedError{errType, "", str}
 	err.errMsg = fmt.Sprintf("==== %v ====\nError message:\n%s\nBacktrace:%v", errType, str, buf)
 	return &err
 }
+
+// ErrorMessage returns the message of the error without the back trace.
+func ErrorMessage(err error) string {
+	if e, ok := err.(*TypedError); ok {
+		return e.msg
+	}
+	return err.Error()
+}
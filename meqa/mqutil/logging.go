@@ -5,6 +5,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"strings"
 )
 
 // Test results constants
@@ -13,6 +14,7 @@ const (
 	Failed         = "Failed"
 	Skipped        = "Skipped"
 	SchemaMismatch = "SchemaMismatch"
+	Filtered       = "Filtered"
 	Total          = "Total"
 	FuzzTotal      = "Fuzz Total"
 	FuzzFails      = "Fuzz Fails"
@@ -51,3 +53,25 @@ var Logger *log.Logger
 
 // Whether verbose mose is on
 var Verbose bool
+
+// SensitiveHeaders are the headers whose values are hidden when the requests and responses are logged.
+var SensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// LogSecrets logs the sensitive headers and the credentials as they are, to debug the authentication.
+var LogSecrets bool
+
+// Redacted is what the hidden values are replaced with.
+const Redacted = "***"
+
+// RedactHeader returns the value of the header to log, hidden if the header is sensitive.
+func RedactHeader(name string, value string) string {
+	if LogSecrets {
+		return value
+	}
+	for _, h := range SensitiveHeaders {
+		if strings.EqualFold(h, name) {
+			return Redacted
+		}
+	}
+	return value
+}
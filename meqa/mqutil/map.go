@@ -4,8 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"reflect"
-	"strconv"
 	"strings"
 	"time"
 
@@ -94,7 +95,7 @@ func MapCombine(dst map[string]interface{}, src map[string]interface{}) map[stri
 		return dst
 	}
 	for k, v := range src {
-		dst[k] = v
+		dst[k] = InterfaceCopy(v)
 	}
 	return dst
 }
@@ -109,7 +110,7 @@ func MapAdd(dst map[string]interface{}, src map[string]interface{}) map[string]i
 	}
 	for k, v := range src {
 		if _, exist := dst[k]; !exist {
-			dst[k] = v
+			dst[k] = InterfaceCopy(v)
 		}
 	}
 	return dst
@@ -122,7 +123,7 @@ func MapReplace(dst map[string]interface{}, src map[string]interface{}) map[stri
 	}
 	for k := range dst {
 		if v, ok := src[k]; ok {
-			dst[k] = v
+			dst[k] = InterfaceCopy(v)
 		}
 	}
 	return dst
@@ -161,14 +162,63 @@ func ArrayCopy(src []interface{}) (dst []interface{}) {
 	return dst
 }
 
+// InterfaceCopy deep copies the maps and arrays in v, so the copy can be changed without affecting v.
+func InterfaceCopy(v interface{}) interface{} {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		return MapCopy(c)
+	case []interface{}:
+		return ArrayCopy(c)
+	}
+	return v
+}
+
 func InterfacePrint(m interface{}, printToConsole bool) {
+	InterfaceFprint(os.Stdout, m, printToConsole)
+}
+
+// InterfaceFprint is the same as InterfacePrint but prints to w instead of the console.
+func InterfaceFprint(w io.Writer, m interface{}, print bool) {
 	yamlBytes, _ := yaml.Marshal(m)
 	Logger.Print(string(yamlBytes))
-	if printToConsole {
-		fmt.Println(string(yamlBytes))
+	if print {
+		fmt.Fprintln(w, string(yamlBytes))
 	}
 }
 
+// JsonEquals checks whether the two json values are the same, the way the json schema compares them. The
+// numbers are compared by value, the arrays in order and the objects by all their fields.
+func JsonEquals(a interface{}, b interface{}) bool {
+	if cmp, ok := NumberCompare(a, b); ok {
+		return cmp == 0
+	}
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			if w, exist := bv[k]; !exist || !JsonEquals(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !JsonEquals(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
 // Check if existing matches criteria. When criteria is a map, we check whether
 // everything in criteria can be found and equals a field in existing.
 func InterfaceEquals(criteria interface{}, existing interface{}) bool {
@@ -187,6 +237,11 @@ func InterfaceEquals(criteria interface{}, existing interface{}) bool {
 			return false
 		}
 	}
+	// The numbers are compared by value, exactly, since they can be decoded as different types and the large
+	// integers don't fit in a float64.
+	if cmp, ok := NumberCompare(criteria, existing); ok {
+		return cmp == 0
+	}
 	cType := reflect.TypeOf(criteria)
 	eType := reflect.TypeOf(existing)
 	if cType == eType && cType.Comparable() {
@@ -240,14 +295,8 @@ func InterfaceEquals(criteria interface{}, existing interface{}) bool {
 		return true
 	}
 	if eKind == reflect.String && ((cKind >= reflect.Int && cKind <= reflect.Uint64) || cKind == reflect.Float32 || cKind == reflect.Float64) {
-		if reflect.TypeOf(existing).String() == "json.Number" {
-			return true
-		}
-		var e interface{}
-		var err error
-		e, err = strconv.ParseFloat(existing.(string), 64)
-		if err == nil {
-			return InterfaceEquals(criteria, e)
+		if cmp, ok := NumberCompare(criteria, json.Number(existing.(string))); ok {
+			return cmp == 0
 		}
 		return false
 	}
@@ -282,7 +331,7 @@ func YamlToJson(in []byte) (json.RawMessage, error) {
 
 func JsonToYaml(in []byte) ([]byte, error) {
 	var out interface{}
-	err := json.Unmarshal(in, &out)
+	err := DecodeJson(in, &out)
 	if err != nil {
 		return nil, err
 	}
@@ -295,7 +344,7 @@ func YamlObjToJsonObj(in interface{}) (interface{}, error) {
 		return nil, err
 	}
 	var out interface{}
-	err = json.Unmarshal(jsonRaw, &out)
+	err = DecodeJson(jsonRaw, &out)
 	if err != nil {
 		return nil, err
 	}
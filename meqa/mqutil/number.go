@@ -0,0 +1,51 @@
+package mqutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// NumberRat converts any of the numeric types we get from unmarshaling or generation to an exact rational,
+// so that the large integers decoded as json.Number don't lose their precision the way float64 does.
+func NumberRat(c interface{}) (*big.Rat, bool) {
+	if n, ok := c.(json.Number); ok {
+		return new(big.Rat).SetString(n.String())
+	}
+	v := reflect.ValueOf(c)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return new(big.Rat).SetInt64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(v.Uint())), true
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(f), true
+	}
+	return nil, false
+}
+
+// NumberCompare compares two numbers exactly, returning -1, 0 or 1. ok is false when either isn't a number.
+func NumberCompare(a, b interface{}) (cmp int, ok bool) {
+	x, ok := NumberRat(a)
+	if !ok {
+		return 0, false
+	}
+	y, ok := NumberRat(b)
+	if !ok {
+		return 0, false
+	}
+	return x.Cmp(y), true
+}
+
+// DecodeJson unmarshals the json with the numbers as json.Number, keeping the large integers exact.
+func DecodeJson(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
@@ -0,0 +1,103 @@
+package mqutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSON patch (RFC 6902) operations.
+const (
+	PatchAdd     = "add"
+	PatchRemove  = "remove"
+	PatchReplace = "replace"
+)
+
+// JsonPointerEscape escapes a single reference token of a JSON pointer (RFC 6901).
+func JsonPointerEscape(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+func jsonPointerUnescape(token string) string {
+	return strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+}
+
+// patchOne applies one operation to the value at the tokens under the container.
+func patchOne(container interface{}, tokens []string, op string, value interface{}) (interface{}, error) {
+	token := jsonPointerUnescape(tokens[0])
+	switch c := container.(type) {
+	case map[string]interface{}:
+		if len(tokens) > 1 {
+			child, err := patchOne(c[token], tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			c[token] = child
+			return c, nil
+		}
+		_, exist := c[token]
+		if !exist && op != PatchAdd {
+			return nil, NewError(ErrInvalid, fmt.Sprintf("json patch %s: field not found: %s", op, token))
+		}
+		if op == PatchRemove {
+			delete(c, token)
+		} else {
+			c[token] = value
+		}
+		return c, nil
+	case []interface{}:
+		if token == "-" && op == PatchAdd && len(tokens) == 1 {
+			return append(c, value), nil
+		}
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 || i > len(c) || (i == len(c) && op != PatchAdd) {
+			return nil, NewError(ErrInvalid, fmt.Sprintf("json patch %s: invalid array index: %s", op, token))
+		}
+		if len(tokens) > 1 {
+			child, err := patchOne(c[i], tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			c[i] = child
+			return c, nil
+		}
+		switch op {
+		case PatchAdd:
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+		case PatchRemove:
+			c = append(c[:i], c[i+1:]...)
+		default:
+			c[i] = value
+		}
+		return c, nil
+	}
+	return nil, NewError(ErrInvalid, fmt.Sprintf("json patch %s: can't descend into %v", op, container))
+}
+
+// JsonPatchApply applies the patch operations to a copy of the document and returns the copy.
+// The add, remove and replace operations are supported.
+func JsonPatchApply(doc map[string]interface{}, patch []interface{}) (map[string]interface{}, error) {
+	result := MapCopy(doc)
+	for _, entry := range patch {
+		opMap, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, NewError(ErrInvalid, fmt.Sprintf("json patch operation is not an object: %v", entry))
+		}
+		op, _ := opMap["op"].(string)
+		path, _ := opMap["path"].(string)
+		if op != PatchAdd && op != PatchRemove && op != PatchReplace {
+			return nil, NewError(ErrInvalid, fmt.Sprintf("unsupported json patch operation: %s", op))
+		}
+		if !strings.HasPrefix(path, "/") {
+			return nil, NewError(ErrInvalid, fmt.Sprintf("invalid json patch path: %s", path))
+		}
+		patched, err := patchOne(result, strings.Split(path[1:], "/"), op, opMap["value"])
+		if err != nil {
+			return nil, err
+		}
+		result = patched.(map[string]interface{})
+	}
+	return result, nil
+}
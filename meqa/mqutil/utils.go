@@ -1,5 +1,12 @@
 package mqutil
 
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
 const (
 	FuzzPositive = "positive"
 	FuzzDataType = "datatype"
@@ -11,3 +18,48 @@ type FuzzValue struct {
 	Value    interface{}
 	FuzzType string
 }
+
+// lockedSource is a random source that can be used by several goroutines.
+type lockedSource struct {
+	mutex sync.Mutex
+	src   rand.Source64
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.src.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.src.Seed(seed)
+}
+
+// Rand is where all the generated values come from, so that seeding it with the same seed generates the
+// same values again.
+var Rand = rand.New(&lockedSource{src: rand.NewSource(time.Now().UnixNano()).(rand.Source64)})
+
+// Seed makes Rand generate the same values as any other run with the same seed.
+func Seed(seed int64) {
+	Rand.Seed(seed)
+}
+
+// RandomUUID generates a version 4 UUID (RFC 4122). It uses Rand so that the UUIDs are the same for the
+// same seed.
+func RandomUUID() string {
+	var b [16]byte
+	for i := range b {
+		b[i] = byte(Rand.Intn(256))
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,84 @@
+package mqutil
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// IsXmlMediaType checks whether the media type (e.g. application/xml; charset=utf-8) is an XML type.
+func IsXmlMediaType(mediaType string) bool {
+	if i := strings.IndexByte(mediaType, ';'); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	return strings.HasSuffix(mediaType, "/xml") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// xmlNode is an element being decoded. It becomes a string if it only has text, or a map otherwise.
+type xmlNode struct {
+	fields map[string]interface{}
+	text   bytes.Buffer
+}
+
+func (n *xmlNode) add(name string, value interface{}) {
+	if n.fields == nil {
+		n.fields = make(map[string]interface{})
+	}
+	// A repeated element becomes an array.
+	if existing, ok := n.fields[name]; ok {
+		if ar, isArray := existing.([]interface{}); isArray {
+			n.fields[name] = append(ar, value)
+		} else {
+			n.fields[name] = []interface{}{existing, value}
+		}
+		return
+	}
+	n.fields[name] = value
+}
+
+func (n *xmlNode) value() interface{} {
+	if n.fields == nil {
+		return strings.TrimSpace(n.text.String())
+	}
+	return n.fields
+}
+
+// XmlToObject decodes the XML document into the same kind of object that decoding a JSON document
+// produces. The root element becomes the object, child elements and attributes become its fields.
+// All the values are strings, since XML carries no type information.
+func XmlToObject(data []byte) (interface{}, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*xmlNode
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return nil, NewError(ErrInvalid, "xml document has no root element")
+		}
+		if err != nil {
+			return nil, NewError(ErrInvalid, err.Error())
+		}
+		switch tok := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{}
+			for _, attr := range tok.Attr {
+				if attr.Name.Space != "xmlns" && attr.Name.Local != "xmlns" {
+					node.add(attr.Name.Local, attr.Value)
+				}
+			}
+			stack = append(stack, node)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(tok)
+			}
+		case xml.EndElement:
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return node.value(), nil
+			}
+			stack[len(stack)-1].add(tok.Name.Local, node.value())
+		}
+	}
+}